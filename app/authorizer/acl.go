@@ -0,0 +1,115 @@
+package authorizer
+
+import "strings"
+
+// ResourceType, PatternType, Operation and Permission use the codes of the ACL
+// APIs and the metadata log
+type ResourceType int8
+
+const (
+	ResourceUnknown         ResourceType = 0
+	ResourceAny             ResourceType = 1
+	ResourceTopic           ResourceType = 2
+	ResourceGroup           ResourceType = 3
+	ResourceCluster         ResourceType = 4
+	ResourceTransactionalID ResourceType = 5
+	ResourceDelegationToken ResourceType = 6
+	ResourceUser            ResourceType = 7
+)
+
+type PatternType int8
+
+const (
+	PatternUnknown  PatternType = 0
+	PatternAny      PatternType = 1
+	PatternMatch    PatternType = 2
+	PatternLiteral  PatternType = 3
+	PatternPrefixed PatternType = 4
+)
+
+type Operation int8
+
+const (
+	OperationUnknown Operation = 0
+	OperationAny     Operation = 1
+	All              Operation = 2
+	Read             Operation = 3
+	Write            Operation = 4
+	Create           Operation = 5
+	Delete           Operation = 6
+	Alter            Operation = 7
+	Describe         Operation = 8
+	ClusterAction    Operation = 9
+	DescribeConfigs  Operation = 10
+	AlterConfigs     Operation = 11
+	IdempotentWrite  Operation = 12
+	CreateTokens     Operation = 13
+	DescribeTokens   Operation = 14
+)
+
+type Permission int8
+
+const (
+	PermissionUnknown Permission = 0
+	PermissionAny     Permission = 1
+	Deny              Permission = 2
+	Allow             Permission = 3
+)
+
+const (
+	// Wildcard matches every resource name, principal or host
+	Wildcard = "*"
+	// ClusterResourceName is the name of the only cluster resource
+	ClusterResourceName = "kafka-cluster"
+	// WildcardPrincipal matches every user
+	WildcardPrincipal = "User:*"
+)
+
+// ACL allows or denies one operation on the resources matching a pattern
+type ACL struct {
+	ResourceType ResourceType
+	ResourceName string
+	PatternType  PatternType
+	Principal    string
+	Host         string
+	Operation    Operation
+	Permission   Permission
+}
+
+// matchesResource reports whether the ACL's pattern covers a resource
+func (acl ACL) matchesResource(resourceType ResourceType, name string) bool {
+	if acl.ResourceType != resourceType {
+		return false
+	}
+	switch acl.PatternType {
+	case PatternLiteral:
+		return acl.ResourceName == name || acl.ResourceName == Wildcard
+	case PatternPrefixed:
+		return strings.HasPrefix(name, acl.ResourceName)
+	}
+	return false
+}
+
+func (acl ACL) matchesIdentity(principal string, host string) bool {
+	return (acl.Principal == principal || acl.Principal == WildcardPrincipal) &&
+		(acl.Host == host || acl.Host == Wildcard)
+}
+
+// matchesOperation applies the implications of Kafka's authorizer, ALL covers
+// every operation and allowing READ, WRITE, DELETE or ALTER also allows
+// DESCRIBE, allowing ALTER_CONFIGS also allows DESCRIBE_CONFIGS
+func (acl ACL) matchesOperation(operation Operation) bool {
+	if acl.Operation == operation || acl.Operation == All {
+		return true
+	}
+	if acl.Permission != Allow {
+		return false
+	}
+	switch operation {
+	case Describe:
+		return acl.Operation == Read || acl.Operation == Write || acl.Operation == Delete || acl.Operation == Alter
+	case DescribeConfigs:
+		return acl.Operation == AlterConfigs
+	}
+	return false
+}
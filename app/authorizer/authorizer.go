@@ -0,0 +1,121 @@
+package authorizer
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Action is an operation a principal wants to run on a resource
+type Action struct {
+	Principal    string // User:name
+	Host         string
+	ResourceType ResourceType
+	ResourceName string
+	Operation    Operation
+}
+
+// Authorizer evaluates ACLs the way Kafka's StandardAuthorizer does, a
+// matching DENY wins over any ALLOW
+type Authorizer struct {
+	// SuperUsers mirrors super.users, they are allowed everything
+	SuperUsers []string
+	// AllowEveryoneIfNoACLFound mirrors allow.everyone.if.no.acl.found, it
+	// applies to resources no ACL matches
+	AllowEveryoneIfNoACLFound bool
+
+	mu   sync.RWMutex
+	acls map[uuid.UUID]ACL
+}
+
+func New() *Authorizer {
+	return &Authorizer{acls: make(map[uuid.UUID]ACL)}
+}
+
+func (a *Authorizer) AddACL(id uuid.UUID, acl ACL) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acls[id] = acl
+}
+
+func (a *Authorizer) RemoveACL(id uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.acls, id)
+}
+
+// ACLs returns a copy of every ACL by id
+func (a *Authorizer) ACLs() map[uuid.UUID]ACL {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	acls := make(map[uuid.UUID]ACL, len(a.acls))
+	for id, acl := range a.acls {
+		acls[id] = acl
+	}
+	return acls
+}
+
+func (a *Authorizer) Authorize(action Action) bool {
+	if slices.Contains(a.SuperUsers, action.Principal) {
+		return true
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	found, allowed := false, false
+	for _, acl := range a.acls {
+		if !acl.matchesResource(action.ResourceType, action.ResourceName) {
+			continue
+		}
+		found = true
+		if !acl.matchesIdentity(action.Principal, action.Host) || !acl.matchesOperation(action.Operation) {
+			continue
+		}
+		switch acl.Permission {
+		case Deny:
+			return false
+		case Allow:
+			allowed = true
+		}
+	}
+	if !found {
+		return a.AllowEveryoneIfNoACLFound
+	}
+	return allowed
+}
+
+// AuthorizeByResourceType reports whether the principal may run the operation
+// on some resource of the type, like Kafka's authorizeByResourceType that
+// idempotent producers are checked with. A DENY of every resource of the type
+// wins over any ALLOW.
+func (a *Authorizer) AuthorizeByResourceType(principal string, host string, resourceType ResourceType, operation Operation) bool {
+	if slices.Contains(a.SuperUsers, principal) {
+		return true
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	found, allowed := false, false
+	for _, acl := range a.acls {
+		if acl.ResourceType != resourceType {
+			continue
+		}
+		found = true
+		if !acl.matchesIdentity(principal, host) || !acl.matchesOperation(operation) {
+			continue
+		}
+		switch {
+		case acl.Permission == Deny && acl.PatternType == PatternLiteral && acl.ResourceName == Wildcard:
+			return false
+		case acl.Permission == Allow:
+			allowed = true
+		}
+	}
+	if !found {
+		return a.AllowEveryoneIfNoACLFound
+	}
+	return allowed
+}
@@ -0,0 +1,168 @@
+package authorizer
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthorize(t *testing.T) {
+	a := New()
+	a.SuperUsers = []string{"User:admin"}
+	add := func(acl ACL) uuid.UUID {
+		id := uuid.New()
+		a.AddACL(id, acl)
+		return id
+	}
+
+	add(ACL{ResourceType: ResourceTopic, ResourceName: "orders-", PatternType: PatternPrefixed, Principal: "User:alice", Host: Wildcard, Operation: Read, Permission: Allow})
+	add(ACL{ResourceType: ResourceTopic, ResourceName: "orders-secret", PatternType: PatternLiteral, Principal: WildcardPrincipal, Host: Wildcard, Operation: All, Permission: Deny})
+	add(ACL{ResourceType: ResourceTopic, ResourceName: Wildcard, PatternType: PatternLiteral, Principal: "User:bob", Host: "10.0.0.1", Operation: Write, Permission: Allow})
+	add(ACL{ResourceType: ResourceTopic, ResourceName: "payments", PatternType: PatternLiteral, Principal: "User:alice", Host: Wildcard, Operation: AlterConfigs, Permission: Allow})
+	denyWrite := add(ACL{ResourceType: ResourceTopic, ResourceName: "payments", PatternType: PatternLiteral, Principal: "User:bob", Host: Wildcard, Operation: Write, Permission: Deny})
+
+	for _, tc := range []struct {
+		principal string
+		host      string
+		topic     string
+		operation Operation
+		allowed   bool
+	}{
+		{"User:alice", "10.0.0.9", "orders-eu", Read, true},
+		{"User:alice", "10.0.0.9", "orders-eu", Describe, true}, // implied by READ
+		{"User:alice", "10.0.0.9", "orders-eu", Write, false},
+		{"User:alice", "10.0.0.9", "orders", Read, false}, // not under the prefix
+		{"User:alice", "10.0.0.9", "orders-secret", Read, false},
+		{"User:admin", "10.0.0.9", "orders-secret", Read, true},
+		{"User:bob", "10.0.0.1", "anything", Write, true},
+		{"User:bob", "10.0.0.2", "anything", Write, false},
+		{"User:bob", "10.0.0.1", "payments", Write, false}, // deny wins
+		{"User:alice", "10.0.0.9", "payments", DescribeConfigs, true},
+		{"User:alice", "10.0.0.9", "payments", Describe, false},
+		{"User:alice", "10.0.0.9", "unmatched", Read, false}, // bob's wildcard ACL gives every topic an ACL
+	} {
+		action := Action{Principal: tc.principal, Host: tc.host, ResourceType: ResourceTopic, ResourceName: tc.topic, Operation: tc.operation}
+		if allowed := a.Authorize(action); allowed != tc.allowed {
+			t.Errorf("%+v: expected allowed %v", action, tc.allowed)
+		}
+	}
+
+	a.RemoveACL(denyWrite)
+	if !a.Authorize(Action{Principal: "User:bob", Host: "10.0.0.1", ResourceType: ResourceTopic, ResourceName: "payments", Operation: Write}) {
+		t.Errorf("Expected the write to be allowed once the deny ACL is removed")
+	}
+}
+
+func TestNoACLFound(t *testing.T) {
+	a := New()
+	action := Action{Principal: "User:alice", Host: "127.0.0.1", ResourceType: ResourceGroup, ResourceName: "g", Operation: Read}
+	if a.Authorize(action) {
+		t.Errorf("Expected resources without ACLs to be denied by default")
+	}
+	a.AllowEveryoneIfNoACLFound = true
+	if !a.Authorize(action) {
+		t.Errorf("Expected allow.everyone.if.no.acl.found to allow resources without ACLs")
+	}
+
+	// An ACL for another principal still counts as an ACL on the resource
+	a.AddACL(uuid.New(), ACL{ResourceType: ResourceGroup, ResourceName: "g", PatternType: PatternLiteral, Principal: "User:bob", Host: Wildcard, Operation: Read, Permission: Allow})
+	if a.Authorize(action) {
+		t.Errorf("Expected alice to be denied once the group has ACLs")
+	}
+}
+
+func TestAuthorizeByResourceType(t *testing.T) {
+	a := New()
+	alice := "User:alice"
+	if a.AuthorizeByResourceType(alice, "127.0.0.1", ResourceTopic, Write) {
+		t.Errorf("Expected alice to be denied without ACLs")
+	}
+
+	a.AddACL(uuid.New(), ACL{ResourceType: ResourceTopic, ResourceName: "orders-", PatternType: PatternPrefixed, Principal: alice, Host: Wildcard, Operation: Write, Permission: Allow})
+	if !a.AuthorizeByResourceType(alice, "127.0.0.1", ResourceTopic, Write) {
+		t.Errorf("Expected a WRITE on some topics to allow alice")
+	}
+	if a.AuthorizeByResourceType("User:bob", "127.0.0.1", ResourceTopic, Write) {
+		t.Errorf("Expected bob to be denied")
+	}
+
+	a.AddACL(uuid.New(), ACL{ResourceType: ResourceTopic, ResourceName: Wildcard, PatternType: PatternLiteral, Principal: alice, Host: Wildcard, Operation: Write, Permission: Deny})
+	if a.AuthorizeByResourceType(alice, "127.0.0.1", ResourceTopic, Write) {
+		t.Errorf("Expected a DENY of every topic to win")
+	}
+}
+
+func TestFilterMatching(t *testing.T) {
+	literal := ACL{ResourceType: ResourceTopic, ResourceName: "orders", PatternType: PatternLiteral, Principal: "User:alice", Host: Wildcard, Operation: Read, Permission: Allow}
+	wildcard := ACL{ResourceType: ResourceTopic, ResourceName: Wildcard, PatternType: PatternLiteral, Principal: "User:bob", Host: Wildcard, Operation: Write, Permission: Allow}
+	prefixed := ACL{ResourceType: ResourceTopic, ResourceName: "ord", PatternType: PatternPrefixed, Principal: "User:alice", Host: "10.0.0.1", Operation: All, Permission: Deny}
+	group := ACL{ResourceType: ResourceGroup, ResourceName: "orders", PatternType: PatternLiteral, Principal: "User:alice", Host: Wildcard, Operation: Read, Permission: Allow}
+	all := []ACL{literal, wildcard, prefixed, group}
+
+	name := func(s string) *string { return &s }
+	anyFilter := Filter{ResourceType: ResourceAny, PatternType: PatternAny, Operation: OperationAny, Permission: PermissionAny}
+
+	for _, tc := range []struct {
+		description string
+		filter      func(f Filter) Filter
+		expected    []ACL
+	}{
+		{"everything", func(f Filter) Filter { return f }, all},
+		{"topics", func(f Filter) Filter { f.ResourceType = ResourceTopic; return f }, []ACL{literal, wildcard, prefixed}},
+		{"exact name", func(f Filter) Filter { f.ResourceName = name("orders"); return f }, []ACL{literal, group}},
+		{"literal orders", func(f Filter) Filter { f.PatternType = PatternLiteral; f.ResourceName = name("orders"); return f }, []ACL{literal, group}},
+		{"match orders topic", func(f Filter) Filter {
+			f.ResourceType, f.PatternType, f.ResourceName = ResourceTopic, PatternMatch, name("orders")
+			return f
+		}, []ACL{literal, wildcard, prefixed}},
+		{"prefixed", func(f Filter) Filter { f.PatternType = PatternPrefixed; return f }, []ACL{prefixed}},
+		{"principal", func(f Filter) Filter { f.Principal = name("User:bob"); return f }, []ACL{wildcard}},
+		{"host", func(f Filter) Filter { f.Host = name("10.0.0.1"); return f }, []ACL{prefixed}},
+		{"operation", func(f Filter) Filter { f.Operation = Read; return f }, []ACL{literal, group}},
+		{"permission", func(f Filter) Filter { f.Permission = Deny; return f }, []ACL{prefixed}},
+	} {
+		filter := tc.filter(anyFilter)
+		var matched []ACL
+		for _, acl := range all {
+			if filter.Matches(acl) {
+				matched = append(matched, acl)
+			}
+		}
+		if len(matched) != len(tc.expected) {
+			t.Errorf("%s: expected %d ACLs, got %+v", tc.description, len(tc.expected), matched)
+			continue
+		}
+		for i := range matched {
+			if matched[i] != tc.expected[i] {
+				t.Errorf("%s: expected %+v, got %+v", tc.description, tc.expected[i], matched[i])
+			}
+		}
+	}
+
+	if err := (Filter{ResourceType: ResourceUnknown, PatternType: PatternAny, Operation: OperationAny, Permission: PermissionAny}).Validate(); err == nil {
+		t.Errorf("Expected a filter with UNKNOWN elements to be rejected")
+	}
+}
+
+func TestValidateACL(t *testing.T) {
+	valid := ACL{ResourceType: ResourceTopic, ResourceName: "orders", PatternType: PatternLiteral, Principal: "User:alice", Host: Wildcard, Operation: Read, Permission: Allow}
+	if err := ValidateACL(valid); err != nil {
+		t.Errorf("Expected a valid ACL, got %v", err)
+	}
+
+	for _, change := range []func(acl *ACL){
+		func(acl *ACL) { acl.ResourceType = ResourceAny },
+		func(acl *ACL) { acl.PatternType = PatternMatch },
+		func(acl *ACL) { acl.ResourceName = "" },
+		func(acl *ACL) { acl.ResourceType = ResourceCluster },
+		func(acl *ACL) { acl.Operation = OperationAny },
+		func(acl *ACL) { acl.Permission = PermissionAny },
+		func(acl *ACL) { acl.Principal = "alice" },
+	} {
+		acl := valid
+		change(&acl)
+		if err := ValidateACL(acl); err == nil {
+			t.Errorf("Expected %+v to be rejected", acl)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Filter selects ACLs like Kafka's AclBindingFilter, the ANY codes and an
+// unset name, principal or host match everything
+type Filter struct {
+	ResourceType ResourceType
+	ResourceName *string
+	PatternType  PatternType
+	Principal    *string
+	Host         *string
+	Operation    Operation
+	Permission   Permission
+}
+
+// Validate rejects filters with UNKNOWN elements, which match nothing
+func (f Filter) Validate() error {
+	if f.ResourceType == ResourceUnknown || f.PatternType == PatternUnknown || f.Operation == OperationUnknown || f.Permission == PermissionUnknown {
+		return errors.New("the filter contained UNKNOWN elements")
+	}
+	return nil
+}
+
+func (f Filter) Matches(acl ACL) bool {
+	return f.matchesPattern(acl) &&
+		(f.Principal == nil || *f.Principal == acl.Principal) &&
+		(f.Host == nil || *f.Host == acl.Host) &&
+		(f.Operation == OperationAny || f.Operation == acl.Operation) &&
+		(f.Permission == PermissionAny || f.Permission == acl.Permission)
+}
+
+// matchesPattern compares names exactly, except for the MATCH pattern type
+// which selects every ACL that applies to the named resource
+func (f Filter) matchesPattern(acl ACL) bool {
+	if f.ResourceType != ResourceAny && f.ResourceType != acl.ResourceType {
+		return false
+	}
+	if f.PatternType != PatternAny && f.PatternType != PatternMatch && f.PatternType != acl.PatternType {
+		return false
+	}
+	if f.ResourceName == nil {
+		return true
+	}
+	if f.PatternType != PatternMatch {
+		return *f.ResourceName == acl.ResourceName
+	}
+	return acl.matchesResource(acl.ResourceType, *f.ResourceName)
+}
+
+// Match returns the ids of the ACLs a filter selects
+func (a *Authorizer) Match(filter Filter) map[uuid.UUID]ACL {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	matched := make(map[uuid.UUID]ACL)
+	for id, acl := range a.acls {
+		if filter.Matches(acl) {
+			matched[id] = acl
+		}
+	}
+	return matched
+}
+
+// ValidateACL checks an ACL before it is created, the same way Kafka's
+// controller does
+func ValidateACL(acl ACL) error {
+	switch {
+	case acl.ResourceType < ResourceTopic || acl.ResourceType > ResourceUser:
+		return fmt.Errorf("invalid resource type %d", acl.ResourceType)
+	case acl.PatternType != PatternLiteral && acl.PatternType != PatternPrefixed:
+		return fmt.Errorf("invalid pattern type %d, expected LITERAL or PREFIXED", acl.PatternType)
+	case acl.ResourceName == "":
+		return errors.New("resource name should not be empty")
+	case acl.ResourceType == ResourceCluster && (acl.ResourceName != ClusterResourceName || acl.PatternType != PatternLiteral):
+		return fmt.Errorf("the only valid name for the CLUSTER resource is %s", ClusterResourceName)
+	case acl.Operation < All || acl.Operation > DescribeTokens:
+		return fmt.Errorf("invalid operation %d", acl.Operation)
+	case acl.Permission != Allow && acl.Permission != Deny:
+		return fmt.Errorf("invalid permission type %d", acl.Permission)
+	case acl.Host == "":
+		return errors.New("host should not be empty")
+	}
+
+	principalType, name, ok := strings.Cut(acl.Principal, ":")
+	if !ok || principalType == "" || name == "" {
+		return fmt.Errorf("could not parse principal %q, expected type:name", acl.Principal)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package broker
+
+import (
+	"sort"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+
+	"github.com/google/uuid"
+)
+
+const securityDisabledMessage = "No Authorizer is configured."
+
+// handleDescribeAclsRequest lists the ACLs matching the filter, grouped by
+// resource pattern
+func (srv *Server) handleDescribeAclsRequest(buff []byte, session *clientSession) (*DescribeAclsResponse, error) {
+	req, err := deserializeDescribeAclsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DescribeAclsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+		Resources:     []DescribeAclsResource{},
+	}
+
+	filter := aclFilter(req.Filter)
+	switch {
+	case srv.authorizer == nil:
+		response.ErrorCode = ErrorCodeSecurityDisabled
+		response.ErrorMessage = securityDisabledMessage
+		return response, nil
+	case !session.authorize(authorizer.Describe, authorizer.ResourceCluster, authorizer.ClusterResourceName):
+		response.ErrorCode = ErrorCodeClusterAuthorizationFailed
+		return response, nil
+	}
+	if err := filter.Validate(); err != nil {
+		response.ErrorCode = ErrorCodeInvalidRequest
+		response.ErrorMessage = err.Error()
+		return response, nil
+	}
+
+	type resourcePattern struct {
+		resourceType authorizer.ResourceType
+		name         string
+		patternType  authorizer.PatternType
+	}
+	grouped := make(map[resourcePattern][]authorizer.ACL)
+	for _, acl := range srv.authorizer.Match(filter) {
+		pattern := resourcePattern{acl.ResourceType, acl.ResourceName, acl.PatternType}
+		grouped[pattern] = append(grouped[pattern], acl)
+	}
+
+	for pattern, acls := range grouped {
+		sort.Slice(acls, func(i, j int) bool { return aclLess(acls[i], acls[j]) })
+		resource := DescribeAclsResource{
+			ResourceType: int8(pattern.resourceType),
+			ResourceName: pattern.name,
+			PatternType:  int8(pattern.patternType),
+		}
+		for _, acl := range acls {
+			resource.Acls = append(resource.Acls, AclDescription{
+				Principal:      acl.Principal,
+				Host:           acl.Host,
+				Operation:      int8(acl.Operation),
+				PermissionType: int8(acl.Permission),
+			})
+		}
+		response.Resources = append(response.Resources, resource)
+	}
+	sort.Slice(response.Resources, func(i, j int) bool {
+		a, b := response.Resources[i], response.Resources[j]
+		if a.ResourceType != b.ResourceType {
+			return a.ResourceType < b.ResourceType
+		}
+		if a.ResourceName != b.ResourceName {
+			return a.ResourceName < b.ResourceName
+		}
+		return a.PatternType < b.PatternType
+	})
+
+	return response, nil
+}
+
+// handleCreateAclsRequest appends an AccessControlEntryRecord for every valid
+// creation and applies it to the running authorizer. Creating an ACL that
+// already exists succeeds without a new record, like in Kafka.
+func (srv *Server) handleCreateAclsRequest(buff []byte, session *clientSession) (*CreateAclsResponse, error) {
+	req, err := deserializeCreateAclsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CreateAclsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		Results:       make([]AclCreationResult, len(req.Creations)),
+	}
+
+	code, message := srv.aclAdminError(session)
+	if code != ErrorCodeNone {
+		for i := range response.Results {
+			response.Results[i] = AclCreationResult{ErrorCode: code, ErrorMessage: message}
+		}
+		return response, nil
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	existing := make(map[authorizer.ACL]bool)
+	for _, acl := range srv.authorizer.ACLs() {
+		existing[acl] = true
+	}
+
+	var values [][]byte
+	var created []int
+	for i, creation := range req.Creations {
+		acl := authorizer.ACL{
+			ResourceType: authorizer.ResourceType(creation.ResourceType),
+			ResourceName: creation.ResourceName,
+			PatternType:  authorizer.PatternType(creation.ResourcePatternType),
+			Principal:    creation.Principal,
+			Host:         creation.Host,
+			Operation:    authorizer.Operation(creation.Operation),
+			Permission:   authorizer.Permission(creation.PermissionType),
+		}
+		if err := authorizer.ValidateACL(acl); err != nil {
+			response.Results[i] = AclCreationResult{ErrorCode: ErrorCodeInvalidRequest, ErrorMessage: err.Error()}
+			continue
+		}
+		if existing[acl] {
+			continue
+		}
+		existing[acl] = true
+
+		values = append(values, file_metadata.EncodeAccessControlEntryValue(file_metadata.AccessControlEntryValue{
+			Id:             uuid.New(),
+			ResourceType:   creation.ResourceType,
+			ResourceName:   creation.ResourceName,
+			PatternType:    creation.ResourcePatternType,
+			Principal:      creation.Principal,
+			Host:           creation.Host,
+			Operation:      creation.Operation,
+			PermissionType: creation.PermissionType,
+		}))
+		created = append(created, i)
+	}
+
+	if err := srv.appendACLRecords(values); err != nil {
+		for _, i := range created {
+			response.Results[i] = AclCreationResult{ErrorCode: ErrorCodeUnknownServerError, ErrorMessage: err.Error()}
+		}
+	}
+	return response, nil
+}
+
+// handleDeleteAclsRequest appends a RemoveAccessControlEntryRecord for every
+// ACL matching one of the filters. An ACL matched by several filters is only
+// reported by the first one.
+func (srv *Server) handleDeleteAclsRequest(buff []byte, session *clientSession) (*DeleteAclsResponse, error) {
+	req, err := deserializeDeleteAclsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DeleteAclsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		FilterResults: make([]DeleteAclsFilterResult, len(req.Filters)),
+	}
+
+	code, message := srv.aclAdminError(session)
+	if code != ErrorCodeNone {
+		for i := range response.FilterResults {
+			response.FilterResults[i] = DeleteAclsFilterResult{ErrorCode: code, ErrorMessage: message, MatchingAcls: []DeleteAclsMatchingAcl{}}
+		}
+		return response, nil
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	deleted := make(map[uuid.UUID]bool)
+	var values [][]byte
+	for i, requested := range req.Filters {
+		result := DeleteAclsFilterResult{ErrorCode: ErrorCodeNone, MatchingAcls: []DeleteAclsMatchingAcl{}}
+		filter := aclFilter(requested)
+		if err := filter.Validate(); err != nil {
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = err.Error()
+			response.FilterResults[i] = result
+			continue
+		}
+
+		matched := srv.authorizer.Match(filter)
+		ids := make([]uuid.UUID, 0, len(matched))
+		for id := range matched {
+			if !deleted[id] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(a, b int) bool { return aclLess(matched[ids[a]], matched[ids[b]]) })
+
+		for _, id := range ids {
+			deleted[id] = true
+			acl := matched[id]
+			values = append(values, file_metadata.EncodeRemoveAccessControlEntryValue(file_metadata.RemoveAccessControlEntryValue{Id: id}))
+			result.MatchingAcls = append(result.MatchingAcls, DeleteAclsMatchingAcl{
+				ErrorCode:      ErrorCodeNone,
+				ResourceType:   int8(acl.ResourceType),
+				ResourceName:   acl.ResourceName,
+				PatternType:    int8(acl.PatternType),
+				Principal:      acl.Principal,
+				Host:           acl.Host,
+				Operation:      int8(acl.Operation),
+				PermissionType: int8(acl.Permission),
+			})
+		}
+		response.FilterResults[i] = result
+	}
+
+	if err := srv.appendACLRecords(values); err != nil {
+		for i := range response.FilterResults {
+			for j := range response.FilterResults[i].MatchingAcls {
+				response.FilterResults[i].MatchingAcls[j].ErrorCode = ErrorCodeUnknownServerError
+				response.FilterResults[i].MatchingAcls[j].ErrorMessage = err.Error()
+			}
+		}
+	}
+	return response, nil
+}
+
+// aclAdminError is the error of CreateAcls and DeleteAcls, which need an
+// authorizer and ALTER on the cluster
+func (srv *Server) aclAdminError(session *clientSession) (int16, string) {
+	switch {
+	case srv.authorizer == nil:
+		return ErrorCodeSecurityDisabled, securityDisabledMessage
+	case !session.authorize(authorizer.Alter, authorizer.ResourceCluster, authorizer.ClusterResourceName):
+		return ErrorCodeClusterAuthorizationFailed, ""
+	}
+	return ErrorCodeNone, ""
+}
+
+// appendACLRecords writes ACL changes to the metadata log as one batch and
+// applies them, so they take effect before the response is sent. Must be
+// called with metadataLock held.
+func (srv *Server) appendACLRecords(values [][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	batch, err := srv.appendMetadata(values...)
+	if err != nil {
+		return err
+	}
+	for _, record := range batch.Records {
+		srv.applyACLRecord(record.Value)
+	}
+	return nil
+}
+
+func aclFilter(filter ACLFilter) authorizer.Filter {
+	return authorizer.Filter{
+		ResourceType: authorizer.ResourceType(filter.ResourceType),
+		ResourceName: filter.ResourceName,
+		PatternType:  authorizer.PatternType(filter.PatternType),
+		Principal:    filter.Principal,
+		Host:         filter.Host,
+		Operation:    authorizer.Operation(filter.Operation),
+		Permission:   authorizer.Permission(filter.PermissionType),
+	}
+}
+
+// aclLess orders ACLs so responses are stable
+func aclLess(a, b authorizer.ACL) bool {
+	if a.ResourceType != b.ResourceType {
+		return a.ResourceType < b.ResourceType
+	}
+	if a.ResourceName != b.ResourceName {
+		return a.ResourceName < b.ResourceName
+	}
+	if a.PatternType != b.PatternType {
+		return a.PatternType < b.PatternType
+	}
+	if a.Principal != b.Principal {
+		return a.Principal < b.Principal
+	}
+	if a.Host != b.Host {
+		return a.Host < b.Host
+	}
+	if a.Operation != b.Operation {
+		return a.Operation < b.Operation
+	}
+	return a.Permission < b.Permission
+}
@@ -0,0 +1,350 @@
+package broker
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"toy_kafka/app/file_metadata"
+
+	"github.com/google/uuid"
+)
+
+// The admin API is read-only JSON over HTTP, for the inspection that the
+// Kafka protocol makes tedious
+
+type adminTopic struct {
+	Name       string           `json:"name"`
+	ID         uuid.UUID        `json:"id"`
+	Internal   bool             `json:"internal"`
+	Partitions []adminPartition `json:"partitions"`
+}
+
+type adminPartition struct {
+	Partition   int32   `json:"partition"`
+	Leader      int32   `json:"leader"`
+	LeaderEpoch int32   `json:"leader_epoch"`
+	Replicas    []int32 `json:"replicas"`
+	ISR         []int32 `json:"isr"`
+	// LogEndOffset is left out of the metadata image, it is not metadata
+	LogEndOffset *int64 `json:"log_end_offset,omitempty"`
+}
+
+type adminSegment struct {
+	Path                string `json:"path"`
+	BaseOffset          int64  `json:"base_offset"`
+	EndOffset           int64  `json:"end_offset"`
+	Size                int64  `json:"size"`
+	Batches             int    `json:"batches"`
+	AbortedTransactions int    `json:"aborted_transactions"`
+	SnapshotOffset      int64  `json:"snapshot_offset"`
+}
+
+type adminGroup struct {
+	GroupID      string         `json:"group_id"`
+	Type         string         `json:"type"`
+	State        string         `json:"state"`
+	ProtocolType string         `json:"protocol_type"`
+	Lag          int64          `json:"lag"`
+	Offsets      []partitionLag `json:"offsets"`
+}
+
+// partitionLag is how far the committed offset of a group is behind the end
+// of a partition
+type partitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committed_offset"`
+	EndOffset       int64  `json:"end_offset"`
+	Lag             int64  `json:"lag"`
+}
+
+// adminTopics lists the topics of the metadata in log order, with the end
+// offsets of their partitions when endOffsets is not nil
+func (srv *Server) adminTopics(endOffsets map[topicPartition]int64) []adminTopic {
+	topics, partitions := srv.metadataPartitions()
+	result := make([]adminTopic, 0, len(topics))
+	for _, topic := range topics {
+		adminTopic := adminTopic{Name: topic.TopicName, ID: topic.TopicId, Internal: isInternalTopic(topic.TopicName), Partitions: []adminPartition{}}
+		for _, partition := range partitions[topic.TopicId] {
+			adminPartition := adminPartition{
+				Partition:   partition.PartitionId,
+				Leader:      partition.LeaderId,
+				LeaderEpoch: partition.LeaderEpoch,
+				Replicas:    partition.ReplicaIdArray,
+				ISR:         partition.InSyncReplicaArray,
+			}
+			if offset, ok := endOffsets[topicPartition{topic: topic.TopicName, partition: partition.PartitionId}]; ok {
+				adminPartition.LogEndOffset = &offset
+			}
+			adminTopic.Partitions = append(adminTopic.Partitions, adminPartition)
+		}
+		sort.Slice(adminTopic.Partitions, func(i, j int) bool { return adminTopic.Partitions[i].Partition < adminTopic.Partitions[j].Partition })
+		result = append(result, adminTopic)
+	}
+	return result
+}
+
+func (srv *Server) handleTopics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, srv.adminTopics(srv.logEndOffsets()))
+}
+
+func (srv *Server) handleTopic(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("topic")
+	for _, topic := range srv.adminTopics(srv.logEndOffsets()) {
+		if topic.Name == name {
+			writeJSON(w, http.StatusOK, topic)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "This server does not host this topic")
+}
+
+func (srv *Server) handleSegments(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("topic")
+	partition, err := strconv.ParseInt(r.PathValue("partition"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "The partition must be a number")
+		return
+	}
+	srv.metadataLock.RLock()
+	partitionCount := srv.topicPartitionCount(name)
+	srv.metadataLock.RUnlock()
+	if partition < 0 || int32(partition) >= partitionCount {
+		writeError(w, http.StatusNotFound, "This server does not host this topic-partition")
+		return
+	}
+
+	log, err := srv.partitionLogs.get(name, int32(partition))
+	if err != nil {
+		srv.log.Error("Failed to open a partition log", "topic", name, "partition", partition, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to open the partition log")
+		return
+	}
+	segments := []adminSegment{}
+	for _, segment := range log.Segments() {
+		segments = append(segments, adminSegment(segment))
+	}
+	writeJSON(w, http.StatusOK, segments)
+}
+
+func (srv *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, srv.clients.list())
+}
+
+func (srv *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	endOffsets := srv.logEndOffsets()
+	groups := []adminGroup{}
+	for _, overview := range srv.groupCoordinator.ListGroups(nil, nil) {
+		group := adminGroup{GroupID: overview.GroupID, Type: overview.Type, State: overview.State, ProtocolType: overview.ProtocolType}
+		group.Offsets = srv.consumerGroupLag(overview.GroupID, endOffsets)
+		for _, offset := range group.Offsets {
+			group.Lag += offset.Lag
+		}
+		groups = append(groups, group)
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// consumerGroupLag is the lag of every partition the group committed an
+// offset for, partitions of deleted topics are left out
+func (srv *Server) consumerGroupLag(groupID string, endOffsets map[topicPartition]int64) []partitionLag {
+	lags := []partitionLag{}
+	for tp, committed := range srv.groupCoordinator.FetchOffsets(groupID) {
+		end, ok := endOffsets[topicPartition{topic: tp.Topic, partition: tp.Partition}]
+		if !ok {
+			continue
+		}
+		lags = append(lags, partitionLag{Topic: tp.Topic, Partition: tp.Partition, CommittedOffset: committed.Offset, EndOffset: end, Lag: max(end-committed.Offset, 0)})
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags
+}
+
+// metadataImage is the state the metadata log materializes to, what a Kafka
+// broker keeps as its MetadataImage. SCRAM credentials are listed without
+// their keys.
+type metadataImage struct {
+	// EndOffset is the offset after the last record of the metadata log
+	EndOffset        int64                  `json:"end_offset"`
+	Features         map[string]int16       `json:"features"`
+	Brokers          []int32                `json:"brokers"`
+	Topics           []adminTopic           `json:"topics"`
+	NextProducerID   int64                  `json:"next_producer_id"`
+	Configs          []imageConfig          `json:"configs"`
+	ClientQuotas     []imageClientQuota     `json:"client_quotas"`
+	ACLs             []imageACL             `json:"acls"`
+	ScramCredentials []imageScramCredential `json:"scram_credentials"`
+}
+
+type imageConfig struct {
+	ResourceType int8   `json:"resource_type"`
+	ResourceName string `json:"resource_name"`
+	Name         string `json:"name"`
+	Value        string `json:"value"`
+}
+
+type imageClientQuota struct {
+	Entity []imageQuotaEntity `json:"entity"`
+	Key    string             `json:"key"`
+	Value  float64            `json:"value"`
+}
+
+type imageQuotaEntity struct {
+	Type string `json:"type"`
+	// Name is empty for the default entity of the type
+	Name    string `json:"name,omitempty"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// imageACL uses the codes of the ACL APIs for its enums
+type imageACL struct {
+	ID             uuid.UUID `json:"id"`
+	ResourceType   int8      `json:"resource_type"`
+	ResourceName   string    `json:"resource_name"`
+	PatternType    int8      `json:"pattern_type"`
+	Principal      string    `json:"principal"`
+	Host           string    `json:"host"`
+	Operation      int8      `json:"operation"`
+	PermissionType int8      `json:"permission_type"`
+}
+
+type imageScramCredential struct {
+	Name       string `json:"name"`
+	Mechanism  int8   `json:"mechanism"`
+	Iterations int32  `json:"iterations"`
+}
+
+// metadataImage replays the metadata log, a later record replaces or removes
+// what an earlier one set
+func (srv *Server) metadataImage() metadataImage {
+	image := metadataImage{Topics: srv.adminTopics(nil)}
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	image.Brokers = srv.liveBrokers()
+	image.Features = make(map[string]int16)
+	type configKey struct {
+		resourceType int8
+		resourceName string
+		name         string
+	}
+	configValues := make(map[configKey]string)
+	quotas := make(map[string]imageClientQuota)
+	acls := make(map[uuid.UUID]imageACL)
+	type scramKey struct {
+		name      string
+		mechanism int8
+	}
+	credentials := make(map[scramKey]imageScramCredential)
+	topicNames := make(map[uuid.UUID]string)
+
+	for _, batch := range srv.metadata.Batches {
+		image.EndOffset = batch.NextOffset()
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.FeatureLevelValue:
+				image.Features[value.Name] = value.FeatureLevel()
+			case file_metadata.TopicValue:
+				topicNames[value.TopicId] = value.TopicName
+			case file_metadata.RemoveTopicValue:
+				for key := range configValues {
+					if key.resourceType == file_metadata.TopicConfigResource && key.resourceName == topicNames[value.TopicId] {
+						delete(configValues, key)
+					}
+				}
+			case file_metadata.ProducerIdsValue:
+				image.NextProducerID = value.NextProducerId
+			case file_metadata.ConfigValue:
+				key := configKey{value.ResourceType, value.ResourceName, value.Name}
+				if value.Removed {
+					delete(configValues, key)
+				} else {
+					configValues[key] = value.Value
+				}
+			case file_metadata.ClientQuotaValue:
+				quota := imageClientQuota{Key: value.Key, Value: value.Value, Entity: []imageQuotaEntity{}}
+				id := value.Key
+				for _, part := range value.Entity {
+					quota.Entity = append(quota.Entity, imageQuotaEntity{Type: part.EntityType, Name: part.EntityName, Default: part.IsDefault})
+					id += "\xff" + part.EntityType + "\xff" + part.EntityName + "\xff" + strconv.FormatBool(part.IsDefault)
+				}
+				if value.Remove {
+					delete(quotas, id)
+				} else {
+					quotas[id] = quota
+				}
+			case file_metadata.AccessControlEntryValue:
+				acls[value.Id] = imageACL{
+					ID:             value.Id,
+					ResourceType:   value.ResourceType,
+					ResourceName:   value.ResourceName,
+					PatternType:    value.PatternType,
+					Principal:      value.Principal,
+					Host:           value.Host,
+					Operation:      value.Operation,
+					PermissionType: value.PermissionType,
+				}
+			case file_metadata.RemoveAccessControlEntryValue:
+				delete(acls, value.Id)
+			case file_metadata.UserScramCredentialValue:
+				credentials[scramKey{value.Name, value.Mechanism}] = imageScramCredential{Name: value.Name, Mechanism: value.Mechanism, Iterations: value.Iterations}
+			case file_metadata.RemoveUserScramCredentialValue:
+				delete(credentials, scramKey{value.Name, value.Mechanism})
+			}
+		}
+	}
+
+	image.Configs = []imageConfig{}
+	for key, value := range configValues {
+		image.Configs = append(image.Configs, imageConfig{ResourceType: key.resourceType, ResourceName: key.resourceName, Name: key.name, Value: value})
+	}
+	sort.Slice(image.Configs, func(i, j int) bool {
+		a, b := image.Configs[i], image.Configs[j]
+		if a.ResourceType != b.ResourceType {
+			return a.ResourceType < b.ResourceType
+		}
+		if a.ResourceName != b.ResourceName {
+			return a.ResourceName < b.ResourceName
+		}
+		return a.Name < b.Name
+	})
+
+	var quotaIDs []string
+	for id := range quotas {
+		quotaIDs = append(quotaIDs, id)
+	}
+	sort.Strings(quotaIDs)
+	image.ClientQuotas = []imageClientQuota{}
+	for _, id := range quotaIDs {
+		image.ClientQuotas = append(image.ClientQuotas, quotas[id])
+	}
+
+	image.ACLs = []imageACL{}
+	for _, acl := range acls {
+		image.ACLs = append(image.ACLs, acl)
+	}
+	sort.Slice(image.ACLs, func(i, j int) bool { return image.ACLs[i].ID.String() < image.ACLs[j].ID.String() })
+
+	image.ScramCredentials = []imageScramCredential{}
+	for _, credential := range credentials {
+		image.ScramCredentials = append(image.ScramCredentials, credential)
+	}
+	sort.Slice(image.ScramCredentials, func(i, j int) bool {
+		a, b := image.ScramCredentials[i], image.ScramCredentials[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Mechanism < b.Mechanism
+	})
+	return image
+}
+
+func (srv *Server) handleMetadataImage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, srv.metadataImage())
+}
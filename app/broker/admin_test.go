@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func startHTTPServer(t *testing.T) *Server {
+	t.Helper()
+	return startServerWith(t, func(config *Config) { config.HTTPAddr = "127.0.0.1:0" })
+}
+
+func getJSON(t *testing.T, server *Server, path string, body any) int {
+	t.Helper()
+	response, err := http.Get("http://" + server.HTTPAddr() + path)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", path, err)
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return response.StatusCode
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.handleReadyz(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the server is started, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	server.whenReady(server.handleTopics)(recorder, httptest.NewRequest("GET", "/topics", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the admin API to wait for the metadata, got %d", recorder.Code)
+	}
+
+	server = startHTTPServer(t)
+	var status healthStatus
+	if code := getJSON(t, server, "/readyz", &status); code != http.StatusOK || status.Status != "ready" {
+		t.Errorf("Expected ready once started, got %d %+v", code, status)
+	}
+	if code := getJSON(t, server, "/healthz", &status); code != http.StatusOK {
+		t.Errorf("Expected /healthz to answer 200, got %d", code)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	t.Parallel()
+	server := startHTTPServer(t)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	request, _ := hex.DecodeString("0000000d001200000000002a0003636c69")
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	if _, err := readRequest(conn, 1<<20); err != nil {
+		t.Fatalf("Failed to read from server: %v", err)
+	}
+
+	var clients []connectedClient
+	getJSON(t, server, "/clients", &clients)
+	if len(clients) != 1 || clients[0].ClientID != "cli" || clients[0].Requests != 1 || clients[0].Listener != "PLAINTEXT" {
+		t.Errorf("Expected the connected client, got %+v", clients)
+	}
+
+	var topic adminTopic
+	if code := getJSON(t, server, "/topics/__consumer_offsets", &topic); code != http.StatusOK || !topic.Internal || len(topic.Partitions) != 1 || *topic.Partitions[0].LogEndOffset != 0 {
+		t.Errorf("Expected the offsets topic, got %d %+v", code, topic)
+	}
+	var notFound errorBody
+	if code := getJSON(t, server, "/topics/missing", &notFound); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing topic, got %d", code)
+	}
+
+	var segments []adminSegment
+	if code := getJSON(t, server, "/topics/__consumer_offsets/partitions/0/segments", &segments); code != http.StatusOK || len(segments) != 1 || segments[0].Size != 0 {
+		t.Errorf("Expected one empty segment, got %d %+v", code, segments)
+	}
+
+	var image metadataImage
+	getJSON(t, server, "/metadata", &image)
+	if len(image.Topics) != 2 || len(image.Brokers) != 1 || image.EndOffset == 0 {
+		t.Errorf("Expected the internal topics in the metadata image, got %+v", image)
+	}
+}
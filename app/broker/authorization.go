@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+)
+
+// Operations reported in TopicAuthOps, the bit of each one is its ACL code
+var topicAuthOps = []struct {
+	operation authorizer.Operation
+	bit       int32
+}{
+	{authorizer.Read, TopicAuthOpRead},
+	{authorizer.Write, TopicAuthOpWrite},
+	{authorizer.Create, TopicAuthOpCreate},
+	{authorizer.Delete, TopicAuthOpDelete},
+	{authorizer.Alter, TopicAuthOpAlter},
+	{authorizer.Describe, TopicAuthOpDescribe},
+	{authorizer.DescribeConfigs, TopicAuthOpDescribeConfigs},
+	{authorizer.AlterConfigs, TopicAuthOpAlterConfigs},
+}
+
+// Operations on the cluster reported in ClusterAuthorizedOperations
+var clusterOperations = []authorizer.Operation{
+	authorizer.Create,
+	authorizer.Alter,
+	authorizer.Describe,
+	authorizer.ClusterAction,
+	authorizer.DescribeConfigs,
+	authorizer.AlterConfigs,
+	authorizer.IdempotentWrite,
+}
+
+// loadAuthorizer creates the authorizer when one is configured and replays
+// the ACL records of the metadata log into it
+func (srv *Server) loadAuthorizer() {
+	if srv.config.AuthorizerClassName == "" {
+		return
+	}
+	srv.authorizer = authorizer.New()
+	srv.authorizer.SuperUsers = srv.config.SuperUsers
+	srv.authorizer.AllowEveryoneIfNoACLFound = srv.config.AllowEveryoneIfNoACLFound
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+	for _, batch := range srv.metadata.Batches {
+		for _, record := range batch.Records {
+			srv.applyACLRecord(record.Value)
+		}
+	}
+}
+
+// applyACLRecord updates the running authorizer with a metadata record, other
+// records are ignored
+func (srv *Server) applyACLRecord(value interface{}) {
+	if srv.authorizer == nil {
+		return
+	}
+	switch value := value.(type) {
+	case file_metadata.AccessControlEntryValue:
+		srv.authorizer.AddACL(value.Id, authorizer.ACL{
+			ResourceType: authorizer.ResourceType(value.ResourceType),
+			ResourceName: value.ResourceName,
+			PatternType:  authorizer.PatternType(value.PatternType),
+			Principal:    value.Principal,
+			Host:         value.Host,
+			Operation:    authorizer.Operation(value.Operation),
+			Permission:   authorizer.Permission(value.PermissionType),
+		})
+	case file_metadata.RemoveAccessControlEntryValue:
+		srv.authorizer.RemoveACL(value.Id)
+	}
+}
+
+// authorize checks an operation of the session's principal on a resource
+func (s *clientSession) authorize(operation authorizer.Operation, resourceType authorizer.ResourceType, name string) bool {
+	if s.server.authorizer == nil {
+		return true
+	}
+	return s.server.authorizer.Authorize(authorizer.Action{
+		Principal:    "User:" + s.principal,
+		Host:         s.host,
+		ResourceType: resourceType,
+		ResourceName: name,
+		Operation:    operation,
+	})
+}
+
+func (s *clientSession) authorizeTopic(operation authorizer.Operation, topic string) bool {
+	return s.authorize(operation, authorizer.ResourceTopic, topic)
+}
+
+func (s *clientSession) authorizeGroup(operation authorizer.Operation, group string) bool {
+	return s.authorize(operation, authorizer.ResourceGroup, group)
+}
+
+func (s *clientSession) authorizeTransactionalID(operation authorizer.Operation, transactionalID string) bool {
+	return s.authorize(operation, authorizer.ResourceTransactionalID, transactionalID)
+}
+
+// authorizeAnyTopic reports whether the operation is allowed on some topic,
+// which is how Kafka lets idempotent producers in without IDEMPOTENT_WRITE
+func (s *clientSession) authorizeAnyTopic(operation authorizer.Operation) bool {
+	if s.server.authorizer == nil {
+		return true
+	}
+	return s.server.authorizer.AuthorizeByResourceType("User:"+s.principal, s.host, authorizer.ResourceTopic, operation)
+}
+
+// topicAuthorizedOperations is the TopicAuthOps bit field of a topic
+func (s *clientSession) topicAuthorizedOperations(topic string) int32 {
+	var ops int32
+	for _, op := range topicAuthOps {
+		if s.authorizeTopic(op.operation, topic) {
+			ops |= op.bit
+		}
+	}
+	return ops
+}
+
+func (s *clientSession) clusterAuthorizedOperations() int32 {
+	var ops int32
+	for _, operation := range clusterOperations {
+		if s.authorize(operation, authorizer.ResourceCluster, authorizer.ClusterResourceName) {
+			ops |= 1 << operation
+		}
+	}
+	return ops
+}
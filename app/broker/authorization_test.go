@@ -0,0 +1,465 @@
+package broker
+
+import (
+	"net"
+	"testing"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/ssl"
+
+	"github.com/google/uuid"
+)
+
+// startAuthorizedServer runs a broker with an authorizer and no ACLs, so every
+// principal except the super users is denied everything. The anonymous
+// principal the topic helpers use is a super user.
+func startAuthorizedServer(t *testing.T) *Server {
+	t.Helper()
+	return startServerWith(t, func(config *Config) {
+		config.AuthorizerClassName = "org.apache.kafka.metadata.authorizer.StandardAuthorizer"
+		config.SuperUsers = []string{"User:admin", "User:" + ssl.AnonymousPrincipal}
+	})
+}
+
+// allow grants alice an operation on a resource
+func allow(server *Server, resourceType authorizer.ResourceType, name string, operation authorizer.Operation) {
+	server.authorizer.AddACL(uuid.New(), authorizer.ACL{
+		ResourceType: resourceType,
+		ResourceName: name,
+		PatternType:  authorizer.PatternLiteral,
+		Principal:    "User:alice",
+		Host:         authorizer.Wildcard,
+		Operation:    operation,
+		Permission:   authorizer.Allow,
+	})
+}
+
+var testRemote = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+
+// offsetCommitRequest is an OffsetCommit v8 of offset 1 for the first
+// partition of topic, outside of any generation
+func offsetCommitRequest(group string, topic string) []byte {
+	body := compactStringToBytes(group)
+	body = append(body, int32ToBytes(-1)...) // generation id
+	body = append(body, compactStringToBytes("")...)
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, compactStringToBytes(topic)...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, int32ToBytes(0)...)  // partition
+	body = append(body, int64ToBytes(1)...)  // committed offset
+	body = append(body, int32ToBytes(-1)...) // committed leader epoch
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, 0x00, 0x00, 0x00) // partition, topic and request tag buffers
+	return requestBytes(OffsetCommitAPIKEY, 8, 1, body)
+}
+
+// offsetFetchRequest is an OffsetFetch v8 of the first partition of topic,
+// or of every committed offset without a topic
+func offsetFetchRequest(group string, topic string) []byte {
+	body := compactArrayLengthToBytes(1)
+	body = append(body, compactStringToBytes(group)...)
+	if topic == "" {
+		body = append(body, 0x00) // null topics
+	} else {
+		body = append(body, compactArrayLengthToBytes(1)...)
+		body = append(body, compactStringToBytes(topic)...)
+		body = append(body, compactInt32ArrayToBytes([]int32{0})...)
+		body = append(body, 0x00)
+	}
+	body = append(body, 0x00)
+	body = append(body, boolToBytes(false)...) // require stable
+	body = append(body, 0x00)
+	return requestBytes(OffsetFetchAPIKEY, 8, 1, body)
+}
+
+// groupsRequest is a request of a single array of group ids, followed by
+// include_authorized_operations for DescribeGroups and ConsumerGroupDescribe
+func groupsRequest(apiKey int16, version int16, groups ...string) []byte {
+	body := compactArrayLengthToBytes(len(groups))
+	for _, group := range groups {
+		body = append(body, compactStringToBytes(group)...)
+	}
+	if apiKey != DeleteGroupsAPIKEY {
+		body = append(body, boolToBytes(false)...)
+	}
+	body = append(body, 0x00)
+	return requestBytes(apiKey, version, 1, body)
+}
+
+func TestGroupRequestsNeedGroupACLs(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+	alice := testSession(server, "alice")
+
+	findCoordinator := append([]byte{CoordinatorKeyTypeGroup}, compactArrayLengthToBytes(1)...)
+	findCoordinator = append(findCoordinator, compactStringToBytes("group")...)
+	findCoordinator = append(findCoordinator, 0x00)
+	found, err := server.handleFindCoordinatorRequest(requestBytes(FindCoordinatorAPIKEY, 4, 1, findCoordinator), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle FindCoordinator: %v", err)
+	}
+	if found.Coordinators[0].ErrorCode != ErrorCodeGroupAuthorizationFailed || found.Coordinators[0].NodeID != -1 {
+		t.Errorf("Expected FindCoordinator to be denied, got %+v", found.Coordinators[0])
+	}
+
+	var joined *JoinGroupResponse
+	if err := server.handleJoinGroupRequest(joinGroupRequest(1, "group", ""), alice, testRemote, func(response *JoinGroupResponse) { joined = response }); err != nil {
+		t.Fatalf("Failed to handle JoinGroup: %v", err)
+	}
+	if joined == nil || joined.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected JoinGroup to be denied right away, got %+v", joined)
+	}
+
+	var synced *SyncGroupResponse
+	if err := server.handleSyncGroupRequest(syncGroupRequest(1, "group", "member", nil), alice, func(response *SyncGroupResponse) { synced = response }); err != nil {
+		t.Fatalf("Failed to handle SyncGroup: %v", err)
+	}
+	if synced == nil || synced.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected SyncGroup to be denied right away, got %+v", synced)
+	}
+
+	heartbeat := compactStringToBytes("group")
+	heartbeat = append(heartbeat, int32ToBytes(1)...) // generation id
+	heartbeat = append(heartbeat, compactStringToBytes("member")...)
+	heartbeat = append(heartbeat, compactNullableStringToBytes("", true)...)
+	heartbeat = append(heartbeat, 0x00)
+	beat, err := server.handleHeartbeatRequest(requestBytes(HeartbeatAPIKEY, 4, 1, heartbeat), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle Heartbeat: %v", err)
+	}
+	if beat.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected Heartbeat to be denied, got %d", beat.ErrorCode)
+	}
+
+	leave := compactStringToBytes("group")
+	leave = append(leave, compactArrayLengthToBytes(1)...)
+	leave = append(leave, compactStringToBytes("member")...)
+	leave = append(leave, compactNullableStringToBytes("", true)...)
+	leave = append(leave, 0x00, 0x00)
+	left, err := server.handleLeaveGroupRequest(requestBytes(LeaveGroupAPIKEY, 4, 1, leave), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle LeaveGroup: %v", err)
+	}
+	if left.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected LeaveGroup to be denied, got %d", left.ErrorCode)
+	}
+
+	consumerHeartbeat := compactStringToBytes("group")
+	consumerHeartbeat = append(consumerHeartbeat, compactStringToBytes("")...)
+	consumerHeartbeat = append(consumerHeartbeat, int32ToBytes(0)...) // member epoch
+	consumerHeartbeat = append(consumerHeartbeat, 0x00, 0x00)         // null instance and rack ids
+	consumerHeartbeat = append(consumerHeartbeat, int32ToBytes(-1)...)
+	consumerHeartbeat = append(consumerHeartbeat, compactArrayLengthToBytes(1)...)
+	consumerHeartbeat = append(consumerHeartbeat, compactStringToBytes("orders")...)
+	consumerHeartbeat = append(consumerHeartbeat, 0x00, 0x00, 0x00) // null assignor and partitions, tag buffer
+	consumed, err := server.handleConsumerGroupHeartbeatRequest(requestBytes(ConsumerGroupHeartbeatAPIKEY, 0, 1, consumerHeartbeat), alice, testRemote)
+	if err != nil {
+		t.Fatalf("Failed to handle ConsumerGroupHeartbeat: %v", err)
+	}
+	if consumed.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected ConsumerGroupHeartbeat to be denied, got %d", consumed.ErrorCode)
+	}
+
+	described, err := server.handleDescribeGroupsRequest(groupsRequest(DescribeGroupsAPIKEY, 5, "group"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle DescribeGroups: %v", err)
+	}
+	if described.Groups[0].ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected DescribeGroups to be denied, got %+v", described.Groups[0])
+	}
+
+	consumerDescribed, err := server.handleConsumerGroupDescribeRequest(groupsRequest(ConsumerGroupDescribeAPIKEY, 0, "group"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle ConsumerGroupDescribe: %v", err)
+	}
+	if consumerDescribed.Groups[0].ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected ConsumerGroupDescribe to be denied, got %+v", consumerDescribed.Groups[0])
+	}
+
+	deleted, err := server.handleDeleteGroupsRequest(groupsRequest(DeleteGroupsAPIKEY, 2, "group"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle DeleteGroups: %v", err)
+	}
+	if deleted.Results[0].ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected DeleteGroups to be denied, got %+v", deleted.Results[0])
+	}
+}
+
+func TestOffsetRequestsNeedGroupAndTopicACLs(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+	alice := testSession(server, "alice")
+	createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+
+	committed, err := server.handleOffsetCommitRequest(offsetCommitRequest("group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle OffsetCommit: %v", err)
+	}
+	if code := committed.Topics[0].Partitions[0].ErrorCode; code != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected OffsetCommit without group READ to be denied, got %d", code)
+	}
+	fetched, err := server.handleOffsetFetchRequest(offsetFetchRequest("group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle OffsetFetch: %v", err)
+	}
+	if fetched.Groups[0].ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected OffsetFetch without group READ to be denied, got %+v", fetched.Groups[0])
+	}
+
+	// With the group but not the topic, the partitions are denied
+	allow(server, authorizer.ResourceGroup, "group", authorizer.Read)
+	committed, err = server.handleOffsetCommitRequest(offsetCommitRequest("group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle OffsetCommit: %v", err)
+	}
+	if code := committed.Topics[0].Partitions[0].ErrorCode; code != ErrorCodeTopicAuthorizationFailed {
+		t.Errorf("Expected OffsetCommit without topic READ to be denied, got %d", code)
+	}
+
+	admin := testSession(server, "admin")
+	if committed, err := server.handleOffsetCommitRequest(offsetCommitRequest("group", "orders"), admin); err != nil || committed.Topics[0].Partitions[0].ErrorCode != ErrorCodeNone {
+		t.Fatalf("Expected the super user to commit, got %+v, %v", committed, err)
+	}
+	fetched, err = server.handleOffsetFetchRequest(offsetFetchRequest("group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle OffsetFetch: %v", err)
+	}
+	if partition := fetched.Groups[0].Topics[0].Partitions[0]; partition.ErrorCode != ErrorCodeTopicAuthorizationFailed || partition.CommittedOffset != -1 {
+		t.Errorf("Expected OffsetFetch without topic DESCRIBE to be denied, got %+v", partition)
+	}
+	fetched, err = server.handleOffsetFetchRequest(offsetFetchRequest("group", ""), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle OffsetFetch: %v", err)
+	}
+	if topics := fetched.Groups[0].Topics; len(topics) != 0 {
+		t.Errorf("Expected fetching every offset to leave out unauthorized topics, got %+v", topics)
+	}
+}
+
+func TestListGroupsFiltersByACLs(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+	createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+	admin := testSession(server, "admin")
+	for _, group := range []string{"visible", "hidden"} {
+		if _, err := server.handleOffsetCommitRequest(offsetCommitRequest(group, "orders"), admin); err != nil {
+			t.Fatalf("Failed to handle OffsetCommit: %v", err)
+		}
+	}
+	allow(server, authorizer.ResourceGroup, "visible", authorizer.Describe)
+
+	listGroups := requestBytes(ListGroupsAPIKEY, 3, 1, []byte{0x00})
+	listed, err := server.handleListGroupsRequest(listGroups, testSession(server, "alice"))
+	if err != nil {
+		t.Fatalf("Failed to handle ListGroups: %v", err)
+	}
+	if len(listed.Groups) != 1 || listed.Groups[0].GroupID != "visible" {
+		t.Errorf("Expected only the group alice may describe, got %+v", listed.Groups)
+	}
+
+	listed, err = server.handleListGroupsRequest(listGroups, admin)
+	if err != nil {
+		t.Fatalf("Failed to handle ListGroups: %v", err)
+	}
+	if len(listed.Groups) != 2 {
+		t.Errorf("Expected every group with cluster DESCRIBE, got %+v", listed.Groups)
+	}
+}
+
+// transactionRequest starts a request of the transaction APIs, which all
+// begin with the transactional id and the producer
+func transactionRequest(transactionalID string) []byte {
+	body := compactStringToBytes(transactionalID)
+	body = append(body, int64ToBytes(1)...) // producer id
+	return append(body, int16ToBytes(0)...) // producer epoch
+}
+
+// addPartitionsToTxnRequest is an AddPartitionsToTxn v3 of the first
+// partition of each topic
+func addPartitionsToTxnRequest(transactionalID string, topics ...string) []byte {
+	body := transactionRequest(transactionalID)
+	body = append(body, compactArrayLengthToBytes(len(topics))...)
+	for _, topic := range topics {
+		body = append(body, compactStringToBytes(topic)...)
+		body = append(body, compactInt32ArrayToBytes([]int32{0})...)
+		body = append(body, 0x00)
+	}
+	body = append(body, 0x00)
+	return requestBytes(AddPartitionsToTxnAPIKEY, 3, 1, body)
+}
+
+// txnOffsetCommitRequest is a TxnOffsetCommit v3 of offset 1 for the first
+// partition of topic
+func txnOffsetCommitRequest(transactionalID string, group string, topic string) []byte {
+	body := compactStringToBytes(transactionalID)
+	body = append(body, compactStringToBytes(group)...)
+	body = append(body, int64ToBytes(1)...)  // producer id
+	body = append(body, int16ToBytes(0)...)  // producer epoch
+	body = append(body, int32ToBytes(-1)...) // generation id
+	body = append(body, compactStringToBytes("")...)
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, compactStringToBytes(topic)...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, int32ToBytes(0)...)  // partition
+	body = append(body, int64ToBytes(1)...)  // committed offset
+	body = append(body, int32ToBytes(-1)...) // committed leader epoch
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, 0x00, 0x00, 0x00) // partition, topic and request tag buffers
+	return requestBytes(TxnOffsetCommitAPIKEY, 3, 1, body)
+}
+
+func TestTransactionRequestsNeedTransactionalIDACLs(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+	alice := testSession(server, "alice")
+	createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+
+	findCoordinator := append([]byte{CoordinatorKeyTypeTransaction}, compactArrayLengthToBytes(1)...)
+	findCoordinator = append(findCoordinator, compactStringToBytes("txn")...)
+	findCoordinator = append(findCoordinator, 0x00)
+	found, err := server.handleFindCoordinatorRequest(requestBytes(FindCoordinatorAPIKEY, 4, 1, findCoordinator), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle FindCoordinator: %v", err)
+	}
+	if found.Coordinators[0].ErrorCode != ErrorCodeTransactionalIDAuthorizationFailed {
+		t.Errorf("Expected FindCoordinator to be denied, got %+v", found.Coordinators[0])
+	}
+
+	initProducerID := compactNullableStringToBytes("txn", false)
+	initProducerID = append(initProducerID, int32ToBytes(60000)...) // transaction timeout ms
+	initProducerID = append(initProducerID, 0x00)
+	initialized, err := server.handleInitProducerIdRequest(requestBytes(InitProducerIdAPIKEY, 2, 1, initProducerID), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle InitProducerId: %v", err)
+	}
+	if initialized.ErrorCode != ErrorCodeTransactionalIDAuthorizationFailed || initialized.ProducerID != -1 {
+		t.Errorf("Expected InitProducerId to be denied, got %+v", initialized)
+	}
+
+	added, err := server.handleAddPartitionsToTxnRequest(addPartitionsToTxnRequest("txn", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle AddPartitionsToTxn: %v", err)
+	}
+	if code := added.Results[0].Results[0].ErrorCode; code != ErrorCodeTransactionalIDAuthorizationFailed {
+		t.Errorf("Expected AddPartitionsToTxn to be denied, got %d", code)
+	}
+
+	addOffsets := append(transactionRequest("txn"), compactStringToBytes("group")...)
+	addOffsets = append(addOffsets, 0x00)
+	addedOffsets, err := server.handleAddOffsetsToTxnRequest(requestBytes(AddOffsetsToTxnAPIKEY, 3, 1, addOffsets), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle AddOffsetsToTxn: %v", err)
+	}
+	if addedOffsets.ErrorCode != ErrorCodeTransactionalIDAuthorizationFailed {
+		t.Errorf("Expected AddOffsetsToTxn to be denied, got %d", addedOffsets.ErrorCode)
+	}
+
+	endTxn := append(transactionRequest("txn"), boolToBytes(true)...)
+	endTxn = append(endTxn, 0x00)
+	ended, err := server.handleEndTxnRequest(requestBytes(EndTxnAPIKEY, 3, 1, endTxn), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle EndTxn: %v", err)
+	}
+	if ended.ErrorCode != ErrorCodeTransactionalIDAuthorizationFailed {
+		t.Errorf("Expected EndTxn to be denied, got %d", ended.ErrorCode)
+	}
+
+	committed, err := server.handleTxnOffsetCommitRequest(txnOffsetCommitRequest("txn", "group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle TxnOffsetCommit: %v", err)
+	}
+	if code := committed.Topics[0].Partitions[0].ErrorCode; code != ErrorCodeTransactionalIDAuthorizationFailed {
+		t.Errorf("Expected TxnOffsetCommit to be denied, got %d", code)
+	}
+
+	// With the transactional id, the group and the topics are checked next
+	allow(server, authorizer.ResourceTransactionalID, "txn", authorizer.Write)
+	addedOffsets, err = server.handleAddOffsetsToTxnRequest(requestBytes(AddOffsetsToTxnAPIKEY, 3, 1, addOffsets), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle AddOffsetsToTxn: %v", err)
+	}
+	if addedOffsets.ErrorCode != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected AddOffsetsToTxn without group READ to be denied, got %d", addedOffsets.ErrorCode)
+	}
+	committed, err = server.handleTxnOffsetCommitRequest(txnOffsetCommitRequest("txn", "group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle TxnOffsetCommit: %v", err)
+	}
+	if code := committed.Topics[0].Partitions[0].ErrorCode; code != ErrorCodeGroupAuthorizationFailed {
+		t.Errorf("Expected TxnOffsetCommit without group READ to be denied, got %d", code)
+	}
+	allow(server, authorizer.ResourceGroup, "group", authorizer.Read)
+	committed, err = server.handleTxnOffsetCommitRequest(txnOffsetCommitRequest("txn", "group", "orders"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle TxnOffsetCommit: %v", err)
+	}
+	if code := committed.Topics[0].Partitions[0].ErrorCode; code != ErrorCodeTopicAuthorizationFailed {
+		t.Errorf("Expected TxnOffsetCommit without topic READ to be denied, got %d", code)
+	}
+
+	createTopics(t, server, false, CreatableTopic{Name: "payments", NumPartitions: 1, ReplicationFactor: 1})
+	allow(server, authorizer.ResourceTopic, "payments", authorizer.Write)
+	added, err = server.handleAddPartitionsToTxnRequest(addPartitionsToTxnRequest("txn", "orders", "payments"), alice)
+	if err != nil {
+		t.Fatalf("Failed to handle AddPartitionsToTxn: %v", err)
+	}
+	if code := added.Results[0].Results[0].ErrorCode; code != ErrorCodeTopicAuthorizationFailed {
+		t.Errorf("Expected the unauthorized topic to be denied, got %d", code)
+	}
+	if code := added.Results[1].Results[0].ErrorCode; code != ErrorCodeOperationNotAttempted {
+		t.Errorf("Expected the authorized topic not to be attempted, got %d", code)
+	}
+}
+
+func TestIdempotentProducersNeedWriteACLs(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+	alice := testSession(server, "alice")
+
+	initProducerID := compactNullableStringToBytes("", true)
+	initProducerID = append(initProducerID, int32ToBytes(-1)...) // transaction timeout ms
+	initProducerID = append(initProducerID, 0x00)
+	request := requestBytes(InitProducerIdAPIKEY, 2, 1, initProducerID)
+
+	initialized, err := server.handleInitProducerIdRequest(request, alice)
+	if err != nil {
+		t.Fatalf("Failed to handle InitProducerId: %v", err)
+	}
+	if initialized.ErrorCode != ErrorCodeClusterAuthorizationFailed {
+		t.Errorf("Expected InitProducerId without any WRITE to be denied, got %+v", initialized)
+	}
+
+	// WRITE on a single topic is enough, like IDEMPOTENT_WRITE on the cluster
+	allow(server, authorizer.ResourceTopic, "orders", authorizer.Write)
+	initialized, err = server.handleInitProducerIdRequest(request, alice)
+	if err != nil {
+		t.Fatalf("Failed to handle InitProducerId: %v", err)
+	}
+	if initialized.ErrorCode != ErrorCodeNone || initialized.ProducerID < 0 {
+		t.Errorf("Expected a producer id, got %+v", initialized)
+	}
+}
+
+func TestWriteTxnMarkersNeedsClusterAction(t *testing.T) {
+	t.Parallel()
+	server := startAuthorizedServer(t)
+
+	markers := compactArrayLengthToBytes(1)
+	markers = append(markers, int64ToBytes(1)...) // producer id
+	markers = append(markers, int16ToBytes(0)...) // producer epoch
+	markers = append(markers, boolToBytes(true)...)
+	markers = append(markers, compactArrayLengthToBytes(1)...)
+	markers = append(markers, compactStringToBytes("orders")...)
+	markers = append(markers, compactInt32ArrayToBytes([]int32{0})...)
+	markers = append(markers, 0x00)
+	markers = append(markers, int32ToBytes(0)...) // coordinator epoch
+	markers = append(markers, 0x00, 0x00)
+	written, err := server.handleWriteTxnMarkersRequest(requestBytes(WriteTxnMarkersAPIKEY, 1, 1, markers), testSession(server, "alice"))
+	if err != nil {
+		t.Fatalf("Failed to handle WriteTxnMarkers: %v", err)
+	}
+	if code := written.Markers[0].Topics[0].Partitions[0].ErrorCode; code != ErrorCodeClusterAuthorizationFailed {
+		t.Errorf("Expected WriteTxnMarkers to be denied, got %d", code)
+	}
+}
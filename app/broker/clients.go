@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// connectedClient is what the admin API shows of an open connection
+type connectedClient struct {
+	ID          int64     `json:"id"`
+	Listener    string    `json:"listener"`
+	Remote      string    `json:"remote"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// The fields below change with every request
+	ClientID    string    `json:"client_id"`
+	Principal   string    `json:"principal"`
+	Requests    int64     `json:"requests"`
+	LastRequest time.Time `json:"last_request,omitzero"`
+}
+
+// connectedClients tracks the open connections, they are added once accepted
+// and removed when closed
+type connectedClients struct {
+	mu      sync.Mutex
+	clients map[int64]*connectedClient
+}
+
+func (c *connectedClients) add(client *connectedClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients == nil {
+		c.clients = make(map[int64]*connectedClient)
+	}
+	c.clients[client.ID] = client
+}
+
+func (c *connectedClients) remove(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, id)
+}
+
+// received records a request of the connection
+func (c *connectedClients) received(id int64, session *clientSession, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[id]; ok {
+		client.ClientID = session.clientID
+		client.Principal = session.principal
+		client.Requests++
+		client.LastRequest = at
+	}
+}
+
+// list copies the clients, oldest connection first
+func (c *connectedClients) list() []connectedClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clients := make([]connectedClient, 0, len(c.clients))
+	for _, client := range c.clients {
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
@@ -0,0 +1,280 @@
+package broker
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/file_metadata"
+)
+
+// brokerDefs lists the dynamic broker configs, then the broker's own settings
+// as read only configs whose defaults are the ones of DefaultConfig
+func brokerDefs() []configs.Def {
+	defaults := DefaultConfig()
+	defs := append(configs.BrokerSynonymDefs(), configs.ConnectionDefs...)
+	return append(defs,
+		configs.ReadOnlyDef("node.id", configs.Int, strconv.Itoa(int(defaults.NodeID)), "The node ID associated with the roles this process is playing."),
+		configs.ReadOnlyDef("log.dirs", configs.String, defaults.LogDir, "The directories in which the log data is kept."),
+		configs.ReadOnlyDef("metadata.log.dir", configs.String, defaults.MetadataLogDir, "This configuration determines where we put the metadata log. If it is not set, the metadata log is placed in the first log directory from log.dirs."),
+		configs.ReadOnlyDef("num.partitions", configs.Int, strconv.Itoa(int(defaults.DefaultNumPartitions)), "The default number of log partitions per topic."),
+		configs.ReadOnlyDef("default.replication.factor", configs.Int, strconv.Itoa(int(defaults.DefaultReplicationFactor)), "The replication factor for automatically created topics."),
+		configs.ReadOnlyDef("offsets.topic.num.partitions", configs.Int, strconv.Itoa(int(defaults.OffsetsTopicNumPartitions)), "The number of partitions for the offset commit topic."),
+		configs.ReadOnlyDef("transaction.state.log.num.partitions", configs.Int, strconv.Itoa(int(defaults.TransactionStateTopicNumPartitions)), "The number of partitions for the transaction topic."),
+		configs.ReadOnlyDef("quota.window.num", configs.Int, strconv.Itoa(QuotaWindowNum), "The number of samples to retain in memory for client quotas."),
+		configs.ReadOnlyDef("quota.window.size.seconds", configs.Int, strconv.Itoa(QuotaWindowSizeMs/1000), "The time span of each sample for client quotas."),
+		configs.ReadOnlyDef("socket.request.max.bytes", configs.Int, strconv.Itoa(int(defaults.MaxRequestSize)), "The maximum number of bytes in a socket request."),
+		configs.ReadOnlyDef("num.io.threads", configs.Int, strconv.Itoa(int(defaults.NumIoThreads)), "The number of threads that the server uses for processing requests, which may include disk I/O."),
+		configs.ReadOnlyDef("queued.max.requests", configs.Int, strconv.Itoa(int(defaults.QueuedMaxRequests)), "The number of queued requests allowed for data-plane, before blocking the network threads."),
+		configs.ReadOnlyDef("queued.max.requests.per.connection", configs.Int, strconv.Itoa(int(defaults.QueuedMaxRequestsPerConnection)), "The number of requests of a connection read before the first one is answered, 1 disables pipelining."),
+		configs.ReadOnlyDef("connections.max.idle.ms", configs.Long, strconv.FormatInt(defaults.ConnectionsMaxIdleMs, 10), "Idle connections timeout: the server socket processor threads close the connections that idle more than this."),
+	)
+}
+
+// appliedTopicConfigs are the topic configs the broker reads when it uses
+// them. The log has no retention, compaction, segments or recompression, so
+// the other topic configs and their broker synonyms can only be set to their
+// defaults.
+var appliedTopicConfigs = []string{"max.message.bytes", "min.insync.replicas"}
+
+// unsupportedConfig returns why the broker refuses a value of a config it does
+// not apply, "" when it takes the value
+func unsupportedConfig(resourceType int8, name string, value string) string {
+	for _, def := range configs.TopicDefs {
+		if slices.Contains(appliedTopicConfigs, def.Name) {
+			continue
+		}
+		if !(resourceType == configs.TopicResource && name == def.Name || resourceType == configs.BrokerResource && name == def.BrokerSynonym) {
+			continue
+		}
+		if slices.Equal(configs.SplitList(value), configs.SplitList(def.Default)) {
+			return ""
+		}
+		return fmt.Sprintf("Invalid value %s for configuration %s: The broker does not apply %s, it can only be set to its default %s", value, name, name, def.Default)
+	}
+	return ""
+}
+
+// loadConfigs replays the ConfigRecords of the metadata log, the configs of a
+// deleted topic go with it
+func (srv *Server) loadConfigs() {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	topicNames := make(map[[16]byte]string)
+	for _, batch := range srv.metadata.Batches {
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.TopicValue:
+				topicNames[value.TopicId] = value.TopicName
+			case file_metadata.RemoveTopicValue:
+				srv.configs.Forget(configs.Resource{Type: configs.TopicResource, Name: topicNames[value.TopicId]})
+			default:
+				srv.applyConfigRecord(value)
+			}
+		}
+	}
+}
+
+// applyConfigRecord updates the configs with a metadata record, other records
+// are ignored. The subsystems read their configs when they use them, so a
+// change applies from the next request on.
+func (srv *Server) applyConfigRecord(value interface{}) {
+	if config, ok := value.(file_metadata.ConfigValue); ok {
+		resource := configs.Resource{Type: config.ResourceType, Name: config.ResourceName}
+		srv.configs.Apply(resource, config.Name, config.Value, config.Removed)
+	}
+}
+
+// configResourceError checks that a resource of the config APIs exists and
+// that the session may run the operation on it. Must be called with
+// metadataLock held.
+func (srv *Server) configResourceError(resourceType int8, name string, session *clientSession, operation authorizer.Operation) (int16, string) {
+	switch resourceType {
+	case configs.TopicResource:
+		if !session.authorizeTopic(operation, name) {
+			return ErrorCodeTopicAuthorizationFailed, ""
+		}
+		if srv.topics.topic(name) == nil {
+			return ErrorCodeUnknownTopic, fmt.Sprintf("The topic '%s' does not exist.", name)
+		}
+	case configs.BrokerResource:
+		if !session.authorize(operation, authorizer.ResourceCluster, authorizer.ClusterResourceName) {
+			return ErrorCodeClusterAuthorizationFailed, ""
+		}
+		if name != "" && name != strconv.Itoa(int(srv.config.NodeID)) {
+			return ErrorCodeInvalidRequest, fmt.Sprintf("Unexpected broker id, expected %d or empty string, but received %s", srv.config.NodeID, name)
+		}
+	default:
+		return ErrorCodeInvalidRequest, fmt.Sprintf("Unsupported resource type %d", resourceType)
+	}
+	return ErrorCodeNone, ""
+}
+
+func (srv *Server) handleDescribeConfigsRequest(buff []byte, session *clientSession) (*DescribeConfigsResponse, error) {
+	req, err := deserializeDescribeConfigsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DescribeConfigsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	for _, resource := range req.Resources {
+		result := DescribeConfigsResult{
+			ErrorCode:    ErrorCodeNone,
+			ResourceType: resource.ResourceType,
+			ResourceName: resource.ResourceName,
+			Configs:      []DescribeConfigsResourceConfig{},
+		}
+		result.ErrorCode, result.ErrorMessage = srv.configResourceError(resource.ResourceType, resource.ResourceName, session, authorizer.DescribeConfigs)
+		if result.ErrorCode != ErrorCodeNone {
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		for _, entry := range srv.configs.Describe(configs.Resource{Type: resource.ResourceType, Name: resource.ResourceName}) {
+			if resource.ConfigurationKeys != nil && !slices.Contains(resource.ConfigurationKeys, entry.Name) {
+				continue
+			}
+			config := DescribeConfigsResourceConfig{
+				Name:         entry.Name,
+				Value:        entry.Value,
+				ReadOnly:     entry.ReadOnly,
+				ConfigSource: int8(entry.Source),
+				IsSensitive:  false,
+				Synonyms:     []DescribeConfigsSynonym{},
+				ConfigType:   int8(entry.Type),
+			}
+			if req.IncludeSynonyms {
+				for _, synonym := range entry.Synonyms {
+					config.Synonyms = append(config.Synonyms, DescribeConfigsSynonym{Name: synonym.Name, Value: synonym.Value, Source: int8(synonym.Source)})
+				}
+			}
+			if req.IncludeDocumentation {
+				config.Documentation = entry.Documentation
+			}
+			result.Configs = append(result.Configs, config)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	return response, nil
+}
+
+// handleAlterConfigsRequest replaces the dynamic configs of each resource with
+// the ones in the request, configs left out go back to their defaults
+func (srv *Server) handleAlterConfigsRequest(buff []byte, session *clientSession) (*AlterConfigsResponse, error) {
+	req, err := deserializeAlterConfigsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AlterConfigsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	for _, resource := range req.Resources {
+		result := AlterConfigsResourceResponse{ResourceType: resource.ResourceType, ResourceName: resource.ResourceName}
+		result.ErrorCode, result.ErrorMessage = srv.configResourceError(resource.ResourceType, resource.ResourceName, session, authorizer.AlterConfigs)
+		if result.ErrorCode == ErrorCodeNone {
+			var wanted []configs.Change
+			for _, config := range resource.Configs {
+				wanted = append(wanted, configs.Change{Name: config.Name, Value: config.Value})
+			}
+			target := configs.Resource{Type: resource.ResourceType, Name: resource.ResourceName}
+			changes, err := srv.configs.Replace(target, wanted)
+			result.ErrorCode, result.ErrorMessage = srv.alterConfigs(target, changes, err, req.ValidateOnly)
+		}
+		response.Responses = append(response.Responses, result)
+	}
+
+	return response, nil
+}
+
+// handleIncrementalAlterConfigsRequest sets, deletes, appends to or subtracts
+// from single configs of each resource
+func (srv *Server) handleIncrementalAlterConfigsRequest(buff []byte, session *clientSession) (*AlterConfigsResponse, error) {
+	req, err := deserializeIncrementalAlterConfigsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AlterConfigsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	for _, resource := range req.Resources {
+		result := AlterConfigsResourceResponse{ResourceType: resource.ResourceType, ResourceName: resource.ResourceName}
+		result.ErrorCode, result.ErrorMessage = srv.configResourceError(resource.ResourceType, resource.ResourceName, session, authorizer.AlterConfigs)
+		if result.ErrorCode == ErrorCodeNone {
+			var ops []configs.Op
+			for _, config := range resource.Configs {
+				ops = append(ops, configs.Op{Name: config.Name, Operation: config.ConfigOperation, Value: config.Value})
+			}
+			target := configs.Resource{Type: resource.ResourceType, Name: resource.ResourceName}
+			changes, err := srv.configs.Incremental(target, ops)
+			result.ErrorCode, result.ErrorMessage = srv.alterConfigs(target, changes, err, req.ValidateOnly)
+		}
+		response.Responses = append(response.Responses, result)
+	}
+
+	return response, nil
+}
+
+// alterConfigs appends the ConfigRecords of a resource's changes and applies
+// them, validation errors are mapped to their error codes. Must be called with
+// metadataLock held.
+func (srv *Server) alterConfigs(resource configs.Resource, changes []configs.Change, err error, validateOnly bool) (int16, string) {
+	switch {
+	case configs.IsInvalidRequest(err):
+		return ErrorCodeInvalidRequest, err.Error()
+	case err != nil:
+		return ErrorCodeInvalidConfig, err.Error()
+	}
+	for _, change := range changes {
+		if change.Value == nil {
+			continue
+		}
+		if message := unsupportedConfig(resource.Type, change.Name, *change.Value); message != "" {
+			return ErrorCodeInvalidConfig, message
+		}
+	}
+	if validateOnly || len(changes) == 0 {
+		return ErrorCodeNone, ""
+	}
+
+	var values [][]byte
+	for _, change := range changes {
+		config := file_metadata.ConfigValue{ResourceType: resource.Type, ResourceName: resource.Name, Name: change.Name}
+		if change.Value == nil {
+			config.Removed = true
+		} else {
+			config.Value = *change.Value
+		}
+		values = append(values, file_metadata.EncodeConfigValue(config))
+	}
+
+	batch, err := srv.appendMetadata(values...)
+	if err != nil {
+		return ErrorCodeUnknownServerError, err.Error()
+	}
+	for _, record := range batch.Records {
+		srv.applyConfigRecord(record.Value)
+	}
+	return ErrorCodeNone, ""
+}
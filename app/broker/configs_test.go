@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"testing"
+	"toy_kafka/app/configs"
+)
+
+// Configs nothing in the broker applies can only be set to their defaults,
+// with AlterConfigs and IncrementalAlterConfigs as with CreateTopics
+func TestUnappliedConfigsAreRefused(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+
+	value := func(v string) *string { return &v }
+	topic := configs.Resource{Type: configs.TopicResource, Name: "orders"}
+	broker := configs.Resource{Type: configs.BrokerResource, Name: ""}
+	for _, c := range []struct {
+		resource configs.Resource
+		name     string
+		value    string
+		expected int16
+	}{
+		{topic, "max.message.bytes", "2000", ErrorCodeNone},
+		{topic, "min.insync.replicas", "1", ErrorCodeNone},
+		{topic, "retention.ms", "1000", ErrorCodeInvalidConfig},
+		{topic, "retention.ms", "604800000", ErrorCodeNone},
+		{topic, "compression.type", "gzip", ErrorCodeInvalidConfig},
+		{topic, "cleanup.policy", "compact", ErrorCodeInvalidConfig},
+		{topic, "cleanup.policy", " delete ", ErrorCodeNone},
+		{broker, "log.retention.bytes", "1000", ErrorCodeInvalidConfig},
+		{broker, "message.max.bytes", "2000", ErrorCodeNone},
+	} {
+		for _, validateOnly := range []bool{true, false} {
+			changes := []configs.Change{{Name: c.name, Value: value(c.value)}}
+			server.metadataLock.Lock()
+			errorCode, message := server.alterConfigs(c.resource, changes, nil, validateOnly)
+			server.metadataLock.Unlock()
+			if errorCode != c.expected {
+				t.Errorf("Expected %d setting %s to %q, got %d %s", c.expected, c.name, c.value, errorCode, message)
+			}
+		}
+	}
+	if retention := server.configs.TopicInt("orders", "retention.ms"); retention != 604800000 {
+		t.Errorf("Expected the default retention to stay, got %d", retention)
+	}
+
+	server.metadataLock.Lock()
+	result := server.createTopicFromRequest(CreatableTopic{
+		Name:              "compacted",
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+		Configs:           []CreatableTopicConfig{{Name: "cleanup.policy", Value: "compact"}},
+	}, false)
+	server.metadataLock.Unlock()
+	if result.ErrorCode != ErrorCodeInvalidConfig || topicExists(server, "compacted") {
+		t.Errorf("Expected CreateTopics with cleanup.policy=compact to be refused, got %+v", result)
+	}
+}
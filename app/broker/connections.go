@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/listeners"
+)
+
+// connectionQuotas counts the open connections, in total and by IP address,
+// against max.connections and max.connections.per.ip like Kafka's
+// ConnectionQuotas. Where Kafka makes a connection over max.connections wait
+// for a free slot, it is refused here.
+type connectionQuotas struct {
+	mu    sync.Mutex
+	total int64
+	perIP map[string]int64
+
+	// overrides is max.connections.per.ip.overrides by IP address, the
+	// hostnames are resolved when the config changes
+	overridesMu    sync.Mutex
+	overridesValue string
+	overrides      map[string]int64
+}
+
+// admitConnection takes a connection slot for conn, the returned func gives it
+// back
+func (srv *Server) admitConnection(conn net.Conn, listener listeners.Listener) (func(), error) {
+	ip := connectionIP(conn)
+	maxConnections := srv.configs.BrokerInt("max.connections")
+	maxPerIP := srv.maxConnectionsPerIP(ip)
+
+	q := &srv.connectionQuotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.total >= maxConnections {
+		srv.metrics.connectionsRejected.Inc(listener.Name, "max.connections")
+		return nil, fmt.Errorf("the broker already has the maximum of %d connections", maxConnections)
+	}
+	if q.perIP[ip] >= maxPerIP {
+		srv.metrics.connectionsRejected.Inc(listener.Name, "max.connections.per.ip")
+		return nil, fmt.Errorf("%s already has the maximum of %d connections", ip, maxPerIP)
+	}
+	if q.perIP == nil {
+		q.perIP = make(map[string]int64)
+	}
+	q.total++
+	q.perIP[ip]++
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.total--
+		if q.perIP[ip]--; q.perIP[ip] <= 0 {
+			delete(q.perIP, ip)
+		}
+	}, nil
+}
+
+// maxConnectionsPerIP is the override for ip, or max.connections.per.ip
+func (srv *Server) maxConnectionsPerIP(ip string) int64 {
+	q := &srv.connectionQuotas
+	value := srv.configs.BrokerValue("max.connections.per.ip.overrides")
+
+	q.overridesMu.Lock()
+	defer q.overridesMu.Unlock()
+	if value != q.overridesValue || q.overrides == nil {
+		q.overrides = srv.resolveConnectionOverrides(value)
+		q.overridesValue = value
+	}
+	if limit, ok := q.overrides[ip]; ok {
+		return limit
+	}
+	return srv.configs.BrokerInt("max.connections.per.ip")
+}
+
+// resolveConnectionOverrides maps the hosts of the overrides to their IP
+// addresses, hosts that do not resolve are skipped
+func (srv *Server) resolveConnectionOverrides(value string) map[string]int64 {
+	resolved := make(map[string]int64)
+	overrides, err := configs.ParseConnectionOverrides(value)
+	if err != nil {
+		srv.log.Warn("Ignoring invalid connection overrides", "error", err)
+		return resolved
+	}
+	for host, limit := range overrides {
+		if ip := net.ParseIP(host); ip != nil {
+			resolved[ip.String()] = int64(limit)
+			continue
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			srv.log.Warn("Failed to resolve a host of max.connections.per.ip.overrides", "host", host, "error", err)
+			continue
+		}
+		for _, addr := range addrs {
+			resolved[net.ParseIP(addr).String()] = int64(limit)
+		}
+	}
+	return resolved
+}
+
+func connectionIP(conn net.Conn) string {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// idleConn sets a deadline before every read and write, so a connection that
+// neither sends nor receives anything for connections.max.idle.ms fails with
+// os.ErrDeadlineExceeded. Reads fail right away once ctx is done.
+type idleConn struct {
+	net.Conn
+	ctx  context.Context
+	idle time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.idle))
+	// Checked after the deadline is set, so the one set when ctx is done is
+	// not overwritten unnoticed
+	if c.ctx.Err() != nil {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.idle))
+	return c.Conn.Write(b)
+}
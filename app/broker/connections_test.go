@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectClosed fails unless the broker closes conn within timeout
+func expectClosed(t *testing.T, conn net.Conn, timeout time.Duration) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	t.Parallel()
+	server := startServerWith(t, func(config *Config) {
+		config.Configs = map[string]string{"max.connections.per.ip": "1"}
+	})
+
+	first, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer first.Close()
+	second, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer second.Close()
+	expectClosed(t, second, time.Second)
+
+	var metrics strings.Builder
+	server.metrics.registry.WriteTo(&metrics)
+	rejected := `kafka_server_socket_server_metrics_connection_rejected_total{listener="PLAINTEXT",reason="max.connections.per.ip"} 1`
+	if !strings.Contains(metrics.String(), rejected) {
+		t.Errorf("Expected the refused connection to be counted, got\n%s", metrics.String())
+	}
+
+	// The slot is given back once the first connection is closed
+	first.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		third, err := net.Dial("tcp", server.Addr())
+		if err != nil {
+			t.Fatalf("Failed to connect to server: %v", err)
+		}
+		third.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err = third.Read(make([]byte, 1))
+		third.Close()
+		if err != io.EOF {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a new connection to be served once the first one closed")
+		}
+	}
+}
+
+func TestMaxConnectionsPerIPOverrides(t *testing.T) {
+	t.Parallel()
+	server := startServerWith(t, func(config *Config) {
+		config.Configs = map[string]string{"max.connections.per.ip": "0", "max.connections.per.ip.overrides": "localhost:1"}
+	})
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err == io.EOF {
+		t.Error("Expected localhost to be allowed a connection by its override")
+	}
+}
+
+func TestIdleConnectionsAreClosed(t *testing.T) {
+	t.Parallel()
+	server := startServerWith(t, func(config *Config) { config.ConnectionsMaxIdleMs = 100 })
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	expectClosed(t, conn, 2*time.Second)
+}
@@ -0,0 +1,83 @@
+package broker
+
+const (
+	ProduceAPIKEY                 = 0
+	FetchAPIKEY                   = 1
+	MetadataAPIKEY                = 3
+	OffsetCommitAPIKEY            = 8
+	OffsetFetchAPIKEY             = 9
+	FindCoordinatorAPIKEY         = 10
+	JoinGroupAPIKEY               = 11
+	HeartbeatAPIKEY               = 12
+	LeaveGroupAPIKEY              = 13
+	SyncGroupAPIKEY               = 14
+	DescribeGroupsAPIKEY          = 15
+	ListGroupsAPIKEY              = 16
+	SaslHandshakeAPIKEY           = 17
+	ApiVersionAPIKEY              = 18
+	CreateTopicsAPIKEY            = 19
+	DeleteTopicsAPIKEY            = 20
+	InitProducerIdAPIKEY          = 22
+	AddPartitionsToTxnAPIKEY      = 24
+	AddOffsetsToTxnAPIKEY         = 25
+	EndTxnAPIKEY                  = 26
+	WriteTxnMarkersAPIKEY         = 27
+	TxnOffsetCommitAPIKEY         = 28
+	DescribeAclsAPIKEY            = 29
+	CreateAclsAPIKEY              = 30
+	DeleteAclsAPIKEY              = 31
+	DescribeConfigsAPIKEY         = 32
+	AlterConfigsAPIKEY            = 33
+	SaslAuthenticateAPIKEY        = 36
+	CreatePartitionsAPIKEY        = 37
+	DeleteGroupsAPIKEY            = 42
+	IncrementalAlterConfigsAPIKEY = 44
+	DescribeClientQuotasAPIKEY    = 48
+	AlterClientQuotasAPIKEY       = 49
+	ConsumerGroupHeartbeatAPIKEY  = 68
+	ConsumerGroupDescribeAPIKEY   = 69
+	DescribeTopicPartitionsAPIKEY = 75
+)
+
+const (
+	// The metadata log, relative to metadata.log.dir
+	MetadataLogFile = "__cluster_metadata-0/00000000000000000000.log"
+
+	// Advertised by listeners bound to every interface
+	AdvertisedHost = "localhost"
+
+	// Port of the default PLAINTEXT listener, or SASL_PLAINTEXT once SASL
+	// credentials exist
+	DefaultListenerPort = 9092
+
+	// Producer ids are taken from the metadata log in blocks of this size, like
+	// the controller hands them out in Kafka
+	ProducerIdBlockSize = 1000
+
+	// user=password lines for SASL, relative to log.dirs, more users can come
+	// from the metadata log
+	SaslCredentialsFile = "sasl_credentials"
+
+	// The default SSL listener is only started when the certificate exists,
+	// client certificates are verified against the CA when it exists. The files
+	// are relative to log.dirs.
+	SslListenerPort       = 9093
+	SslCertFile           = "ssl/server.pem"
+	SslKeyFile            = "ssl/server.key"
+	SslCAFile             = "ssl/ca.pem"
+	SslHandshakeTimeoutMs = 10000
+
+	// CreateTopics and CreatePartitions refuse topics of more partitions than
+	// this, every partition is a directory created while the metadata lock is
+	// held
+	MaxTopicPartitions = 10000
+
+	// How long a shutdown waits for the open connections to answer the
+	// requests they are handling
+	ShutdownTimeoutMs = 30000
+
+	// Same as Kafka's quota.window.num and quota.window.size.seconds defaults,
+	// rates are measured over QuotaWindowNum samples of QuotaWindowSizeMs
+	QuotaWindowNum    = 11
+	QuotaWindowSizeMs = 1000
+)
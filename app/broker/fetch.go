@@ -0,0 +1,203 @@
+package broker
+
+import (
+	"errors"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+
+	"github.com/google/uuid"
+)
+
+// Values of the isolation_level field of Fetch
+const (
+	IsolationReadUncommitted = 0
+	IsolationReadCommitted   = 1
+)
+
+// handleFetchRequest reads the requested partitions. Unless min_bytes are
+// available right away, the request waits in the fetch purgatory for appends
+// to them, up to max_wait_ms. Fetch sessions are not supported, every request
+// is a full fetch answered with session id 0.
+func (srv *Server) handleFetchRequest(req *request) (*pendingResponse, error) {
+	fetch, err := deserializeFetchRequest(req.buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response, partitions, ready := srv.fetchOnce(fetch, req.session)
+	if ready || fetch.MaxWaitMs <= 0 {
+		return srv.answerFetch(req, fetch, response), nil
+	}
+	delayed := &delayedFetch{srv: srv, req: req, fetch: fetch, parkedAt: time.Now()}
+	srv.fetchPurgatory.TryCompleteElseWatch(delayed, time.Duration(fetch.MaxWaitMs)*time.Millisecond, partitions...)
+	return parked, nil
+}
+
+func (srv *Server) answerFetch(req *request, fetch *FetchRequest, response *FetchResponse) *pendingResponse {
+	srv.recordBytesOut(fetch, response)
+	req.session.throttleFetch(req.dequeued, response)
+	return &pendingResponse{bytes: serializeFetchResponse(response), answered: response}
+}
+
+// delayedFetch is a Fetch waiting for min_bytes, like Kafka's DelayedFetch.
+// Its partitions are read again once it completes.
+type delayedFetch struct {
+	srv      *Server
+	req      *request
+	fetch    *FetchRequest
+	parkedAt time.Time
+}
+
+// TryComplete adds up the bytes available in the partitions without reading
+// them. A partition that cannot be read anymore completes the fetch, the
+// error is answered.
+func (f *delayedFetch) TryComplete() bool {
+	readCommitted := f.fetch.IsolationLevel == IsolationReadCommitted
+	var accumulated int64
+	for _, topic := range f.fetch.Topics {
+		name, partitionCount, code := f.srv.resolveFetchTopic(f.fetch.RequestAPIVersion, topic)
+		if code != ErrorCodeNone {
+			return true
+		}
+		for _, partition := range topic.Partitions {
+			if partition.Partition >= partitionCount {
+				return true
+			}
+			log, err := f.srv.partitionLogs.get(name, partition.Partition)
+			if err != nil {
+				return true
+			}
+			available, err := log.Available(partition.FetchOffset, readCommitted)
+			if err != nil {
+				return true
+			}
+			accumulated += min(available, int64(partition.PartitionMaxBytes))
+		}
+	}
+	return accumulated >= int64(f.fetch.MinBytes)
+}
+
+func (f *delayedFetch) OnComplete(expired bool) {
+	response, _, _ := f.srv.fetchOnce(f.fetch, f.req.session)
+	// Waiting for data is not handling time
+	f.req.session.delayed += time.Since(f.parkedAt)
+	f.srv.completeDelayed(f.req, f.parkedAt, f.srv.answerFetch(f.req, f.fetch, response))
+}
+
+// fetchOnce reads every requested partition once. It also returns the
+// partitions it read, and whether the response can be sent without waiting
+// for more.
+func (srv *Server) fetchOnce(req *FetchRequest, session *clientSession) (*FetchResponse, []topicPartition, bool) {
+	response := &FetchResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+		SessionID:     0,
+	}
+
+	var partitions []topicPartition
+	ready := false
+	remaining := req.MaxBytes
+	for _, topic := range req.Topics {
+		name, partitionCount, code := srv.resolveFetchTopic(req.RequestAPIVersion, topic)
+		if code == ErrorCodeNone && !session.authorizeTopic(authorizer.Read, name) {
+			code = ErrorCodeTopicAuthorizationFailed
+		}
+		topicResponse := FetchResponseTopic{Topic: topic.Topic, TopicID: topic.TopicID}
+
+		for _, partition := range topic.Partitions {
+			partitionResponse := FetchResponsePartition{
+				PartitionIndex:       partition.Partition,
+				ErrorCode:            code,
+				HighWatermark:        -1,
+				LastStableOffset:     -1,
+				LogStartOffset:       -1,
+				PreferredReadReplica: -1,
+			}
+			if code == ErrorCodeNone && (partition.Partition < 0 || partition.Partition >= partitionCount) {
+				partitionResponse.ErrorCode = ErrorCodeUnknownTopic
+			}
+			if partitionResponse.ErrorCode == ErrorCodeNone {
+				remaining = srv.fetchPartition(req, name, partition, remaining, &partitionResponse)
+				partitions = append(partitions, topicPartition{topic: name, partition: partition.Partition})
+			}
+			// Errors are answered right away
+			if partitionResponse.ErrorCode != ErrorCodeNone {
+				ready = true
+			}
+			topicResponse.Partitions = append(topicResponse.Partitions, partitionResponse)
+		}
+		response.Responses = append(response.Responses, topicResponse)
+	}
+
+	if req.MaxBytes-remaining >= req.MinBytes {
+		ready = true
+	}
+	return response, partitions, ready
+}
+
+// resolveFetchTopic finds the name and partition count of a fetched topic,
+// named up to v12 and identified by id from v13
+func (srv *Server) resolveFetchTopic(version int, topic FetchRequestTopic) (string, int32, int16) {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	if version >= 13 {
+		found := srv.topics.topicById(uuid.UUID(topic.TopicID))
+		if found == nil {
+			return "", 0, ErrorCodeUnknownTopicID
+		}
+		return found.TopicName, srv.topicPartitionCount(found.TopicName), ErrorCodeNone
+	}
+
+	partitionCount := srv.topicPartitionCount(topic.Topic)
+	if partitionCount == 0 {
+		return "", 0, ErrorCodeUnknownTopic
+	}
+	return topic.Topic, partitionCount, ErrorCodeNone
+}
+
+// fetchPartition fills in the response of a single partition and returns the
+// bytes left for the rest of the response
+func (srv *Server) fetchPartition(req *FetchRequest, topic string, partition FetchRequestPartition, remaining int32, response *FetchResponsePartition) int32 {
+	log, err := srv.partitionLogs.get(topic, partition.Partition)
+	if err != nil {
+		srv.log.Error("Failed to open a partition log", "topic", topic, "partition", partition.Partition, "error", err)
+		response.ErrorCode = ErrorCodeKafkaStorageError
+		return remaining
+	}
+
+	maxBytes := min(partition.PartitionMaxBytes, remaining)
+	readCommitted := req.IsolationLevel == IsolationReadCommitted
+	data, err := log.Read(partition.FetchOffset, max(maxBytes, 1), readCommitted)
+	response.HighWatermark = data.HighWatermark
+	response.LastStableOffset = data.LastStableOffset
+	response.LogStartOffset = data.LogStartOffset
+	switch {
+	case errors.Is(err, file_metadata.ErrOffsetOutOfRange):
+		response.ErrorCode = ErrorCodeOffsetOutOfRange
+		return remaining
+	case err != nil:
+		srv.log.Error("Failed to read a partition log", "topic", topic, "partition", partition.Partition, "error", err)
+		response.ErrorCode = ErrorCodeKafkaStorageError
+		return remaining
+	}
+
+	// Past the response limit only the offsets are reported
+	if maxBytes <= 0 && remaining < req.MaxBytes {
+		data.Records = nil
+	}
+	response.Records = data.Records
+	if response.Records == nil {
+		response.Records = []byte{}
+	}
+	if readCommitted {
+		response.AbortedTransactions = []FetchAbortedTransaction{}
+		for _, aborted := range data.Aborted {
+			response.AbortedTransactions = append(response.AbortedTransactions, FetchAbortedTransaction{ProducerID: aborted.ProducerID, FirstOffset: aborted.FirstOffset})
+		}
+	}
+	return remaining - int32(len(response.Records))
+}
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"net"
+	"testing"
+	"time"
+	"toy_kafka/app/file_metadata"
+)
+
+// fetchRequest is a Fetch v12 of the first partition of __consumer_offsets
+// from offset 0, waiting up to maxWaitMs for a byte
+func fetchRequest(correlationID int32, maxWaitMs int32) []byte {
+	var body []byte
+	body = append(body, int16ToBytes(FetchAPIKEY)...)
+	body = append(body, int16ToBytes(12)...)
+	body = append(body, int32ToBytes(correlationID)...)
+	body = append(body, 0x00, 0x03, 'c', 'l', 'i', 0x00)
+	body = append(body, int32ToBytes(-1)...) // replica id
+	body = append(body, int32ToBytes(maxWaitMs)...)
+	body = append(body, int32ToBytes(1)...)     // min bytes
+	body = append(body, int32ToBytes(1<<20)...) // max bytes
+	body = append(body, 0x00)                   // isolation level
+	body = append(body, int32ToBytes(0)...)     // session id
+	body = append(body, int32ToBytes(-1)...)    // session epoch
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, compactStringToBytes("__consumer_offsets")...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, int32ToBytes(0)...)     // partition
+	body = append(body, int32ToBytes(-1)...)    // current leader epoch
+	body = append(body, int64ToBytes(0)...)     // fetch offset
+	body = append(body, int32ToBytes(-1)...)    // last fetched epoch
+	body = append(body, int64ToBytes(-1)...)    // log start offset
+	body = append(body, int32ToBytes(1<<20)...) // partition max bytes
+	body = append(body, 0x00, 0x00)             // partition and topic tag buffers
+	body = append(body, compactArrayLengthToBytes(0)...)
+	body = append(body, compactStringToBytes("")...)
+	body = append(body, 0x00)
+	return append(int32ToBytes(int32(len(body))), body...)
+}
+
+func TestDelayedFetch(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Nothing arrives, the fetch is answered once max_wait_ms passed
+	sent := time.Now()
+	if _, err := conn.Write(fetchRequest(1, 100)); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	if _, err := readRequest(conn, 1<<20); err != nil {
+		t.Fatalf("Failed to read from server: %v", err)
+	}
+	if waited := time.Since(sent); waited < 100*time.Millisecond {
+		t.Errorf("Expected the fetch to wait for max_wait_ms, answered after %v", waited)
+	}
+
+	// An append answers the fetch before max_wait_ms
+	sent = time.Now()
+	if _, err := conn.Write(fetchRequest(2, 4000)); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	for server.fetchPurgatory.Delayed() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	log, err := server.partitionLogs.get("__consumer_offsets", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the partition log: %v", err)
+	}
+	if _, err := log.AppendBatch(file_metadata.EncodeRecordBatch(0, time.Now().UnixMilli(), [][]byte{[]byte("value")})); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	response, err := readRequest(conn, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to read from server: %v", err)
+	}
+	if waited := time.Since(sent); waited >= 4*time.Second {
+		t.Errorf("Expected the append to answer the fetch, answered after %v", waited)
+	}
+	if correlationID := bytesToInt32(response, 4, 8); correlationID != 2 {
+		t.Errorf("Expected the response to 2, got %d", correlationID)
+	}
+	if delayed := server.fetchPurgatory.Delayed(); delayed != 0 {
+		t.Errorf("Expected no fetch left in the purgatory, got %d", delayed)
+	}
+}
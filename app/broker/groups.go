@@ -0,0 +1,620 @@
+package broker
+
+import (
+	"math"
+	"net"
+	"slices"
+	"sort"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/group_coordinator"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CoordinatorKeyTypeGroup       = 0
+	CoordinatorKeyTypeTransaction = 1
+)
+
+// handleFindCoordinatorRequest needs DESCRIBE on each group or transactional id
+func (srv *Server) handleFindCoordinatorRequest(buff []byte, session *clientSession) (*FindCoordinatorResponse, error) {
+	req, err := deserializeFindCoordinatorRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &FindCoordinatorResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+	}
+
+	// This broker is the only one, so it coordinates every group and
+	// transaction at the address of the request's listener
+	for _, key := range req.Keys {
+		coordinator := Coordinator{Key: key, NodeID: -1, Host: "", Port: -1}
+		switch {
+		case req.KeyType == CoordinatorKeyTypeGroup && !session.authorizeGroup(authorizer.Describe, key):
+			coordinator.ErrorCode = ErrorCodeGroupAuthorizationFailed
+		case req.KeyType == CoordinatorKeyTypeTransaction && !session.authorizeTransactionalID(authorizer.Describe, key):
+			coordinator.ErrorCode = ErrorCodeTransactionalIDAuthorizationFailed
+		case req.KeyType == CoordinatorKeyTypeGroup, req.KeyType == CoordinatorKeyTypeTransaction:
+			coordinator.NodeID = srv.config.NodeID
+			coordinator.Host = session.listener.AdvertisedHost
+			coordinator.Port = int32(session.listener.AdvertisedPort)
+		default:
+			coordinator.ErrorCode = ErrorCodeInvalidRequest
+			coordinator.ErrorMessage = "Unknown coordinator key type."
+		}
+		response.Coordinators = append(response.Coordinators, coordinator)
+	}
+
+	return response, nil
+}
+
+// handleJoinGroupRequest calls respond once the group finished the join phase
+// the member takes part in, which may be after it returned. Group membership
+// needs READ on the group.
+func (srv *Server) handleJoinGroupRequest(buff []byte, session *clientSession, remoteAddr net.Addr, respond func(*JoinGroupResponse)) error {
+	req, err := deserializeJoinGroupRequest(buff)
+	if err != nil {
+		return err
+	}
+
+	if !session.authorizeGroup(authorizer.Read, req.GroupID) {
+		respond(&JoinGroupResponse{
+			CorrelationID: req.CorrelationID,
+			APIVersion:    req.RequestAPIVersion,
+			ErrorCode:     ErrorCodeGroupAuthorizationFailed,
+			GenerationID:  -1,
+			MemberID:      req.MemberID,
+		})
+		return nil
+	}
+
+	protocols := make([]group_coordinator.Protocol, 0, len(req.Protocols))
+	for _, protocol := range req.Protocols {
+		protocols = append(protocols, group_coordinator.Protocol{Name: protocol.Name, Metadata: protocol.Metadata})
+	}
+
+	joinRequest := group_coordinator.JoinGroupRequest{
+		GroupID:          req.GroupID,
+		MemberID:         req.MemberID,
+		GroupInstanceID:  req.GroupInstanceID,
+		ClientID:         req.ClientID,
+		ClientHost:       clientHostOf(remoteAddr),
+		SessionTimeout:   time.Duration(req.SessionTimeoutMs) * time.Millisecond,
+		RebalanceTimeout: time.Duration(req.RebalanceTimeoutMs) * time.Millisecond,
+		ProtocolType:     req.ProtocolType,
+		Protocols:        protocols,
+	}
+	srv.groupCoordinator.HandleJoinGroup(joinRequest, func(result group_coordinator.JoinGroupResult) {
+		response := &JoinGroupResponse{
+			CorrelationID: req.CorrelationID,
+			APIVersion:    req.RequestAPIVersion,
+			ThrottleTime:  0,
+			ErrorCode:     result.ErrorCode,
+			GenerationID:  result.GenerationID,
+			ProtocolType:  result.ProtocolType,
+			ProtocolName:  result.ProtocolName,
+			Leader:        result.LeaderID,
+			MemberID:      result.MemberID,
+		}
+		for _, member := range result.Members {
+			response.Members = append(response.Members, JoinGroupResponseMember{
+				MemberID:        member.MemberID,
+				GroupInstanceID: member.GroupInstanceID,
+				Metadata:        member.Metadata,
+			})
+		}
+		respond(response)
+	})
+
+	return nil
+}
+
+// handleSyncGroupRequest answers followers through respond once the leader
+// sent the assignment
+func (srv *Server) handleSyncGroupRequest(buff []byte, session *clientSession, respond func(*SyncGroupResponse)) error {
+	req, err := deserializeSyncGroupRequest(buff)
+	if err != nil {
+		return err
+	}
+
+	if !session.authorizeGroup(authorizer.Read, req.GroupID) {
+		respond(&SyncGroupResponse{
+			CorrelationID: req.CorrelationID,
+			APIVersion:    req.RequestAPIVersion,
+			ErrorCode:     ErrorCodeGroupAuthorizationFailed,
+			Assignment:    []byte{},
+		})
+		return nil
+	}
+
+	assignments := make([]group_coordinator.SyncGroupAssignment, 0, len(req.Assignments))
+	for _, assignment := range req.Assignments {
+		assignments = append(assignments, group_coordinator.SyncGroupAssignment{MemberID: assignment.MemberID, Assignment: assignment.Assignment})
+	}
+
+	syncRequest := group_coordinator.SyncGroupRequest{
+		GroupID:         req.GroupID,
+		GenerationID:    req.GenerationID,
+		MemberID:        req.MemberID,
+		GroupInstanceID: req.GroupInstanceID,
+		ProtocolType:    req.ProtocolType,
+		ProtocolName:    req.ProtocolName,
+		Assignments:     assignments,
+	}
+	srv.groupCoordinator.HandleSyncGroup(syncRequest, func(result group_coordinator.SyncGroupResult) {
+		respond(&SyncGroupResponse{
+			CorrelationID: req.CorrelationID,
+			APIVersion:    req.RequestAPIVersion,
+			ThrottleTime:  0,
+			ErrorCode:     result.ErrorCode,
+			ProtocolType:  result.ProtocolType,
+			ProtocolName:  result.ProtocolName,
+			Assignment:    result.Assignment,
+		})
+	})
+
+	return nil
+}
+
+func (srv *Server) handleHeartbeatRequest(buff []byte, session *clientSession) (*HeartbeatResponse, error) {
+	req, err := deserializeHeartbeatRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	errorCode := int16(ErrorCodeGroupAuthorizationFailed)
+	if session.authorizeGroup(authorizer.Read, req.GroupID) {
+		errorCode = srv.groupCoordinator.Heartbeat(group_coordinator.HeartbeatRequest{
+			GroupID:         req.GroupID,
+			GenerationID:    req.GenerationID,
+			MemberID:        req.MemberID,
+			GroupInstanceID: req.GroupInstanceID,
+		})
+	}
+
+	return &HeartbeatResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     errorCode,
+	}, nil
+}
+
+func (srv *Server) handleLeaveGroupRequest(buff []byte, session *clientSession) (*LeaveGroupResponse, error) {
+	req, err := deserializeLeaveGroupRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.authorizeGroup(authorizer.Read, req.GroupID) {
+		return &LeaveGroupResponse{CorrelationID: req.CorrelationID, ErrorCode: ErrorCodeGroupAuthorizationFailed}, nil
+	}
+
+	leaving := make([]group_coordinator.LeaveGroupMember, 0, len(req.Members))
+	for _, member := range req.Members {
+		leaving = append(leaving, group_coordinator.LeaveGroupMember{MemberID: member.MemberID, GroupInstanceID: member.GroupInstanceID})
+	}
+	codes := srv.groupCoordinator.LeaveGroup(req.GroupID, leaving)
+
+	response := &LeaveGroupResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+	}
+	for i, member := range req.Members {
+		response.Members = append(response.Members, LeaveGroupResponseMember{
+			MemberID:        member.MemberID,
+			GroupInstanceID: member.GroupInstanceID,
+			ErrorCode:       codes[i],
+		})
+	}
+
+	return response, nil
+}
+
+// handleOffsetCommitRequest needs READ on the group and on each topic
+func (srv *Server) handleOffsetCommitRequest(buff []byte, session *clientSession) (*OffsetCommitResponse, error) {
+	req, err := deserializeOffsetCommitRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &OffsetCommitResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	groupAuthorized := session.authorizeGroup(authorizer.Read, req.GroupID)
+
+	// Offsets of partitions that do not exist are rejected before they reach the coordinator
+	var commits []group_coordinator.OffsetCommit
+	srv.metadataLock.RLock()
+	for _, topic := range req.Topics {
+		result := OffsetCommitResponseTopic{Name: topic.Name}
+		topicAuthorized := session.authorizeTopic(authorizer.Read, topic.Name)
+		partitionCount := srv.topicPartitionCount(topic.Name)
+		for _, partition := range topic.Partitions {
+			errorCode := int16(ErrorCodeNone)
+			switch {
+			case !groupAuthorized:
+				errorCode = ErrorCodeGroupAuthorizationFailed
+			case !topicAuthorized:
+				errorCode = ErrorCodeTopicAuthorizationFailed
+			case partition.PartitionIndex < 0 || partition.PartitionIndex >= partitionCount:
+				errorCode = ErrorCodeUnknownTopic
+			default:
+				commits = append(commits, group_coordinator.OffsetCommit{
+					TopicPartition: group_coordinator.TopicPartition{Topic: topic.Name, Partition: partition.PartitionIndex},
+					OffsetAndMetadata: group_coordinator.OffsetAndMetadata{
+						Offset:      partition.CommittedOffset,
+						LeaderEpoch: partition.CommittedLeaderEpoch,
+						Metadata:    partition.CommittedMetadata,
+					},
+				})
+			}
+			result.Partitions = append(result.Partitions, OffsetCommitResponsePartition{PartitionIndex: partition.PartitionIndex, ErrorCode: errorCode})
+		}
+		response.Topics = append(response.Topics, result)
+	}
+	srv.metadataLock.RUnlock()
+	if !groupAuthorized {
+		return response, nil
+	}
+
+	codes := srv.groupCoordinator.CommitOffsets(group_coordinator.CommitOffsetsRequest{
+		GroupID:         req.GroupID,
+		GenerationID:    req.GenerationID,
+		MemberID:        req.MemberID,
+		GroupInstanceID: req.GroupInstanceID,
+		Offsets:         commits,
+	})
+
+	// The coordinator answers the remaining partitions in request order
+	next := 0
+	for i := range response.Topics {
+		for j := range response.Topics[i].Partitions {
+			if response.Topics[i].Partitions[j].ErrorCode == ErrorCodeNone {
+				response.Topics[i].Partitions[j].ErrorCode = codes[next]
+				next++
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// handleOffsetFetchRequest needs READ on each group. Partitions of topics
+// without DESCRIBE are answered with an error, or left out when every
+// committed offset is fetched.
+func (srv *Server) handleOffsetFetchRequest(buff []byte, session *clientSession) (*OffsetFetchResponse, error) {
+	req, err := deserializeOffsetFetchRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &OffsetFetchResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	for _, group := range req.Groups {
+		result := OffsetFetchResponseGroup{GroupID: group.GroupID, ErrorCode: ErrorCodeNone}
+		if !session.authorizeGroup(authorizer.Read, group.GroupID) {
+			result.ErrorCode = ErrorCodeGroupAuthorizationFailed
+			response.Groups = append(response.Groups, result)
+			continue
+		}
+		if code := srv.groupCoordinator.ValidateOffsetFetch(group.GroupID, group.MemberID, group.MemberEpoch); code != ErrorCodeNone {
+			result.ErrorCode = code
+			response.Groups = append(response.Groups, result)
+			continue
+		}
+		committed := srv.groupCoordinator.FetchOffsets(group.GroupID)
+
+		topics := group.Topics
+		if topics == nil {
+			topics = slices.DeleteFunc(committedTopics(committed), func(topic OffsetFetchRequestTopic) bool {
+				return !session.authorizeTopic(authorizer.Describe, topic.Name)
+			})
+		}
+
+		for _, topic := range topics {
+			topicResult := OffsetFetchResponseTopic{Name: topic.Name}
+			topicAuthorized := session.authorizeTopic(authorizer.Describe, topic.Name)
+			for _, partitionIndex := range topic.PartitionIndexes {
+				partition := OffsetFetchResponsePartition{PartitionIndex: partitionIndex, CommittedOffset: -1, CommittedLeaderEpoch: -1}
+				if !topicAuthorized {
+					partition.ErrorCode = ErrorCodeTopicAuthorizationFailed
+					topicResult.Partitions = append(topicResult.Partitions, partition)
+					continue
+				}
+				tp := group_coordinator.TopicPartition{Topic: topic.Name, Partition: partitionIndex}
+				if offset, ok := committed[tp]; ok {
+					partition.CommittedOffset = offset.Offset
+					partition.CommittedLeaderEpoch = offset.LeaderEpoch
+					partition.Metadata = offset.Metadata
+				}
+				// A transaction still holds a newer offset for the partition
+				if req.RequireStable && srv.groupCoordinator.HasPendingOffset(group.GroupID, tp) {
+					partition.ErrorCode = ErrorCodeUnstableOffsetCommit
+				}
+				topicResult.Partitions = append(topicResult.Partitions, partition)
+			}
+			result.Topics = append(result.Topics, topicResult)
+		}
+		response.Groups = append(response.Groups, result)
+	}
+
+	return response, nil
+}
+
+// committedTopics lists every partition with a committed offset, sorted by
+// topic and partition, for fetches that do not name any topics
+func committedTopics(committed map[group_coordinator.TopicPartition]group_coordinator.OffsetAndMetadata) []OffsetFetchRequestTopic {
+	partitions := make(map[string][]int32)
+	for tp := range committed {
+		partitions[tp.Topic] = append(partitions[tp.Topic], tp.Partition)
+	}
+
+	var topics []OffsetFetchRequestTopic
+	for name, indexes := range partitions {
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+		topics = append(topics, OffsetFetchRequestTopic{Name: name, PartitionIndexes: indexes})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+// clientHostOf formats a client address the way Kafka reports it, "/<ip>"
+func clientHostOf(remoteAddr net.Addr) string {
+	clientHost := remoteAddr.String()
+	if host, _, err := net.SplitHostPort(clientHost); err == nil {
+		clientHost = "/" + host
+	}
+	return clientHost
+}
+
+func (srv *Server) handleConsumerGroupHeartbeatRequest(buff []byte, session *clientSession, remoteAddr net.Addr) (*ConsumerGroupHeartbeatResponse, error) {
+	req, err := deserializeConsumerGroupHeartbeatRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.authorizeGroup(authorizer.Read, req.GroupID) {
+		return &ConsumerGroupHeartbeatResponse{
+			CorrelationID: req.CorrelationID,
+			ErrorCode:     ErrorCodeGroupAuthorizationFailed,
+			MemberID:      req.MemberID,
+			MemberEpoch:   req.MemberEpoch,
+		}, nil
+	}
+
+	heartbeat := group_coordinator.ConsumerGroupHeartbeatRequest{
+		GroupID:              req.GroupID,
+		MemberID:             req.MemberID,
+		MemberEpoch:          req.MemberEpoch,
+		InstanceID:           req.InstanceID,
+		RackID:               req.RackID,
+		ClientID:             req.ClientID,
+		ClientHost:           clientHostOf(remoteAddr),
+		SubscribedTopicNames: req.SubscribedTopicNames,
+	}
+	if req.RebalanceTimeoutMs > 0 {
+		heartbeat.RebalanceTimeout = time.Duration(req.RebalanceTimeoutMs) * time.Millisecond
+	}
+	if req.SubscribedTopicRegexOK {
+		heartbeat.SubscribedTopicRegex = &req.SubscribedTopicRegex
+	}
+	if req.ServerAssignorOK {
+		heartbeat.ServerAssignor = &req.ServerAssignor
+	}
+	if req.TopicPartitions != nil {
+		heartbeat.OwnedPartitions = group_coordinator.Assignment{}
+		for _, topic := range req.TopicPartitions {
+			heartbeat.OwnedPartitions[uuid.UUID(topic.TopicID)] = topic.Partitions
+		}
+	}
+
+	result := srv.groupCoordinator.ConsumerGroupHeartbeat(heartbeat)
+
+	response := &ConsumerGroupHeartbeatResponse{
+		CorrelationID:       req.CorrelationID,
+		ThrottleTime:        0,
+		ErrorCode:           result.ErrorCode,
+		ErrorMessage:        result.ErrorMessage,
+		MemberID:            result.MemberID,
+		MemberEpoch:         result.MemberEpoch,
+		HeartbeatIntervalMs: int32(result.HeartbeatInterval / time.Millisecond),
+	}
+	if result.Assignment != nil {
+		response.Assignment = []ConsumerGroupHeartbeatTopicPartitions{}
+		for _, id := range sortedTopicIDs(result.Assignment) {
+			response.Assignment = append(response.Assignment, ConsumerGroupHeartbeatTopicPartitions{
+				TopicID:    id,
+				Partitions: result.Assignment[id],
+			})
+		}
+	}
+
+	return response, nil
+}
+
+func (srv *Server) handleConsumerGroupDescribeRequest(buff []byte, session *clientSession) (*ConsumerGroupDescribeResponse, error) {
+	req, err := deserializeConsumerGroupDescribeRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ConsumerGroupDescribeResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+	}
+
+	topicNames := make(map[uuid.UUID]string)
+	for _, topic := range srv.consumerGroupTopics() {
+		topicNames[topic.ID] = topic.Name
+	}
+	describeAssignment := func(assignment group_coordinator.Assignment) []ConsumerGroupDescribeTopicPartitions {
+		var topics []ConsumerGroupDescribeTopicPartitions
+		for _, id := range sortedTopicIDs(assignment) {
+			topics = append(topics, ConsumerGroupDescribeTopicPartitions{
+				TopicID:    id,
+				TopicName:  topicNames[id],
+				Partitions: assignment[id],
+			})
+		}
+		return topics
+	}
+
+	for _, groupID := range req.GroupIDs {
+		if !session.authorizeGroup(authorizer.Describe, groupID) {
+			response.Groups = append(response.Groups, ConsumerGroupDescribeGroup{GroupID: groupID, ErrorCode: ErrorCodeGroupAuthorizationFailed, AuthorizedOperations: math.MinInt32})
+			continue
+		}
+		description := srv.groupCoordinator.DescribeConsumerGroups([]string{groupID})[0]
+		group := ConsumerGroupDescribeGroup{
+			ErrorCode:            description.ErrorCode,
+			ErrorMessage:         description.ErrorMessage,
+			GroupID:              description.GroupID,
+			GroupState:           description.State,
+			GroupEpoch:           description.Epoch,
+			AssignmentEpoch:      description.AssignmentEpoch,
+			AssignorName:         description.AssignorName,
+			AuthorizedOperations: math.MinInt32,
+		}
+		for _, member := range description.Members {
+			group.Members = append(group.Members, ConsumerGroupDescribeMember{
+				MemberID:             member.MemberID,
+				InstanceID:           member.InstanceID,
+				RackID:               member.RackID,
+				MemberEpoch:          member.MemberEpoch,
+				ClientID:             member.ClientID,
+				ClientHost:           member.ClientHost,
+				SubscribedTopicNames: member.SubscribedTopicNames,
+				SubscribedTopicRegex: member.SubscribedTopicRegex,
+				Assignment:           describeAssignment(member.Assignment),
+				TargetAssignment:     describeAssignment(member.TargetAssignment),
+			})
+		}
+		response.Groups = append(response.Groups, group)
+	}
+
+	return response, nil
+}
+
+// sortedTopicIDs orders the topics of an assignment so responses are stable
+func sortedTopicIDs(assignment group_coordinator.Assignment) [][16]byte {
+	ids := make([][16]byte, 0, len(assignment))
+	for id := range assignment {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return string(ids[i][:]) < string(ids[j][:]) })
+	return ids
+}
+
+// handleDescribeGroupsRequest needs DESCRIBE on each group
+func (srv *Server) handleDescribeGroupsRequest(buff []byte, session *clientSession) (*DescribeGroupsResponse, error) {
+	req, err := deserializeDescribeGroupsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DescribeGroupsResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+	}
+
+	for _, groupID := range req.Groups {
+		if !session.authorizeGroup(authorizer.Describe, groupID) {
+			response.Groups = append(response.Groups, DescribeGroupsResponseGroup{GroupID: groupID, ErrorCode: ErrorCodeGroupAuthorizationFailed, AuthorizedOperations: math.MinInt32})
+			continue
+		}
+		description := srv.groupCoordinator.DescribeGroups([]string{groupID})[0]
+		group := DescribeGroupsResponseGroup{
+			ErrorCode:            description.ErrorCode,
+			ErrorMessage:         description.ErrorMessage,
+			GroupID:              description.GroupID,
+			GroupState:           description.State,
+			ProtocolType:         description.ProtocolType,
+			ProtocolData:         description.Protocol,
+			AuthorizedOperations: math.MinInt32,
+		}
+		// Before v6 a missing group is only reported through its Dead state
+		if req.RequestAPIVersion < 6 && group.ErrorCode == ErrorCodeGroupIDNotFound {
+			group.ErrorCode = ErrorCodeNone
+		}
+		for _, member := range description.Members {
+			group.Members = append(group.Members, DescribeGroupsResponseMember{
+				MemberID:         member.MemberID,
+				GroupInstanceID:  member.GroupInstanceID,
+				ClientID:         member.ClientID,
+				ClientHost:       member.ClientHost,
+				MemberMetadata:   member.Metadata,
+				MemberAssignment: member.Assignment,
+			})
+		}
+		response.Groups = append(response.Groups, group)
+	}
+
+	return response, nil
+}
+
+// handleListGroupsRequest lists every group to principals allowed DESCRIBE on
+// the cluster, and the groups they may DESCRIBE to the others
+func (srv *Server) handleListGroupsRequest(buff []byte, session *clientSession) (*ListGroupsResponse, error) {
+	req, err := deserializeListGroupsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ListGroupsResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+	}
+
+	clusterDescribe := session.authorize(authorizer.Describe, authorizer.ResourceCluster, authorizer.ClusterResourceName)
+	for _, overview := range srv.groupCoordinator.ListGroups(req.StatesFilter, req.TypesFilter) {
+		if !clusterDescribe && !session.authorizeGroup(authorizer.Describe, overview.GroupID) {
+			continue
+		}
+		response.Groups = append(response.Groups, ListGroupsResponseGroup{
+			GroupID:      overview.GroupID,
+			ProtocolType: overview.ProtocolType,
+			GroupState:   overview.State,
+			GroupType:    overview.Type,
+		})
+	}
+
+	return response, nil
+}
+
+// handleDeleteGroupsRequest needs DELETE on each group
+func (srv *Server) handleDeleteGroupsRequest(buff []byte, session *clientSession) (*DeleteGroupsResponse, error) {
+	req, err := deserializeDeleteGroupsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DeleteGroupsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	for _, groupID := range req.GroupsNames {
+		code := int16(ErrorCodeGroupAuthorizationFailed)
+		if session.authorizeGroup(authorizer.Delete, groupID) {
+			code = srv.groupCoordinator.DeleteGroups([]string{groupID})[0]
+		}
+		response.Results = append(response.Results, DeleteGroupsResponseResult{GroupID: groupID, ErrorCode: code})
+	}
+
+	return response, nil
+}
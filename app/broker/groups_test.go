@@ -0,0 +1,209 @@
+package broker
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/group_coordinator"
+)
+
+// joinGroupRequest is a JoinGroup v6 of a dynamic member of group, with
+// memberID "" for its first join
+func joinGroupRequest(correlationID int32, group string, memberID string) []byte {
+	body := compactStringToBytes(group)
+	body = append(body, int32ToBytes(10000)...) // session timeout ms
+	body = append(body, int32ToBytes(10000)...) // rebalance timeout ms
+	body = append(body, compactStringToBytes(memberID)...)
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, compactStringToBytes("consumer")...)
+	body = append(body, compactArrayLengthToBytes(1)...)
+	body = append(body, compactStringToBytes("range")...)
+	body = append(body, compactBytesToBytes([]byte{})...)
+	body = append(body, 0x00, 0x00) // protocol and request tag buffers
+	return requestBytes(JoinGroupAPIKEY, 6, correlationID, body)
+}
+
+// syncGroupRequest is a SyncGroup v4 of generation 1, the leader hands an
+// assignment of its own member id to every member
+func syncGroupRequest(correlationID int32, group string, memberID string, assignTo []string) []byte {
+	body := compactStringToBytes(group)
+	body = append(body, int32ToBytes(1)...) // generation id
+	body = append(body, compactStringToBytes(memberID)...)
+	body = append(body, compactNullableStringToBytes("", true)...)
+	body = append(body, compactArrayLengthToBytes(len(assignTo))...)
+	for _, member := range assignTo {
+		body = append(body, compactStringToBytes(member)...)
+		body = append(body, compactBytesToBytes([]byte(member))...)
+		body = append(body, 0x00)
+	}
+	body = append(body, 0x00)
+	return requestBytes(SyncGroupAPIKEY, 4, correlationID, body)
+}
+
+// joined is the part of a JoinGroup v6 response the tests look at
+type joined struct {
+	errorCode    int16
+	generationID int32
+	leader       string
+	memberID     string
+	members      int
+}
+
+func readJoinGroupResponse(conn net.Conn) (joined, error) {
+	response, err := readRequest(conn, 1<<20)
+	if err != nil {
+		return joined{}, err
+	}
+	r := newByteReader(response[9:]) // size, correlation id and tag buffer
+	r.int32("throttle time ms")
+	result := joined{errorCode: r.int16("error code"), generationID: r.int32("generation id")}
+	r.compactString("protocol name")
+	result.leader = r.compactString("leader")
+	result.memberID = r.compactString("member id")
+	result.members = r.compactArrayLength("members array length")
+	return result, r.err
+}
+
+func readSyncGroupResponse(t *testing.T, conn net.Conn) (int16, string) {
+	t.Helper()
+	response, err := readRequest(conn, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to read the SyncGroup response: %v", err)
+	}
+	r := newByteReader(response[9:])
+	r.int32("throttle time ms")
+	errorCode := r.int16("error code")
+	return errorCode, string(r.compactBytes("assignment"))
+}
+
+// More members than handlers wait for the same rebalance, each one's
+// JoinGroup and SyncGroup are parked instead of holding a handler
+func TestRebalanceWithMoreMembersThanHandlers(t *testing.T) {
+	t.Parallel()
+	const handlers, members = 2, 5
+	server := startServerWith(t, func(config *Config) {
+		config.NumIoThreads = handlers
+	})
+	server.groupCoordinator.InitialRebalanceDelay = 200 * time.Millisecond
+
+	conns := make([]net.Conn, members)
+	memberIDs := make([]string, members)
+	for i := range conns {
+		conn, err := net.Dial("tcp", server.Addr())
+		if err != nil {
+			t.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		conns[i] = conn
+
+		if _, err := conn.Write(joinGroupRequest(1, "group", "")); err != nil {
+			t.Fatalf("Failed to write to server: %v", err)
+		}
+		result, err := readJoinGroupResponse(conn)
+		if err != nil {
+			t.Fatalf("Failed to read the JoinGroup response: %v", err)
+		}
+		if result.errorCode != group_coordinator.ErrorCodeMemberIDRequired {
+			t.Fatalf("Expected MEMBER_ID_REQUIRED, got %+v", result)
+		}
+		memberIDs[i] = result.memberID
+	}
+
+	results := make([]joined, members)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := conn.Write(joinGroupRequest(2, "group", memberIDs[i])); err != nil {
+				t.Errorf("Failed to write to server: %v", err)
+				return
+			}
+			result, err := readJoinGroupResponse(conn)
+			if err != nil {
+				t.Errorf("Failed to read the JoinGroup response: %v", err)
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	leader := -1
+	for i, result := range results {
+		if result.errorCode != ErrorCodeNone || result.generationID != 1 {
+			t.Fatalf("Expected every member in generation 1, got %+v", result)
+		}
+		if result.memberID == result.leader {
+			leader = i
+		}
+	}
+	if leader < 0 || results[leader].members != members {
+		t.Fatalf("Expected the leader to get all %d members, got %+v", members, results)
+	}
+
+	// The followers wait for the leader's assignment
+	for i, conn := range conns {
+		if i == leader {
+			continue
+		}
+		if _, err := conn.Write(syncGroupRequest(3, "group", memberIDs[i], nil)); err != nil {
+			t.Fatalf("Failed to write to server: %v", err)
+		}
+	}
+	if _, err := conns[leader].Write(syncGroupRequest(3, "group", memberIDs[leader], memberIDs)); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	for i, conn := range conns {
+		errorCode, assignment := readSyncGroupResponse(t, conn)
+		if errorCode != ErrorCodeNone || assignment != memberIDs[i] {
+			t.Errorf("Expected member %d to get its assignment, got %d %q", i, errorCode, assignment)
+		}
+	}
+}
+
+// A JoinGroup parked for a rebalance is answered when the broker shuts down,
+// its connection drains and the shutdown is clean
+func TestShutdownAnswersParkedJoinGroup(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	server.groupCoordinator.InitialRebalanceDelay = time.Minute
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := conn.Write(joinGroupRequest(1, "group", "")); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	first, err := readJoinGroupResponse(conn)
+	if err != nil || first.errorCode != group_coordinator.ErrorCodeMemberIDRequired {
+		t.Fatalf("Expected MEMBER_ID_REQUIRED, got %+v, err %v", first, err)
+	}
+	if _, err := conn.Write(joinGroupRequest(2, "group", first.memberID)); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	// The join waits for the initial rebalance delay
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- server.Close() }()
+	result, err := readJoinGroupResponse(conn)
+	if err != nil || result.errorCode != group_coordinator.ErrorCodeCoordinatorNotAvailable {
+		t.Fatalf("Expected COORDINATOR_NOT_AVAILABLE, got %+v, err %v", result, err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Failed to close the server: %v", err)
+	}
+	if clean, err := file_metadata.RemoveCleanShutdownMarker(server.config.LogDir); !clean || err != nil {
+		t.Errorf("Expected a clean shutdown, got %v, err %v", clean, err)
+	}
+}
@@ -0,0 +1,1006 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/listeners"
+
+	"github.com/google/uuid"
+)
+
+// handleConnection reads the requests of a connection onto the request queue
+// until the client closes it or ctx is done, the requests read by then are
+// still answered
+func (srv *Server) handleConnection(ctx context.Context, conn net.Conn, listener listeners.Listener) {
+	defer conn.Close()
+
+	// Wakes up the read of an idle connection when the broker shuts down
+	wake := conn.SetReadDeadline
+	stop := context.AfterFunc(ctx, func() { wake(time.Now()) })
+	defer stop()
+
+	srv.metrics.connections.Add(1, listener.Name)
+	defer srv.metrics.connections.Add(-1, listener.Name)
+
+	connID := srv.lastConnID.Add(1)
+	connLog := srv.log.With("conn_id", connID, "listener", listener.Name, "remote", conn.RemoteAddr().String())
+	session, err := srv.newClientSession(conn, listener, connLog)
+	if err != nil {
+		connLog.Warn("TLS handshake failed", "error", err)
+		return
+	}
+	srv.clients.add(&connectedClient{ID: connID, Listener: listener.Name, Remote: conn.RemoteAddr().String(), ConnectedAt: time.Now(), Principal: session.principal})
+	defer srv.clients.remove(connID)
+
+	conn = &idleConn{Conn: conn, ctx: ctx, idle: time.Duration(srv.config.ConnectionsMaxIdleMs) * time.Millisecond}
+	c := srv.newConnection(conn, connLog)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.writeResponses()
+	}()
+	defer func() {
+		c.inflight.Wait()
+		close(c.responses)
+		<-written
+	}()
+
+	for ctx.Err() == nil {
+		// A throttled connection is muted, its next request is not read
+		c.waitUnmuted(ctx)
+		if !c.acquire(ctx) {
+			break
+		}
+
+		buff, err := readRequest(conn, srv.config.MaxRequestSize)
+		if err != nil {
+			c.release()
+			// The connection is closed by the writer when a response fails
+			if err == io.EOF || errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				break
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				connLog.Debug("Closing an idle connection")
+				return
+			}
+			connLog.Warn("Failed to read a request, closing the connection", "error", err)
+			return
+		}
+		received := time.Now()
+
+		minimalReq, err := deserializeMinimalRequest(buff)
+		if err != nil {
+			c.release()
+			connLog.Warn("Failed to deserialize a request header", "error", err)
+			continue
+		}
+		session.clientID = requestClientID(buff)
+		session.log = connLog.With(logArgs(minimalReq, session.clientID)...)
+		srv.clients.received(connID, session, received)
+
+		if minimalReq.RequestAPIKey != ApiVersionAPIKEY && !srv.isSupportedVersion(minimalReq.RequestAPIKey, minimalReq.RequestAPIVersion) {
+			c.release()
+			session.log.Warn("Unsupported api version, closing the connection")
+			return
+		}
+
+		if !session.allows(minimalReq.RequestAPIKey) {
+			c.release()
+			session.log.Warn("Request from an unauthenticated client, closing the connection")
+			return
+		}
+
+		// The SASL requests change the session, they are handled alone. So is
+		// a request reusing the correlation id of one in flight, whose
+		// responses could not be told apart.
+		req := &request{header: minimalReq, buff: buff, session: session, remote: conn.RemoteAddr(), conn: c, received: received}
+		alone := minimalReq.RequestAPIKey == SaslHandshakeAPIKEY || minimalReq.RequestAPIKey == SaslAuthenticateAPIKEY || c.inFlight(minimalReq.CorrelationID)
+		if alone {
+			c.inflight.Wait()
+		} else {
+			req.session = session.forRequest()
+		}
+		c.enqueue(req)
+		if alone {
+			c.inflight.Wait()
+		}
+	}
+}
+
+// handleRequest answers a request on a goroutine of the handler pool, nil
+// closes the connection without an answer
+func (srv *Server) handleRequest(req *request) *pendingResponse {
+	buff, session := req.buff, req.session
+	switch req.header.RequestAPIKey {
+	case ApiVersionAPIKEY:
+		response := srv.handleAPIRequest(req.header)
+		return &pendingResponse{bytes: serializeResponse(response), answered: response}
+
+	case SaslHandshakeAPIKEY:
+		response, err := srv.handleSaslHandshakeRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return &pendingResponse{bytes: serializeSaslHandshakeResponse(response), answered: response}
+
+	case SaslAuthenticateAPIKEY:
+		response, err := handleSaslAuthenticateRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		// A failed authentication closes the connection
+		return &pendingResponse{bytes: serializeSaslAuthenticateResponse(response), answered: response, closeConnection: response.ErrorCode != ErrorCodeNone}
+
+	case ProduceAPIKEY:
+		response, err := srv.handleProduceRequest(req)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return response
+
+	case InitProducerIdAPIKEY:
+		response, err := srv.handleInitProducerIdRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeInitProducerIdResponse(response), answered: response}
+
+	case FetchAPIKEY:
+		response, err := srv.handleFetchRequest(req)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return response
+
+	case AddPartitionsToTxnAPIKEY:
+		response, err := srv.handleAddPartitionsToTxnRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeAddPartitionsToTxnResponse(response), answered: response}
+
+	case AddOffsetsToTxnAPIKEY:
+		response, err := srv.handleAddOffsetsToTxnRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeAddOffsetsToTxnResponse(response), answered: response}
+
+	case EndTxnAPIKEY:
+		response, err := srv.handleEndTxnRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeEndTxnResponse(response), answered: response}
+
+	case WriteTxnMarkersAPIKEY:
+		response, err := srv.handleWriteTxnMarkersRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return &pendingResponse{bytes: serializeWriteTxnMarkersResponse(response), answered: response}
+
+	case TxnOffsetCommitAPIKEY:
+		response, err := srv.handleTxnOffsetCommitRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeTxnOffsetCommitResponse(response), answered: response}
+
+	case DescribeTopicPartitionsAPIKEY:
+		response, err := srv.handleDescribeRequest(buff, len(buff), session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDescribeTopicPartitionsResponse(response), answered: response}
+
+	case CreateTopicsAPIKEY:
+		response, err := srv.handleCreateTopicsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeCreateTopicsResponse(response), answered: response}
+
+	case DeleteTopicsAPIKEY:
+		response, err := srv.handleDeleteTopicsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDeleteTopicsResponse(response), answered: response}
+
+	case CreatePartitionsAPIKEY:
+		response, err := srv.handleCreatePartitionsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeCreatePartitionsResponse(response), answered: response}
+
+	case DescribeAclsAPIKEY:
+		response, err := srv.handleDescribeAclsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDescribeAclsResponse(response), answered: response}
+
+	case CreateAclsAPIKEY:
+		response, err := srv.handleCreateAclsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeCreateAclsResponse(response), answered: response}
+
+	case DeleteAclsAPIKEY:
+		response, err := srv.handleDeleteAclsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDeleteAclsResponse(response), answered: response}
+
+	case DescribeClientQuotasAPIKEY:
+		response, err := srv.handleDescribeClientQuotasRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDescribeClientQuotasResponse(response), answered: response}
+
+	case AlterClientQuotasAPIKEY:
+		response, err := srv.handleAlterClientQuotasRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeAlterClientQuotasResponse(response), answered: response}
+
+	case DescribeConfigsAPIKEY:
+		response, err := srv.handleDescribeConfigsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDescribeConfigsResponse(response), answered: response}
+
+	case AlterConfigsAPIKEY:
+		response, err := srv.handleAlterConfigsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeAlterConfigsResponse(response), answered: response}
+
+	case IncrementalAlterConfigsAPIKEY:
+		response, err := srv.handleIncrementalAlterConfigsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeAlterConfigsResponse(response), answered: response}
+
+	case MetadataAPIKEY:
+		response, err := srv.handleMetadataRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeMetadataResponse(response), answered: response}
+
+	case OffsetCommitAPIKEY:
+		response, err := srv.handleOffsetCommitRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeOffsetCommitResponse(response), answered: response}
+
+	case OffsetFetchAPIKEY:
+		response, err := srv.handleOffsetFetchRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeOffsetFetchResponse(response), answered: response}
+
+	case FindCoordinatorAPIKEY:
+		response, err := srv.handleFindCoordinatorRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeFindCoordinatorResponse(response), answered: response}
+
+	case JoinGroupAPIKEY:
+		// The request waits for the rebalance without holding a handler, it
+		// is answered by whoever completes the join phase
+		parkedAt := time.Now()
+		err := srv.handleJoinGroupRequest(buff, session, req.remote, func(response *JoinGroupResponse) {
+			// Waiting for the rebalance is not handling time
+			session.delayed += time.Since(parkedAt)
+			response.ThrottleTime = session.throttle(req.dequeued)
+			srv.completeDelayed(req, parkedAt, &pendingResponse{bytes: serializeJoinGroupResponse(response), answered: response})
+		})
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return parked
+
+	case SyncGroupAPIKEY:
+		parkedAt := time.Now()
+		err := srv.handleSyncGroupRequest(buff, session, func(response *SyncGroupResponse) {
+			session.delayed += time.Since(parkedAt)
+			response.ThrottleTime = session.throttle(req.dequeued)
+			srv.completeDelayed(req, parkedAt, &pendingResponse{bytes: serializeSyncGroupResponse(response), answered: response})
+		})
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		return parked
+
+	case HeartbeatAPIKEY:
+		response, err := srv.handleHeartbeatRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeHeartbeatResponse(response), answered: response}
+
+	case LeaveGroupAPIKEY:
+		response, err := srv.handleLeaveGroupRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeLeaveGroupResponse(response), answered: response}
+
+	case DescribeGroupsAPIKEY:
+		response, err := srv.handleDescribeGroupsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDescribeGroupsResponse(response), answered: response}
+
+	case ListGroupsAPIKEY:
+		response, err := srv.handleListGroupsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeListGroupsResponse(response), answered: response}
+
+	case DeleteGroupsAPIKEY:
+		response, err := srv.handleDeleteGroupsRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeDeleteGroupsResponse(response), answered: response}
+
+	case ConsumerGroupHeartbeatAPIKEY:
+		response, err := srv.handleConsumerGroupHeartbeatRequest(buff, session, req.remote)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeConsumerGroupHeartbeatResponse(response), answered: response}
+
+	case ConsumerGroupDescribeAPIKEY:
+		response, err := srv.handleConsumerGroupDescribeRequest(buff, session)
+		if err != nil {
+			session.log.Error("Failed to deserialize a request", "error", err)
+			return nil
+		}
+		response.ThrottleTime = session.throttle(req.dequeued)
+		return &pendingResponse{bytes: serializeConsumerGroupDescribeResponse(response), answered: response}
+
+	default:
+		session.log.Error("No handler for the api key, closing the connection")
+		return nil
+	}
+}
+
+func (srv *Server) handleDescribeRequest(buff []byte, n int, session *clientSession) (*DescribeTopicPartitionsResponse, error) {
+	req, err := deserializeDescribeTopicPartitionsRequest(buff[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	// Create response with unknown topic error, then fill in the topics that
+	// exist and the client may describe
+	response := createUnknownTopicResponse(req)
+	for i, topic := range req.Topics {
+		name := string(topic.TopicName)
+		if !session.authorizeTopic(authorizer.Describe, name) {
+			response.Topics[i].ErrorCode = ErrorCodeTopicAuthorizationFailed
+			continue
+		}
+		found := srv.topics.topic(name)
+		if found == nil {
+			continue
+		}
+		response.Topics[i].ErrorCode = 0
+		response.Topics[i].TopicID = found.TopicId
+		response.Topics[i].IsInternal = isInternalTopic(found.TopicName)
+		response.Topics[i].TopicAuthOps = session.topicAuthorizedOperations(found.TopicName)
+		for _, partition := range srv.metadataTopic(*found).Partitions {
+			response.Topics[i].PartitionsArray = append(response.Topics[i].PartitionsArray, Partition{
+				ErrorCode:      partition.ErrorCode,
+				PartitionIndex: partition.PartitionIndex,
+				LeaderID:       partition.LeaderID,
+				LeaderEpoch:    partition.LeaderEpoch,
+				ReplicaNodes:   partition.ReplicaNodes,
+				ISRNodes:       partition.ISRNodes,
+			})
+		}
+	}
+
+	return response, nil
+}
+
+// handleMetadataRequest advertises the address of the listener the request
+// came in on, topics the client may not describe are left out
+func (srv *Server) handleMetadataRequest(buff []byte, session *clientSession) (*MetadataResponse, error) {
+	req, err := deserializeMetadataRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &MetadataResponse{
+		CorrelationID:               req.CorrelationID,
+		APIVersion:                  req.RequestAPIVersion,
+		ThrottleTime:                0,
+		Brokers:                     []MetadataResponseBroker{{NodeID: srv.config.NodeID, Host: session.listener.AdvertisedHost, Port: int32(session.listener.AdvertisedPort)}},
+		ControllerID:                srv.config.NodeID,
+		ClusterAuthorizedOperations: math.MinInt32,
+	}
+	if req.IncludeClusterAuthorizedOperations {
+		response.ClusterAuthorizedOperations = session.clusterAuthorizedOperations()
+	}
+	describeTopic := func(topic file_metadata.TopicValue) MetadataResponseTopic {
+		result := srv.metadataTopic(topic)
+		if req.IncludeTopicAuthorizedOperations {
+			result.TopicAuthorizedOperations = session.topicAuthorizedOperations(topic.TopicName)
+		}
+		return result
+	}
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	if req.Topics == nil {
+		topics := srv.topics.list()
+		sort.Slice(topics, func(i, j int) bool { return topics[i].TopicName < topics[j].TopicName })
+		for _, topic := range topics {
+			if session.authorizeTopic(authorizer.Describe, topic.TopicName) {
+				response.Topics = append(response.Topics, describeTopic(topic))
+			}
+		}
+		return response, nil
+	}
+
+	for _, requested := range req.Topics {
+		var found *file_metadata.TopicValue
+		if requested.Name != "" {
+			found = srv.topics.topic(requested.Name)
+		} else {
+			found = srv.topics.topicById(requested.TopicID)
+		}
+
+		// Named topics are checked first so clients cannot probe which exist
+		errorCode := int16(ErrorCodeNone)
+		switch {
+		case requested.Name != "" && !session.authorizeTopic(authorizer.Describe, requested.Name):
+			errorCode = ErrorCodeTopicAuthorizationFailed
+		case found == nil && requested.Name != "":
+			errorCode = ErrorCodeUnknownTopic
+		case found == nil:
+			errorCode = ErrorCodeUnknownTopicID
+		case !session.authorizeTopic(authorizer.Describe, found.TopicName):
+			errorCode = ErrorCodeTopicAuthorizationFailed
+		}
+
+		if errorCode != ErrorCodeNone {
+			response.Topics = append(response.Topics, MetadataResponseTopic{
+				ErrorCode:                 errorCode,
+				Name:                      requested.Name,
+				TopicID:                   requested.TopicID,
+				TopicAuthorizedOperations: math.MinInt32,
+			})
+			continue
+		}
+		response.Topics = append(response.Topics, describeTopic(*found))
+	}
+
+	return response, nil
+}
+
+// metadataTopic describes an existing topic and its partitions, must be called
+// with metadataLock held
+func (srv *Server) metadataTopic(topic file_metadata.TopicValue) MetadataResponseTopic {
+	result := MetadataResponseTopic{
+		ErrorCode:                 ErrorCodeNone,
+		Name:                      topic.TopicName,
+		TopicID:                   topic.TopicId,
+		IsInternal:                isInternalTopic(topic.TopicName),
+		TopicAuthorizedOperations: math.MinInt32,
+	}
+
+	partitions := srv.topics.partitionsOf(topic.TopicId)
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].PartitionId < partitions[j].PartitionId })
+	for _, partition := range partitions {
+		result.Partitions = append(result.Partitions, MetadataResponsePartition{
+			ErrorCode:       ErrorCodeNone,
+			PartitionIndex:  partition.PartitionId,
+			LeaderID:        partition.LeaderId,
+			LeaderEpoch:     partition.LeaderEpoch,
+			ReplicaNodes:    partition.ReplicaIdArray,
+			ISRNodes:        partition.InSyncReplicaArray,
+			OfflineReplicas: []int32{},
+		})
+	}
+	return result
+}
+
+// Every API the broker answers, also advertised through ApiVersions
+var supportedAPIVersions = []APIVersion{
+	{APIKey: ProduceAPIKEY, MinVersion: 9, MaxVersion: 11, TagBuffer: 0},
+	{APIKey: FetchAPIKEY, MinVersion: 12, MaxVersion: 16, TagBuffer: 0},
+	{APIKey: MetadataAPIKEY, MinVersion: 9, MaxVersion: 12, TagBuffer: 0},
+	{APIKey: OffsetCommitAPIKEY, MinVersion: 8, MaxVersion: 9, TagBuffer: 0},
+	{APIKey: OffsetFetchAPIKEY, MinVersion: 8, MaxVersion: 9, TagBuffer: 0},
+	{APIKey: FindCoordinatorAPIKEY, MinVersion: 3, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: JoinGroupAPIKEY, MinVersion: 6, MaxVersion: 9, TagBuffer: 0},
+	{APIKey: HeartbeatAPIKEY, MinVersion: 4, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: LeaveGroupAPIKEY, MinVersion: 4, MaxVersion: 5, TagBuffer: 0},
+	{APIKey: SyncGroupAPIKEY, MinVersion: 4, MaxVersion: 5, TagBuffer: 0},
+	{APIKey: DescribeGroupsAPIKEY, MinVersion: 5, MaxVersion: 6, TagBuffer: 0},
+	{APIKey: ListGroupsAPIKEY, MinVersion: 3, MaxVersion: 5, TagBuffer: 0},
+	{APIKey: SaslHandshakeAPIKEY, MinVersion: 1, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: ApiVersionAPIKEY, MinVersion: 0, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: CreateTopicsAPIKEY, MinVersion: 5, MaxVersion: 7, TagBuffer: 0},
+	{APIKey: DeleteTopicsAPIKEY, MinVersion: 6, MaxVersion: 6, TagBuffer: 0},
+	{APIKey: InitProducerIdAPIKEY, MinVersion: 2, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: AddPartitionsToTxnAPIKEY, MinVersion: 3, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: AddOffsetsToTxnAPIKEY, MinVersion: 3, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: EndTxnAPIKEY, MinVersion: 3, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: WriteTxnMarkersAPIKEY, MinVersion: 1, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: TxnOffsetCommitAPIKEY, MinVersion: 3, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: DescribeAclsAPIKEY, MinVersion: 2, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: CreateAclsAPIKEY, MinVersion: 2, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: DeleteAclsAPIKEY, MinVersion: 2, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: DescribeConfigsAPIKEY, MinVersion: 4, MaxVersion: 4, TagBuffer: 0},
+	{APIKey: AlterConfigsAPIKEY, MinVersion: 2, MaxVersion: 2, TagBuffer: 0},
+	{APIKey: SaslAuthenticateAPIKEY, MinVersion: 0, MaxVersion: 2, TagBuffer: 0},
+	{APIKey: CreatePartitionsAPIKEY, MinVersion: 2, MaxVersion: 3, TagBuffer: 0},
+	{APIKey: DeleteGroupsAPIKEY, MinVersion: 2, MaxVersion: 2, TagBuffer: 0},
+	{APIKey: IncrementalAlterConfigsAPIKEY, MinVersion: 1, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: DescribeClientQuotasAPIKEY, MinVersion: 1, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: AlterClientQuotasAPIKEY, MinVersion: 1, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: ConsumerGroupHeartbeatAPIKEY, MinVersion: 0, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: ConsumerGroupDescribeAPIKEY, MinVersion: 0, MaxVersion: 1, TagBuffer: 0},
+	{APIKey: DescribeTopicPartitionsAPIKEY, MinVersion: 0, MaxVersion: 0, TagBuffer: 0},
+}
+
+// isEnabledAPI reports whether an API behind a feature switch is turned on
+func (srv *Server) isEnabledAPI(apiKey int) bool {
+	switch apiKey {
+	case ConsumerGroupHeartbeatAPIKEY, ConsumerGroupDescribeAPIKEY:
+		return srv.config.ConsumerGroupProtocolEnabled
+	}
+	return true
+}
+
+// advertisedAPIVersions is supportedAPIVersions without the disabled APIs
+func (srv *Server) advertisedAPIVersions() []APIVersion {
+	var apis []APIVersion
+	for _, api := range supportedAPIVersions {
+		if srv.isEnabledAPI(api.APIKey) {
+			apis = append(apis, api)
+		}
+	}
+	return apis
+}
+
+func (srv *Server) isSupportedVersion(apiKey int, version int) bool {
+	for _, api := range supportedAPIVersions {
+		if api.APIKey == apiKey {
+			return srv.isEnabledAPI(apiKey) && version >= api.MinVersion && version <= api.MaxVersion
+		}
+	}
+	// Unknown keys fall through to the UNHANDLED CASE
+	return true
+}
+
+func (srv *Server) handleAPIRequest(minimalReq *MinimalRequest) Response {
+	apis := srv.advertisedAPIVersions()
+
+	response := Response{
+		MessageSize:   33, // Will be calculated properly in serialization
+		CorrelationID: minimalReq.CorrelationID,
+		ErrorCode:     0,
+		ArrayLength:   len(apis) + 1,
+		APIVersions:   apis,
+		ThrottleTime:  0,
+		TagBuffer:     0,
+	}
+
+	// Create API func bytesToIntVersions response
+	if !(minimalReq.RequestAPIVersion >= 0 && minimalReq.RequestAPIVersion <= 4) {
+		response.ErrorCode = 35
+	}
+
+	return response
+}
+
+// handleCreateTopicsRequest needs CREATE on the cluster, or on each topic
+func (srv *Server) handleCreateTopicsRequest(buff []byte, session *clientSession) (*CreateTopicsResponse, error) {
+	req, err := deserializeCreateTopicsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CreateTopicsResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		ThrottleTime:  0,
+	}
+
+	requested := make(map[string]int)
+	for _, topic := range req.Topics {
+		requested[topic.Name]++
+	}
+
+	clusterCreate := session.authorize(authorizer.Create, authorizer.ResourceCluster, authorizer.ClusterResourceName)
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	for _, topic := range req.Topics {
+		var result CreatableTopicResult
+		switch {
+		case requested[topic.Name] > 1:
+			result = CreatableTopicResult{ErrorCode: ErrorCodeInvalidRequest, ErrorMessage: "Duplicate topic name."}
+		case !clusterCreate && !session.authorizeTopic(authorizer.Create, topic.Name):
+			result = CreatableTopicResult{ErrorCode: ErrorCodeTopicAuthorizationFailed, ErrorMessage: "Authorization failed."}
+		default:
+			result = srv.createTopicFromRequest(topic, req.ValidateOnly)
+		}
+		result.Name = topic.Name
+		if result.ErrorCode != ErrorCodeNone {
+			result.NumPartitions = -1
+			result.ReplicationFactor = -1
+		}
+		response.Topics = append(response.Topics, result)
+	}
+
+	return response, nil
+}
+
+// createTopicFromRequest validates a single topic of a CreateTopics request and,
+// unless validateOnly is set, creates it. Must be called with metadataLock held.
+func (srv *Server) createTopicFromRequest(topic CreatableTopic, validateOnly bool) CreatableTopicResult {
+	if message := validateTopicName(topic.Name); message != "" {
+		return CreatableTopicResult{ErrorCode: ErrorCodeInvalidTopic, ErrorMessage: message}
+	}
+	if srv.topics.topic(topic.Name) != nil {
+		return CreatableTopicResult{ErrorCode: ErrorCodeTopicAlreadyExists, ErrorMessage: fmt.Sprintf("Topic '%s' already exists.", topic.Name)}
+	}
+	for _, config := range topic.Configs {
+		if config.ValueIsNull {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidConfig, ErrorMessage: fmt.Sprintf("Null value not supported for topic configs: %s", config.Name)}
+		}
+		if err := srv.configs.Validate(configs.TopicResource, config.Name, config.Value); err != nil {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidConfig, ErrorMessage: err.Error()}
+		}
+		if message := unsupportedConfig(configs.TopicResource, config.Name, config.Value); message != "" {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidConfig, ErrorMessage: message}
+		}
+	}
+
+	brokers := srv.liveBrokers()
+	var assignments [][]int32
+	if len(topic.Assignments) > 0 {
+		if topic.NumPartitions != -1 || topic.ReplicationFactor != -1 {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidRequest, ErrorMessage: "Both numPartitions or replicationFactor and replicasAssignments were set. Both cannot be used at the same time."}
+		}
+
+		if len(topic.Assignments) > MaxTopicPartitions {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidPartitions, ErrorMessage: fmt.Sprintf("Number of partitions must not be larger than %d.", MaxTopicPartitions)}
+		}
+
+		var message string
+		assignments, message = validateReplicaAssignment(topic.Assignments, brokers)
+		if message != "" {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidReplicaAssignment, ErrorMessage: message}
+		}
+	} else {
+		numPartitions := topic.NumPartitions
+		if numPartitions == -1 {
+			numPartitions = srv.config.DefaultNumPartitions
+		}
+		replicationFactor := topic.ReplicationFactor
+		if replicationFactor == -1 {
+			replicationFactor = srv.config.DefaultReplicationFactor
+		}
+
+		if numPartitions <= 0 {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidPartitions, ErrorMessage: "Number of partitions must be larger than 0."}
+		}
+		if numPartitions > MaxTopicPartitions {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidPartitions, ErrorMessage: fmt.Sprintf("Number of partitions must not be larger than %d.", MaxTopicPartitions)}
+		}
+		if replicationFactor <= 0 {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidReplicationFactor, ErrorMessage: "Replication factor must be larger than 0."}
+		}
+		if int(replicationFactor) > len(brokers) {
+			return CreatableTopicResult{ErrorCode: ErrorCodeInvalidReplicationFactor, ErrorMessage: fmt.Sprintf("Unable to replicate the partition %d time(s): The target replication factor of %d cannot be reached because only %d broker(s) are registered.", replicationFactor, replicationFactor, len(brokers))}
+		}
+		assignments = assignReplicas(brokers, 0, numPartitions, replicationFactor)
+	}
+
+	result := CreatableTopicResult{
+		ErrorCode:         ErrorCodeNone,
+		NumPartitions:     int32(len(assignments)),
+		ReplicationFactor: int16(len(assignments[0])),
+	}
+	for _, config := range topic.Configs {
+		result.Configs = append(result.Configs, CreatableTopicResultConfig{
+			Name:         config.Name,
+			Value:        config.Value,
+			ConfigSource: ConfigSourceDynamicTopic,
+		})
+	}
+
+	if validateOnly {
+		return result
+	}
+
+	topicId := uuid.New()
+	if err := srv.createTopic(topic.Name, topicId, assignments, topic.Configs); err != nil {
+		return CreatableTopicResult{ErrorCode: ErrorCodeUnknownServerError, ErrorMessage: err.Error()}
+	}
+	result.TopicID = topicId
+	return result
+}
+
+func (srv *Server) handleDeleteTopicsRequest(buff []byte, session *clientSession) (*DeleteTopicsResponse, error) {
+	req, err := deserializeDeleteTopicsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DeleteTopicsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	// Resolve every topic first so duplicates can be rejected before anything is deleted
+	topics := make([]*file_metadata.TopicValue, len(req.Topics))
+	requested := make(map[uuid.UUID]int)
+	for i, state := range req.Topics {
+		result := DeletableTopicResult{Name: state.Name, NameIsNull: state.NameIsNull, TopicID: state.TopicID}
+
+		byId := uuid.UUID(state.TopicID) != uuid.Nil
+		switch {
+		case byId && !state.NameIsNull:
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = "Topic name and topic id can not both be specified."
+		case byId:
+			topics[i] = srv.topics.topicById(state.TopicID)
+			if topics[i] == nil {
+				result.ErrorCode = ErrorCodeUnknownTopicID
+				result.ErrorMessage = "This server does not host this topic ID."
+			}
+		default:
+			topics[i] = srv.topics.topic(state.Name)
+			if topics[i] == nil {
+				result.ErrorCode = ErrorCodeUnknownTopic
+				result.ErrorMessage = "This server does not host this topic-partition."
+			}
+		}
+
+		if topics[i] != nil && !session.authorizeTopic(authorizer.Delete, topics[i].TopicName) {
+			result.ErrorCode = ErrorCodeTopicAuthorizationFailed
+			result.ErrorMessage = "Authorization failed."
+			topics[i] = nil
+		}
+		// The coordinators keep writing to their topics' logs
+		if topics[i] != nil && isInternalTopic(topics[i].TopicName) {
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = fmt.Sprintf("Cannot delete the internal topic %s.", topics[i].TopicName)
+			topics[i] = nil
+		}
+		if topics[i] != nil {
+			result.Name, result.NameIsNull = topics[i].TopicName, false
+			result.TopicID = topics[i].TopicId
+			requested[topics[i].TopicId]++
+		}
+		response.Responses = append(response.Responses, result)
+	}
+
+	for i, topic := range topics {
+		if topic == nil {
+			continue
+		}
+
+		// The same topic named twice, possibly once by name and once by id
+		if requested[topic.TopicId] > 1 {
+			response.Responses[i].ErrorCode = ErrorCodeInvalidRequest
+			response.Responses[i].ErrorMessage = "Duplicate topic in request."
+			continue
+		}
+
+		if err := srv.deleteTopic(*topic); err != nil {
+			response.Responses[i].ErrorCode = ErrorCodeUnknownServerError
+			response.Responses[i].ErrorMessage = err.Error()
+		}
+	}
+
+	return response, nil
+}
+
+func (srv *Server) handleCreatePartitionsRequest(buff []byte, session *clientSession) (*CreatePartitionsResponse, error) {
+	req, err := deserializeCreatePartitionsRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CreatePartitionsResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	requested := make(map[string]int)
+	for _, topic := range req.Topics {
+		requested[topic.Name]++
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	for _, topic := range req.Topics {
+		result := CreatePartitionsTopicResult{Name: topic.Name}
+		switch {
+		case requested[topic.Name] > 1:
+			result.ErrorCode = ErrorCodeInvalidRequest
+			result.ErrorMessage = "Duplicate topic in request."
+		case !session.authorizeTopic(authorizer.Alter, topic.Name):
+			result.ErrorCode = ErrorCodeTopicAuthorizationFailed
+			result.ErrorMessage = "Authorization failed."
+		default:
+			result.ErrorCode, result.ErrorMessage = srv.createPartitionsFromRequest(topic, req.ValidateOnly)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	return response, nil
+}
+
+// createPartitionsFromRequest grows a single topic of a CreatePartitions request
+// to the requested count. Must be called with metadataLock held.
+func (srv *Server) createPartitionsFromRequest(topic CreatePartitionsTopic, validateOnly bool) (int16, string) {
+	found := srv.topics.topic(topic.Name)
+	if found == nil {
+		return ErrorCodeUnknownTopic, "This server does not host this topic-partition."
+	}
+	// The coordinators hash group and transactional ids by the partition
+	// counts of their topics, growing them would move the coordinators
+	if isInternalTopic(topic.Name) {
+		return ErrorCodeInvalidRequest, fmt.Sprintf("Cannot increase the number of partitions of the internal topic %s.", topic.Name)
+	}
+
+	existing := srv.topics.partitionsOf(found.TopicId)
+	current := int32(len(existing))
+	if topic.Count < current {
+		return ErrorCodeInvalidPartitions, fmt.Sprintf("Topic currently has %d partitions, which is higher than the requested %d.", current, topic.Count)
+	}
+	if topic.Count == current {
+		return ErrorCodeInvalidPartitions, fmt.Sprintf("Topic already has %d partitions.", current)
+	}
+	if topic.Count > MaxTopicPartitions {
+		return ErrorCodeInvalidPartitions, fmt.Sprintf("Number of partitions must not be larger than %d.", MaxTopicPartitions)
+	}
+
+	// New partitions get the replication factor the topic already has
+	replicationFactor := srv.config.DefaultReplicationFactor
+	if current > 0 {
+		replicationFactor = int16(len(existing[0].ReplicaIdArray))
+	}
+
+	brokers := srv.liveBrokers()
+	var assignments [][]int32
+	if topic.Assignments != nil {
+		if int32(len(topic.Assignments)) != topic.Count-current {
+			return ErrorCodeInvalidReplicaAssignment, fmt.Sprintf("Increasing the number of partitions by %d but %d assignments provided.", topic.Count-current, len(topic.Assignments))
+		}
+
+		explicit := make([]CreatableReplicaAssignment, len(topic.Assignments))
+		for i, brokerIDs := range topic.Assignments {
+			if len(brokerIDs) != int(replicationFactor) {
+				return ErrorCodeInvalidReplicaAssignment, fmt.Sprintf("The manual partition assignment includes a partition with %d replica(s), but this is not consistent with previous partitions, which have %d replica(s).", len(brokerIDs), replicationFactor)
+			}
+			explicit[i] = CreatableReplicaAssignment{PartitionIndex: int32(i), BrokerIDs: brokerIDs}
+		}
+
+		var message string
+		assignments, message = validateReplicaAssignment(explicit, brokers)
+		if message != "" {
+			return ErrorCodeInvalidReplicaAssignment, message
+		}
+	} else {
+		if int(replicationFactor) > len(brokers) {
+			return ErrorCodeInvalidReplicationFactor, fmt.Sprintf("Unable to replicate the partition %d time(s): The target replication factor of %d cannot be reached because only %d broker(s) are registered.", replicationFactor, replicationFactor, len(brokers))
+		}
+		assignments = assignReplicas(brokers, current, topic.Count-current, replicationFactor)
+	}
+
+	if validateOnly {
+		return ErrorCodeNone, ""
+	}
+
+	if err := srv.createPartitions(*found, current, assignments); err != nil {
+		return ErrorCodeUnknownServerError, err.Error()
+	}
+	return ErrorCodeNone, ""
+}
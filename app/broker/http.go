@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// startHTTP serves /metrics, the health checks and the read-only admin API on
+// HTTPAddr until the server is closed
+func (srv *Server) startHTTP() error {
+	if srv.config.HTTPAddr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", srv.config.HTTPAddr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", srv.metrics.registry.Handler())
+	mux.HandleFunc("GET /healthz", srv.handleHealthz)
+	mux.HandleFunc("GET /readyz", srv.handleReadyz)
+	mux.HandleFunc("GET /topics", srv.whenReady(srv.handleTopics))
+	mux.HandleFunc("GET /topics/{topic}", srv.whenReady(srv.handleTopic))
+	mux.HandleFunc("GET /topics/{topic}/partitions/{partition}/segments", srv.whenReady(srv.handleSegments))
+	mux.HandleFunc("GET /metadata", srv.whenReady(srv.handleMetadataImage))
+	mux.HandleFunc("GET /clients", srv.whenReady(srv.handleClients))
+	mux.HandleFunc("GET /groups", srv.whenReady(srv.handleGroups))
+	srv.httpServer = &http.Server{Handler: mux, ErrorLog: slog.NewLogLogger(srv.log.Handler(), slog.LevelWarn)}
+	srv.httpAddr = listener.Addr().String()
+	srv.log.Info("Serving HTTP", "addr", srv.httpAddr)
+
+	go func() {
+		if err := srv.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			srv.log.Error("The HTTP server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (srv *Server) stopHTTP(ctx context.Context) {
+	if srv.httpServer == nil {
+		return
+	}
+	if err := srv.httpServer.Shutdown(ctx); err != nil {
+		srv.log.Warn("Failed to shut down the HTTP server", "error", err)
+	}
+}
+
+// HTTPAddr is the address the HTTP server listens on, with the port it was
+// given when HTTPAddr was configured with port 0. It is empty when nothing is
+// served.
+func (srv *Server) HTTPAddr() string {
+	return srv.httpAddr
+}
+
+// healthStatus is the body of /healthz and /readyz
+type healthStatus struct {
+	Status string `json:"status"`
+	// Error is why the broker failed to start
+	Error string `json:"error,omitempty"`
+}
+
+// handleHealthz answers as long as the process serves HTTP
+func (srv *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// handleReadyz answers 200 once the metadata log is loaded and the listeners
+// are started, and 503 while starting, after failing to start or while
+// shutting down
+func (srv *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if failure := srv.startFailure.Load(); failure != nil {
+		writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "failed", Error: *failure})
+		return
+	}
+	if !srv.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ready"})
+}
+
+// whenReady answers 503 instead of calling handler while the broker state is
+// not loaded
+func (srv *Server) whenReady(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !srv.ready.Load() {
+			writeError(w, http.StatusServiceUnavailable, "The broker is not ready")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorBody{Error: message})
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"toy_kafka/app/listeners"
+	"toy_kafka/app/ssl"
+)
+
+// defaultListeners requires SASL on the default port once credentials exist,
+// and adds an SSL listener when the certificate exists
+func (srv *Server) defaultListeners() string {
+	protocol := listeners.Plaintext
+	if !srv.credentials.Empty() {
+		protocol = listeners.SaslPlaintext
+	}
+	configured := fmt.Sprintf("%s://0.0.0.0:%d", protocol, DefaultListenerPort)
+	if _, err := os.Stat(filepath.Join(srv.config.LogDir, SslCertFile)); err == nil {
+		configured += fmt.Sprintf(",%s://0.0.0.0:%d", listeners.Ssl, SslListenerPort)
+	}
+	return configured
+}
+
+// startListeners starts every configured listener, the certificate of the SSL
+// ones is picked up again when it changes. Their connections are served until
+// ctx is done.
+func (srv *Server) startListeners(ctx context.Context) error {
+	config := srv.config.Listeners
+	if config.Listeners == "" {
+		config.Listeners = srv.defaultListeners()
+	}
+	resolved, err := config.Resolve()
+	if err != nil {
+		return err
+	}
+
+	for _, listener := range resolved {
+		if slices.Contains(srv.config.ControllerListenerNames, listener.Name) {
+			continue
+		}
+		if listener.SecurityProtocol.UsesTLS() && srv.listenerManager.TLSConfig == nil {
+			reloader, err := srv.newSslReloader()
+			if err != nil {
+				return err
+			}
+			reloader.Logger = srv.log
+			reloader.Watch(ssl.DefaultReloadInterval)
+			srv.listenerManager.TLSConfig = reloader.TLSConfig()
+		}
+
+		started, err := srv.listenerManager.Start(ctx, listener)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", listener.Name, err)
+		}
+		srv.log.Info("Listening", "listener", started.Name, "port", started.Port, "advertised", net.JoinHostPort(started.AdvertisedHost, strconv.Itoa(started.AdvertisedPort)))
+		if srv.addr == "" {
+			srv.addr = started.Address()
+		}
+	}
+	return nil
+}
+
+func (srv *Server) newSslReloader() (*ssl.Reloader, error) {
+	config := ssl.Config{CertFile: filepath.Join(srv.config.LogDir, SslCertFile), KeyFile: filepath.Join(srv.config.LogDir, SslKeyFile), ClientAuth: ssl.ClientAuthNone}
+	caFile := filepath.Join(srv.config.LogDir, SslCAFile)
+	if _, err := os.Stat(caFile); err == nil {
+		config.CAFile = caFile
+		config.ClientAuth = srv.config.SslClientAuth
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return ssl.NewReloader(config)
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats accepted by NewLogger
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger writes records of level and above to w, as logfmt style text or as
+// one JSON object per line
+func NewLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+}
+
+// parseLogLevel accepts debug, info, warn and error in any case, log4j's
+// TRACE is taken as debug
+func parseLogLevel(value string) (slog.Level, error) {
+	if strings.EqualFold(value, "trace") {
+		return slog.LevelDebug, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return level, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// logArgs are the fields of a request that every line logged while handling
+// it carries
+func logArgs(req *MinimalRequest, clientID string) []any {
+	return []any{
+		"client_id", clientID,
+		"api_key", req.RequestAPIKey,
+		"api_version", req.RequestAPIVersion,
+		"correlation_id", req.CorrelationID,
+	}
+}
@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	t.Parallel()
+	var logs bytes.Buffer
+	logger, err := NewLogger(&logs, LogFormatText, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("Failed to create the logger: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	config.Listeners.Listeners = "PLAINTEXT://127.0.0.1:0"
+	config.Logger = logger
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start the server: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	// ApiVersions v0 with correlation id 42 and client id "cli"
+	request, _ := hex.DecodeString("0000000d001200000000002a0003636c69")
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	if _, err := readRequest(conn, 1<<20); err != nil && err != io.EOF {
+		t.Fatalf("Failed to read from server: %v", err)
+	}
+	conn.Close()
+	if err := server.Close(); err != nil {
+		t.Fatalf("Failed to close the server: %v", err)
+	}
+
+	var line string
+	for _, l := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(l, `msg="Completed a request"`) {
+			line = l
+		}
+	}
+	for _, field := range []string{"level=DEBUG", "conn_id=1", "client_id=cli", "api_key=18", "api_version=0", "correlation_id=42", "latency="} {
+		if !strings.Contains(line, field) {
+			t.Errorf("Expected %s in the request log, got %q", field, line)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for value, want := range map[string]slog.Level{"debug": slog.LevelDebug, "TRACE": slog.LevelDebug, "Info": slog.LevelInfo, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if level, err := parseLogLevel(value); err != nil || level != want {
+			t.Errorf("Expected %s to parse as %v, got %v, %v", value, want, level, err)
+		}
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
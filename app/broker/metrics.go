@@ -0,0 +1,329 @@
+package broker
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/metrics"
+
+	"github.com/google/uuid"
+)
+
+// Request latency buckets in milliseconds, Kafka's TotalTimeMs is in
+// milliseconds too
+var requestTimeBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// brokerMetrics are named after Kafka's JMX MBeans the way the Prometheus JMX
+// exporter names them, e.g. kafka.network:type=RequestMetrics,name=RequestsPerSec
+// becomes kafka_network_requestmetrics_requests_total
+type brokerMetrics struct {
+	registry *metrics.Registry
+
+	requests    *metrics.Counter
+	requestTime *metrics.Histogram
+	// requestQueueTime, localTime and responseQueueTime split requestTime
+	// into waiting for a handler, handling and waiting for the responses
+	// to the requests read before on the connection
+	requestQueueTime  *metrics.Histogram
+	localTime         *metrics.Histogram
+	responseQueueTime *metrics.Histogram
+	// remoteTime is how long requests waited in a purgatory
+	remoteTime  *metrics.Histogram
+	errors      *metrics.Counter
+	connections *metrics.Gauge
+	// connectionsRejected counts the connections refused by a limit
+	connectionsRejected *metrics.Counter
+
+	bytesIn    *metrics.Counter
+	bytesOut   *metrics.Counter
+	messagesIn *metrics.Counter
+
+	metadataLoadTime *metrics.Gauge
+}
+
+func (srv *Server) newMetrics() *brokerMetrics {
+	r := metrics.NewRegistry()
+	m := &brokerMetrics{
+		registry:            r,
+		requests:            r.Counter("kafka_network_requestmetrics_requests_total", "Requests answered, by API and version", "request", "version"),
+		requestTime:         r.Histogram("kafka_network_requestmetrics_totaltimems", "Time from reading a request to writing its response in milliseconds, by API and version", requestTimeBuckets, "request", "version"),
+		requestQueueTime:    r.Histogram("kafka_network_requestmetrics_requestqueuetimems", "Time requests waited in the request queue in milliseconds, by API", requestTimeBuckets, "request"),
+		localTime:           r.Histogram("kafka_network_requestmetrics_localtimems", "Time requests were handled in milliseconds, by API", requestTimeBuckets, "request"),
+		remoteTime:          r.Histogram("kafka_network_requestmetrics_remotetimems", "Time Fetch and Produce requests waited in a purgatory in milliseconds, by API", requestTimeBuckets, "request"),
+		responseQueueTime:   r.Histogram("kafka_network_requestmetrics_responsequeuetimems", "Time responses waited for the responses before them on the connection in milliseconds, by API", requestTimeBuckets, "request"),
+		errors:              r.Counter("kafka_network_requestmetrics_errors_total", "Error codes in responses, by API and error, NONE included like in Kafka", "request", "error"),
+		connections:         r.Gauge("kafka_server_socket_server_metrics_connection_count", "Open connections, by listener", "listener"),
+		connectionsRejected: r.Counter("kafka_server_socket_server_metrics_connection_rejected_total", "Connections refused by max.connections or max.connections.per.ip, by listener and config", "listener", "reason"),
+		bytesIn:             r.Counter("kafka_server_brokertopicmetrics_bytesin_total", "Bytes appended by producers, by topic", "topic"),
+		bytesOut:            r.Counter("kafka_server_brokertopicmetrics_bytesout_total", "Bytes sent to consumers, by topic", "topic"),
+		messagesIn:          r.Counter("kafka_server_brokertopicmetrics_messagesin_total", "Records appended by producers, by topic", "topic"),
+		metadataLoadTime:    r.Gauge("kafka_server_broker_metadata_metrics_metadata_load_time_ms", "Time it took to load the metadata log at startup in milliseconds"),
+	}
+	r.GaugeFunc("kafka_network_requestchannel_requestqueuesize", "Requests waiting in the request queue", nil, srv.collectRequestQueueSize)
+	r.GaugeFunc("kafka_server_delayedoperationpurgatory_numdelayedoperations", "Requests waiting in a purgatory, by operation", []string{"delayedOperation"}, srv.collectDelayedOperations)
+	r.GaugeFunc("kafka_log_log_logendoffset", "Offset of the next record appended to the partition", []string{"topic", "partition"}, srv.collectLogEndOffsets)
+	r.GaugeFunc("kafka_server_replicamanager_underreplicatedpartitions", "Partitions with fewer in-sync replicas than replicas", nil, srv.collectUnderReplicatedPartitions)
+	r.GaugeFunc("kafka_consumergroup_lag", "Records between the committed offset of a group and the end of the partition", []string{"consumergroup", "topic", "partition"}, srv.collectConsumerGroupLag)
+	return m
+}
+
+// observeRequest records a request answered with response, nil when nothing
+// was answered
+func (m *brokerMetrics) observeRequest(req *MinimalRequest, response any, elapsed time.Duration) {
+	request := apiName(req.RequestAPIKey)
+	version := strconv.Itoa(req.RequestAPIVersion)
+	m.requests.Inc(request, version)
+	m.requestTime.Observe(milliseconds(elapsed), request, version)
+
+	if response != nil {
+		counts := make(map[int64]int)
+		countErrorCodes(reflect.ValueOf(response), counts)
+		for code, n := range counts {
+			m.errors.Add(float64(n), request, errorName(code))
+		}
+	}
+}
+
+// countErrorCodes counts the ErrorCode fields found anywhere in a response,
+// which is every partition's and topic's besides the top level one
+func countErrorCodes(v reflect.Value, counts map[int64]int) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			countErrorCodes(v.Elem(), counts)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct && v.Type().Elem().Kind() != reflect.Pointer {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			countErrorCodes(v.Index(i), counts)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if v.Type().Field(i).Name == "ErrorCode" && field.CanInt() {
+				counts[field.Int()]++
+				continue
+			}
+			countErrorCodes(field, counts)
+		}
+	}
+}
+
+// recordBytesOut counts the records of a fetch response, topics are
+// answered in the order of the request
+func (srv *Server) recordBytesOut(req *FetchRequest, response *FetchResponse) {
+	for i, topic := range response.Responses {
+		bytes := 0
+		for _, partition := range topic.Partitions {
+			bytes += len(partition.Records)
+		}
+		if bytes == 0 || i >= len(req.Topics) {
+			continue
+		}
+		if name, _, code := srv.resolveFetchTopic(req.RequestAPIVersion, req.Topics[i]); code == ErrorCodeNone {
+			srv.metrics.bytesOut.Add(float64(bytes), name)
+		}
+	}
+}
+
+// metadataPartitions lists the partitions of every topic by id
+func (srv *Server) metadataPartitions() ([]file_metadata.TopicValue, map[uuid.UUID][]file_metadata.PartitionValue) {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	topics := srv.topics.list()
+	partitions := make(map[uuid.UUID][]file_metadata.PartitionValue, len(topics))
+	for _, topic := range topics {
+		partitions[topic.TopicId] = srv.topics.partitionsOf(topic.TopicId)
+	}
+	return topics, partitions
+}
+
+// logEndOffsets are the end offsets of every partition in the metadata, their
+// logs are opened as a fetch would
+func (srv *Server) logEndOffsets() map[topicPartition]int64 {
+	topics, partitions := srv.metadataPartitions()
+	offsets := make(map[topicPartition]int64)
+	for _, topic := range topics {
+		for _, partition := range partitions[topic.TopicId] {
+			log, err := srv.partitionLogs.get(topic.TopicName, partition.PartitionId)
+			if err != nil {
+				srv.log.Warn("Failed to open a partition log for its metrics", "topic", topic.TopicName, "partition", partition.PartitionId, "error", err)
+				continue
+			}
+			offsets[topicPartition{topic: topic.TopicName, partition: partition.PartitionId}] = log.EndOffset()
+		}
+	}
+	return offsets
+}
+
+// The collectors read the broker state, which is only loaded once the server
+// is ready
+
+func (srv *Server) collectLogEndOffsets(emit func(float64, ...string)) {
+	if !srv.ready.Load() {
+		return
+	}
+	for tp, offset := range srv.logEndOffsets() {
+		emit(float64(offset), tp.topic, strconv.Itoa(int(tp.partition)))
+	}
+}
+
+func (srv *Server) collectRequestQueueSize(emit func(float64, ...string)) {
+	if !srv.ready.Load() {
+		return
+	}
+	emit(float64(len(srv.requestQueue)))
+}
+
+func (srv *Server) collectDelayedOperations(emit func(float64, ...string)) {
+	emit(float64(srv.fetchPurgatory.Delayed()), "Fetch")
+	emit(float64(srv.producePurgatory.Delayed()), "Produce")
+}
+
+func (srv *Server) collectUnderReplicatedPartitions(emit func(float64, ...string)) {
+	if !srv.ready.Load() {
+		return
+	}
+	topics, partitions := srv.metadataPartitions()
+	count := 0
+	for _, topic := range topics {
+		for _, partition := range partitions[topic.TopicId] {
+			if len(partition.InSyncReplicaArray) < len(partition.ReplicaIdArray) {
+				count++
+			}
+		}
+	}
+	emit(float64(count))
+}
+
+// collectConsumerGroupLag reports the lag of the committed offsets of every
+// group, named like kafka_exporter's since Kafka has no such broker metric
+func (srv *Server) collectConsumerGroupLag(emit func(float64, ...string)) {
+	if !srv.ready.Load() {
+		return
+	}
+	endOffsets := srv.logEndOffsets()
+	for _, group := range srv.groupCoordinator.ListGroups(nil, nil) {
+		for _, lag := range srv.consumerGroupLag(group.GroupID, endOffsets) {
+			emit(float64(lag.Lag), group.GroupID, lag.Topic, strconv.Itoa(int(lag.Partition)))
+		}
+	}
+}
+
+func apiName(apiKey int) string {
+	if name, ok := apiNames[apiKey]; ok {
+		return name
+	}
+	return strconv.Itoa(apiKey)
+}
+
+func errorName(code int64) string {
+	if name, ok := errorNames[code]; ok {
+		return name
+	}
+	return strconv.FormatInt(code, 10)
+}
+
+// apiNames are the names of Kafka's ApiKeys enum, which its request label uses
+var apiNames = map[int]string{
+	ProduceAPIKEY:                 "Produce",
+	FetchAPIKEY:                   "Fetch",
+	MetadataAPIKEY:                "Metadata",
+	OffsetCommitAPIKEY:            "OffsetCommit",
+	OffsetFetchAPIKEY:             "OffsetFetch",
+	FindCoordinatorAPIKEY:         "FindCoordinator",
+	JoinGroupAPIKEY:               "JoinGroup",
+	HeartbeatAPIKEY:               "Heartbeat",
+	LeaveGroupAPIKEY:              "LeaveGroup",
+	SyncGroupAPIKEY:               "SyncGroup",
+	DescribeGroupsAPIKEY:          "DescribeGroups",
+	ListGroupsAPIKEY:              "ListGroups",
+	SaslHandshakeAPIKEY:           "SaslHandshake",
+	ApiVersionAPIKEY:              "ApiVersions",
+	CreateTopicsAPIKEY:            "CreateTopics",
+	DeleteTopicsAPIKEY:            "DeleteTopics",
+	InitProducerIdAPIKEY:          "InitProducerId",
+	AddPartitionsToTxnAPIKEY:      "AddPartitionsToTxn",
+	AddOffsetsToTxnAPIKEY:         "AddOffsetsToTxn",
+	EndTxnAPIKEY:                  "EndTxn",
+	WriteTxnMarkersAPIKEY:         "WriteTxnMarkers",
+	TxnOffsetCommitAPIKEY:         "TxnOffsetCommit",
+	DescribeAclsAPIKEY:            "DescribeAcls",
+	CreateAclsAPIKEY:              "CreateAcls",
+	DeleteAclsAPIKEY:              "DeleteAcls",
+	DescribeConfigsAPIKEY:         "DescribeConfigs",
+	AlterConfigsAPIKEY:            "AlterConfigs",
+	SaslAuthenticateAPIKEY:        "SaslAuthenticate",
+	CreatePartitionsAPIKEY:        "CreatePartitions",
+	DeleteGroupsAPIKEY:            "DeleteGroups",
+	IncrementalAlterConfigsAPIKEY: "IncrementalAlterConfigs",
+	DescribeClientQuotasAPIKEY:    "DescribeClientQuotas",
+	AlterClientQuotasAPIKEY:       "AlterClientQuotas",
+	ConsumerGroupHeartbeatAPIKEY:  "ConsumerGroupHeartbeat",
+	ConsumerGroupDescribeAPIKEY:   "ConsumerGroupDescribe",
+	DescribeTopicPartitionsAPIKEY: "DescribeTopicPartitions",
+}
+
+// errorNames are the names of Kafka's Errors enum for the codes the broker
+// and its coordinators answer with
+var errorNames = map[int64]string{
+	-1:  "UNKNOWN_SERVER_ERROR",
+	0:   "NONE",
+	1:   "OFFSET_OUT_OF_RANGE",
+	2:   "CORRUPT_MESSAGE",
+	3:   "UNKNOWN_TOPIC_OR_PARTITION",
+	7:   "REQUEST_TIMED_OUT",
+	10:  "MESSAGE_TOO_LARGE",
+	12:  "OFFSET_METADATA_TOO_LARGE",
+	15:  "COORDINATOR_NOT_AVAILABLE",
+	17:  "INVALID_TOPIC_EXCEPTION",
+	19:  "NOT_ENOUGH_REPLICAS",
+	20:  "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	21:  "INVALID_REQUIRED_ACKS",
+	22:  "ILLEGAL_GENERATION",
+	23:  "INCONSISTENT_GROUP_PROTOCOL",
+	24:  "INVALID_GROUP_ID",
+	25:  "UNKNOWN_MEMBER_ID",
+	26:  "INVALID_SESSION_TIMEOUT",
+	27:  "REBALANCE_IN_PROGRESS",
+	29:  "TOPIC_AUTHORIZATION_FAILED",
+	30:  "GROUP_AUTHORIZATION_FAILED",
+	31:  "CLUSTER_AUTHORIZATION_FAILED",
+	33:  "UNSUPPORTED_SASL_MECHANISM",
+	34:  "ILLEGAL_SASL_STATE",
+	35:  "UNSUPPORTED_VERSION",
+	36:  "TOPIC_ALREADY_EXISTS",
+	37:  "INVALID_PARTITIONS",
+	38:  "INVALID_REPLICATION_FACTOR",
+	39:  "INVALID_REPLICA_ASSIGNMENT",
+	40:  "INVALID_CONFIG",
+	42:  "INVALID_REQUEST",
+	45:  "OUT_OF_ORDER_SEQUENCE_NUMBER",
+	47:  "INVALID_PRODUCER_EPOCH",
+	48:  "INVALID_TXN_STATE",
+	49:  "INVALID_PRODUCER_ID_MAPPING",
+	50:  "INVALID_TRANSACTION_TIMEOUT",
+	51:  "CONCURRENT_TRANSACTIONS",
+	53:  "TRANSACTIONAL_ID_AUTHORIZATION_FAILED",
+	54:  "SECURITY_DISABLED",
+	55:  "OPERATION_NOT_ATTEMPTED",
+	56:  "KAFKA_STORAGE_ERROR",
+	58:  "SASL_AUTHENTICATION_FAILED",
+	68:  "NON_EMPTY_GROUP",
+	69:  "GROUP_ID_NOT_FOUND",
+	79:  "MEMBER_ID_REQUIRED",
+	82:  "FENCED_INSTANCE_ID",
+	87:  "INVALID_RECORD",
+	88:  "UNSTABLE_OFFSET_COMMIT",
+	90:  "PRODUCER_FENCED",
+	100: "UNKNOWN_TOPIC_ID",
+	110: "FENCED_MEMBER_EPOCH",
+	111: "UNRELEASED_INSTANCE_ID",
+	112: "UNSUPPORTED_ASSIGNOR",
+	113: "STALE_MEMBER_EPOCH",
+	130: "INVALID_REGULAR_EXPRESSION",
+}
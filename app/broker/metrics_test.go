@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+	server := startHTTPServer(t)
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	// ApiVersions v0, then v5 which is answered with UNSUPPORTED_VERSION
+	for _, request := range []string{"0000000d001200000000002a0003636c69", "0000000d001200050000002b0003636c69"} {
+		bytes, _ := hex.DecodeString(request)
+		if _, err := conn.Write(bytes); err != nil {
+			t.Fatalf("Failed to write to server: %v", err)
+		}
+		if _, err := readRequest(conn, 1<<20); err != nil {
+			t.Fatalf("Failed to read from server: %v", err)
+		}
+	}
+
+	response, err := http.Get("http://" + server.HTTPAddr() + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to scrape the metrics: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	for _, line := range []string{
+		`kafka_network_requestmetrics_requests_total{request="ApiVersions",version="0"} 1`,
+		`kafka_network_requestmetrics_errors_total{request="ApiVersions",error="NONE"} 1`,
+		`kafka_network_requestmetrics_errors_total{request="ApiVersions",error="UNSUPPORTED_VERSION"} 1`,
+		`kafka_network_requestmetrics_totaltimems_count{request="ApiVersions",version="5"} 1`,
+		`kafka_network_requestmetrics_requestqueuetimems_count{request="ApiVersions"} 2`,
+		`kafka_network_requestmetrics_localtimems_count{request="ApiVersions"} 2`,
+		`kafka_network_requestchannel_requestqueuesize 0`,
+		`kafka_server_delayedoperationpurgatory_numdelayedoperations{delayedOperation="Fetch"} 0`,
+		`kafka_server_socket_server_metrics_connection_count{listener="PLAINTEXT"} 1`,
+		`kafka_log_log_logendoffset{topic="__consumer_offsets",partition="0"} 0`,
+		`kafka_server_replicamanager_underreplicatedpartitions 0`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Expected %s in the metrics, got\n%s", line, body)
+		}
+	}
+}
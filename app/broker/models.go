@@ -0,0 +1,2213 @@
+package broker
+
+// ===================================================================================
+
+// Kafka API Versions Request (v4)
+
+// Part 1
+// 00 00 00 23  // message_size
+
+// Part 2
+// 00 12		// request_api_key
+// 00 04 		// request_api_version
+// 00 00 00 07  // correlation_id
+// 00 09 		// api_client_id_length
+// 7d 00 09 	// api_client_id_content (variable length)
+// 6b 61 66
+// 6b 61 2d
+// 00			// api_tag_buffer
+
+// Part 3: Client ID
+// 0a 			// client_id_length
+// 00 00 00 	// cliend_id_content (variable length)
+// 00 00 00
+// 00 00 00
+
+// Client Software Version
+// 04 			// client_software_version_length
+// 00 00 00 	// client_software_version_content <- length is 1 less (variable length)
+// 00 			// client_software_version_tag_buffer
+
+// Minimal request structure (always present)
+type MinimalRequest struct {
+	MessageSize       int
+	RequestAPIKey     int
+	RequestAPIVersion int
+	CorrelationID     int32
+}
+
+// Full request structure with optional fields
+type FullRequest struct {
+	MinimalRequest
+	APIClientIDLength              int
+	APIClientIDContent             []byte
+	APITagBuffer                   int
+	ClientIDLength                 int
+	ClientIDContent                []byte
+	ClientSoftwareVersionLength    int
+	ClientSoftwareVersionContent   []byte
+	ClientSoftwareVersionTagBuffer int
+}
+
+// ===================================================================================
+
+// Kafka API Versions Response (v4)
+
+// 00 00 00 21  // message_size
+
+// Response Header V0
+// 00 00 00 07  // correlation_id
+
+// API Versions Response Body (v4)
+// 00 00		// Error code
+// 04			// Array Length: The length of the API Versions array + 1
+
+// API Version #1
+// 00 01		// API Key
+// 00 00		// Min supported API Version
+// 00 11		// Max supported API Version
+// 00			// Tag Buffer
+
+// API Version #2
+// 00 12		// API Key
+// 00 00		// Min supported API Version
+// 00 04		// Max supported API Version
+// 00 			// Tag Buffer
+
+// API Version #3
+// 00 4b		// API Key
+// 00 00		// Min supported API Version
+// 00 00		// Max supported API Version
+// 00 			// Tag Buffer
+
+// 00 00 00 00 	// Throttle time
+// 00  			// Tag buffer
+
+// Response structure
+type Response struct {
+	MessageSize   int
+	CorrelationID int32
+	ErrorCode     int
+	ArrayLength   int
+	APIVersions   []APIVersion
+	ThrottleTime  int
+	TagBuffer     int
+}
+
+// API Version entry for response
+type APIVersion struct {
+	APIKey     int
+	MinVersion int
+	MaxVersion int
+	TagBuffer  int
+}
+
+// ===================================================================================
+
+// Kafka DescribeTopicPartitions Request (v0)
+// MINIMAL REQUEST +
+// 00 09 		// topic_client_id_length
+// 00 00 00		// topic_client_id_content
+// 00 00 00
+// 00 00 00
+// 00			// tag buffer
+
+// Describe topics paritions
+
+// 02			// topics_array_length (The length of the topics array + 1)
+// 04			// topic_name_length (The length of the topic name + 1)
+// 00 00 00 	// topic_name (actual topic name)
+// 00 			// topic tag buffer
+
+// Response Patition Limit
+// 00 00 00 64	// response_partition_limit (imits the number of partitions to be returned in the response)
+// 00 			// cursor (A nullable field that can be used for pagination.)
+// 00 			// Tag Buffer
+
+// Topic in the DescribeTopicPartitions request
+type TopicRequest struct {
+	TopicNameLength int8
+	TopicName       []byte
+	TopicTagBuffer  int
+}
+
+// DescribeTopicPartitions Request (v0)
+type DescribeTopicPartitionsRequest struct {
+	MinimalRequest
+	TopicClientIDLength    int
+	TopicClientIDContent   []byte
+	TagBuffer              int
+	TopicsArrayLength      int
+	Topics                 []TopicRequest
+	ResponsePartitionLimit int
+	Cursor                 int
+	RequestTagBuffer       int
+}
+
+// ===================================================================================
+
+// Kafka DescribeTopicPartitions Response (v0) - Unknown Topic
+
+// 00 00 00 29  // message_size
+// 00 00 00 07	// correlation_id
+// 00 			// tag buffer
+
+// Describe topic partitions
+
+// 00 00 00 00	// throttle_time
+// 02			// topics_array_length (The length of the topics array + 1)
+
+// topic 1
+
+// 00 03		// Error code (03 means unknown_topic)
+// 04			// topic_name_length (The length of the topic name + 1)
+// 00 00 00 	// topic_name (actual topic name)
+// 00 00 00 00 	// topic_id (16 bytes)
+// 00 00 00 00
+// 00 00 00 00
+// 00 00 00 00
+// 00 			// is_internal (A boolean indicating whether the topic is internal)
+// 03			// partitions_array_length (A COMPACT_ARRAY of partitions for this topic, which contains the length + 1 encoded as a varint, followed by the contents.)
+//	00 00	 	// Error code 00 means no error
+//	00 00 00 00	// Partition Index
+//	00 00 00 01 // leader id
+//  00 00 00 00 // leader epoch
+//  02 			// replica_node_length
+// 00 00 00 01  // replica_node A 4-byte integer representing a replica node ID
+// 02			// isr nodes length
+// 00 00 00 01  // A 4-byte integer representing an in-sync replica node ID.
+// 01			// eligible leader replica number
+// eligible leader replicas
+// LastKnownELR
+// offline replicas
+// 00 			// tag buffer
+// 00 00		// error code
+// 00 00 00 01	// Partition Index
+// ...
+// 00 00 00 00 	// topic_auth_ops 4 byte bit field to show authorized operations for this topic.
+// 00 			// tag buffer
+
+// ff 			// next_cursor (-1 for null)
+// 00 			// tag buffer
+
+type Partition struct {
+	ErrorCode              int16
+	PartitionIndex         int32
+	LeaderID               int32
+	LeaderEpoch            int32
+	ReplicaNodes           []int32
+	ISRNodes               []int32
+	EligibleLeaderReplicas []int32
+	LastKnownELR           []int32
+	OfflineReplicas        []int32
+	TaggedFields           int8
+}
+
+type TopicResponse struct {
+	ErrorCode         int16
+	TopicNameLength   int8
+	TopicName         []byte
+	TopicID           [16]byte // 16 bytes UUID
+	IsInternal        bool
+	PartitionsArray   []Partition
+	TopicAuthOps      int32 // 4 byte bit field for authorized operations
+	ResponseTagBuffer int8
+}
+
+// DescribeTopicPartitions Response (v0)
+type DescribeTopicPartitionsResponse struct {
+	MessageSize       int32
+	CorrelationID     int32
+	TagBuffer         int8
+	ThrottleTime      int32
+	TopicsArrayLength int8
+	Topics            []TopicResponse
+	NextCursor        int8
+	ResponseTagBuffer int8
+}
+
+// Meaning of different codes in the topic_auth_ops
+// READ (bit index 3 from the right)
+// WRITE (bit index 4 from the right)
+// CREATE (bit index 5 from the right)
+// DELETE (bit index 6 from the right)
+// ALTER (bit index 7 from the right)
+// DESCRIBE (bit index 8 from the right)
+// DESCRIBE_CONFIGS (bit index 10 from the right)
+// ALTER_CONFIGS (bit index 11 from the right)
+
+const (
+	TopicAuthOpRead            = 1 << 3  // bit index 3 from the right
+	TopicAuthOpWrite           = 1 << 4  // bit index 4 from the right
+	TopicAuthOpCreate          = 1 << 5  // bit index 5 from the right
+	TopicAuthOpDelete          = 1 << 6  // bit index 6 from the right
+	TopicAuthOpAlter           = 1 << 7  // bit index 7 from the right
+	TopicAuthOpDescribe        = 1 << 8  // bit index 8 from the right
+	TopicAuthOpDescribeConfigs = 1 << 10 // bit index 10 from the right
+	TopicAuthOpAlterConfigs    = 1 << 11 // bit index 11 from the right
+)
+
+// Error codes
+const (
+	ErrorCodeUnknownServerError                 = -1
+	ErrorCodeNone                               = 0
+	ErrorCodeOffsetOutOfRange                   = 1
+	ErrorCodeCorruptMessage                     = 2
+	ErrorCodeUnknownTopic                       = 3
+	ErrorCodeRequestTimedOut                    = 7
+	ErrorCodeMessageTooLarge                    = 10
+	ErrorCodeCoordinatorNotAvailable            = 15
+	ErrorCodeInvalidTopic                       = 17
+	ErrorCodeNotEnoughReplicas                  = 19
+	ErrorCodeNotEnoughReplicasAfterAppend       = 20
+	ErrorCodeInvalidRequiredAcks                = 21
+	ErrorCodeTopicAlreadyExists                 = 36
+	ErrorCodeInvalidPartitions                  = 37
+	ErrorCodeInvalidReplicationFactor           = 38
+	ErrorCodeInvalidReplicaAssignment           = 39
+	ErrorCodeInvalidConfig                      = 40
+	ErrorCodeTopicAuthorizationFailed           = 29
+	ErrorCodeGroupAuthorizationFailed           = 30
+	ErrorCodeClusterAuthorizationFailed         = 31
+	ErrorCodeUnsupportedSaslMechanism           = 33
+	ErrorCodeIllegalSaslState                   = 34
+	ErrorCodeInvalidRequest                     = 42
+	ErrorCodeOutOfOrderSequence                 = 45
+	ErrorCodeSecurityDisabled                   = 54
+	ErrorCodeOperationNotAttempted              = 55
+	ErrorCodeInvalidProducerEpoch               = 47
+	ErrorCodeInvalidTxnState                    = 48
+	ErrorCodeTransactionalIDAuthorizationFailed = 53
+	ErrorCodeKafkaStorageError                  = 56
+	ErrorCodeSaslAuthenticationFailed           = 58
+	ErrorCodeGroupIDNotFound                    = 69
+	ErrorCodeInvalidRecord                      = 87
+	ErrorCodeUnstableOffsetCommit               = 88
+	ErrorCodeProducerFenced                     = 90
+	ErrorCodeUnknownTopicID                     = 100
+)
+
+// ===================================================================================
+
+// Request Header (v2), used by every flexible request version
+
+// 00 00 00 31  // message_size
+// 00 13        // request_api_key
+// 00 07        // request_api_version
+// 00 00 00 07  // correlation_id
+// 00 0c        // client_id_length (INT16, -1 means null)
+// 6b 61 66     // client_id_content (variable length)
+// ...
+// 00           // tag buffer
+
+type RequestHeader struct {
+	MinimalRequest
+	ClientID string
+}
+
+// ===================================================================================
+
+// Kafka CreateTopics Request (v5 - v7)
+// REQUEST HEADER V2 +
+// 02           // topics_array_length (compact array)
+// 04 66 6f 6f  // name (compact string)
+// ff ff ff ff  // num_partitions (-1 uses the broker default)
+// ff ff        // replication_factor (-1 uses the broker default)
+// 01           // assignments (compact array: partition_index, broker_ids, tag buffer)
+// 01           // configs (compact array: name, nullable value, tag buffer)
+// 00           // topic tag buffer
+// 00 00 75 30  // timeout_ms
+// 00           // validate_only
+// 00           // tag buffer
+
+type CreatableReplicaAssignment struct {
+	PartitionIndex int32
+	BrokerIDs      []int32
+}
+
+type CreatableTopicConfig struct {
+	Name        string
+	Value       string
+	ValueIsNull bool
+}
+
+type CreatableTopic struct {
+	Name              string
+	NumPartitions     int32
+	ReplicationFactor int16
+	Assignments       []CreatableReplicaAssignment
+	Configs           []CreatableTopicConfig
+}
+
+type CreateTopicsRequest struct {
+	RequestHeader
+	Topics       []CreatableTopic
+	TimeoutMs    int32
+	ValidateOnly bool
+}
+
+// Kafka CreateTopics Response (v5 - v7)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // topics_array_length (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 00 .. 00     // topic_id (16 bytes, v7+)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 00 00 00 01  // num_partitions
+// 00 01        // replication_factor
+// 01           // configs (compact nullable array: name, value, read_only, config_source, is_sensitive, tag buffer)
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type CreatableTopicResultConfig struct {
+	Name         string
+	Value        string
+	ValueIsNull  bool
+	ReadOnly     bool
+	ConfigSource int8
+	IsSensitive  bool
+}
+
+type CreatableTopicResult struct {
+	Name              string
+	TopicID           [16]byte
+	ErrorCode         int16
+	ErrorMessage      string
+	NumPartitions     int32
+	ReplicationFactor int16
+	Configs           []CreatableTopicResultConfig
+}
+
+type CreateTopicsResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	Topics        []CreatableTopicResult
+}
+
+// Config sources reported back to clients
+const (
+	ConfigSourceDynamicTopic = 1
+)
+
+// ===================================================================================
+
+// Kafka DeleteTopics Request (v6)
+// REQUEST HEADER V2 +
+// 02           // topics_array_length (compact array)
+// 04 66 6f 6f  // name (compact nullable string, null when deleting by id)
+// 00 .. 00     // topic_id (16 bytes, zero when deleting by name)
+// 00           // topic tag buffer
+// 00 00 75 30  // timeout_ms
+// 00           // tag buffer
+
+type DeleteTopicState struct {
+	Name       string
+	NameIsNull bool
+	TopicID    [16]byte
+}
+
+type DeleteTopicsRequest struct {
+	RequestHeader
+	Topics    []DeleteTopicState
+	TimeoutMs int32
+}
+
+// Kafka DeleteTopics Response (v6)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // responses_array_length (compact array)
+// 04 66 6f 6f  // name (compact nullable string)
+// 00 .. 00     // topic_id (16 bytes)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type DeletableTopicResult struct {
+	Name         string
+	NameIsNull   bool
+	TopicID      [16]byte
+	ErrorCode    int16
+	ErrorMessage string
+}
+
+type DeleteTopicsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Responses     []DeletableTopicResult
+}
+
+// ===================================================================================
+
+// Kafka CreatePartitions Request (v2 - v3)
+// REQUEST HEADER V2 +
+// 02           // topics_array_length (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 00 00 00 04  // count (the new total number of partitions)
+// 00           // assignments (compact nullable array: broker_ids, tag buffer), null to let the broker place them
+// 00           // topic tag buffer
+// 00 00 75 30  // timeout_ms
+// 00           // validate_only
+// 00           // tag buffer
+
+type CreatePartitionsTopic struct {
+	Name        string
+	Count       int32
+	Assignments [][]int32 // broker ids of every new partition, nil when not given
+}
+
+type CreatePartitionsRequest struct {
+	RequestHeader
+	Topics       []CreatePartitionsTopic
+	TimeoutMs    int32
+	ValidateOnly bool
+}
+
+// Kafka CreatePartitions Response (v2 - v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // results_array_length (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 00           // result tag buffer
+// 00           // tag buffer
+
+type CreatePartitionsTopicResult struct {
+	Name         string
+	ErrorCode    int16
+	ErrorMessage string
+}
+
+type CreatePartitionsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Results       []CreatePartitionsTopicResult
+}
+
+// ===================================================================================
+
+// Kafka FindCoordinator Request (v3 - v4)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // key (compact string, v3 only)
+// 00           // key_type (0 = group, 1 = transaction)
+// 02           // coordinator_keys (compact array of compact strings, v4+)
+// 04 67 72 70
+// 00           // tag buffer
+
+type FindCoordinatorRequest struct {
+	RequestHeader
+	KeyType int8
+	Keys    []string // the single v3 key or every v4+ coordinator key
+}
+
+// Kafka FindCoordinator Response (v3 - v4)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// v3: error_code, error_message, node_id, host, port, tag buffer
+// v4+: coordinators (compact array)
+// 04 67 72 70  // key (compact string)
+// 00 00 00 01  // node_id
+// 0a 6c 6f ..  // host (compact string)
+// 00 00 23 84  // port
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 00           // coordinator tag buffer
+// 00           // tag buffer
+
+type Coordinator struct {
+	Key          string
+	NodeID       int32
+	Host         string
+	Port         int32
+	ErrorCode    int16
+	ErrorMessage string
+}
+
+type FindCoordinatorResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	Coordinators  []Coordinator
+}
+
+// ===================================================================================
+
+// Kafka JoinGroup Request (v6 - v9)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// 00 00 27 10  // session_timeout_ms
+// 00 04 93 e0  // rebalance_timeout_ms
+// 01           // member_id (compact string, empty on the first join)
+// 00           // group_instance_id (compact nullable string, static membership)
+// 09 63 6f ..  // protocol_type (compact string)
+// 02           // protocols (compact array: name, metadata (compact bytes), tag buffer)
+// 00           // reason (compact nullable string, v8+)
+// 00           // tag buffer
+
+type JoinGroupRequestProtocol struct {
+	Name     string
+	Metadata []byte
+}
+
+type JoinGroupRequest struct {
+	RequestHeader
+	GroupID            string
+	SessionTimeoutMs   int32
+	RebalanceTimeoutMs int32
+	MemberID           string
+	GroupInstanceID    string
+	ProtocolType       string
+	Protocols          []JoinGroupRequestProtocol
+	Reason             string
+}
+
+// Kafka JoinGroup Response (v6 - v9)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00 00 00 01  // generation_id
+// 09 63 6f ..  // protocol_type (compact nullable string, v7+)
+// 06 72 61 ..  // protocol_name (compact nullable string)
+// 25 ...       // leader (compact string)
+// 00           // skip_assignment (v9+)
+// 25 ...       // member_id (compact string)
+// 02           // members (compact array: member_id, group_instance_id, metadata, tag buffer), only sent to the leader
+// 00           // tag buffer
+
+type JoinGroupResponseMember struct {
+	MemberID        string
+	GroupInstanceID string
+	Metadata        []byte
+}
+
+type JoinGroupResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	ErrorCode     int16
+	GenerationID  int32
+	ProtocolType  string
+	ProtocolName  string
+	Leader        string
+	MemberID      string
+	Members       []JoinGroupResponseMember
+}
+
+// ===================================================================================
+
+// Kafka SyncGroup Request (v4 - v5)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// 00 00 00 01  // generation_id
+// 25 ...       // member_id (compact string)
+// 00           // group_instance_id (compact nullable string)
+// 09 63 6f ..  // protocol_type (compact nullable string, v5+)
+// 06 72 61 ..  // protocol_name (compact nullable string, v5+)
+// 02           // assignments (compact array: member_id, assignment (compact bytes), tag buffer), only from the leader
+// 00           // tag buffer
+
+type SyncGroupRequestAssignment struct {
+	MemberID   string
+	Assignment []byte
+}
+
+type SyncGroupRequest struct {
+	RequestHeader
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+	ProtocolType    string
+	ProtocolName    string
+	Assignments     []SyncGroupRequestAssignment
+}
+
+// Kafka SyncGroup Response (v4 - v5)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 09 63 6f ..  // protocol_type (compact nullable string, v5+)
+// 06 72 61 ..  // protocol_name (compact nullable string, v5+)
+// 05 ...       // assignment (compact bytes)
+// 00           // tag buffer
+
+type SyncGroupResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	ErrorCode     int16
+	ProtocolType  string
+	ProtocolName  string
+	Assignment    []byte
+}
+
+// ===================================================================================
+
+// Kafka Heartbeat Request (v4)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// 00 00 00 01  // generation_id
+// 25 ...       // member_id (compact string)
+// 00           // group_instance_id (compact nullable string)
+// 00           // tag buffer
+
+type HeartbeatRequest struct {
+	RequestHeader
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+}
+
+// Kafka Heartbeat Response (v4)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // tag buffer
+
+type HeartbeatResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+}
+
+// ===================================================================================
+
+// Kafka LeaveGroup Request (v4 - v5)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// 02           // members (compact array)
+// 25 ...       // member_id (compact string)
+// 00           // group_instance_id (compact nullable string)
+// 00           // reason (compact nullable string, v5+)
+// 00           // member tag buffer
+// 00           // tag buffer
+
+type LeaveGroupRequestMember struct {
+	MemberID        string
+	GroupInstanceID string
+	Reason          string
+}
+
+type LeaveGroupRequest struct {
+	RequestHeader
+	GroupID string
+	Members []LeaveGroupRequestMember
+}
+
+// Kafka LeaveGroup Response (v4 - v5)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 02           // members (compact array: member_id, group_instance_id, error_code, tag buffer)
+// 00           // tag buffer
+
+type LeaveGroupResponseMember struct {
+	MemberID        string
+	GroupInstanceID string
+	ErrorCode       int16
+}
+
+type LeaveGroupResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+	Members       []LeaveGroupResponseMember
+}
+
+// ===================================================================================
+
+// Kafka OffsetCommit Request (v8 - v9)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// ff ff ff ff  // generation_id_or_member_epoch (-1 for commits from outside of the group)
+// 01           // member_id (compact string)
+// 00           // group_instance_id (compact nullable string)
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00 00 00 00 00 00 2a  // committed_offset
+// ff ff ff ff  // committed_leader_epoch
+// 01           // committed_metadata (compact nullable string)
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type OffsetCommitRequestPartition struct {
+	PartitionIndex       int32
+	CommittedOffset      int64
+	CommittedLeaderEpoch int32
+	CommittedMetadata    string
+}
+
+type OffsetCommitRequestTopic struct {
+	Name       string
+	Partitions []OffsetCommitRequestPartition
+}
+
+type OffsetCommitRequest struct {
+	RequestHeader
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+	Topics          []OffsetCommitRequestTopic
+}
+
+// Kafka OffsetCommit Response (v8 - v9)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array: partition_index, error_code, tag buffer)
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type OffsetCommitResponsePartition struct {
+	PartitionIndex int32
+	ErrorCode      int16
+}
+
+type OffsetCommitResponseTopic struct {
+	Name       string
+	Partitions []OffsetCommitResponsePartition
+}
+
+type OffsetCommitResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Topics        []OffsetCommitResponseTopic
+}
+
+// ===================================================================================
+
+// Kafka OffsetFetch Request (v8 - v9)
+// REQUEST HEADER V2 +
+// 02           // groups (compact array)
+// 04 67 72 70  // group_id (compact string)
+// 00           // member_id (compact nullable string, v9+)
+// ff ff ff ff  // member_epoch (v9+)
+// 02           // topics (compact nullable array, null for every committed offset)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partition_indexes (compact array of int32)
+// 00 00 00 00
+// 00           // topic tag buffer
+// 00           // group tag buffer
+// 00           // require_stable
+// 00           // tag buffer
+
+type OffsetFetchRequestTopic struct {
+	Name             string
+	PartitionIndexes []int32
+}
+
+type OffsetFetchRequestGroup struct {
+	GroupID     string
+	MemberID    string
+	MemberEpoch int32
+	Topics      []OffsetFetchRequestTopic // nil for every committed offset of the group
+}
+
+type OffsetFetchRequest struct {
+	RequestHeader
+	Groups        []OffsetFetchRequestGroup
+	RequireStable bool
+}
+
+// Kafka OffsetFetch Response (v8 - v9)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // groups (compact array)
+// 04 67 72 70  // group_id (compact string)
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00 00 00 00 00 00 2a  // committed_offset (-1 when nothing was committed)
+// ff ff ff ff  // committed_leader_epoch
+// 01           // metadata (compact nullable string)
+// 00 00        // error_code
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00 00        // error_code
+// 00           // group tag buffer
+// 00           // tag buffer
+
+type OffsetFetchResponsePartition struct {
+	PartitionIndex       int32
+	CommittedOffset      int64
+	CommittedLeaderEpoch int32
+	Metadata             string
+	ErrorCode            int16
+}
+
+type OffsetFetchResponseTopic struct {
+	Name       string
+	Partitions []OffsetFetchResponsePartition
+}
+
+type OffsetFetchResponseGroup struct {
+	GroupID   string
+	Topics    []OffsetFetchResponseTopic
+	ErrorCode int16
+}
+
+type OffsetFetchResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Groups        []OffsetFetchResponseGroup
+}
+
+// ===================================================================================
+
+// Kafka Metadata Request (v9 - v12)
+// REQUEST HEADER V2 +
+// 02           // topics (compact nullable array, null for every topic)
+// 00 00 00 00  // topic_id (16 bytes, v10+)
+// 00 00 00 00
+// 00 00 00 00
+// 00 00 00 00
+// 04 66 6f 6f  // name (compact string, nullable in v12+)
+// 00           // topic tag buffer
+// 01           // allow_auto_topic_creation
+// 00           // include_cluster_authorized_operations (v9 - v10)
+// 00           // include_topic_authorized_operations
+// 00           // tag buffer
+
+type MetadataRequestTopic struct {
+	TopicID [16]byte
+	Name    string
+}
+
+type MetadataRequest struct {
+	RequestHeader
+	Topics                             []MetadataRequestTopic // nil for every topic
+	AllowAutoTopicCreation             bool
+	IncludeClusterAuthorizedOperations bool
+	IncludeTopicAuthorizedOperations   bool
+}
+
+// Kafka Metadata Response (v9 - v12)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // brokers (compact array)
+// 00 00 00 01  // node_id
+// 0a 6c 6f ..  // host (compact string)
+// 00 00 23 84  // port
+// 00           // rack (compact nullable string)
+// 00           // broker tag buffer
+// 00           // cluster_id (compact nullable string)
+// 00 00 00 01  // controller_id
+// 02           // topics (compact array)
+// 00 00        // error_code
+// 04 66 6f 6f  // name (compact nullable string)
+// 00 .. 00     // topic_id (16 bytes, v10+)
+// 00           // is_internal
+// 02           // partitions (compact array)
+// 00 00        // error_code
+// 00 00 00 00  // partition_index
+// 00 00 00 01  // leader_id
+// 00 00 00 00  // leader_epoch
+// 02 00 00 00 01  // replica_nodes (compact array of int32)
+// 02 00 00 00 01  // isr_nodes (compact array of int32)
+// 01           // offline_replicas (compact array of int32)
+// 00           // partition tag buffer
+// 80 00 00 00  // topic_authorized_operations (INT32_MIN when not requested)
+// 00           // topic tag buffer
+// 80 00 00 00  // cluster_authorized_operations (v9 - v10)
+// 00           // tag buffer
+
+type MetadataResponseBroker struct {
+	NodeID int32
+	Host   string
+	Port   int32
+}
+
+type MetadataResponsePartition struct {
+	ErrorCode       int16
+	PartitionIndex  int32
+	LeaderID        int32
+	LeaderEpoch     int32
+	ReplicaNodes    []int32
+	ISRNodes        []int32
+	OfflineReplicas []int32
+}
+
+type MetadataResponseTopic struct {
+	ErrorCode                 int16
+	Name                      string
+	TopicID                   [16]byte
+	IsInternal                bool
+	Partitions                []MetadataResponsePartition
+	TopicAuthorizedOperations int32
+}
+
+type MetadataResponse struct {
+	CorrelationID               int32
+	APIVersion                  int
+	ThrottleTime                int32
+	Brokers                     []MetadataResponseBroker
+	ClusterID                   string
+	ControllerID                int32
+	Topics                      []MetadataResponseTopic
+	ClusterAuthorizedOperations int32
+}
+
+// ===================================================================================
+
+// Kafka ConsumerGroupHeartbeat Request (v0 - v1)
+// REQUEST HEADER V2 +
+// 04 67 72 70  // group_id (compact string)
+// 01           // member_id (compact string, empty on the first heartbeat of v0 clients)
+// 00 00 00 00  // member_epoch (0 to join, -1 to leave, -2 for a static member to leave)
+// 00           // instance_id (compact nullable string)
+// 00           // rack_id (compact nullable string)
+// 00 00 75 30  // rebalance_timeout_ms (-1 when unchanged)
+// 02 04 66 6f 6f  // subscribed_topic_names (compact nullable array of compact strings, null when unchanged)
+// 00           // subscribed_topic_regex (compact nullable string, v1+)
+// 00           // server_assignor (compact nullable string)
+// 00           // topic_partitions (compact nullable array: topic_id, partitions, tag buffer, null when unchanged)
+// 00           // tag buffer
+
+type ConsumerGroupHeartbeatTopicPartitions struct {
+	TopicID    [16]byte
+	Partitions []int32
+}
+
+type ConsumerGroupHeartbeatRequest struct {
+	RequestHeader
+	GroupID                string
+	MemberID               string
+	MemberEpoch            int32
+	InstanceID             string
+	RackID                 string
+	RebalanceTimeoutMs     int32
+	SubscribedTopicNames   []string // nil when unchanged
+	SubscribedTopicRegex   string
+	SubscribedTopicRegexOK bool // false when the regex is null
+	ServerAssignor         string
+	ServerAssignorOK       bool                                    // false when the assignor is null
+	TopicPartitions        []ConsumerGroupHeartbeatTopicPartitions // nil when unchanged
+}
+
+// Kafka ConsumerGroupHeartbeat Response (v0 - v1)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 25 ...       // member_id (compact nullable string)
+// 00 00 00 01  // member_epoch
+// 00 00 13 88  // heartbeat_interval_ms
+// 01           // assignment (nullable struct, ff when null)
+// 02           // topic_partitions (compact array: topic_id, partitions, tag buffer)
+// 00           // assignment tag buffer
+// 00           // tag buffer
+
+type ConsumerGroupHeartbeatResponse struct {
+	CorrelationID       int32
+	ThrottleTime        int32
+	ErrorCode           int16
+	ErrorMessage        string
+	MemberID            string
+	MemberEpoch         int32
+	HeartbeatIntervalMs int32
+	Assignment          []ConsumerGroupHeartbeatTopicPartitions // nil when not sent
+}
+
+// ===================================================================================
+
+// Kafka ConsumerGroupDescribe Request (v0 - v1)
+// REQUEST HEADER V2 +
+// 02 04 67 72 70  // group_ids (compact array of compact strings)
+// 00           // include_authorized_operations
+// 00           // tag buffer
+
+type ConsumerGroupDescribeRequest struct {
+	RequestHeader
+	GroupIDs                    []string
+	IncludeAuthorizedOperations bool
+}
+
+// Kafka ConsumerGroupDescribe Response (v0 - v1)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // groups (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 04 67 72 70  // group_id (compact string)
+// 07 53 74 ..  // group_state (compact string)
+// 00 00 00 02  // group_epoch
+// 00 00 00 02  // assignment_epoch
+// 08 75 6e ..  // assignor_name (compact string)
+// 02           // members (compact array)
+//   member_id, instance_id, rack_id, member_epoch, client_id, client_host,
+//   subscribed_topic_names, subscribed_topic_regex, assignment, target_assignment,
+//   member_type (int8, v1+), tag buffer
+// 80 00 00 00  // authorized_operations
+// 00           // group tag buffer
+// 00           // tag buffer
+//
+// An assignment is a compact array of (topic_id, topic_name, partitions, tag
+// buffer) followed by its own tag buffer
+
+type ConsumerGroupDescribeTopicPartitions struct {
+	TopicID    [16]byte
+	TopicName  string
+	Partitions []int32
+}
+
+type ConsumerGroupDescribeMember struct {
+	MemberID             string
+	InstanceID           string
+	RackID               string
+	MemberEpoch          int32
+	ClientID             string
+	ClientHost           string
+	SubscribedTopicNames []string
+	SubscribedTopicRegex string
+	Assignment           []ConsumerGroupDescribeTopicPartitions
+	TargetAssignment     []ConsumerGroupDescribeTopicPartitions
+}
+
+type ConsumerGroupDescribeGroup struct {
+	ErrorCode            int16
+	ErrorMessage         string
+	GroupID              string
+	GroupState           string
+	GroupEpoch           int32
+	AssignmentEpoch      int32
+	AssignorName         string
+	Members              []ConsumerGroupDescribeMember
+	AuthorizedOperations int32
+}
+
+type ConsumerGroupDescribeResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	Groups        []ConsumerGroupDescribeGroup
+}
+
+// ===================================================================================
+
+// Kafka DescribeGroups Request (v5 - v6)
+// REQUEST HEADER V2 +
+// 02 04 67 72 70  // groups (compact array of compact strings)
+// 00           // include_authorized_operations
+// 00           // tag buffer
+
+type DescribeGroupsRequest struct {
+	RequestHeader
+	Groups                      []string
+	IncludeAuthorizedOperations bool
+}
+
+// Kafka DescribeGroups Response (v5 - v6)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // groups (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string, v6+)
+// 04 67 72 70  // group_id (compact string)
+// 07 53 74 ..  // group_state (compact string)
+// 09 63 6f ..  // protocol_type (compact string)
+// 06 72 61 ..  // protocol_data (compact string)
+// 02           // members (compact array)
+//   member_id, group_instance_id (compact nullable string), client_id,
+//   client_host, member_metadata (compact bytes), member_assignment
+//   (compact bytes), tag buffer
+// 80 00 00 00  // authorized_operations
+// 00           // group tag buffer
+// 00           // tag buffer
+
+type DescribeGroupsResponseMember struct {
+	MemberID         string
+	GroupInstanceID  string
+	ClientID         string
+	ClientHost       string
+	MemberMetadata   []byte
+	MemberAssignment []byte
+}
+
+type DescribeGroupsResponseGroup struct {
+	ErrorCode            int16
+	ErrorMessage         string
+	GroupID              string
+	GroupState           string
+	ProtocolType         string
+	ProtocolData         string
+	Members              []DescribeGroupsResponseMember
+	AuthorizedOperations int32
+}
+
+type DescribeGroupsResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	Groups        []DescribeGroupsResponseGroup
+}
+
+// ===================================================================================
+
+// Kafka ListGroups Request (v3 - v5)
+// REQUEST HEADER V2 +
+// 02 07 53 74 ..  // states_filter (compact array of compact strings, v4+)
+// 02 09 63 6c ..  // types_filter (compact array of compact strings, v5+)
+// 00           // tag buffer
+
+type ListGroupsRequest struct {
+	RequestHeader
+	StatesFilter []string
+	TypesFilter  []string
+}
+
+// Kafka ListGroups Response (v3 - v5)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 02           // groups (compact array)
+// 04 67 72 70  // group_id (compact string)
+// 09 63 6f ..  // protocol_type (compact string)
+// 07 53 74 ..  // group_state (compact string, v4+)
+// 08 63 6c ..  // group_type (compact string, v5+)
+// 00           // group tag buffer
+// 00           // tag buffer
+
+type ListGroupsResponseGroup struct {
+	GroupID      string
+	ProtocolType string
+	GroupState   string
+	GroupType    string
+}
+
+type ListGroupsResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	ErrorCode     int16
+	Groups        []ListGroupsResponseGroup
+}
+
+// ===================================================================================
+
+// Kafka DeleteGroups Request (v2)
+// REQUEST HEADER V2 +
+// 02 04 67 72 70  // groups_names (compact array of compact strings)
+// 00           // tag buffer
+
+type DeleteGroupsRequest struct {
+	RequestHeader
+	GroupsNames []string
+}
+
+// Kafka DeleteGroups Response (v2)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // results (compact array)
+// 04 67 72 70  // group_id (compact string)
+// 00 00        // error_code
+// 00           // result tag buffer
+// 00           // tag buffer
+
+type DeleteGroupsResponseResult struct {
+	GroupID   string
+	ErrorCode int16
+}
+
+type DeleteGroupsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Results       []DeleteGroupsResponseResult
+}
+
+// ===================================================================================
+
+// Kafka InitProducerId Request (v2 - v4)
+// REQUEST HEADER V2 +
+// 00           // transactional_id (compact nullable string)
+// 00 00 ea 60  // transaction_timeout_ms
+// ff ff ff ff ff ff ff ff  // producer_id (v3+, -1 for a new producer)
+// ff ff        // producer_epoch (v3+)
+// 00           // tag buffer
+
+type InitProducerIdRequest struct {
+	RequestHeader
+	TransactionalID      string
+	TransactionalIDNull  bool
+	TransactionTimeoutMs int32
+	ProducerID           int64
+	ProducerEpoch        int16
+}
+
+// Kafka InitProducerId Response (v2 - v4)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 00           // tag buffer
+
+type InitProducerIdResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+	ProducerID    int64
+	ProducerEpoch int16
+}
+
+// ===================================================================================
+
+// Kafka Produce Request (v9 - v11)
+// REQUEST HEADER V2 +
+// 00           // transactional_id (compact nullable string)
+// ff ff        // acks (0, 1 or -1 for all in sync replicas)
+// 00 00 75 30  // timeout_ms
+// 02           // topic_data (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partition_data (compact array)
+// 00 00 00 00  // index
+// 4a 00 00 ..  // records (compact nullable bytes, a single v2 record batch)
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type ProducePartitionData struct {
+	Index   int32
+	Records []byte
+}
+
+type ProduceTopicData struct {
+	Name          string
+	PartitionData []ProducePartitionData
+}
+
+type ProduceRequest struct {
+	RequestHeader
+	TransactionalID string
+	Acks            int16
+	TimeoutMs       int32
+	TopicData       []ProduceTopicData
+}
+
+// Kafka Produce Response (v9 - v11)
+// RESPONSE HEADER V1 +
+// 02           // responses (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partition_responses (compact array)
+// 00 00 00 00  // index
+// 00 00        // error_code
+// 00 00 00 00 00 00 00 00  // base_offset
+// ff ff ff ff ff ff ff ff  // log_append_time_ms (-1 for CreateTime)
+// 00 00 00 00 00 00 00 00  // log_start_offset
+// 01           // record_errors (compact array: batch_index, batch_index_error_message, tag buffer)
+// 00           // error_message (compact nullable string)
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00 00 00 00  // throttle_time
+// 00           // tag buffer
+
+type ProducePartitionResponse struct {
+	Index           int32
+	ErrorCode       int16
+	BaseOffset      int64
+	LogAppendTimeMs int64
+	LogStartOffset  int64
+	ErrorMessage    string
+}
+
+type ProduceTopicResponse struct {
+	Name               string
+	PartitionResponses []ProducePartitionResponse
+}
+
+type ProduceResponse struct {
+	CorrelationID int32
+	Responses     []ProduceTopicResponse
+	ThrottleTime  int32
+}
+
+// ===================================================================================
+
+// Kafka AddPartitionsToTxn Request (v3)
+// REQUEST HEADER V2 +
+// 04 74 78 6e  // transactional_id (compact string)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02 00 00 00 00  // partitions (compact array of int32)
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type AddPartitionsToTxnTopic struct {
+	Name       string
+	Partitions []int32
+}
+
+type AddPartitionsToTxnRequest struct {
+	RequestHeader
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	Topics          []AddPartitionsToTxnTopic
+}
+
+// Kafka AddPartitionsToTxn Response (v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // results_by_topic (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // results_by_partition (compact array)
+// 00 00 00 00  // partition_index
+// 00 00        // partition_error_code
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type AddPartitionsToTxnPartitionResult struct {
+	PartitionIndex int32
+	ErrorCode      int16
+}
+
+type AddPartitionsToTxnTopicResult struct {
+	Name    string
+	Results []AddPartitionsToTxnPartitionResult
+}
+
+type AddPartitionsToTxnResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Results       []AddPartitionsToTxnTopicResult
+}
+
+// ===================================================================================
+
+// Kafka AddOffsetsToTxn Request (v3)
+// REQUEST HEADER V2 +
+// 04 74 78 6e  // transactional_id (compact string)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 04 67 72 70  // group_id (compact string)
+// 00           // tag buffer
+
+type AddOffsetsToTxnRequest struct {
+	RequestHeader
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	GroupID         string
+}
+
+// Kafka AddOffsetsToTxn Response (v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // tag buffer
+
+type AddOffsetsToTxnResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+}
+
+// ===================================================================================
+
+// Kafka EndTxn Request (v3 - v4)
+// REQUEST HEADER V2 +
+// 04 74 78 6e  // transactional_id (compact string)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 01           // committed (boolean)
+// 00           // tag buffer
+
+type EndTxnRequest struct {
+	RequestHeader
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	Committed       bool
+}
+
+// Kafka EndTxn Response (v3 - v4)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // tag buffer
+
+type EndTxnResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+}
+
+// ===================================================================================
+
+// Kafka WriteTxnMarkers Request (v1)
+// REQUEST HEADER V2 +
+// 02           // markers (compact array)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 01           // transaction_result (true for commit)
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02 00 00 00 00  // partition_indexes (compact array of int32)
+// 00           // topic tag buffer
+// 00 00 00 00  // coordinator_epoch
+// 00           // marker tag buffer
+// 00           // tag buffer
+
+type WritableTxnMarkerTopic struct {
+	Name             string
+	PartitionIndexes []int32
+}
+
+type WritableTxnMarker struct {
+	ProducerID        int64
+	ProducerEpoch     int16
+	TransactionResult bool
+	Topics            []WritableTxnMarkerTopic
+	CoordinatorEpoch  int32
+}
+
+type WriteTxnMarkersRequest struct {
+	RequestHeader
+	Markers []WritableTxnMarker
+}
+
+// Kafka WriteTxnMarkers Response (v1)
+// RESPONSE HEADER V1 +
+// 02           // markers (compact array)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00        // error_code
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // marker tag buffer
+// 00           // tag buffer
+
+type WritableTxnMarkerPartitionResult struct {
+	PartitionIndex int32
+	ErrorCode      int16
+}
+
+type WritableTxnMarkerTopicResult struct {
+	Name       string
+	Partitions []WritableTxnMarkerPartitionResult
+}
+
+type WritableTxnMarkerResult struct {
+	ProducerID int64
+	Topics     []WritableTxnMarkerTopicResult
+}
+
+type WriteTxnMarkersResponse struct {
+	CorrelationID int32
+	Markers       []WritableTxnMarkerResult
+}
+
+// ===================================================================================
+
+// Kafka TxnOffsetCommit Request (v3)
+// REQUEST HEADER V2 +
+// 04 74 78 6e  // transactional_id (compact string)
+// 04 67 72 70  // group_id (compact string)
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// ff ff ff ff  // generation_id
+// 01           // member_id (compact string)
+// 00           // group_instance_id (compact nullable string)
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00 00 00 00 00 00 2a  // committed_offset
+// ff ff ff ff  // committed_leader_epoch
+// 01           // committed_metadata (compact nullable string)
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type TxnOffsetCommitRequestPartition struct {
+	PartitionIndex       int32
+	CommittedOffset      int64
+	CommittedLeaderEpoch int32
+	CommittedMetadata    string
+}
+
+type TxnOffsetCommitRequestTopic struct {
+	Name       string
+	Partitions []TxnOffsetCommitRequestPartition
+}
+
+type TxnOffsetCommitRequest struct {
+	RequestHeader
+	TransactionalID string
+	GroupID         string
+	ProducerID      int64
+	ProducerEpoch   int16
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+	Topics          []TxnOffsetCommitRequestTopic
+}
+
+// Kafka TxnOffsetCommit Response (v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // topics (compact array)
+// 04 66 6f 6f  // name (compact string)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00        // error_code
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type TxnOffsetCommitResponsePartition struct {
+	PartitionIndex int32
+	ErrorCode      int16
+}
+
+type TxnOffsetCommitResponseTopic struct {
+	Name       string
+	Partitions []TxnOffsetCommitResponsePartition
+}
+
+type TxnOffsetCommitResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Topics        []TxnOffsetCommitResponseTopic
+}
+
+// ===================================================================================
+
+// Kafka Fetch Request (v12 - v16)
+// REQUEST HEADER V2 +
+// ff ff ff ff  // replica_id (v12 - v14)
+// 00 00 01 f4  // max_wait_ms
+// 00 00 00 01  // min_bytes
+// 03 20 00 00  // max_bytes
+// 00           // isolation_level (0 read_uncommitted, 1 read_committed)
+// 00 00 00 00  // session_id
+// ff ff ff ff  // session_epoch
+// 02           // topics (compact array)
+// 04 66 6f 6f  // topic (compact string, v12) or 16 bytes topic_id (v13+)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition
+// ff ff ff ff  // current_leader_epoch
+// 00 00 00 00 00 00 00 00  // fetch_offset
+// ff ff ff ff  // last_fetched_epoch
+// ff ff ff ff ff ff ff ff  // log_start_offset
+// 00 10 00 00  // partition_max_bytes
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 01           // forgotten_topics_data (compact array)
+// 01           // rack_id (compact string)
+// 00           // tag buffer
+
+type FetchRequestPartition struct {
+	Partition          int32
+	CurrentLeaderEpoch int32
+	FetchOffset        int64
+	LogStartOffset     int64
+	PartitionMaxBytes  int32
+}
+
+type FetchRequestTopic struct {
+	Topic      string
+	TopicID    [16]byte
+	Partitions []FetchRequestPartition
+}
+
+type FetchRequest struct {
+	RequestHeader
+	MaxWaitMs      int32
+	MinBytes       int32
+	MaxBytes       int32
+	IsolationLevel int8
+	SessionID      int32
+	SessionEpoch   int32
+	Topics         []FetchRequestTopic
+}
+
+// Kafka Fetch Response (v12 - v16)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00 00 00 00  // session_id
+// 02           // responses (compact array)
+// 04 66 6f 6f  // topic (compact string, v12) or 16 bytes topic_id (v13+)
+// 02           // partitions (compact array)
+// 00 00 00 00  // partition_index
+// 00 00        // error_code
+// 00 00 00 00 00 00 00 0a  // high_watermark
+// 00 00 00 00 00 00 00 0a  // last_stable_offset
+// 00 00 00 00 00 00 00 00  // log_start_offset
+// 00           // aborted_transactions (compact nullable array: producer_id, first_offset, tag buffer)
+// ff ff ff ff  // preferred_read_replica
+// 4a 00 00 ..  // records (compact nullable bytes)
+// 00           // partition tag buffer
+// 00           // topic tag buffer
+// 00           // tag buffer
+
+type FetchAbortedTransaction struct {
+	ProducerID  int64
+	FirstOffset int64
+}
+
+type FetchResponsePartition struct {
+	PartitionIndex       int32
+	ErrorCode            int16
+	HighWatermark        int64
+	LastStableOffset     int64
+	LogStartOffset       int64
+	AbortedTransactions  []FetchAbortedTransaction // null unless read_committed
+	PreferredReadReplica int32
+	Records              []byte
+}
+
+type FetchResponseTopic struct {
+	Topic      string
+	TopicID    [16]byte
+	Partitions []FetchResponsePartition
+}
+
+type FetchResponse struct {
+	CorrelationID int32
+	APIVersion    int
+	ThrottleTime  int32
+	ErrorCode     int16
+	SessionID     int32
+	Responses     []FetchResponseTopic
+}
+
+// ===================================================================================
+
+// Kafka SaslHandshake Request (v1)
+// REQUEST HEADER V1 +
+// 00 05 50 4c 41 49 4e  // mechanism (string)
+
+type SaslHandshakeRequest struct {
+	RequestHeader
+	Mechanism string
+}
+
+// Kafka SaslHandshake Response (v1)
+// RESPONSE HEADER V0 +
+// 00 00        // error_code
+// 00 00 00 01  // mechanisms (array)
+// 00 05 50 4c 41 49 4e  // mechanism (string)
+
+type SaslHandshakeResponse struct {
+	CorrelationID int32
+	ErrorCode     int16
+	Mechanisms    []string
+}
+
+// ===================================================================================
+
+// Kafka SaslAuthenticate Request (v0 - v2)
+// REQUEST HEADER V1 (V2 from v2) +
+// 00 00 00 0c ...  // auth_bytes (bytes, compact from v2)
+// 00           // tag buffer (v2)
+
+type SaslAuthenticateRequest struct {
+	RequestHeader
+	AuthBytes []byte
+}
+
+// Kafka SaslAuthenticate Response (v0 - v2)
+// RESPONSE HEADER V0 (V1 from v2) +
+// 00 00        // error_code
+// ff ff        // error_message (nullable string, compact from v2)
+// 00 00 00 00  // auth_bytes (bytes, compact from v2)
+// 00 00 00 00 00 00 00 00  // session_lifetime_ms (v1+)
+// 00           // tag buffer (v2)
+
+type SaslAuthenticateResponse struct {
+	CorrelationID     int32
+	APIVersion        int
+	ErrorCode         int16
+	ErrorMessage      string // null when empty
+	AuthBytes         []byte
+	SessionLifetimeMs int64
+}
+
+// ===================================================================================
+
+// Kafka DescribeAcls Request (v2 - v3)
+// REQUEST HEADER V2 +
+// 02           // resource_type_filter
+// 04 66 6f 6f  // resource_name_filter (compact nullable string)
+// 03           // pattern_type_filter
+// 00           // principal_filter (compact nullable string)
+// 00           // host_filter (compact nullable string)
+// 01           // operation
+// 01           // permission_type
+// 00           // tag buffer
+
+// ACLFilter is the filter of DescribeAcls and of each DeleteAcls filter, a
+// nil name, principal or host matches everything
+type ACLFilter struct {
+	ResourceType   int8
+	ResourceName   *string
+	PatternType    int8
+	Principal      *string
+	Host           *string
+	Operation      int8
+	PermissionType int8
+}
+
+type DescribeAclsRequest struct {
+	RequestHeader
+	Filter ACLFilter
+}
+
+// Kafka DescribeAcls Response (v2 - v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // resources (compact array)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 03           // pattern_type
+// 02           // acls (compact array)
+// 0b 55 73 65 72 3a 61 6c 69 63 65  // principal (compact string)
+// 02 2a        // host (compact string)
+// 03           // operation
+// 03           // permission_type
+// 00           // acl tag buffer
+// 00           // resource tag buffer
+// 00           // tag buffer
+
+type AclDescription struct {
+	Principal      string
+	Host           string
+	Operation      int8
+	PermissionType int8
+}
+
+type DescribeAclsResource struct {
+	ResourceType int8
+	ResourceName string
+	PatternType  int8
+	Acls         []AclDescription
+}
+
+type DescribeAclsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+	ErrorMessage  string // null when empty
+	Resources     []DescribeAclsResource
+}
+
+// ===================================================================================
+
+// Kafka CreateAcls Request (v2 - v3)
+// REQUEST HEADER V2 +
+// 02           // creations (compact array)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 03           // resource_pattern_type
+// 0b 55 73 65 72 3a 61 6c 69 63 65  // principal (compact string)
+// 02 2a        // host (compact string)
+// 03           // operation
+// 03           // permission_type
+// 00           // creation tag buffer
+// 00           // tag buffer
+
+type AclCreation struct {
+	ResourceType        int8
+	ResourceName        string
+	ResourcePatternType int8
+	Principal           string
+	Host                string
+	Operation           int8
+	PermissionType      int8
+}
+
+type CreateAclsRequest struct {
+	RequestHeader
+	Creations []AclCreation
+}
+
+// Kafka CreateAcls Response (v2 - v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // results (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 00           // result tag buffer
+// 00           // tag buffer
+
+type AclCreationResult struct {
+	ErrorCode    int16
+	ErrorMessage string // null when empty
+}
+
+type CreateAclsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Results       []AclCreationResult
+}
+
+// ===================================================================================
+
+// Kafka DeleteAcls Request (v2 - v3)
+// REQUEST HEADER V2 +
+// 02           // filters (compact array), each laid out like the DescribeAcls filter
+// 00           // tag buffer
+
+type DeleteAclsRequest struct {
+	RequestHeader
+	Filters []ACLFilter
+}
+
+// Kafka DeleteAcls Response (v2 - v3)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // filter_results (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // matching_acls (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 03           // pattern_type
+// 0b 55 73 65 72 3a 61 6c 69 63 65  // principal (compact string)
+// 02 2a        // host (compact string)
+// 03           // operation
+// 03           // permission_type
+// 00           // matching acl tag buffer
+// 00           // filter result tag buffer
+// 00           // tag buffer
+
+type DeleteAclsMatchingAcl struct {
+	ErrorCode      int16
+	ErrorMessage   string // null when empty
+	ResourceType   int8
+	ResourceName   string
+	PatternType    int8
+	Principal      string
+	Host           string
+	Operation      int8
+	PermissionType int8
+}
+
+type DeleteAclsFilterResult struct {
+	ErrorCode    int16
+	ErrorMessage string // null when empty
+	MatchingAcls []DeleteAclsMatchingAcl
+}
+
+type DeleteAclsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	FilterResults []DeleteAclsFilterResult
+}
+
+// ===================================================================================
+
+// Kafka DescribeClientQuotas Request (v1)
+// REQUEST HEADER V2 +
+// 02           // components (compact array)
+// 05 75 73 65 72  // entity_type (compact string)
+// 00           // match_type
+// 06 61 6c 69 63 65  // match (compact nullable string)
+// 00           // component tag buffer
+// 00           // strict
+// 00           // tag buffer
+
+type ClientQuotaFilterComponent struct {
+	EntityType string
+	MatchType  int8
+	Match      *string
+}
+
+type DescribeClientQuotasRequest struct {
+	RequestHeader
+	Components []ClientQuotaFilterComponent
+	Strict     bool
+}
+
+// Kafka DescribeClientQuotas Response (v1)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // entries (compact nullable array)
+// 02           // entity (compact array)
+// 05 75 73 65 72  // entity_type (compact string)
+// 06 61 6c 69 63 65  // entity_name (compact nullable string)
+// 00           // entity tag buffer
+// 02           // values (compact array)
+// 13 70 72 6f 64 75 63 65 72 5f 62 79 74 65 5f 72 61 74 65  // key (compact string)
+// 41 30 00 00 00 00 00 00  // value (float64)
+// 00           // value tag buffer
+// 00           // entry tag buffer
+// 00           // tag buffer
+
+// ClientQuotaEntity is one part of a quota entity, a nil name is the default
+// entity of the type
+type ClientQuotaEntity struct {
+	EntityType string
+	EntityName *string
+}
+
+type ClientQuotaValue struct {
+	Key   string
+	Value float64
+}
+
+type DescribeClientQuotasEntry struct {
+	Entity []ClientQuotaEntity
+	Values []ClientQuotaValue
+}
+
+type DescribeClientQuotasResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	ErrorCode     int16
+	ErrorMessage  string                      // null when empty
+	Entries       []DescribeClientQuotasEntry // null on errors
+}
+
+// ===================================================================================
+
+// Kafka AlterClientQuotas Request (v1)
+// REQUEST HEADER V2 +
+// 02           // entries (compact array)
+// 02           // entity (compact array)
+// 05 75 73 65 72  // entity_type (compact string)
+// 06 61 6c 69 63 65  // entity_name (compact nullable string)
+// 00           // entity tag buffer
+// 02           // ops (compact array)
+// 13 70 72 6f 64 75 63 65 72 5f 62 79 74 65 5f 72 61 74 65  // key (compact string)
+// 41 30 00 00 00 00 00 00  // value (float64)
+// 00           // remove
+// 00           // op tag buffer
+// 00           // entry tag buffer
+// 00           // validate_only
+// 00           // tag buffer
+
+type ClientQuotaOp struct {
+	Key    string
+	Value  float64
+	Remove bool
+}
+
+type AlterClientQuotasEntry struct {
+	Entity []ClientQuotaEntity
+	Ops    []ClientQuotaOp
+}
+
+type AlterClientQuotasRequest struct {
+	RequestHeader
+	Entries      []AlterClientQuotasEntry
+	ValidateOnly bool
+}
+
+// Kafka AlterClientQuotas Response (v1)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // entries (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // entity (compact array)
+// 05 75 73 65 72  // entity_type (compact string)
+// 06 61 6c 69 63 65  // entity_name (compact nullable string)
+// 00           // entity tag buffer
+// 00           // entry tag buffer
+// 00           // tag buffer
+
+type AlterClientQuotasResult struct {
+	ErrorCode    int16
+	ErrorMessage string // null when empty
+	Entity       []ClientQuotaEntity
+}
+
+type AlterClientQuotasResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Entries       []AlterClientQuotasResult
+}
+
+// ===================================================================================
+
+// Kafka DescribeConfigs Request (v4)
+// REQUEST HEADER V2 +
+// 02           // resources (compact array)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 00           // configuration_keys (compact nullable array, null for all)
+// 00           // resource tag buffer
+// 01           // include_synonyms
+// 00           // include_documentation
+// 00           // tag buffer
+
+type DescribeConfigsResource struct {
+	ResourceType      int8
+	ResourceName      string
+	ConfigurationKeys []string // nil for all
+}
+
+type DescribeConfigsRequest struct {
+	RequestHeader
+	Resources            []DescribeConfigsResource
+	IncludeSynonyms      bool
+	IncludeDocumentation bool
+}
+
+// Kafka DescribeConfigs Response (v4)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // results (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 02           // configs (compact array)
+// 0d 72 65 74 65 6e 74 69 6f 6e 2e 6d 73  // name (compact string)
+// 0a 36 30 34 38 30 30 30 30 30  // value (compact nullable string)
+// 00           // read_only
+// 05           // config_source
+// 00           // is_sensitive
+// 02           // synonyms (compact array: name, value, source, tag buffer)
+// 05           // config_type
+// 00           // documentation (compact nullable string)
+// 00           // config tag buffer
+// 00           // result tag buffer
+// 00           // tag buffer
+
+type DescribeConfigsSynonym struct {
+	Name   string
+	Value  string
+	Source int8
+}
+
+type DescribeConfigsResourceConfig struct {
+	Name          string
+	Value         string
+	ReadOnly      bool
+	ConfigSource  int8
+	IsSensitive   bool
+	Synonyms      []DescribeConfigsSynonym
+	ConfigType    int8
+	Documentation string // null when empty
+}
+
+type DescribeConfigsResult struct {
+	ErrorCode    int16
+	ErrorMessage string // null when empty
+	ResourceType int8
+	ResourceName string
+	Configs      []DescribeConfigsResourceConfig
+}
+
+type DescribeConfigsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Results       []DescribeConfigsResult
+}
+
+// ===================================================================================
+
+// Kafka AlterConfigs Request (v2)
+// REQUEST HEADER V2 +
+// 02           // resources (compact array)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 02           // configs (compact array)
+// 0d 72 65 74 65 6e 74 69 6f 6e 2e 6d 73  // name (compact string)
+// 05 36 30 30 30  // value (compact nullable string)
+// 00           // config tag buffer
+// 00           // resource tag buffer
+// 00           // validate_only
+// 00           // tag buffer
+
+type AlterableConfig struct {
+	Name  string
+	Value *string
+}
+
+type AlterConfigsResource struct {
+	ResourceType int8
+	ResourceName string
+	Configs      []AlterableConfig
+}
+
+type AlterConfigsRequest struct {
+	RequestHeader
+	Resources    []AlterConfigsResource
+	ValidateOnly bool
+}
+
+// Kafka AlterConfigs Response (v2), also IncrementalAlterConfigs Response (v1)
+// RESPONSE HEADER V1 +
+// 00 00 00 00  // throttle_time
+// 02           // responses (compact array)
+// 00 00        // error_code
+// 00           // error_message (compact nullable string)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 00           // response tag buffer
+// 00           // tag buffer
+
+type AlterConfigsResourceResponse struct {
+	ErrorCode    int16
+	ErrorMessage string // null when empty
+	ResourceType int8
+	ResourceName string
+}
+
+type AlterConfigsResponse struct {
+	CorrelationID int32
+	ThrottleTime  int32
+	Responses     []AlterConfigsResourceResponse
+}
+
+// ===================================================================================
+
+// Kafka IncrementalAlterConfigs Request (v1)
+// REQUEST HEADER V2 +
+// 02           // resources (compact array)
+// 02           // resource_type
+// 04 66 6f 6f  // resource_name (compact string)
+// 02           // configs (compact array)
+// 0f 63 6c 65 61 6e 75 70 2e 70 6f 6c 69 63 79  // name (compact string)
+// 02           // config_operation (SET, DELETE, APPEND, SUBTRACT)
+// 08 63 6f 6d 70 61 63 74  // value (compact nullable string)
+// 00           // config tag buffer
+// 00           // resource tag buffer
+// 00           // validate_only
+// 00           // tag buffer
+
+type AlterableConfigOp struct {
+	Name            string
+	ConfigOperation int8
+	Value           *string
+}
+
+type IncrementalAlterConfigsResource struct {
+	ResourceType int8
+	ResourceName string
+	Configs      []AlterableConfigOp
+}
+
+type IncrementalAlterConfigsRequest struct {
+	RequestHeader
+	Resources    []IncrementalAlterConfigsResource
+	ValidateOnly bool
+}
+
+// ===================================================================================
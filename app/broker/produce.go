@@ -0,0 +1,340 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/transaction_coordinator"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionLogs holds the open logs of the topic partitions in dir, each one is
+// opened on its first write
+type partitionLogs struct {
+	dir  string
+	mu   sync.Mutex
+	logs map[topicPartition]*file_metadata.PartitionLog
+	// appended is called after every append to one of the logs
+	appended func(topicPartition)
+}
+
+func (p *partitionLogs) get(topic string, partition int32) (*file_metadata.PartitionLog, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tp := topicPartition{topic: topic, partition: partition}
+	if log, ok := p.logs[tp]; ok {
+		return log, nil
+	}
+	log, _, err := file_metadata.OpenPartitionLog(p.dir, topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	p.watch(tp, log)
+	p.logs[tp] = log
+	return log, nil
+}
+
+// adopt registers logs opened elsewhere, the coordinators open the partitions
+// of their internal topics themselves
+func (p *partitionLogs) adopt(topic string, logs []*file_metadata.PartitionLog) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for partition, log := range logs {
+		tp := topicPartition{topic: topic, partition: int32(partition)}
+		p.watch(tp, log)
+		p.logs[tp] = log
+	}
+}
+
+func (p *partitionLogs) watch(tp topicPartition, log *file_metadata.PartitionLog) {
+	if p.appended != nil {
+		log.OnAppend(func() { p.appended(tp) })
+	}
+}
+
+// closeAll closes every open log, which snapshots its producer state, and
+// returns the first error
+func (p *partitionLogs) closeAll() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var first error
+	for tp, log := range p.logs {
+		if err := log.Close(); err != nil && first == nil {
+			first = fmt.Errorf("closing %s-%d: %w", tp.topic, tp.partition, err)
+		}
+	}
+	return first
+}
+
+// drop forgets the logs of a deleted topic without closing them, their
+// directories are already on the way out
+func (p *partitionLogs) drop(topic string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for tp := range p.logs {
+		if tp.topic == topic {
+			delete(p.logs, tp)
+		}
+	}
+}
+
+// handleProduceRequest appends the batches of every partition. With acks=-1
+// the response waits in the produce purgatory until the in-sync replicas have
+// the batches, up to timeout_ms. Requests with acks=0 get no response.
+func (srv *Server) handleProduceRequest(req *request) (*pendingResponse, error) {
+	produce, err := deserializeProduceRequest(req.buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ProduceResponse{
+		CorrelationID: produce.CorrelationID,
+		ThrottleTime:  0,
+	}
+
+	// A transactional producer also needs WRITE on its transactional id
+	transactionAuthorized := produce.TransactionalID == "" || req.session.authorizeTransactionalID(authorizer.Write, produce.TransactionalID)
+
+	var acks []produceAck
+	for _, topic := range produce.TopicData {
+		topicResponse := ProduceTopicResponse{Name: topic.Name}
+		errorCode := int16(ErrorCodeNone)
+		switch {
+		case !transactionAuthorized:
+			errorCode = ErrorCodeTransactionalIDAuthorizationFailed
+		case !req.session.authorizeTopic(authorizer.Write, topic.Name):
+			errorCode = ErrorCodeTopicAuthorizationFailed
+		}
+		for _, partition := range topic.PartitionData {
+			if errorCode != ErrorCodeNone {
+				topicResponse.PartitionResponses = append(topicResponse.PartitionResponses, ProducePartitionResponse{Index: partition.Index, ErrorCode: errorCode, BaseOffset: -1, LogAppendTimeMs: -1, LogStartOffset: -1})
+				continue
+			}
+			result := srv.producePartition(produce, topic.Name, partition)
+			if produce.Acks == -1 && result.ErrorCode == ErrorCodeNone {
+				acks = append(acks, produceAck{
+					tp:             topicPartition{topic: topic.Name, partition: partition.Index},
+					topic:          len(response.Responses),
+					partition:      len(topicResponse.PartitionResponses),
+					requiredOffset: batchEnd(partition.Records, result.BaseOffset),
+				})
+			}
+			topicResponse.PartitionResponses = append(topicResponse.PartitionResponses, result)
+		}
+		response.Responses = append(response.Responses, topicResponse)
+	}
+
+	// With acks=0 the client does not wait for an answer
+	if produce.Acks == 0 {
+		req.session.throttleProduce(req.dequeued, len(req.buff))
+		return &pendingResponse{}, nil
+	}
+	if len(acks) == 0 {
+		return srv.answerProduce(req, response), nil
+	}
+	delayed := &delayedProduce{srv: srv, req: req, response: response, pending: acks, parkedAt: time.Now()}
+	partitions := make([]topicPartition, len(acks))
+	for i, ack := range acks {
+		partitions[i] = ack.tp
+	}
+	srv.producePurgatory.TryCompleteElseWatch(delayed, time.Duration(produce.TimeoutMs)*time.Millisecond, partitions...)
+	return parked, nil
+}
+
+func (srv *Server) answerProduce(req *request, response *ProduceResponse) *pendingResponse {
+	response.ThrottleTime = req.session.throttleProduce(req.dequeued, len(req.buff))
+	return &pendingResponse{bytes: serializeProduceResponse(response), answered: response}
+}
+
+// delayedProduce is a Produce with acks=-1 waiting for the in-sync replicas to
+// reach the end of its batches, like Kafka's DelayedProduce. Partitions still
+// waiting when it expires are answered with REQUEST_TIMED_OUT, their batches
+// stay appended.
+type delayedProduce struct {
+	srv      *Server
+	req      *request
+	response *ProduceResponse
+	// pending are the partitions whose acks are still missing
+	pending  []produceAck
+	parkedAt time.Time
+}
+
+// produceAck is a partition of a delayedProduce
+type produceAck struct {
+	tp topicPartition
+	// topic and partition locate the partition in the response
+	topic     int
+	partition int
+	// requiredOffset is the offset after the appended batch
+	requiredOffset int64
+}
+
+func (p *delayedProduce) TryComplete() bool {
+	waiting := p.pending[:0]
+	for _, ack := range p.pending {
+		reached, code := p.srv.replicasReached(ack.tp, ack.requiredOffset)
+		if !reached {
+			waiting = append(waiting, ack)
+			continue
+		}
+		p.response.Responses[ack.topic].PartitionResponses[ack.partition].ErrorCode = code
+	}
+	p.pending = waiting
+	return len(p.pending) == 0
+}
+
+func (p *delayedProduce) OnComplete(expired bool) {
+	for _, ack := range p.pending {
+		p.response.Responses[ack.topic].PartitionResponses[ack.partition].ErrorCode = ErrorCodeRequestTimedOut
+	}
+	// Waiting for the replicas is not handling time
+	p.req.session.delayed += time.Since(p.parkedAt)
+	p.srv.completeDelayed(p.req, p.parkedAt, p.srv.answerProduce(p.req, p.response))
+}
+
+// replicasReached tells whether the in-sync replicas of a partition have its
+// log up to requiredOffset, which is when its high watermark gets there, like
+// Kafka's Partition.checkEnoughReplicasReachOffset. The broker is the only
+// replica, the high watermark is the end of its log. An ISR that shrank below
+// min.insync.replicas meanwhile fails with NOT_ENOUGH_REPLICAS_AFTER_APPEND.
+func (srv *Server) replicasReached(tp topicPartition, requiredOffset int64) (bool, int16) {
+	srv.metadataLock.RLock()
+	partitionCount := srv.topicPartitionCount(tp.topic)
+	inSyncReplicas := srv.inSyncReplicaCount(tp.topic, tp.partition)
+	srv.metadataLock.RUnlock()
+	// The topic was deleted
+	if tp.partition >= partitionCount {
+		return true, ErrorCodeUnknownTopic
+	}
+
+	log, err := srv.partitionLogs.get(tp.topic, tp.partition)
+	if err != nil {
+		srv.log.Error("Failed to open a partition log", "topic", tp.topic, "partition", tp.partition, "error", err)
+		return true, ErrorCodeKafkaStorageError
+	}
+	if log.EndOffset() < requiredOffset {
+		return false, ErrorCodeNone
+	}
+	if minISR := srv.configs.TopicInt(tp.topic, "min.insync.replicas"); int64(inSyncReplicas) < minISR {
+		return true, ErrorCodeNotEnoughReplicasAfterAppend
+	}
+	return true, ErrorCodeNone
+}
+
+// partitionAppended completes the requests waiting for an append to the
+// partition. The broker is the only replica, so every append also moves the
+// high watermark the acks=-1 produces wait for.
+func (srv *Server) partitionAppended(tp topicPartition) {
+	srv.producePurgatory.CheckAndComplete(tp)
+	srv.fetchPurgatory.CheckAndComplete(tp)
+}
+
+// batchEnd is the offset after a batch appended at baseOffset
+func batchEnd(records []byte, baseOffset int64) int64 {
+	batch, err := file_metadata.DecodeBatchHeader(records)
+	if err != nil {
+		return baseOffset
+	}
+	return baseOffset + batch.NextOffset() - batch.BaseOffset()
+}
+
+func (srv *Server) producePartition(req *ProduceRequest, topic string, partition ProducePartitionData) ProducePartitionResponse {
+	result := ProducePartitionResponse{Index: partition.Index, BaseOffset: -1, LogAppendTimeMs: -1, LogStartOffset: -1}
+	fail := func(code int16, message string) ProducePartitionResponse {
+		result.ErrorCode = code
+		result.ErrorMessage = message
+		return result
+	}
+
+	if req.Acks != 0 && req.Acks != 1 && req.Acks != -1 {
+		return fail(ErrorCodeInvalidRequiredAcks, "acks must be 0, 1 or -1")
+	}
+
+	srv.metadataLock.RLock()
+	partitionCount := srv.topicPartitionCount(topic)
+	inSyncReplicas := srv.inSyncReplicaCount(topic, partition.Index)
+	srv.metadataLock.RUnlock()
+	if partition.Index < 0 || partition.Index >= partitionCount {
+		return fail(ErrorCodeUnknownTopic, "")
+	}
+	if isInternalTopic(topic) {
+		return fail(ErrorCodeInvalidTopic, fmt.Sprintf("Cannot append to internal topic %s", topic))
+	}
+
+	// The topic configs are read on every append, so altering them needs no restart
+	if maxBytes := srv.configs.TopicInt(topic, "max.message.bytes"); int64(len(partition.Records)) > maxBytes {
+		return fail(ErrorCodeMessageTooLarge, fmt.Sprintf("Message batch size is %d bytes in append to partition %s-%d which exceeds the maximum configured size of %d.", len(partition.Records), topic, partition.Index, maxBytes))
+	}
+	if minISR := srv.configs.TopicInt(topic, "min.insync.replicas"); req.Acks == -1 && int64(inSyncReplicas) < minISR {
+		return fail(ErrorCodeNotEnoughReplicas, fmt.Sprintf("The size of the current ISR %d is insufficient to satisfy the min.isr requirement of %d for partition %s-%d", inSyncReplicas, minISR, topic, partition.Index))
+	}
+
+	log, err := srv.partitionLogs.get(topic, partition.Index)
+	if err != nil {
+		srv.log.Error("Failed to open a partition log", "topic", topic, "partition", partition.Index, "error", err)
+		return fail(ErrorCodeKafkaStorageError, "")
+	}
+
+	var baseOffset int64
+	var code int16
+	var message string
+	write := func() int16 {
+		baseOffset, code, message = srv.appendProducedBatch(log, topic, partition)
+		return code
+	}
+
+	// A transactional batch is only written while its partition is part of the
+	// producer's open transaction
+	if batch, err := file_metadata.DecodeBatchHeader(partition.Records); err == nil && batch.IsTransactional() {
+		if req.TransactionalID == "" {
+			return fail(ErrorCodeInvalidRecord, "Transactional records need a transactional id")
+		}
+		tp := transaction_coordinator.TopicPartition{Topic: topic, Partition: partition.Index}
+		code = srv.transactionCoordinator.WithinTransaction(req.TransactionalID, batch.ProducerID(), batch.ProducerEpoch(), tp, write)
+	} else {
+		code = write()
+	}
+	if code != ErrorCodeNone {
+		return fail(code, message)
+	}
+
+	result.BaseOffset = baseOffset
+	result.LogStartOffset = 0
+	return result
+}
+
+// appendProducedBatch appends a batch sent by a client and maps the failures to
+// error codes
+func (srv *Server) appendProducedBatch(log *file_metadata.PartitionLog, topic string, partition ProducePartitionData) (int64, int16, string) {
+	baseOffset, err := log.AppendBatch(partition.Records)
+	switch {
+	case errors.Is(err, file_metadata.ErrCorruptBatch):
+		return 0, ErrorCodeCorruptMessage, err.Error()
+	case errors.Is(err, file_metadata.ErrInvalidBatch), errors.Is(err, file_metadata.ErrInvalidRecord):
+		return 0, ErrorCodeInvalidRecord, err.Error()
+	case errors.Is(err, file_metadata.ErrOutOfOrderSequence):
+		return 0, ErrorCodeOutOfOrderSequence, err.Error()
+	case errors.Is(err, file_metadata.ErrInvalidProducerEpoch):
+		return 0, ErrorCodeInvalidProducerEpoch, err.Error()
+	case err != nil:
+		srv.log.Error("Failed to append to a partition log", "topic", topic, "partition", partition.Index, "error", err)
+		return 0, ErrorCodeKafkaStorageError, ""
+	}
+
+	srv.metrics.bytesIn.Add(float64(len(partition.Records)), topic)
+	if batch, err := file_metadata.DecodeBatchHeader(partition.Records); err == nil {
+		srv.metrics.messagesIn.Add(float64(batch.NextOffset()-batch.BaseOffset()), topic)
+	}
+	return baseOffset, ErrorCodeNone, ""
+}
@@ -0,0 +1,94 @@
+package broker
+
+import (
+	"sync"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/transaction_coordinator"
+)
+
+// producerIdBlock is the range of producer ids this broker currently hands out,
+// [next, end)
+type producerIdBlock struct {
+	mu   sync.Mutex
+	next int64
+	end  int64
+}
+
+// nextProducerId returns an unused producer id, reserving a new block through a
+// ProducerIdsRecord once the current one runs out
+func (srv *Server) nextProducerId() (int64, error) {
+	b := &srv.producerIDs
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.next >= b.end {
+		srv.metadataLock.Lock()
+		start := FindNextProducerIdInGlobalMetadata(*srv.metadata)
+		record := file_metadata.EncodeProducerIdsValue(file_metadata.ProducerIdsValue{
+			BrokerId:       srv.config.NodeID,
+			BrokerEpoch:    0,
+			NextProducerId: start + ProducerIdBlockSize,
+		})
+		_, err := srv.appendMetadata(record)
+		srv.metadataLock.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		b.next, b.end = start, start+ProducerIdBlockSize
+	}
+
+	id := b.next
+	b.next++
+	return id, nil
+}
+
+// handleInitProducerIdRequest needs WRITE on the transactional id, or for
+// idempotent producers IDEMPOTENT_WRITE on the cluster or WRITE on some topic
+func (srv *Server) handleInitProducerIdRequest(buff []byte, session *clientSession) (*InitProducerIdResponse, error) {
+	req, err := deserializeInitProducerIdRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &InitProducerIdResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+		ProducerID:    -1,
+		ProducerEpoch: -1,
+	}
+
+	if !req.TransactionalIDNull {
+		if !session.authorizeTransactionalID(authorizer.Write, req.TransactionalID) {
+			response.ErrorCode = ErrorCodeTransactionalIDAuthorizationFailed
+			return response, nil
+		}
+		result := srv.transactionCoordinator.InitProducerID(transaction_coordinator.InitProducerIDRequest{
+			TransactionalID:      req.TransactionalID,
+			TransactionTimeoutMs: req.TransactionTimeoutMs,
+			ProducerID:           req.ProducerID,
+			ProducerEpoch:        req.ProducerEpoch,
+		})
+		response.ErrorCode = result.ErrorCode
+		response.ProducerID = result.ProducerID
+		response.ProducerEpoch = result.ProducerEpoch
+		return response, nil
+	}
+
+	if !session.authorize(authorizer.IdempotentWrite, authorizer.ResourceCluster, authorizer.ClusterResourceName) && !session.authorizeAnyTopic(authorizer.Write) {
+		response.ErrorCode = ErrorCodeClusterAuthorizationFailed
+		return response, nil
+	}
+
+	// An idempotent producer always starts over with a fresh id, like Kafka
+	producerId, err := srv.nextProducerId()
+	if err != nil {
+		srv.log.Error("Failed to allocate a producer id", "error", err)
+		response.ErrorCode = ErrorCodeUnknownServerError
+		return response, nil
+	}
+	response.ProducerID = producerId
+	response.ProducerEpoch = 0
+	return response, nil
+}
@@ -0,0 +1,267 @@
+package broker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/quotas"
+)
+
+// loadQuotas replays the ClientQuotaRecords of the metadata log
+func (srv *Server) loadQuotas() {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+	for _, batch := range srv.metadata.Batches {
+		for _, record := range batch.Records {
+			srv.applyClientQuotaRecord(record.Value)
+		}
+	}
+}
+
+// applyClientQuotaRecord updates the quotas with a metadata record, other
+// records are ignored
+func (srv *Server) applyClientQuotaRecord(value interface{}) {
+	record, ok := value.(file_metadata.ClientQuotaValue)
+	if !ok {
+		return
+	}
+	var parts []quotas.EntityPart
+	for _, part := range record.Entity {
+		entityPart := quotas.EntityPart{Type: part.EntityType}
+		if !part.IsDefault {
+			entityPart.Name = &part.EntityName
+		}
+		parts = append(parts, entityPart)
+	}
+	entity, err := quotas.NewEntity(parts)
+	if err != nil {
+		return
+	}
+	if record.Remove {
+		srv.quotas.Remove(entity, record.Key)
+	} else {
+		srv.quotas.Set(entity, record.Key, record.Value)
+	}
+}
+
+// handleDescribeClientQuotasRequest lists the quotas of the entities matching
+// the filter
+func (srv *Server) handleDescribeClientQuotasRequest(buff []byte, session *clientSession) (*DescribeClientQuotasResponse, error) {
+	req, err := deserializeDescribeClientQuotasRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DescribeClientQuotasResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     ErrorCodeNone,
+	}
+	if !session.authorize(authorizer.DescribeConfigs, authorizer.ResourceCluster, authorizer.ClusterResourceName) {
+		response.ErrorCode = ErrorCodeClusterAuthorizationFailed
+		return response, nil
+	}
+
+	var components []quotas.FilterComponent
+	for _, component := range req.Components {
+		components = append(components, quotas.FilterComponent{
+			EntityType: component.EntityType,
+			MatchType:  component.MatchType,
+			Match:      component.Match,
+		})
+	}
+	matched, err := srv.quotas.Describe(components, req.Strict)
+	if err != nil {
+		response.ErrorCode = ErrorCodeInvalidRequest
+		response.ErrorMessage = err.Error()
+		return response, nil
+	}
+
+	entities := make([]quotas.Entity, 0, len(matched))
+	for entity := range matched {
+		entities = append(entities, entity)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].User != entities[j].User {
+			return entities[i].User < entities[j].User
+		}
+		return entities[i].ClientID < entities[j].ClientID
+	})
+
+	response.Entries = []DescribeClientQuotasEntry{}
+	for _, entity := range entities {
+		entry := DescribeClientQuotasEntry{Entity: clientQuotaEntity(entity)}
+		for key, value := range matched[entity] {
+			entry.Values = append(entry.Values, ClientQuotaValue{Key: key, Value: value})
+		}
+		sort.Slice(entry.Values, func(i, j int) bool { return entry.Values[i].Key < entry.Values[j].Key })
+		response.Entries = append(response.Entries, entry)
+	}
+	return response, nil
+}
+
+// handleAlterClientQuotasRequest appends a ClientQuotaRecord for every change
+// of a valid entry and applies it, so it takes effect right away. Setting a
+// quota to its current value, or removing a quota that is not set, writes
+// nothing.
+func (srv *Server) handleAlterClientQuotasRequest(buff []byte, session *clientSession) (*AlterClientQuotasResponse, error) {
+	req, err := deserializeAlterClientQuotasRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AlterClientQuotasResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		Entries:       make([]AlterClientQuotasResult, len(req.Entries)),
+	}
+	for i, entry := range req.Entries {
+		response.Entries[i] = AlterClientQuotasResult{ErrorCode: ErrorCodeNone, Entity: entry.Entity}
+	}
+	if !session.authorize(authorizer.AlterConfigs, authorizer.ResourceCluster, authorizer.ClusterResourceName) {
+		for i := range response.Entries {
+			response.Entries[i].ErrorCode = ErrorCodeClusterAuthorizationFailed
+		}
+		return response, nil
+	}
+
+	srv.metadataLock.Lock()
+	defer srv.metadataLock.Unlock()
+
+	current := srv.quotas.Quotas()
+	var values [][]byte
+	var changed []int
+	for i, entry := range req.Entries {
+		records, err := clientQuotaRecords(entry, current)
+		if err != nil {
+			response.Entries[i].ErrorCode = ErrorCodeInvalidRequest
+			response.Entries[i].ErrorMessage = err.Error()
+			continue
+		}
+		if !req.ValidateOnly && len(records) > 0 {
+			values = append(values, records...)
+			changed = append(changed, i)
+		}
+	}
+
+	if len(values) == 0 {
+		return response, nil
+	}
+	batch, err := srv.appendMetadata(values...)
+	if err != nil {
+		for _, i := range changed {
+			response.Entries[i].ErrorCode = ErrorCodeUnknownServerError
+			response.Entries[i].ErrorMessage = err.Error()
+		}
+		return response, nil
+	}
+	for _, record := range batch.Records {
+		srv.applyClientQuotaRecord(record.Value)
+	}
+	return response, nil
+}
+
+// clientQuotaRecords validates an entry and encodes its changes
+func clientQuotaRecords(entry AlterClientQuotasEntry, current map[quotas.Entity]map[string]float64) ([][]byte, error) {
+	var parts []quotas.EntityPart
+	var recordEntity []file_metadata.ClientQuotaEntityData
+	for _, part := range entry.Entity {
+		parts = append(parts, quotas.EntityPart{Type: part.EntityType, Name: part.EntityName})
+		data := file_metadata.ClientQuotaEntityData{EntityType: part.EntityType, IsDefault: part.EntityName == nil}
+		if part.EntityName != nil {
+			data.EntityName = *part.EntityName
+		}
+		recordEntity = append(recordEntity, data)
+	}
+	entity, err := quotas.NewEntity(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, op := range entry.Ops {
+		if seen[op.Key] {
+			return nil, fmt.Errorf("Duplicate quota key %s", op.Key)
+		}
+		seen[op.Key] = true
+		if op.Remove {
+			if err := quotas.ValidateQuota(op.Key, 1); err != nil {
+				return nil, err
+			}
+		} else if err := quotas.ValidateQuota(op.Key, op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	var records [][]byte
+	for _, op := range entry.Ops {
+		value, exists := current[entity][op.Key]
+		if (op.Remove && !exists) || (!op.Remove && exists && value == op.Value) {
+			continue
+		}
+		records = append(records, file_metadata.EncodeClientQuotaValue(file_metadata.ClientQuotaValue{
+			Entity: recordEntity,
+			Key:    op.Key,
+			Value:  op.Value,
+			Remove: op.Remove,
+		}))
+	}
+	return records, nil
+}
+
+func clientQuotaEntity(entity quotas.Entity) []ClientQuotaEntity {
+	var parts []ClientQuotaEntity
+	for _, part := range entity.Parts() {
+		parts = append(parts, ClientQuotaEntity{EntityType: part.Type, EntityName: part.Name})
+	}
+	return parts
+}
+
+// throttle records the time spent handling a request against the client's
+// request_percentage quota and returns the throttle time of its response. Time
+// spent waiting for data in Fetch is not handling time.
+func (s *clientSession) throttle(received time.Time) int32 {
+	now := time.Now()
+	handling := now.Sub(received) - s.delayed
+	s.delayed = 0
+	percentage := float64(handling) * 100 / float64(time.Second)
+	return s.mute(now, s.server.quotas.Record(quotas.RequestPercentage, s.principal, s.clientID, percentage, now))
+}
+
+// throttleProduce also records the request size against producer_byte_rate
+func (s *clientSession) throttleProduce(received time.Time, size int) int32 {
+	now := time.Now()
+	bandwidth := s.mute(now, s.server.quotas.Record(quotas.ProducerByteRate, s.principal, s.clientID, float64(size), now))
+	return max(bandwidth, s.throttle(received))
+}
+
+// throttleFetch also records the fetched records against consumer_byte_rate.
+// Like Kafka, a throttled client gets an empty response and the records are
+// taken back from its rate, since they were not sent.
+func (s *clientSession) throttleFetch(received time.Time, response *FetchResponse) {
+	size := 0
+	for _, topic := range response.Responses {
+		for _, partition := range topic.Partitions {
+			size += len(partition.Records)
+		}
+	}
+
+	now := time.Now()
+	bandwidth := s.mute(now, s.server.quotas.Record(quotas.ConsumerByteRate, s.principal, s.clientID, float64(size), now))
+	response.ThrottleTime = max(bandwidth, s.throttle(received))
+	if response.ThrottleTime > 0 {
+		s.server.quotas.Unrecord(quotas.ConsumerByteRate, s.principal, s.clientID, float64(size), now)
+		response.Responses = nil
+	}
+}
+
+// mute keeps the connection from reading its next request until the throttle
+// time has passed, the response itself is sent right away
+func (s *clientSession) mute(now time.Time, throttle time.Duration) int32 {
+	if until := now.Add(throttle); until.After(s.mutedUntil) {
+		s.mutedUntil = until
+	}
+	return int32(throttle / time.Millisecond)
+}
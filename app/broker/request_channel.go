@@ -0,0 +1,262 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// request is a request read off a connection and queued for the handler pool,
+// like Kafka's RequestChannel.Request
+type request struct {
+	header *MinimalRequest
+	buff   []byte
+	// session is a copy of the connection's, so the handlers of pipelined
+	// requests do not share one. The SASL requests, which change the
+	// connection's security state, get the connection's own.
+	session *clientSession
+	remote  net.Addr
+	conn    *connection
+
+	// received is when the request was read, dequeued when a handler took
+	// it off the queue
+	received time.Time
+	dequeued time.Time
+}
+
+// pendingResponse is the answer to a request, waiting for the responses to the
+// requests read before it on the same connection
+type pendingResponse struct {
+	request *request
+	// bytes is nil for requests that get no response, produce with acks=0
+	bytes []byte
+	// answered is the response before it was serialized, for its error codes
+	answered any
+	// closeConnection closes the connection after bytes are written, it is
+	// set when the request could not be handled
+	closeConnection bool
+	handled         time.Time
+}
+
+// parked is returned by the handlers of requests that wait in a purgatory,
+// they are answered when their operation completes
+var parked = &pendingResponse{}
+
+// startRequestHandlers starts the handler pool, num.io.threads goroutines
+// taking requests off the queue of queued.max.requests. A connection whose
+// request does not fit in the queue waits, it is not read meanwhile.
+func (srv *Server) startRequestHandlers() {
+	srv.requestQueue = make(chan *request, srv.config.QueuedMaxRequests)
+	for range srv.config.NumIoThreads {
+		srv.requestHandlers.Add(1)
+		go func() {
+			defer srv.requestHandlers.Done()
+			for req := range srv.requestQueue {
+				srv.handleQueuedRequest(req)
+			}
+		}()
+	}
+}
+
+// stopRequestHandlers ends the handler pool once the requests already queued
+// are handled. The connections that did not drain cannot queue anymore, their
+// requests are answered by closing the connection.
+func (srv *Server) stopRequestHandlers() {
+	srv.queueLock.Lock()
+	srv.queueClosed = true
+	close(srv.requestQueue)
+	srv.queueLock.Unlock()
+	srv.requestHandlers.Wait()
+}
+
+func (srv *Server) handleQueuedRequest(req *request) {
+	req.dequeued = time.Now()
+	api := apiName(req.header.RequestAPIKey)
+	srv.metrics.requestQueueTime.Observe(milliseconds(req.dequeued.Sub(req.received)), api)
+
+	response := srv.handleRequest(req)
+	srv.metrics.localTime.Observe(milliseconds(time.Since(req.dequeued)), api)
+	if response == parked {
+		return
+	}
+	if response == nil {
+		response = &pendingResponse{closeConnection: true}
+	}
+	srv.respond(req, response)
+}
+
+// completeDelayed answers a request that waited in a purgatory since
+// parkedAt
+func (srv *Server) completeDelayed(req *request, parkedAt time.Time, response *pendingResponse) {
+	srv.metrics.remoteTime.Observe(milliseconds(time.Since(parkedAt)), apiName(req.header.RequestAPIKey))
+	srv.respond(req, response)
+}
+
+// respond hands the response to the writer of the request's connection
+func (srv *Server) respond(req *request, response *pendingResponse) {
+	response.request = req
+	response.handled = time.Now()
+	req.conn.responses <- response
+}
+
+// connection writes the responses to the requests of one connection in the
+// order the requests were read, which is the order Kafka clients expect them
+// in. Its reads are limited to queued.max.requests.per.connection requests
+// in flight, with the default of one a connection is not read while its
+// request is handled, like in Kafka.
+type connection struct {
+	srv  *Server
+	conn net.Conn
+	log  *slog.Logger
+
+	// slots holds a token for every request in flight
+	slots chan struct{}
+	// inflight counts the requests whose response is not written yet
+	inflight sync.WaitGroup
+	// responses is buffered for every request in flight, so the handlers
+	// never wait for a slow client
+	responses chan *pendingResponse
+
+	mu sync.Mutex
+	// order has the correlation ids of the requests in flight, in the order
+	// they were read
+	order []int32
+	// mutedUntil is when the connection stops being throttled
+	mutedUntil time.Time
+}
+
+func (srv *Server) newConnection(conn net.Conn, log *slog.Logger) *connection {
+	maxInflight := srv.config.QueuedMaxRequestsPerConnection
+	return &connection{
+		srv:       srv,
+		conn:      conn,
+		log:       log,
+		slots:     make(chan struct{}, maxInflight),
+		responses: make(chan *pendingResponse, maxInflight),
+	}
+}
+
+// acquire waits for a slot to read a request into, it fails once ctx is done
+func (c *connection) acquire(ctx context.Context) bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives back the slot of a request that was not queued
+func (c *connection) release() {
+	<-c.slots
+}
+
+// inFlight tells whether a request with the correlation id is in flight, the
+// responses could not be told apart
+func (c *connection) inFlight(correlationID int32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Contains(c.order, correlationID)
+}
+
+// enqueue hands a request to the handler pool, its slot is given back once
+// its response is written
+func (c *connection) enqueue(req *request) {
+	c.mu.Lock()
+	c.order = append(c.order, req.header.CorrelationID)
+	c.mu.Unlock()
+	c.inflight.Add(1)
+
+	// The handlers keep taking requests off the queue until it is closed, a
+	// full queue does not hold stopRequestHandlers up for long
+	c.srv.queueLock.RLock()
+	defer c.srv.queueLock.RUnlock()
+	if c.srv.queueClosed {
+		c.srv.respond(req, &pendingResponse{closeConnection: true})
+		return
+	}
+	c.srv.requestQueue <- req
+}
+
+// writeResponses writes the responses until the channel is closed. A
+// response is held back until the ones to the requests read before it are
+// written. Once a write fails or a request could not be handled the
+// connection is closed, the remaining responses are dropped.
+func (c *connection) writeResponses() {
+	held := make(map[int32]*pendingResponse)
+	closed := false
+	for response := range c.responses {
+		held[response.request.header.CorrelationID] = response
+		for {
+			c.mu.Lock()
+			var next *pendingResponse
+			if len(c.order) > 0 {
+				next = held[c.order[0]]
+			}
+			if next == nil {
+				c.mu.Unlock()
+				break
+			}
+			c.order = c.order[1:]
+			c.mu.Unlock()
+
+			delete(held, next.request.header.CorrelationID)
+			if !closed {
+				closed = !c.send(next)
+			}
+			c.inflight.Done()
+			c.release()
+		}
+	}
+}
+
+// send writes a response and reports whether the connection stays open
+func (c *connection) send(response *pendingResponse) bool {
+	req := response.request
+	c.srv.metrics.responseQueueTime.Observe(milliseconds(time.Since(response.handled)), apiName(req.header.RequestAPIKey))
+
+	if response.bytes != nil {
+		if err := writeAll(c.conn, response.bytes); err != nil {
+			req.session.log.Error("Failed to write a response", "error", err)
+			c.conn.Close()
+			return false
+		}
+	}
+	if response.closeConnection {
+		c.conn.Close()
+		return false
+	}
+
+	c.mu.Lock()
+	if req.session.mutedUntil.After(c.mutedUntil) {
+		c.mutedUntil = req.session.mutedUntil
+	}
+	c.mu.Unlock()
+
+	c.srv.metrics.observeRequest(req.header, response.answered, time.Since(req.received))
+	req.session.log.Debug("Completed a request", "latency", time.Since(req.received))
+	return true
+}
+
+// waitUnmuted blocks until the throttle time of the last response has passed
+// or ctx is done
+func (c *connection) waitUnmuted(ctx context.Context) {
+	c.mu.Lock()
+	wait := time.Until(c.mutedUntil)
+	c.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
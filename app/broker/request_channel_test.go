@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResponsesFollowRequestOrder(t *testing.T) {
+	t.Parallel()
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	config.QueuedMaxRequestsPerConnection = 3
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	// No handlers, the test answers the requests itself
+	server.requestQueue = make(chan *request, 3)
+
+	client, broker := net.Pipe()
+	defer client.Close()
+	c := server.newConnection(broker, server.log)
+	go c.writeResponses()
+	defer close(c.responses)
+
+	var requests []*request
+	for id := int32(1); id <= 3; id++ {
+		if !c.acquire(context.Background()) {
+			t.Fatal("Expected a slot for every request")
+		}
+		req := &request{header: &MinimalRequest{CorrelationID: id}, session: &clientSession{log: server.log}, conn: c, received: time.Now()}
+		c.enqueue(req)
+		requests = append(requests, req)
+	}
+
+	for _, i := range []int{2, 0, 1} {
+		c.responses <- &pendingResponse{request: requests[i], bytes: []byte{byte(requests[i].header.CorrelationID)}, handled: time.Now()}
+	}
+	written := make([]byte, 3)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(client, written); err != nil {
+		t.Fatalf("Failed to read the responses: %v", err)
+	}
+	if hex.EncodeToString(written) != "010203" {
+		t.Errorf("Expected the responses in the order of the requests, got %x", written)
+	}
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	t.Parallel()
+	server := startServerWith(t, func(config *Config) {
+		config.NumIoThreads = 4
+		config.QueuedMaxRequestsPerConnection = 4
+	})
+
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	// Three ApiVersions v0 with correlation ids 42, 43 and 44 in one write
+	request, _ := hex.DecodeString("0000000d001200000000002a0003636c69" + "0000000d001200000000002b0003636c69" + "0000000d001200000000002c0003636c69")
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []int32{42, 43, 44} {
+		response, err := readRequest(conn, 1<<20)
+		if err != nil {
+			t.Fatalf("Failed to read from server: %v", err)
+		}
+		if correlationID := bytesToInt32(response, 4, 8); correlationID != expected {
+			t.Errorf("Expected the response to %d, got %d", expected, correlationID)
+		}
+	}
+}
+
+// A connection that did not drain cannot queue once the handlers stopped,
+// its request is answered by closing it
+func TestEnqueueAfterHandlersStopped(t *testing.T) {
+	t.Parallel()
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	server.startRequestHandlers()
+	server.stopRequestHandlers()
+
+	client, broker := net.Pipe()
+	defer client.Close()
+	c := server.newConnection(broker, server.log)
+	go c.writeResponses()
+	defer close(c.responses)
+
+	if !c.acquire(context.Background()) {
+		t.Fatal("Expected a slot for the request")
+	}
+	c.enqueue(&request{header: &MinimalRequest{CorrelationID: 1}, session: &clientSession{log: server.log}, conn: c, received: time.Now()})
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+	c.inflight.Wait()
+}
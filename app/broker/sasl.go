@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/sasl"
+)
+
+// loadCredentials fills credentials from the credentials file, when
+// there is one, then from the UserScramCredentialRecords of the metadata log
+func (srv *Server) loadCredentials() error {
+	if err := srv.credentials.LoadFile(filepath.Join(srv.config.LogDir, SaslCredentialsFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+	applyScramCredentialRecords(*srv.metadata, srv.credentials)
+	return nil
+}
+
+// applyScramCredentialRecords replays the SCRAM credential records of the
+// metadata log in order, so a removal undoes an earlier record
+func applyScramCredentialRecords(metadata file_metadata.ClusterMetaData, store *sasl.CredentialStore) {
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.UserScramCredentialValue:
+				if mechanism, ok := sasl.ScramMechanismName(value.Mechanism); ok {
+					store.SetScramCredential(mechanism, value.Name, sasl.ScramCredential{
+						Salt:       value.Salt,
+						StoredKey:  value.StoredKey,
+						ServerKey:  value.ServerKey,
+						Iterations: int(value.Iterations),
+					})
+				}
+			case file_metadata.RemoveUserScramCredentialValue:
+				if mechanism, ok := sasl.ScramMechanismName(value.Mechanism); ok {
+					store.RemoveScramCredential(mechanism, value.Name)
+				}
+			}
+		}
+	}
+}
+
+// handleSaslHandshakeRequest picks the mechanism of the exchange, a connection
+// of a SASL listener gets a single handshake
+func (srv *Server) handleSaslHandshakeRequest(buff []byte, session *clientSession) (*SaslHandshakeResponse, error) {
+	req, err := deserializeSaslHandshakeRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SaslHandshakeResponse{
+		CorrelationID: req.CorrelationID,
+		Mechanisms:    sasl.Mechanisms,
+	}
+	switch {
+	case !session.listener.SecurityProtocol.UsesSASL() || session.authenticator != nil:
+		response.ErrorCode = ErrorCodeIllegalSaslState
+	case !slices.Contains(sasl.Mechanisms, req.Mechanism):
+		response.ErrorCode = ErrorCodeUnsupportedSaslMechanism
+	default:
+		session.authenticator, _ = sasl.NewAuthenticator(req.Mechanism, srv.credentials)
+		session.mechanism = req.Mechanism
+		response.ErrorCode = ErrorCodeNone
+	}
+	return response, nil
+}
+
+// handleSaslAuthenticateRequest runs one step of the exchange picked by
+// SaslHandshake. Any error code means the connection gets closed.
+func handleSaslAuthenticateRequest(buff []byte, session *clientSession) (*SaslAuthenticateResponse, error) {
+	req, err := deserializeSaslAuthenticateRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SaslAuthenticateResponse{
+		CorrelationID: req.CorrelationID,
+		APIVersion:    req.RequestAPIVersion,
+		AuthBytes:     []byte{},
+	}
+	if session.authenticator == nil || session.saslAuthenticated() {
+		response.ErrorCode = ErrorCodeIllegalSaslState
+		response.ErrorMessage = "Unexpected SaslAuthenticate request"
+		session.log.Warn("Unexpected SaslAuthenticate request")
+		return response, nil
+	}
+
+	challenge, err := session.authenticator.Evaluate(req.AuthBytes)
+	if err != nil {
+		response.ErrorCode = ErrorCodeSaslAuthenticationFailed
+		response.ErrorMessage = "Authentication failed: " + err.Error()
+		session.log.Warn("SASL authentication failed", "mechanism", session.mechanism, "error", err)
+		return response, nil
+	}
+	response.AuthBytes = challenge
+	if session.saslAuthenticated() {
+		session.principal = session.authenticator.Username()
+		session.log.Info("Authenticated", "principal", session.principal, "mechanism", session.mechanism)
+	}
+	return response, nil
+}
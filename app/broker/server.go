@@ -0,0 +1,317 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/group_coordinator"
+	"toy_kafka/app/listeners"
+	"toy_kafka/app/purgatory"
+	"toy_kafka/app/quotas"
+	"toy_kafka/app/sasl"
+	"toy_kafka/app/transaction_coordinator"
+)
+
+// Server is a broker with its own log directory and listeners, several of them
+// can run in one process as long as their directories and ports differ
+type Server struct {
+	config Config
+	log    *slog.Logger
+
+	metadata *file_metadata.ClusterMetaData
+	// topics indexes the topics, partitions and brokers of metadata
+	topics *topicIndex
+	// metadataLock guards metadata, topics and appends to the metadata log
+	metadataLock sync.RWMutex
+
+	groupCoordinator       *group_coordinator.GroupCoordinator
+	transactionCoordinator *transaction_coordinator.TransactionCoordinator
+
+	// configs resolves topic and broker configs
+	configs *configs.Store
+	// authorizer is nil unless AuthorizerClassName is set
+	authorizer  *authorizer.Authorizer
+	quotas      *quotas.Manager
+	credentials *sasl.CredentialStore
+
+	partitionLogs partitionLogs
+	producerIDs   producerIdBlock
+
+	listenerManager *listeners.Manager
+	// addr is the address of the first listener started
+	addr string
+	// httpServer serves /metrics and the admin API, it is nil unless
+	// HTTPAddr is set
+	httpServer *http.Server
+	httpAddr   string
+	metrics    *brokerMetrics
+	// ready is set once Start has loaded everything and started the
+	// listeners, until Close
+	ready atomic.Bool
+	// startFailure is why Start failed, /readyz reports it
+	startFailure atomic.Pointer[string]
+	// lastConnID numbers the connections in the logs
+	lastConnID       atomic.Int64
+	clients          connectedClients
+	connectionQuotas connectionQuotas
+	// requestQueue holds the requests read by the connections until the
+	// requestHandlers take them, it is made by Start. queueLock guards the
+	// sends against the queue being closed, queueClosed is set then.
+	requestQueue    chan *request
+	requestHandlers sync.WaitGroup
+	queueLock       sync.RWMutex
+	queueClosed     bool
+	// fetchPurgatory holds the Fetch requests waiting for min_bytes, and
+	// producePurgatory the Produce requests waiting for their acks, by the
+	// partitions they wait for
+	fetchPurgatory   *purgatory.Purgatory[topicPartition]
+	producePurgatory *purgatory.Purgatory[topicPartition]
+
+	// stop ends the context of the connections, it is set by Start
+	stop      context.CancelFunc
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New creates a broker from its config, nothing is read or bound until Start
+func New(config Config) (*Server, error) {
+	if config.LogDir == "" {
+		return nil, errors.New("a log directory is required")
+	}
+	if config.Listeners.Listeners != "" {
+		if _, err := config.Listeners.Resolve(); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	srv := &Server{
+		config:                 config,
+		log:                    logger,
+		groupCoordinator:       group_coordinator.NewGroupCoordinator(),
+		transactionCoordinator: transaction_coordinator.NewTransactionCoordinator(),
+		configs:                configs.NewStore(strconv.Itoa(int(config.NodeID)), brokerDefs()),
+		quotas:                 quotas.NewManager(QuotaWindowSizeMs*time.Millisecond, QuotaWindowNum),
+		credentials:            sasl.NewCredentialStore(),
+		partitionLogs:          partitionLogs{dir: config.LogDir, logs: make(map[topicPartition]*file_metadata.PartitionLog)},
+		fetchPurgatory:         purgatory.New[topicPartition](),
+		producePurgatory:       purgatory.New[topicPartition](),
+	}
+	srv.partitionLogs.appended = srv.partitionAppended
+	srv.metrics = srv.newMetrics()
+	for name, value := range config.Configs {
+		srv.configs.SetStatic(name, value)
+	}
+	srv.groupCoordinator.Logger = logger
+	srv.transactionCoordinator.Logger = logger
+	srv.listenerManager = listeners.NewManager(srv.handleConnection)
+	srv.listenerManager.Logger = logger
+	srv.listenerManager.Admit = srv.admitConnection
+	return srv, nil
+}
+
+// Start loads the logs and starts the listeners, their connections are served
+// until ctx is done or the server is closed. An empty log directory is
+// formatted as a new cluster. The HTTP server is started first, so /readyz
+// answers while the logs load.
+func (srv *Server) Start(ctx context.Context) error {
+	if err := srv.startHTTP(); err != nil {
+		return fmt.Errorf("failed to start the HTTP server: %w", err)
+	}
+	if err := srv.start(ctx); err != nil {
+		message := err.Error()
+		srv.startFailure.Store(&message)
+		srv.Close()
+		return err
+	}
+	srv.ready.Store(true)
+	return nil
+}
+
+func (srv *Server) start(ctx context.Context) error {
+	for _, dir := range srv.config.logDirs() {
+		clean, err := file_metadata.RemoveCleanShutdownMarker(dir)
+		if err != nil {
+			return fmt.Errorf("failed to check for a clean shutdown: %w", err)
+		}
+		if !clean && holdsLogs(dir) {
+			srv.log.Warn("The log directory was not shut down cleanly, torn writes are cut off as its logs are opened", "dir", dir)
+		}
+	}
+
+	loadStart := time.Now()
+	if err := srv.loadMetadata(); err != nil {
+		return fmt.Errorf("failed to load the metadata log: %w", err)
+	}
+	loadTime := time.Since(loadStart)
+	srv.metrics.metadataLoadTime.Set(float64(loadTime) / float64(time.Millisecond))
+	srv.log.Info("Loaded the metadata log", "batches", len(srv.metadata.Batches), "duration", loadTime)
+	if srv.log.Enabled(ctx, slog.LevelDebug) {
+		file_metadata.PrettyPrintClusterMetaData(*srv.metadata)
+	}
+
+	srv.metadataLock.Lock()
+	offsetsPartitions, err := srv.ensureOffsetsTopic()
+	srv.metadataLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to create the offsets topic: %w", err)
+	}
+	if err := srv.groupCoordinator.LoadOffsets(srv.config.LogDir, offsetsPartitions); err != nil {
+		return fmt.Errorf("failed to load committed offsets: %w", err)
+	}
+
+	srv.groupCoordinator.Topics = srv.consumerGroupTopics
+	srv.partitionLogs.adopt(group_coordinator.OffsetsTopic, srv.groupCoordinator.OffsetLogs())
+
+	srv.metadataLock.Lock()
+	transactionStatePartitions, err := srv.ensureTransactionStateTopic()
+	srv.metadataLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to create the transaction state topic: %w", err)
+	}
+	srv.transactionCoordinator.NextProducerID = srv.nextProducerId
+	srv.transactionCoordinator.WriteMarkers = srv.writeTxnMarkers
+	srv.transactionCoordinator.PartitionExists = srv.transactionPartitionExists
+	if err := srv.transactionCoordinator.Load(srv.config.LogDir, transactionStatePartitions); err != nil {
+		return fmt.Errorf("failed to load transactions: %w", err)
+	}
+	srv.partitionLogs.adopt(transaction_coordinator.TransactionStateTopic, srv.transactionCoordinator.StateLogs())
+
+	srv.loadAuthorizer()
+	srv.loadQuotas()
+	srv.loadConfigs()
+
+	if err := srv.loadCredentials(); err != nil {
+		return fmt.Errorf("failed to load SASL credentials: %w", err)
+	}
+
+	ctx, srv.stop = context.WithCancel(ctx)
+	srv.startRequestHandlers()
+	if err := srv.startListeners(ctx); err != nil {
+		return fmt.Errorf("failed to start the listeners: %w", err)
+	}
+	return nil
+}
+
+// loadMetadata reads the metadata log, which is created when it does not
+// exist yet. A torn write at its end is cut off, failing to read it fails the
+// start.
+func (srv *Server) loadMetadata() error {
+	path := srv.config.metadataLogPath()
+	metadata, err := file_metadata.OpenClusterMetaData(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		srv.metadata = &file_metadata.ClusterMetaData{}
+		srv.topics = newTopicIndex()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	srv.metadata = metadata
+	srv.topics = newTopicIndex()
+	for _, batch := range srv.metadata.Batches {
+		for _, record := range batch.Records {
+			srv.topics.apply(record.Value)
+		}
+	}
+	return nil
+}
+
+// appendMetadata appends records to the metadata log as one batch and updates
+// the topic index with them. Must be called with metadataLock held.
+func (srv *Server) appendMetadata(values ...[]byte) (file_metadata.RecordBatch, error) {
+	batch, err := file_metadata.AppendRecords(srv.config.metadataLogPath(), srv.metadata, values...)
+	if err != nil {
+		return batch, err
+	}
+	for _, record := range batch.Records {
+		srv.topics.apply(record.Value)
+	}
+	return batch, nil
+}
+
+// holdsLogs reports whether a log directory has the metadata or a partition
+// log of an earlier run, a fresh directory has nothing to recover
+func holdsLogs(dir string) bool {
+	segments, _ := filepath.Glob(filepath.Join(dir, "*", "*.log"))
+	return len(segments) > 0
+}
+
+// Addr is the address of the first listener, with the port it was given when
+// it was configured with port 0
+func (srv *Server) Addr() string {
+	return srv.addr
+}
+
+// Close stops accepting connections and gives the open ones ShutdownTimeoutMs
+// to answer the requests they are handling, their context is already done.
+// The logs are closed after that, and the log directories marked as cleanly
+// shut down when every connection drained in time.
+func (srv *Server) Close() error {
+	srv.closeOnce.Do(func() {
+		srv.closeErr = srv.shutdown()
+	})
+	return srv.closeErr
+}
+
+func (srv *Server) shutdown() error {
+	srv.ready.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeoutMs*time.Millisecond)
+	defer cancel()
+	// /readyz reports the shutdown until the connections are drained
+	defer srv.stopHTTP(ctx)
+
+	if srv.stop == nil {
+		// Not started, or Start failed before its listeners
+		return nil
+	}
+	srv.stop()
+	srv.listenerManager.StopAll()
+	// The requests waiting in the purgatories and for a rebalance are
+	// answered with what they have, so their connections can drain
+	srv.fetchPurgatory.Close()
+	srv.producePurgatory.Close()
+	srv.groupCoordinator.Close()
+
+	// The handlers are stopped even when some connections did not drain, no
+	// request may still be appending once the logs are closed. Those logs
+	// are not marked clean, their last batches may have been cut short.
+	drained := true
+	if err := srv.listenerManager.Drain(ctx); err != nil {
+		srv.log.Warn("Closed the connections still busy", "error", err)
+		drained = false
+	}
+	srv.stopRequestHandlers()
+
+	if err := srv.partitionLogs.closeAll(); err != nil {
+		return err
+	}
+	if !drained {
+		return nil
+	}
+	for _, dir := range srv.config.logDirs() {
+		if err := file_metadata.WriteCleanShutdownMarker(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,514 @@
+package broker
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/listeners"
+	"toy_kafka/app/ssl"
+)
+
+// Config holds the settings of server.properties the broker reads at startup,
+// DefaultConfig has Kafka's defaults unless noted otherwise
+type Config struct {
+	// NodeID mirrors node.id
+	NodeID int32
+	// LogDir mirrors log.dirs, which can only name a single directory
+	LogDir string
+	// MetadataLogDir mirrors metadata.log.dir, the metadata log is in LogDir
+	// when it is empty
+	MetadataLogDir string
+
+	// Listeners mirrors listeners, advertised.listeners and
+	// listener.security.protocol.map, empty listeners means defaultListeners
+	Listeners listeners.Config
+	// ControllerListenerNames mirrors controller.listener.names, those
+	// listeners belong to a KRaft controller so they are not started
+	ControllerListenerNames []string
+	// SslClientAuth mirrors ssl.client.auth, it only applies once the CA file
+	// exists
+	SslClientAuth ssl.ClientAuth
+	// SslPrincipalMappingRules mirrors ssl.principal.mapping.rules
+	SslPrincipalMappingRules []ssl.MappingRule
+
+	// AuthorizerClassName mirrors authorizer.class.name, without an authorizer
+	// every request is allowed like in Kafka
+	AuthorizerClassName string
+	// SuperUsers mirrors super.users
+	SuperUsers []string
+	// AllowEveryoneIfNoACLFound mirrors allow.everyone.if.no.acl.found
+	AllowEveryoneIfNoACLFound bool
+
+	// ConsumerGroupProtocolEnabled mirrors
+	// group.coordinator.rebalance.protocols containing "consumer",
+	// ConsumerGroupHeartbeat and ConsumerGroupDescribe are only advertised and
+	// answered while it is set
+	ConsumerGroupProtocolEnabled bool
+
+	// DefaultNumPartitions and DefaultReplicationFactor mirror num.partitions
+	// and default.replication.factor
+	DefaultNumPartitions     int32
+	DefaultReplicationFactor int16
+	// Kafka defaults offsets.topic.num.partitions and
+	// transaction.state.log.num.partitions to 50, one is plenty for a single
+	// broker
+	OffsetsTopicNumPartitions          int32
+	TransactionStateTopicNumPartitions int32
+
+	// MaxRequestSize mirrors socket.request.max.bytes
+	MaxRequestSize int32
+	// NumIoThreads mirrors num.io.threads, the number of goroutines handling
+	// requests
+	NumIoThreads int32
+	// QueuedMaxRequests mirrors queued.max.requests, connections wait to
+	// queue their requests while the queue is full
+	QueuedMaxRequests int32
+	// QueuedMaxRequestsPerConnection is how many requests of a connection
+	// are read before the first one is answered. Kafka has no such setting,
+	// it always waits for the response like the default of 1 does.
+	QueuedMaxRequestsPerConnection int32
+	// ConnectionsMaxIdleMs mirrors connections.max.idle.ms, connections are
+	// closed after that long without reading or writing anything
+	ConnectionsMaxIdleMs int64
+
+	// Configs are the static broker configs, the topic config defaults among
+	// them, by name
+	Configs map[string]string
+
+	// Logger receives the broker's logs, slog.Default() when nil
+	Logger *slog.Logger
+
+	// HTTPAddr is where /metrics, /healthz, /readyz and the read-only admin
+	// API are served, nothing is served when it is empty. Kafka has no such
+	// setting, it is the --http-addr flag.
+	HTTPAddr string
+}
+
+// DefaultConfig is the config of a broker started without server.properties
+func DefaultConfig() Config {
+	return Config{
+		NodeID: 1,
+		LogDir: "/tmp/kraft-combined-logs",
+		Listeners: listeners.Config{
+			SecurityProtocolMap: listeners.DefaultSecurityProtocolMap,
+			DefaultHost:         AdvertisedHost,
+		},
+		SslClientAuth:                      ssl.ClientAuthRequested,
+		SslPrincipalMappingRules:           ssl.DefaultMappingRules,
+		ConsumerGroupProtocolEnabled:       true,
+		DefaultNumPartitions:               1,
+		DefaultReplicationFactor:           1,
+		OffsetsTopicNumPartitions:          1,
+		TransactionStateTopicNumPartitions: 1,
+		MaxRequestSize:                     100 * 1024 * 1024,
+		NumIoThreads:                       8,
+		QueuedMaxRequests:                  500,
+		QueuedMaxRequestsPerConnection:     1,
+		ConnectionsMaxIdleMs:               10 * 60 * 1000,
+	}
+}
+
+// logDirs are the directories holding logs, the metadata log can be in one
+// of its own
+func (c *Config) logDirs() []string {
+	if c.MetadataLogDir != "" && filepath.Clean(c.MetadataLogDir) != filepath.Clean(c.LogDir) {
+		return []string{c.LogDir, c.MetadataLogDir}
+	}
+	return []string{c.LogDir}
+}
+
+func (c *Config) metadataLogPath() string {
+	if c.MetadataLogDir != "" {
+		return filepath.Join(c.MetadataLogDir, MetadataLogFile)
+	}
+	return filepath.Join(c.LogDir, MetadataLogFile)
+}
+
+// setters apply the settings of server.properties the broker reads at
+// startup, the topic config defaults go to Configs instead
+func (c *Config) setters() map[string]func(value string) error {
+	return map[string]func(value string) error{
+		"node.id":                               setInt32(&c.NodeID, 0),
+		"log.dirs":                              c.setLogDirs,
+		"metadata.log.dir":                      setString(&c.MetadataLogDir),
+		"process.roles":                         checkProcessRoles,
+		"listeners":                             setString(&c.Listeners.Listeners),
+		"advertised.listeners":                  setString(&c.Listeners.AdvertisedListeners),
+		"listener.security.protocol.map":        c.setSecurityProtocolMap,
+		"controller.listener.names":             c.setControllerListenerNames,
+		"ssl.client.auth":                       c.setSslClientAuth,
+		"ssl.principal.mapping.rules":           c.setSslPrincipalMappingRules,
+		"authorizer.class.name":                 c.setAuthorizerClassName,
+		"super.users":                           c.setSuperUsers,
+		"allow.everyone.if.no.acl.found":        setBool(&c.AllowEveryoneIfNoACLFound),
+		"group.coordinator.rebalance.protocols": c.setRebalanceProtocols,
+		"num.partitions":                        setInt32(&c.DefaultNumPartitions, 1),
+		"default.replication.factor":            setInt16(&c.DefaultReplicationFactor, 1),
+		"offsets.topic.num.partitions":          setInt32(&c.OffsetsTopicNumPartitions, 1),
+		"transaction.state.log.num.partitions":  setInt32(&c.TransactionStateTopicNumPartitions, 1),
+		"socket.request.max.bytes":              setInt32(&c.MaxRequestSize, 1),
+		"connections.max.idle.ms":               setInt64(&c.ConnectionsMaxIdleMs, 1),
+		"num.io.threads":                        setInt32(&c.NumIoThreads, 1),
+		"queued.max.requests":                   setInt32(&c.QueuedMaxRequests, 1),
+		"queued.max.requests.per.connection":    setInt32(&c.QueuedMaxRequestsPerConnection, 1),
+	}
+}
+
+// ignoredServerConfigs are found in Kafka's sample server.properties but only
+// matter to a cluster of several nodes or to Kafka's thread pools, every
+// connection is read by a goroutine of its own
+var ignoredServerConfigs = []string{
+	"controller.quorum.voters",
+	"controller.quorum.bootstrap.servers",
+	"inter.broker.listener.name",
+	"num.network.threads",
+	"socket.send.buffer.bytes",
+	"socket.receive.buffer.bytes",
+	"num.recovery.threads.per.data.dir",
+	"offsets.topic.replication.factor",
+	"transaction.state.log.replication.factor",
+	"transaction.state.log.min.isr",
+	"share.coordinator.state.topic.replication.factor",
+	"share.coordinator.state.topic.min.isr",
+	"log.retention.check.interval.ms",
+}
+
+// Kafka takes log.retention.ms from these when it is not set itself, the
+// first one set wins
+var retentionFallbacks = []retentionFallback{
+	{"log.retention.minutes", 60 * 1000},
+	{"log.retention.hours", 60 * 60 * 1000},
+}
+
+type retentionFallback struct {
+	name       string
+	multiplier int64
+}
+
+// serverProperty is a setting and where it was given, for error messages
+type serverProperty struct {
+	name   string
+	value  string
+	origin string
+}
+
+// overrideFlags collects the repeatable --override flag
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// LoadConfig applies the properties file named by the first argument, then
+// the --override flags, to DefaultConfig. Every unknown key and invalid value
+// is reported, not only the first one.
+func LoadConfig(args []string) (Config, error) {
+	config := DefaultConfig()
+	var properties []serverProperty
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path := args[0]
+		args = args[1:]
+
+		file, err := os.Open(path)
+		if err != nil {
+			return config, err
+		}
+		parsed, err := configs.ParseProperties(file)
+		file.Close()
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, property := range parsed {
+			properties = append(properties, serverProperty{property.Name, property.Value, fmt.Sprintf("%s:%d", path, property.Line)})
+		}
+	}
+
+	var overrides overrideFlags
+	flags := flag.NewFlagSet("toy_kafka", flag.ContinueOnError)
+	flags.Var(&overrides, "override", "a `property=value` that replaces the one of the properties file, can be repeated")
+	logLevel := flags.String("log-level", "info", "the lowest `level` logged, debug also logs every request")
+	logFormat := flags.String("log-format", LogFormatText, "`text` or json")
+	flags.StringVar(&config.HTTPAddr, "http-addr", "", "the `host:port` serving /metrics, the health checks and the admin API, none when empty")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: toy_kafka [server.properties] [--override property=value]... [--log-level level] [--log-format format] [--http-addr host:port]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+	if flags.NArg() > 0 {
+		return config, fmt.Errorf("unexpected argument %q, the properties file must come first", flags.Arg(0))
+	}
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		return config, err
+	}
+	if config.Logger, err = NewLogger(os.Stdout, *logFormat, level); err != nil {
+		return config, err
+	}
+	for _, override := range overrides {
+		name, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return config, fmt.Errorf("invalid --override %q, expected property=value", override)
+		}
+		properties = append(properties, serverProperty{strings.TrimSpace(name), strings.TrimSpace(value), "--override"})
+	}
+
+	// A later value of a property replaces an earlier one, like in Java
+	var names []string
+	final := make(map[string]serverProperty)
+	for _, property := range properties {
+		if _, ok := final[property.name]; !ok {
+			names = append(names, property.name)
+		}
+		final[property.name] = property
+	}
+
+	var errs []error
+	static := make(map[string]string)
+	for _, name := range names {
+		property := final[name]
+		if err := config.applyServerProperty(property, static); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", property.origin, err))
+		}
+	}
+	if _, ok := final["log.retention.ms"]; !ok {
+		for _, fallback := range retentionFallbacks {
+			if value, ok := static[fallback.name]; ok {
+				// -1 keeps the log forever whatever the unit
+				if parsed, _ := strconv.ParseInt(value, 10, 64); parsed < 0 {
+					static["log.retention.ms"] = "-1"
+				} else {
+					static["log.retention.ms"] = strconv.FormatInt(parsed*fallback.multiplier, 10)
+				}
+				break
+			}
+		}
+	}
+	for _, fallback := range retentionFallbacks {
+		delete(static, fallback.name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(static)) {
+		if unsupportedConfig(configs.BrokerResource, name, static[name]) != "" {
+			config.Logger.Warn("Ignoring a server config the broker does not apply", "config", name, "value", static[name])
+		}
+	}
+
+	if config.Listeners.Listeners != "" {
+		if _, err := config.Listeners.Resolve(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return config, fmt.Errorf("invalid server config:\n%w", errors.Join(errs...))
+	}
+
+	config.Configs = static
+	return config, nil
+}
+
+// applyServerProperty sets a broker setting, or validates a topic config
+// default. The values of known configs are added to static.
+func (c *Config) applyServerProperty(property serverProperty, static map[string]string) error {
+	name, value := property.name, property.value
+	def, isConfig := configs.Lookup(brokerDefs(), name)
+	switch setter, ok := c.setters()[name]; {
+	case ok:
+		if err := setter(value); err != nil {
+			return fmt.Errorf("Invalid value %s for configuration %s: %w", value, name, err)
+		}
+	case isConfig && def.ReadOnly:
+		return fmt.Errorf("Configuration %s is fixed at %s", name, def.Default)
+	case isConfig:
+		if err := def.Validate(value); err != nil {
+			return err
+		}
+	case slices.ContainsFunc(retentionFallbacks, func(f retentionFallback) bool { return f.name == name }):
+		if parsed, err := strconv.ParseInt(value, 10, 64); err != nil || parsed < -1 {
+			return fmt.Errorf("Invalid value %s for configuration %s: Value must be a number of at least -1", value, name)
+		}
+		static[name] = value
+		return nil
+	case slices.Contains(ignoredServerConfigs, name):
+		c.Logger.Warn("Ignoring a server config that has no effect on a single broker", "config", name)
+		return nil
+	default:
+		return fmt.Errorf("Unknown configuration %s", name)
+	}
+
+	if isConfig {
+		static[name] = value
+	}
+	return nil
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil || (value != "true" && value != "false") {
+			return errors.New("Expected value to be either true or false")
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setInt32(target *int32, minimum int32) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return errors.New("Not a number of type INT")
+		}
+		if int32(parsed) < minimum {
+			return fmt.Errorf("Value must be at least %d", minimum)
+		}
+		*target = int32(parsed)
+		return nil
+	}
+}
+
+func setInt64(target *int64, minimum int64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("Not a number of type LONG")
+		}
+		if parsed < minimum {
+			return fmt.Errorf("Value must be at least %d", minimum)
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setInt16(target *int16, minimum int16) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 16)
+		if err != nil {
+			return errors.New("Not a number of type SHORT")
+		}
+		if int16(parsed) < minimum {
+			return fmt.Errorf("Value must be at least %d", minimum)
+		}
+		*target = int16(parsed)
+		return nil
+	}
+}
+
+func (c *Config) setLogDirs(value string) error {
+	dirs := configs.SplitList(value)
+	if len(dirs) != 1 {
+		return fmt.Errorf("Exactly one log directory is supported, got %d", len(dirs))
+	}
+	c.LogDir = dirs[0]
+	return nil
+}
+
+// checkProcessRoles accepts the roles of a broker or a combined node, the
+// metadata log is always managed by this process
+func checkProcessRoles(value string) error {
+	roles := configs.SplitList(value)
+	for _, role := range roles {
+		if role != "broker" && role != "controller" {
+			return fmt.Errorf("Unknown process role %s", role)
+		}
+	}
+	if !slices.Contains(roles, "broker") {
+		return errors.New("The process must have the broker role")
+	}
+	return nil
+}
+
+func (c *Config) setSecurityProtocolMap(value string) error {
+	if _, err := listeners.ParseSecurityProtocolMap(value); err != nil {
+		return err
+	}
+	c.Listeners.SecurityProtocolMap = value
+	return nil
+}
+
+func (c *Config) setControllerListenerNames(value string) error {
+	c.ControllerListenerNames = nil
+	for _, name := range configs.SplitList(value) {
+		c.ControllerListenerNames = append(c.ControllerListenerNames, strings.ToUpper(name))
+	}
+	return nil
+}
+
+func (c *Config) setSslClientAuth(value string) error {
+	clientAuth, err := ssl.ParseClientAuth(value)
+	if err != nil {
+		return err
+	}
+	c.SslClientAuth = clientAuth
+	return nil
+}
+
+func (c *Config) setSslPrincipalMappingRules(value string) error {
+	rules, err := ssl.ParseMappingRules(value)
+	if err != nil {
+		return err
+	}
+	c.SslPrincipalMappingRules = rules
+	return nil
+}
+
+// setAuthorizerClassName accepts Kafka's KRaft authorizer, which is the one
+// the authorizer package implements
+func (c *Config) setAuthorizerClassName(value string) error {
+	switch value {
+	case "", "StandardAuthorizer", "org.apache.kafka.metadata.authorizer.StandardAuthorizer":
+		c.AuthorizerClassName = value
+		return nil
+	}
+	return errors.New("Only org.apache.kafka.metadata.authorizer.StandardAuthorizer is available")
+}
+
+// setSuperUsers parses the semicolon separated principals of super.users
+func (c *Config) setSuperUsers(value string) error {
+	c.SuperUsers = nil
+	for _, principal := range strings.Split(value, ";") {
+		if principal = strings.TrimSpace(principal); principal == "" {
+			continue
+		}
+		if principalType, name, ok := strings.Cut(principal, ":"); !ok || principalType == "" || name == "" {
+			return fmt.Errorf("Principal %s is not of the form Type:name", principal)
+		}
+		c.SuperUsers = append(c.SuperUsers, principal)
+	}
+	return nil
+}
+
+func (c *Config) setRebalanceProtocols(value string) error {
+	protocols := configs.SplitList(value)
+	for _, protocol := range protocols {
+		if protocol != "classic" && protocol != "consumer" {
+			return fmt.Errorf("Unknown rebalance protocol %s", protocol)
+		}
+	}
+	if !slices.Contains(protocols, "classic") {
+		return errors.New("The classic rebalance protocol must be enabled")
+	}
+	c.ConsumerGroupProtocolEnabled = slices.Contains(protocols, "consumer")
+	return nil
+}
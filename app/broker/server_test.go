@@ -0,0 +1,241 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"toy_kafka/app/file_metadata"
+)
+
+// startServer runs a broker of its own in a temporary directory, listening on
+// an ephemeral port, and closes it when the test ends
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	return startServerWith(t, func(*Config) {})
+}
+
+// startServerWith starts a broker on a free port of localhost, with a config
+// changed by configure
+func startServerWith(t *testing.T, configure func(*Config)) *Server {
+	t.Helper()
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	config.Listeners.Listeners = "PLAINTEXT://127.0.0.1:0"
+	configure(&config)
+
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start the server: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := server.Close(); err != nil {
+			t.Errorf("Failed to close the server: %v", err)
+		}
+	})
+	return server
+}
+
+// requestBytes frames the body of a request of a flexible version after its
+// header, with client id "cli"
+func requestBytes(apiKey int16, version int16, correlationID int32, body []byte) []byte {
+	buffer := append(int16ToBytes(apiKey), int16ToBytes(version)...)
+	buffer = append(buffer, int32ToBytes(correlationID)...)
+	buffer = append(buffer, 0x00, 0x03, 'c', 'l', 'i', 0x00)
+	buffer = append(buffer, body...)
+	return append(int32ToBytes(int32(len(buffer))), buffer...)
+}
+
+// testSession is the session of a client of server authenticated as
+// principal, for calling the handlers directly
+func testSession(server *Server, principal string) *clientSession {
+	return &clientSession{server: server, log: server.log, principal: principal, host: "127.0.0.1"}
+}
+
+// describeTopicPartitions sends a raw DescribeTopicPartitions request and
+// returns the raw response, both in hex
+func describeTopicPartitions(t *testing.T, server *Server, hexInput string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	data, err := hex.DecodeString(hexInput)
+	if err != nil {
+		t.Fatalf("Failed to decode hex input: %v", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatalf("Failed to write to server: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := readRequest(conn, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to read from server: %v", err)
+	}
+	return hex.EncodeToString(response)
+}
+
+func TestServerHandlesHardcodedRequest(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	// DescribeTopicPartitions v0 of the unknown topic "unknown-topic-paz"
+	hexInput := "00000031004b00002a5d9747000c6b61666b612d746573746572000212756e6b6e6f776e2d746f7069632d70617a0000000001ff00"
+	expectedHexOutput := "000000372a5d9747" + "00" + "00000000" + "02" +
+		"0003" + "12756e6b6e6f776e2d746f7069632d70617a" + // error code and name
+		"00000000000000000000000000000000" + "00" + "01" + // topic id, is internal and no partitions
+		"00000000" + "00" + // topic authorized operations and tag buffer
+		"ff" + "00" // null next cursor and tag buffer
+
+	if actualHexOutput := describeTopicPartitions(t, server, hexInput); expectedHexOutput != actualHexOutput {
+		t.Fatalf("FAILED TEST, expected %s, got %s", expectedHexOutput, actualHexOutput)
+	}
+}
+
+func TestServerHandlesPartitionRequest(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	if result := createTopics(t, server, false, CreatableTopic{Name: "baz", NumPartitions: 1, ReplicationFactor: 1}); result[0].ErrorCode != ErrorCodeNone {
+		t.Fatalf("Failed to create baz: %+v", result)
+	}
+	server.metadataLock.RLock()
+	topicID := server.topics.topic("baz").TopicId
+	server.metadataLock.RUnlock()
+
+	// DescribeTopicPartitions v0 of the topic "baz"
+	hexInput := "00000023004b00007ff21070000c6b61666b612d74657374657200020462617a0000000001ff00"
+	expectedHexOutput := "000000457ff21070" + "00" + "00000000" + "02" +
+		"0000" + "0462617a" + // error code and name
+		hex.EncodeToString(topicID[:]) + "00" + // topic id and is internal
+		"02" + "0000" + "00000000" + "00000001" + "00000000" + // one partition, its error code, index, leader and leader epoch
+		"0200000001" + "0200000001" + "01" + "01" + "01" + "00" + // replicas, isr, elr, last known elr, offline replicas and tag buffer
+		"00000df8" + "00" + // topic authorized operations and tag buffer
+		"ff" + "00" // null next cursor and tag buffer
+
+	if actualHexOutput := describeTopicPartitions(t, server, hexInput); expectedHexOutput != actualHexOutput {
+		t.Fatalf("FAILED TEST, expected %s, got %s", expectedHexOutput, actualHexOutput)
+	}
+}
+
+// startAndClose runs a broker on logDir once and returns what it logged
+func startAndClose(t *testing.T, logDir string) string {
+	t.Helper()
+	var logs bytes.Buffer
+	logger, err := NewLogger(&logs, LogFormatText, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("Failed to create the logger: %v", err)
+	}
+	config := DefaultConfig()
+	config.LogDir = logDir
+	config.Listeners.Listeners = "PLAINTEXT://127.0.0.1:0"
+	config.Logger = logger
+
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start the server: %v", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Fatalf("Failed to close the server: %v", err)
+	}
+	return logs.String()
+}
+
+func TestUncleanShutdownWarning(t *testing.T) {
+	t.Parallel()
+	logDir := t.TempDir()
+	const warning = "was not shut down cleanly"
+
+	if logs := startAndClose(t, logDir); strings.Contains(logs, warning) {
+		t.Errorf("Expected no warning for a fresh log directory, got %s", logs)
+	}
+	if logs := startAndClose(t, logDir); strings.Contains(logs, warning) {
+		t.Errorf("Expected no warning after a clean shutdown, got %s", logs)
+	}
+
+	// A crash leaves the logs without the marker of a clean shutdown
+	if _, err := file_metadata.RemoveCleanShutdownMarker(logDir); err != nil {
+		t.Fatalf("Failed to remove the clean shutdown marker: %v", err)
+	}
+	if logs := startAndClose(t, logDir); !strings.Contains(logs, warning) {
+		t.Errorf("Expected a warning after an unclean shutdown, got %s", logs)
+	}
+}
+
+// A torn write at the end of the metadata log is cut off, the topics before it
+// are kept
+func TestMetadataLogTornTail(t *testing.T) {
+	t.Parallel()
+	logDir := t.TempDir()
+	configure := func(config *Config) { config.LogDir = logDir }
+
+	server := startServerWith(t, configure)
+	createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+	if err := server.Close(); err != nil {
+		t.Fatalf("Failed to close the server: %v", err)
+	}
+
+	path := server.config.metadataLogPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat the metadata log: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open the metadata log: %v", err)
+	}
+	// The start of a batch whose length runs past the end of the file
+	file.Write([]byte{0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 100, 1, 2, 3})
+	file.Close()
+
+	restarted := startServerWith(t, configure)
+	if !topicExists(restarted, "orders") {
+		t.Error("Expected the topic before the torn write to be kept")
+	}
+	if recovered, err := os.Stat(path); err != nil || recovered.Size() != info.Size() {
+		t.Errorf("Expected the metadata log cut back to %d bytes, got %v, err %v", info.Size(), recovered, err)
+	}
+}
+
+// A metadata log that cannot be read fails the start, /readyz says why
+func TestMetadataLogLoadFailure(t *testing.T) {
+	t.Parallel()
+	config := DefaultConfig()
+	config.LogDir = t.TempDir()
+	config.Listeners.Listeners = "PLAINTEXT://127.0.0.1:0"
+	if err := os.MkdirAll(config.metadataLogPath(), 0755); err != nil {
+		t.Fatalf("Failed to block the metadata log: %v", err)
+	}
+
+	server, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create the server: %v", err)
+	}
+	if err := server.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "metadata log") {
+		t.Fatalf("Expected the start to fail on the metadata log, got %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.handleReadyz(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	var status healthStatus
+	json.NewDecoder(recorder.Body).Decode(&status)
+	if recorder.Code != http.StatusServiceUnavailable || status.Status != "failed" || !strings.Contains(status.Error, "metadata log") {
+		t.Errorf("Expected /readyz to report the failure, got %d %+v", recorder.Code, status)
+	}
+}
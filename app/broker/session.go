@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"time"
+	"toy_kafka/app/listeners"
+	"toy_kafka/app/sasl"
+	"toy_kafka/app/ssl"
+)
+
+// clientSession is the security state of one connection. While SASL is
+// required and not complete, only ApiVersions and the SASL requests are served.
+type clientSession struct {
+	// server is the broker the connection was accepted by
+	server *Server
+	// log carries the fields of the connection and, once one is read, of
+	// the request being handled
+	log *slog.Logger
+
+	// principal is who the client authenticated as, from its certificate or
+	// SASL, ANONYMOUS otherwise
+	principal string
+	// host is the client's IP address, which ACLs can be limited to
+	host string
+
+	// listener is the one the connection came in on, SASL listeners require
+	// authentication before serving anything else
+	listener      listeners.Listener
+	mechanism     string
+	authenticator sasl.Authenticator
+
+	// clientID is the client id of the request being handled, quotas are
+	// looked up by principal and client id
+	clientID string
+	// delayed is how long the request being handled waited for data
+	delayed time.Duration
+	// mutedUntil is when the connection stops being throttled for the
+	// request being handled
+	mutedUntil time.Time
+}
+
+// newClientSession completes the TLS handshake of SSL connections, whose
+// principal comes from the client certificate
+func (srv *Server) newClientSession(conn net.Conn, listener listeners.Listener, log *slog.Logger) (*clientSession, error) {
+	session := &clientSession{server: srv, log: log, principal: ssl.AnonymousPrincipal, listener: listener}
+	session.host, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return session, nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(SslHandshakeTimeoutMs * time.Millisecond))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	// SASL_SSL clients are identified by SASL instead
+	if !listener.SecurityProtocol.UsesSASL() {
+		principal, err := ssl.Principal(tlsConn.ConnectionState(), srv.config.SslPrincipalMappingRules)
+		if err != nil {
+			return nil, err
+		}
+		session.principal = principal
+	}
+	return session, nil
+}
+
+// forRequest copies the session for a request handled alongside others of the
+// connection
+func (s *clientSession) forRequest() *clientSession {
+	forked := *s
+	return &forked
+}
+
+func (s *clientSession) saslAuthenticated() bool {
+	return s.authenticator != nil && s.authenticator.Complete()
+}
+
+func (s *clientSession) allows(apiKey int) bool {
+	switch apiKey {
+	case ApiVersionAPIKEY, SaslHandshakeAPIKEY, SaslAuthenticateAPIKEY:
+		return true
+	}
+	return !s.listener.SecurityProtocol.UsesSASL() || s.saslAuthenticated()
+}
@@ -0,0 +1,111 @@
+package broker
+
+import (
+	"sort"
+	"toy_kafka/app/file_metadata"
+
+	"github.com/google/uuid"
+)
+
+// topicIndex mirrors the topics, partitions and brokers of the metadata log,
+// so requests look them up without replaying the log. It is guarded by
+// metadataLock like the log itself.
+type topicIndex struct {
+	// topics are in the order of their TopicRecords
+	topics     []file_metadata.TopicValue
+	byName     map[string]int
+	byId       map[uuid.UUID]int
+	partitions map[uuid.UUID][]file_metadata.PartitionValue
+	brokers    map[int32]bool
+}
+
+func newTopicIndex() *topicIndex {
+	return &topicIndex{
+		byName:     make(map[string]int),
+		byId:       make(map[uuid.UUID]int),
+		partitions: make(map[uuid.UUID][]file_metadata.PartitionValue),
+		brokers:    make(map[int32]bool),
+	}
+}
+
+// apply updates the index with a metadata record, other records are ignored
+func (index *topicIndex) apply(value interface{}) {
+	switch value := value.(type) {
+	case file_metadata.TopicValue:
+		// A topic named again replaces the earlier one, as the lookups of
+		// the log do
+		if i, ok := index.byName[value.TopicName]; ok {
+			index.remove(index.topics[i].TopicId)
+		}
+		index.byName[value.TopicName] = len(index.topics)
+		index.byId[value.TopicId] = len(index.topics)
+		index.topics = append(index.topics, value)
+	case file_metadata.PartitionValue:
+		index.partitions[value.TopicId] = append(index.partitions[value.TopicId], value)
+	case file_metadata.RemoveTopicValue:
+		index.remove(value.TopicId)
+	case file_metadata.RegisterBrokerValue:
+		index.brokers[value.BrokerId] = true
+	case file_metadata.UnregisterBrokerValue:
+		delete(index.brokers, value.BrokerId)
+	}
+}
+
+func (index *topicIndex) remove(topicId uuid.UUID) {
+	i, ok := index.byId[topicId]
+	if !ok {
+		return
+	}
+	delete(index.byName, index.topics[i].TopicName)
+	delete(index.byId, topicId)
+	delete(index.partitions, topicId)
+	index.topics = append(index.topics[:i], index.topics[i+1:]...)
+	for _, topic := range index.topics[i:] {
+		index.byName[topic.TopicName]--
+		index.byId[topic.TopicId]--
+	}
+}
+
+// topic finds a topic by name, nil when it does not exist
+func (index *topicIndex) topic(name string) *file_metadata.TopicValue {
+	i, ok := index.byName[name]
+	if !ok {
+		return nil
+	}
+	topic := index.topics[i]
+	return &topic
+}
+
+// topicById finds a topic by id, nil when it does not exist
+func (index *topicIndex) topicById(topicId uuid.UUID) *file_metadata.TopicValue {
+	i, ok := index.byId[topicId]
+	if !ok {
+		return nil
+	}
+	topic := index.topics[i]
+	return &topic
+}
+
+// list returns every topic in the order they were created
+func (index *topicIndex) list() []file_metadata.TopicValue {
+	return append([]file_metadata.TopicValue(nil), index.topics...)
+}
+
+// partitionsOf returns the PartitionRecords of a topic in log order, callers
+// holding only the read lock may sort the copy
+func (index *topicIndex) partitionsOf(topicId uuid.UUID) []file_metadata.PartitionValue {
+	return append([]file_metadata.PartitionValue(nil), index.partitions[topicId]...)
+}
+
+// registeredBrokers returns the ids of the brokers registered in the
+// metadata log plus self, in ascending order
+func (index *topicIndex) registeredBrokers(self int32) []int32 {
+	brokers := []int32{self}
+	for broker := range index.brokers {
+		if broker != self {
+			brokers = append(brokers, broker)
+		}
+	}
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i] < brokers[j] })
+	return brokers
+}
@@ -0,0 +1,275 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+	"toy_kafka/app/configs"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/group_coordinator"
+	"toy_kafka/app/transaction_coordinator"
+
+	"github.com/google/uuid"
+)
+
+const maxTopicNameLength = 249
+
+// validateTopicName returns why a topic name is illegal, or "" if it is fine
+func validateTopicName(name string) string {
+	if name == "" {
+		return "Topic name is illegal, it can't be empty"
+	}
+	if name == "." || name == ".." {
+		return "Topic name cannot be \".\" or \"..\""
+	}
+	if len(name) > maxTopicNameLength {
+		return fmt.Sprintf("Topic name is illegal, it can't be longer than %d characters, topic name: %s", maxTopicNameLength, name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("._-", c)) {
+			return fmt.Sprintf("Topic name \"%s\" is illegal, it contains a character other than ASCII alphanumerics, '.', '_' and '-'", name)
+		}
+	}
+	return ""
+}
+
+// liveBrokers returns the ids of the brokers replicas can be placed on, this
+// broker plus every broker registered in the metadata log, in ascending order.
+// Must be called with metadataLock held.
+func (srv *Server) liveBrokers() []int32 {
+	return srv.topics.registeredBrokers(srv.config.NodeID)
+}
+
+// assignReplicas spreads partitions [start, start+count) round robin over the
+// brokers, the first replica of every partition is its leader
+func assignReplicas(brokers []int32, start int32, count int32, replicationFactor int16) [][]int32 {
+	assignments := make([][]int32, 0, count)
+	for p := start; p < start+count; p++ {
+		replicas := make([]int32, 0, replicationFactor)
+		for i := 0; i < int(replicationFactor); i++ {
+			replicas = append(replicas, brokers[(int(p)+i)%len(brokers)])
+		}
+		assignments = append(assignments, replicas)
+	}
+	return assignments
+}
+
+// validateReplicaAssignment checks explicit assignments cover partitions 0..n-1
+// on known brokers, and returns them ordered by partition index
+func validateReplicaAssignment(assignments []CreatableReplicaAssignment, brokers []int32) ([][]int32, string) {
+	known := make(map[int32]bool)
+	for _, broker := range brokers {
+		known[broker] = true
+	}
+
+	ordered := make([][]int32, len(assignments))
+	for _, assignment := range assignments {
+		index := assignment.PartitionIndex
+		if index < 0 || int(index) >= len(assignments) || ordered[index] != nil {
+			return nil, fmt.Sprintf("Partitions should be a consecutive 0-based integer sequence, found partition %d", index)
+		}
+		if len(assignment.BrokerIDs) == 0 {
+			return nil, fmt.Sprintf("Replica assignment for partition %d is empty", index)
+		}
+
+		seen := make(map[int32]bool)
+		for _, broker := range assignment.BrokerIDs {
+			if !known[broker] {
+				return nil, fmt.Sprintf("Broker %d in the assignment for partition %d is not registered", broker, index)
+			}
+			if seen[broker] {
+				return nil, fmt.Sprintf("Duplicate broker %d in the assignment for partition %d", broker, index)
+			}
+			seen[broker] = true
+		}
+		ordered[index] = assignment.BrokerIDs
+	}
+
+	for _, replicas := range ordered[1:] {
+		if len(replicas) != len(ordered[0]) {
+			return nil, "All partitions should have the same number of replicas"
+		}
+	}
+	return ordered, ""
+}
+
+func partitionValue(topicId uuid.UUID, partition int32, replicas []int32) file_metadata.PartitionValue {
+	return file_metadata.PartitionValue{
+		PartitionId:          partition,
+		TopicId:              topicId,
+		ReplicaIdArray:       replicas,
+		InSyncReplicaArray:   replicas,
+		RemovingReplicaArray: []int32{},
+		AddingReplicaArray:   []int32{},
+		LeaderId:             replicas[0],
+		LeaderEpoch:          0,
+		PartitionEpoch:       0,
+	}
+}
+
+// createPartitionDirs creates the directories of partitions [start, start+count)
+// of a topic, those already created are removed again when one fails
+func (srv *Server) createPartitionDirs(topic string, start int32, count int32) error {
+	for partition := start; partition < start+count; partition++ {
+		if err := file_metadata.CreatePartitionDir(srv.config.LogDir, topic, partition); err != nil {
+			srv.removePartitionDirs(topic, start, partition-start+1)
+			return err
+		}
+	}
+	return nil
+}
+
+// removePartitionDirs rolls back createPartitionDirs
+func (srv *Server) removePartitionDirs(topic string, start int32, count int32) {
+	for partition := start; partition < start+count; partition++ {
+		if err := file_metadata.DeletePartitionDir(srv.config.LogDir, topic, partition); err != nil {
+			srv.log.Error("Failed to remove a partition directory", "topic", topic, "partition", partition, "error", err)
+		}
+	}
+}
+
+// createTopic creates the partition directories of a new topic, then appends
+// its TopicRecord, PartitionRecords and ConfigRecords to the metadata log as
+// one batch. The directories are removed again when the append fails, so a
+// topic is never in the metadata without its logs. Must be called with
+// metadataLock held.
+func (srv *Server) createTopic(name string, topicId uuid.UUID, assignments [][]int32, topicConfigs []CreatableTopicConfig) error {
+	if err := srv.createPartitionDirs(name, 0, int32(len(assignments))); err != nil {
+		return err
+	}
+
+	values := [][]byte{file_metadata.EncodeTopicValue(file_metadata.TopicValue{TopicName: name, TopicId: topicId})}
+	for partition, replicas := range assignments {
+		values = append(values, file_metadata.EncodePartitionValue(partitionValue(topicId, int32(partition), replicas)))
+	}
+	for _, config := range topicConfigs {
+		values = append(values, file_metadata.EncodeConfigValue(file_metadata.ConfigValue{
+			ResourceType: file_metadata.TopicConfigResource,
+			ResourceName: name,
+			Name:         config.Name,
+			Value:        config.Value,
+		}))
+	}
+
+	batch, err := srv.appendMetadata(values...)
+	if err != nil {
+		srv.removePartitionDirs(name, 0, int32(len(assignments)))
+		return err
+	}
+	for _, record := range batch.Records {
+		srv.applyConfigRecord(record.Value)
+	}
+	return nil
+}
+
+// deleteTopic appends a RemoveTopicRecord for the topic and moves its partition
+// directories out of the way. Must be called with metadataLock held.
+func (srv *Server) deleteTopic(topic file_metadata.TopicValue) error {
+	partitions := srv.topics.partitionsOf(topic.TopicId)
+
+	removal := file_metadata.EncodeRemoveTopicValue(file_metadata.RemoveTopicValue{TopicId: topic.TopicId})
+	if _, err := srv.appendMetadata(removal); err != nil {
+		return err
+	}
+
+	srv.configs.Forget(configs.Resource{Type: configs.TopicResource, Name: topic.TopicName})
+	srv.partitionLogs.drop(topic.TopicName)
+	for _, partition := range partitions {
+		if err := file_metadata.DeletePartitionDir(srv.config.LogDir, topic.TopicName, partition.PartitionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPartitions creates the directories of partitions [start, start+len(assignments))
+// of an existing topic, then appends their PartitionRecords. Must be called
+// with metadataLock held.
+func (srv *Server) createPartitions(topic file_metadata.TopicValue, start int32, assignments [][]int32) error {
+	count := int32(len(assignments))
+	if err := srv.createPartitionDirs(topic.TopicName, start, count); err != nil {
+		return err
+	}
+
+	var values [][]byte
+	for i, replicas := range assignments {
+		values = append(values, file_metadata.EncodePartitionValue(partitionValue(topic.TopicId, start+int32(i), replicas)))
+	}
+	if _, err := srv.appendMetadata(values...); err != nil {
+		srv.removePartitionDirs(topic.TopicName, start, count)
+		return err
+	}
+	return nil
+}
+
+// isInternalTopic reports the topics the broker manages for itself
+func isInternalTopic(name string) bool {
+	return name == group_coordinator.OffsetsTopic || name == transaction_coordinator.TransactionStateTopic
+}
+
+// ensureOffsetsTopic creates the compacted __consumer_offsets topic the first
+// time the broker starts and returns its partition count. Must be called with
+// metadataLock held.
+func (srv *Server) ensureOffsetsTopic() (int, error) {
+	return srv.ensureInternalTopic(group_coordinator.OffsetsTopic, srv.config.OffsetsTopicNumPartitions)
+}
+
+// ensureTransactionStateTopic does the same for __transaction_state. Must be
+// called with metadataLock held.
+func (srv *Server) ensureTransactionStateTopic() (int, error) {
+	return srv.ensureInternalTopic(transaction_coordinator.TransactionStateTopic, srv.config.TransactionStateTopicNumPartitions)
+}
+
+func (srv *Server) ensureInternalTopic(name string, partitions int32) (int, error) {
+	if topic := srv.topics.topic(name); topic != nil {
+		return len(srv.topics.partitionsOf(topic.TopicId)), nil
+	}
+
+	assignments := assignReplicas([]int32{srv.config.NodeID}, 0, partitions, srv.config.DefaultReplicationFactor)
+	configs := []CreatableTopicConfig{{Name: "cleanup.policy", Value: "compact"}}
+	if err := srv.createTopic(name, uuid.New(), assignments, configs); err != nil {
+		return 0, err
+	}
+	return int(partitions), nil
+}
+
+// topicPartitionCount is the number of partitions of a topic, 0 when it does
+// not exist. Must be called with metadataLock held.
+func (srv *Server) topicPartitionCount(name string) int32 {
+	topic := srv.topics.topic(name)
+	if topic == nil {
+		return 0
+	}
+	return int32(len(srv.topics.partitionsOf(topic.TopicId)))
+}
+
+// inSyncReplicaCount is the size of a partition's ISR. Must be called with
+// metadataLock held.
+func (srv *Server) inSyncReplicaCount(name string, partition int32) int {
+	topic := srv.topics.topic(name)
+	if topic == nil {
+		return 0
+	}
+	for _, value := range srv.topics.partitionsOf(topic.TopicId) {
+		if value.PartitionId == partition {
+			return len(value.InSyncReplicaArray)
+		}
+	}
+	return 0
+}
+
+// consumerGroupTopics lists every topic for the consumer group assignors
+func (srv *Server) consumerGroupTopics() []group_coordinator.TopicMetadata {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+
+	var topics []group_coordinator.TopicMetadata
+	for _, topic := range srv.topics.list() {
+		topics = append(topics, group_coordinator.TopicMetadata{
+			ID:         topic.TopicId,
+			Name:       topic.TopicName,
+			Partitions: int32(len(srv.topics.partitionsOf(topic.TopicId))),
+			Internal:   isInternalTopic(topic.TopicName),
+		})
+	}
+	return topics
+}
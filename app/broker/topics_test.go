@@ -0,0 +1,350 @@
+package broker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/group_coordinator"
+	"toy_kafka/app/ssl"
+	"toy_kafka/app/transaction_coordinator"
+)
+
+// createTopicsRequest is a CreateTopics v7 of topics without assignments or
+// configs
+func createTopicsRequest(validateOnly bool, topics ...CreatableTopic) []byte {
+	body := compactArrayLengthToBytes(len(topics))
+	for _, topic := range topics {
+		body = append(body, compactStringToBytes(topic.Name)...)
+		body = append(body, int32ToBytes(topic.NumPartitions)...)
+		body = append(body, int16ToBytes(topic.ReplicationFactor)...)
+		body = append(body, compactArrayLengthToBytes(0)...) // assignments
+		body = append(body, compactArrayLengthToBytes(0)...) // configs
+		body = append(body, 0x00)
+	}
+	body = append(body, int32ToBytes(30000)...) // timeout ms
+	body = append(body, boolToBytes(validateOnly)...)
+	body = append(body, 0x00)
+	return requestBytes(CreateTopicsAPIKEY, 7, 1, body)
+}
+
+func createTopics(t *testing.T, server *Server, validateOnly bool, topics ...CreatableTopic) []CreatableTopicResult {
+	t.Helper()
+	response, err := server.handleCreateTopicsRequest(createTopicsRequest(validateOnly, topics...), testSession(server, ssl.AnonymousPrincipal))
+	if err != nil {
+		t.Fatalf("Failed to handle CreateTopics: %v", err)
+	}
+	return response.Topics
+}
+
+func topicExists(server *Server, name string) bool {
+	server.metadataLock.RLock()
+	defer server.metadataLock.RUnlock()
+	return FindTopicInGlobalMetadata(*server.metadata, name) != nil
+}
+
+func TestCreateTopics(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	results := createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 3, ReplicationFactor: 1})
+	if len(results) != 1 || results[0].ErrorCode != ErrorCodeNone || results[0].NumPartitions != 3 {
+		t.Fatalf("Expected the topic to be created, got %+v", results)
+	}
+	if !topicExists(server, "orders") {
+		t.Error("Expected the topic in the metadata")
+	}
+
+	results = createTopics(t, server, false, CreatableTopic{Name: "orders", NumPartitions: 1, ReplicationFactor: 1})
+	if results[0].ErrorCode != ErrorCodeTopicAlreadyExists || results[0].NumPartitions != -1 {
+		t.Errorf("Expected TOPIC_ALREADY_EXISTS, got %+v", results[0])
+	}
+}
+
+func TestCreateTopicsDuplicateNames(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	topic := CreatableTopic{Name: "twice", NumPartitions: 1, ReplicationFactor: 1}
+	results := createTopics(t, server, false, topic, topic)
+	for _, result := range results {
+		if result.ErrorCode != ErrorCodeInvalidRequest {
+			t.Errorf("Expected INVALID_REQUEST for a duplicate name, got %+v", result)
+		}
+	}
+	if topicExists(server, "twice") {
+		t.Error("Expected a topic named twice not to be created")
+	}
+}
+
+func TestCreateTopicsInvalidReplicationFactor(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	for _, replicationFactor := range []int16{0, 2} {
+		results := createTopics(t, server, false, CreatableTopic{Name: "replicated", NumPartitions: 1, ReplicationFactor: replicationFactor})
+		if results[0].ErrorCode != ErrorCodeInvalidReplicationFactor {
+			t.Errorf("Expected INVALID_REPLICATION_FACTOR for %d with a single broker, got %+v", replicationFactor, results[0])
+		}
+	}
+	if topicExists(server, "replicated") {
+		t.Error("Expected the topic not to be created")
+	}
+}
+
+func TestCreateTopicsTooManyPartitions(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	results := createTopics(t, server, false, CreatableTopic{Name: "huge", NumPartitions: MaxTopicPartitions + 1, ReplicationFactor: 1})
+	if results[0].ErrorCode != ErrorCodeInvalidPartitions {
+		t.Errorf("Expected INVALID_PARTITIONS, got %+v", results[0])
+	}
+	if topicExists(server, "huge") {
+		t.Error("Expected the topic not to be created")
+	}
+}
+
+// A topic whose partition directories can't be created is not added to the
+// metadata, and the directories created before the failure are removed
+func TestCreateTopicsRollsBackPartitionDirs(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	// A file where the directory of the second partition goes
+	if err := os.WriteFile(filepath.Join(server.config.LogDir, "blocked-1"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write a file: %v", err)
+	}
+
+	results := createTopics(t, server, false, CreatableTopic{Name: "blocked", NumPartitions: 2, ReplicationFactor: 1})
+	if results[0].ErrorCode != ErrorCodeUnknownServerError {
+		t.Errorf("Expected UNKNOWN_SERVER_ERROR, got %+v", results[0])
+	}
+	if topicExists(server, "blocked") {
+		t.Error("Expected the topic not to be in the metadata")
+	}
+	if _, err := os.Stat(filepath.Join(server.config.LogDir, "blocked-0")); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory of the first partition to be removed, got %v", err)
+	}
+}
+
+// deleteTopicsRequest is a DeleteTopics v6 of topics by name
+func deleteTopicsRequest(names ...string) []byte {
+	body := compactArrayLengthToBytes(len(names))
+	for _, name := range names {
+		body = append(body, compactNullableStringToBytes(name, false)...)
+		body = append(body, make([]byte, 16)...) // topic id
+		body = append(body, 0x00)
+	}
+	body = append(body, int32ToBytes(30000)...) // timeout ms
+	body = append(body, 0x00)
+	return requestBytes(DeleteTopicsAPIKEY, 6, 1, body)
+}
+
+func deleteTopics(t *testing.T, server *Server, names ...string) []DeletableTopicResult {
+	t.Helper()
+	response, err := server.handleDeleteTopicsRequest(deleteTopicsRequest(names...), testSession(server, ssl.AnonymousPrincipal))
+	if err != nil {
+		t.Fatalf("Failed to handle DeleteTopics: %v", err)
+	}
+	return response.Responses
+}
+
+func TestDeleteUnknownTopic(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	results := deleteTopics(t, server, "missing")
+	if len(results) != 1 || results[0].ErrorCode != ErrorCodeUnknownTopic {
+		t.Errorf("Expected UNKNOWN_TOPIC_OR_PARTITION, got %+v", results)
+	}
+}
+
+func TestDeleteAndRecreateTopic(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	created := createTopics(t, server, false, CreatableTopic{Name: "events", NumPartitions: 1, ReplicationFactor: 1})
+	log, err := server.partitionLogs.get("events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the partition log: %v", err)
+	}
+	if _, err := log.AppendBatch(file_metadata.EncodeRecordBatch(0, time.Now().UnixMilli(), [][]byte{[]byte("value")})); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	results := deleteTopics(t, server, "events")
+	if len(results) != 1 || results[0].ErrorCode != ErrorCodeNone || results[0].TopicID != created[0].TopicID {
+		t.Fatalf("Expected the topic to be deleted, got %+v", results)
+	}
+	if topicExists(server, "events") {
+		t.Fatal("Expected the topic to be gone from the metadata")
+	}
+	if results := deleteTopics(t, server, "events"); results[0].ErrorCode != ErrorCodeUnknownTopic {
+		t.Errorf("Expected a deleted topic to be unknown, got %+v", results[0])
+	}
+
+	recreated := createTopics(t, server, false, CreatableTopic{Name: "events", NumPartitions: 1, ReplicationFactor: 1})
+	if recreated[0].ErrorCode != ErrorCodeNone || recreated[0].TopicID == created[0].TopicID {
+		t.Fatalf("Expected the topic to be created again with a new id, got %+v", recreated[0])
+	}
+	log, err = server.partitionLogs.get("events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the partition log: %v", err)
+	}
+	if end := log.EndOffset(); end != 0 {
+		t.Errorf("Expected the re-created topic to start empty, its log ends at %d", end)
+	}
+}
+
+func TestDeleteInternalTopics(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	for _, name := range []string{group_coordinator.OffsetsTopic, transaction_coordinator.TransactionStateTopic} {
+		results := deleteTopics(t, server, name)
+		if results[0].ErrorCode != ErrorCodeInvalidRequest {
+			t.Errorf("Expected INVALID_REQUEST deleting %s, got %+v", name, results[0])
+		}
+		if !topicExists(server, name) {
+			t.Errorf("Expected %s to stay in the metadata", name)
+		}
+		if _, err := os.Stat(filepath.Join(server.config.LogDir, name+"-0")); err != nil {
+			t.Errorf("Expected the partition directories of %s to stay: %v", name, err)
+		}
+	}
+}
+
+// createPartitionsRequest is a CreatePartitions v3 growing a topic to count
+// partitions, without assignments
+func createPartitionsRequest(validateOnly bool, name string, count int32) []byte {
+	body := compactArrayLengthToBytes(1)
+	body = append(body, compactStringToBytes(name)...)
+	body = append(body, int32ToBytes(count)...)
+	body = append(body, 0x00) // null assignments
+	body = append(body, 0x00)
+	body = append(body, int32ToBytes(30000)...) // timeout ms
+	body = append(body, boolToBytes(validateOnly)...)
+	body = append(body, 0x00)
+	return requestBytes(CreatePartitionsAPIKEY, 3, 1, body)
+}
+
+func createPartitions(t *testing.T, server *Server, validateOnly bool, name string, count int32) CreatePartitionsTopicResult {
+	t.Helper()
+	response, err := server.handleCreatePartitionsRequest(createPartitionsRequest(validateOnly, name, count), testSession(server, ssl.AnonymousPrincipal))
+	if err != nil {
+		t.Fatalf("Failed to handle CreatePartitions: %v", err)
+	}
+	return response.Results[0]
+}
+
+func partitionCount(server *Server, name string) int32 {
+	server.metadataLock.RLock()
+	defer server.metadataLock.RUnlock()
+	return server.topicPartitionCount(name)
+}
+
+func TestCreatePartitions(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	createTopics(t, server, false, CreatableTopic{Name: "grown", NumPartitions: 2, ReplicationFactor: 1})
+
+	if result := createPartitions(t, server, false, "missing", 3); result.ErrorCode != ErrorCodeUnknownTopic {
+		t.Errorf("Expected UNKNOWN_TOPIC_OR_PARTITION for a missing topic, got %+v", result)
+	}
+	for _, count := range []int32{1, 2} {
+		if result := createPartitions(t, server, false, "grown", count); result.ErrorCode != ErrorCodeInvalidPartitions {
+			t.Errorf("Expected INVALID_PARTITIONS for %d partitions, got %+v", count, result)
+		}
+	}
+
+	if result := createPartitions(t, server, true, "grown", 4); result.ErrorCode != ErrorCodeNone {
+		t.Errorf("Expected validate_only to succeed, got %+v", result)
+	}
+	if count := partitionCount(server, "grown"); count != 2 {
+		t.Errorf("Expected validate_only to leave 2 partitions, got %d", count)
+	}
+
+	if result := createPartitions(t, server, false, "grown", 4); result.ErrorCode != ErrorCodeNone {
+		t.Errorf("Expected the topic to grow, got %+v", result)
+	}
+	if count := partitionCount(server, "grown"); count != 4 {
+		t.Errorf("Expected 4 partitions, got %d", count)
+	}
+}
+
+func TestCreatePartitionsOfInternalTopics(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+
+	for _, name := range []string{group_coordinator.OffsetsTopic, transaction_coordinator.TransactionStateTopic} {
+		before := partitionCount(server, name)
+		for _, validateOnly := range []bool{true, false} {
+			if result := createPartitions(t, server, validateOnly, name, before+1); result.ErrorCode != ErrorCodeInvalidRequest {
+				t.Errorf("Expected INVALID_REQUEST for %s, got %+v", name, result)
+			}
+		}
+		if after := partitionCount(server, name); after != before {
+			t.Errorf("Expected %s to keep %d partitions, got %d", name, before, after)
+		}
+	}
+}
+
+func TestCreatePartitionsTooMany(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	createTopics(t, server, false, CreatableTopic{Name: "grown", NumPartitions: 1, ReplicationFactor: 1})
+
+	if result := createPartitions(t, server, false, "grown", MaxTopicPartitions+1); result.ErrorCode != ErrorCodeInvalidPartitions {
+		t.Errorf("Expected INVALID_PARTITIONS, got %+v", result)
+	}
+	if count := partitionCount(server, "grown"); count != 1 {
+		t.Errorf("Expected the topic to keep 1 partition, got %d", count)
+	}
+}
+
+// The topic index kept up to date by the appends matches the one replayed
+// from the metadata log at startup, and the log itself
+func TestTopicIndexFollowsTheMetadataLog(t *testing.T) {
+	t.Parallel()
+	server := startServer(t)
+	createTopics(t, server, false,
+		CreatableTopic{Name: "grown", NumPartitions: 1, ReplicationFactor: 1},
+		CreatableTopic{Name: "deleted", NumPartitions: 2, ReplicationFactor: 1},
+		CreatableTopic{Name: "kept", NumPartitions: 2, ReplicationFactor: 1})
+	createPartitions(t, server, false, "grown", 3)
+	deleteTopics(t, server, "deleted")
+
+	replayed := &Server{config: server.config}
+	if err := replayed.loadMetadata(); err != nil {
+		t.Fatalf("Failed to load the metadata log: %v", err)
+	}
+
+	server.metadataLock.RLock()
+	defer server.metadataLock.RUnlock()
+	for _, index := range []*topicIndex{server.topics, replayed.topics} {
+		var names []string
+		for _, topic := range index.list() {
+			names = append(names, topic.TopicName)
+		}
+		expected := ListTopicsInGlobalMetadata(*server.metadata)
+		if len(names) != len(expected) {
+			t.Fatalf("Expected the topics of the log, got %v", names)
+		}
+		for i, topic := range expected {
+			if names[i] != topic.TopicName {
+				t.Errorf("Expected topic %d to be %s, got %v", i, topic.TopicName, names)
+			}
+			if got, want := len(index.partitionsOf(topic.TopicId)), len(FindPartitionsInGlobalMetadata(*server.metadata, topic.TopicId)); got != want {
+				t.Errorf("Expected %d partitions of %s, got %d", want, topic.TopicName, got)
+			}
+		}
+		if index.topic("deleted") != nil {
+			t.Error("Expected the deleted topic to be gone from the index")
+		}
+		if partitions := index.partitionsOf(index.topic("grown").TopicId); len(partitions) != 3 {
+			t.Errorf("Expected the grown topic to have 3 partitions, got %d", len(partitions))
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"toy_kafka/app/authorizer"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/group_coordinator"
+	"toy_kafka/app/transaction_coordinator"
+)
+
+// writeTxnMarkers is how the transaction coordinator ends a transaction in the
+// partitions it touched. Partitions of deleted topics have nothing to end.
+func (srv *Server) writeTxnMarkers(producerID int64, producerEpoch int16, commit bool, partitions []transaction_coordinator.TopicPartition) error {
+	for _, tp := range partitions {
+		code := srv.writeTxnMarker(producerID, producerEpoch, commit, 0, tp.Topic, tp.Partition)
+		if code != ErrorCodeNone && code != ErrorCodeUnknownTopic {
+			return fmt.Errorf("marker for %s-%d failed with error code %d", tp.Topic, tp.Partition, code)
+		}
+	}
+	return nil
+}
+
+// writeTxnMarker writes a COMMIT or ABORT control batch to a partition, the
+// group coordinator owns the partitions of the offsets topic
+func (srv *Server) writeTxnMarker(producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32, topic string, partition int32) int16 {
+	srv.metadataLock.RLock()
+	partitionCount := srv.topicPartitionCount(topic)
+	srv.metadataLock.RUnlock()
+	if partition < 0 || partition >= partitionCount {
+		return ErrorCodeUnknownTopic
+	}
+
+	var err error
+	if topic == group_coordinator.OffsetsTopic {
+		err = srv.groupCoordinator.CompleteTxn(producerID, producerEpoch, commit, partition, coordinatorEpoch)
+	} else {
+		var log *file_metadata.PartitionLog
+		log, err = srv.partitionLogs.get(topic, partition)
+		if err == nil {
+			_, err = log.AppendMarker(producerID, producerEpoch, commit, coordinatorEpoch)
+		}
+	}
+
+	switch {
+	case errors.Is(err, file_metadata.ErrInvalidProducerEpoch):
+		return ErrorCodeInvalidProducerEpoch
+	case err != nil:
+		srv.log.Error("Failed to write a transaction marker", "topic", topic, "partition", partition, "error", err)
+		return ErrorCodeKafkaStorageError
+	}
+	return ErrorCodeNone
+}
+
+// transactionPartitionExists reports whether a partition may join a transaction
+func (srv *Server) transactionPartitionExists(tp transaction_coordinator.TopicPartition) bool {
+	srv.metadataLock.RLock()
+	defer srv.metadataLock.RUnlock()
+	return tp.Partition >= 0 && tp.Partition < srv.topicPartitionCount(tp.Topic)
+}
+
+// handleAddPartitionsToTxnRequest needs WRITE on the transactional id and on
+// each topic. Like in Kafka, none of the partitions is added when a topic is
+// not authorized, the others are answered with OPERATION_NOT_ATTEMPTED.
+func (srv *Server) handleAddPartitionsToTxnRequest(buff []byte, session *clientSession) (*AddPartitionsToTxnResponse, error) {
+	req, err := deserializeAddPartitionsToTxnRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []transaction_coordinator.TopicPartition
+	unauthorized := make(map[string]bool)
+	for _, topic := range req.Topics {
+		if !session.authorizeTopic(authorizer.Write, topic.Name) {
+			unauthorized[topic.Name] = true
+		}
+		for _, partition := range topic.Partitions {
+			partitions = append(partitions, transaction_coordinator.TopicPartition{Topic: topic.Name, Partition: partition})
+		}
+	}
+
+	codes := make([]int16, len(partitions))
+	switch {
+	case !session.authorizeTransactionalID(authorizer.Write, req.TransactionalID):
+		for i := range codes {
+			codes[i] = ErrorCodeTransactionalIDAuthorizationFailed
+		}
+	case len(unauthorized) > 0:
+		for i, tp := range partitions {
+			codes[i] = ErrorCodeOperationNotAttempted
+			if unauthorized[tp.Topic] {
+				codes[i] = ErrorCodeTopicAuthorizationFailed
+			}
+		}
+	default:
+		codes = srv.transactionCoordinator.AddPartitions(transaction_coordinator.AddPartitionsRequest{
+			TransactionalID: req.TransactionalID,
+			ProducerID:      req.ProducerID,
+			ProducerEpoch:   req.ProducerEpoch,
+			Partitions:      partitions,
+		})
+	}
+
+	response := &AddPartitionsToTxnResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+	i := 0
+	for _, topic := range req.Topics {
+		result := AddPartitionsToTxnTopicResult{Name: topic.Name}
+		for _, partition := range topic.Partitions {
+			result.Results = append(result.Results, AddPartitionsToTxnPartitionResult{PartitionIndex: partition, ErrorCode: codes[i]})
+			i++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+// handleAddOffsetsToTxnRequest adds the offsets partition of the group to the
+// transaction, so the offsets committed through TxnOffsetCommit get a marker.
+// It needs WRITE on the transactional id and READ on the group.
+func (srv *Server) handleAddOffsetsToTxnRequest(buff []byte, session *clientSession) (*AddOffsetsToTxnResponse, error) {
+	req, err := deserializeAddOffsetsToTxnRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AddOffsetsToTxnResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+	switch {
+	case !session.authorizeTransactionalID(authorizer.Write, req.TransactionalID):
+		response.ErrorCode = ErrorCodeTransactionalIDAuthorizationFailed
+		return response, nil
+	case !session.authorizeGroup(authorizer.Read, req.GroupID):
+		response.ErrorCode = ErrorCodeGroupAuthorizationFailed
+		return response, nil
+	case req.GroupID == "":
+		response.ErrorCode = group_coordinator.ErrorCodeInvalidGroupID
+		return response, nil
+	}
+
+	tp := transaction_coordinator.TopicPartition{
+		Topic:     group_coordinator.OffsetsTopic,
+		Partition: srv.groupCoordinator.OffsetsPartitionFor(req.GroupID),
+	}
+	codes := srv.transactionCoordinator.AddPartitions(transaction_coordinator.AddPartitionsRequest{
+		TransactionalID: req.TransactionalID,
+		ProducerID:      req.ProducerID,
+		ProducerEpoch:   req.ProducerEpoch,
+		Partitions:      []transaction_coordinator.TopicPartition{tp},
+	})
+	response.ErrorCode = codes[0]
+	return response, nil
+}
+
+// handleEndTxnRequest needs WRITE on the transactional id
+func (srv *Server) handleEndTxnRequest(buff []byte, session *clientSession) (*EndTxnResponse, error) {
+	req, err := deserializeEndTxnRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	errorCode := int16(ErrorCodeTransactionalIDAuthorizationFailed)
+	if session.authorizeTransactionalID(authorizer.Write, req.TransactionalID) {
+		errorCode = srv.transactionCoordinator.EndTransaction(req.TransactionalID, req.ProducerID, req.ProducerEpoch, req.Committed)
+	}
+	return &EndTxnResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+		ErrorCode:     errorCode,
+	}, nil
+}
+
+// handleWriteTxnMarkersRequest writes markers on behalf of a coordinator, with
+// a single broker only admin tools send it. It needs CLUSTER_ACTION on the
+// cluster, like every inter-broker request.
+func (srv *Server) handleWriteTxnMarkersRequest(buff []byte, session *clientSession) (*WriteTxnMarkersResponse, error) {
+	req, err := deserializeWriteTxnMarkersRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	authorized := session.authorize(authorizer.ClusterAction, authorizer.ResourceCluster, authorizer.ClusterResourceName)
+	response := &WriteTxnMarkersResponse{CorrelationID: req.CorrelationID}
+	for _, marker := range req.Markers {
+		result := WritableTxnMarkerResult{ProducerID: marker.ProducerID}
+		for _, topic := range marker.Topics {
+			topicResult := WritableTxnMarkerTopicResult{Name: topic.Name}
+			for _, partition := range topic.PartitionIndexes {
+				code := int16(ErrorCodeClusterAuthorizationFailed)
+				if authorized {
+					code = srv.writeTxnMarker(marker.ProducerID, marker.ProducerEpoch, marker.TransactionResult, marker.CoordinatorEpoch, topic.Name, partition)
+				}
+				topicResult.Partitions = append(topicResult.Partitions, WritableTxnMarkerPartitionResult{PartitionIndex: partition, ErrorCode: code})
+			}
+			result.Topics = append(result.Topics, topicResult)
+		}
+		response.Markers = append(response.Markers, result)
+	}
+	return response, nil
+}
+
+// handleTxnOffsetCommitRequest commits offsets as part of a transaction, the
+// group's offsets partition must have been added through AddOffsetsToTxn. It
+// needs WRITE on the transactional id, and READ on the group and each topic.
+func (srv *Server) handleTxnOffsetCommitRequest(buff []byte, session *clientSession) (*TxnOffsetCommitResponse, error) {
+	req, err := deserializeTxnOffsetCommitRequest(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	// Partitions of topics without READ are answered without reaching the
+	// coordinator, codes follows the partitions of the request
+	var codes []int16
+	commit := group_coordinator.CommitOffsetsRequest{
+		GroupID:         req.GroupID,
+		GenerationID:    req.GenerationID,
+		MemberID:        req.MemberID,
+		GroupInstanceID: req.GroupInstanceID,
+	}
+	for _, topic := range req.Topics {
+		authorized := session.authorizeTopic(authorizer.Read, topic.Name)
+		for _, partition := range topic.Partitions {
+			if !authorized {
+				codes = append(codes, ErrorCodeTopicAuthorizationFailed)
+				continue
+			}
+			codes = append(codes, ErrorCodeNone)
+			commit.Offsets = append(commit.Offsets, group_coordinator.OffsetCommit{
+				TopicPartition: group_coordinator.TopicPartition{Topic: topic.Name, Partition: partition.PartitionIndex},
+				OffsetAndMetadata: group_coordinator.OffsetAndMetadata{
+					Offset:      partition.CommittedOffset,
+					LeaderEpoch: partition.CommittedLeaderEpoch,
+					Metadata:    partition.CommittedMetadata,
+				},
+			})
+		}
+	}
+
+	switch {
+	case !session.authorizeTransactionalID(authorizer.Write, req.TransactionalID):
+		for i := range codes {
+			codes[i] = ErrorCodeTransactionalIDAuthorizationFailed
+		}
+	case !session.authorizeGroup(authorizer.Read, req.GroupID):
+		for i := range codes {
+			codes[i] = ErrorCodeGroupAuthorizationFailed
+		}
+	default:
+		committed := make([]int16, len(commit.Offsets))
+		tp := transaction_coordinator.TopicPartition{
+			Topic:     group_coordinator.OffsetsTopic,
+			Partition: srv.groupCoordinator.OffsetsPartitionFor(req.GroupID),
+		}
+		code := srv.transactionCoordinator.WithinTransaction(req.TransactionalID, req.ProducerID, req.ProducerEpoch, tp, func() int16 {
+			committed = srv.groupCoordinator.CommitTxnOffsets(commit, group_coordinator.TxnProducer{ProducerID: req.ProducerID, ProducerEpoch: req.ProducerEpoch})
+			return ErrorCodeNone
+		})
+
+		// The partitions that reached the coordinator take its answers in order
+		next := 0
+		for i := range codes {
+			if codes[i] != ErrorCodeNone {
+				continue
+			}
+			codes[i] = committed[next]
+			if code != ErrorCodeNone {
+				codes[i] = code
+			}
+			next++
+		}
+	}
+
+	response := &TxnOffsetCommitResponse{
+		CorrelationID: req.CorrelationID,
+		ThrottleTime:  0,
+	}
+	i := 0
+	for _, topic := range req.Topics {
+		topicResult := TxnOffsetCommitResponseTopic{Name: topic.Name}
+		for _, partition := range topic.Partitions {
+			topicResult.Partitions = append(topicResult.Partitions, TxnOffsetCommitResponsePartition{PartitionIndex: partition.PartitionIndex, ErrorCode: codes[i]})
+			i++
+		}
+		response.Topics = append(response.Topics, topicResult)
+	}
+	return response, nil
+}
@@ -0,0 +1,466 @@
+package broker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/utils"
+
+	"github.com/google/uuid"
+)
+
+func bytesToInt(bs []byte, start int, end int) int {
+	valLen := end - start
+
+	switch valLen {
+	case 1:
+		return int(bs[start])
+	case 2:
+		return int(binary.BigEndian.Uint16(bs[start:end]))
+	case 4:
+		return int(binary.BigEndian.Uint32(bs[start:end]))
+	case 8:
+		return int(binary.BigEndian.Uint64(bs[start:end]))
+	default:
+		slog.Debug("Decoding an integer of unusual length", "bytes", valLen)
+		val := 0
+		for i := 0; i < valLen && i < 8; i++ {
+			val |= int(bs[start+i]) << ((valLen - 1 - i) * 8)
+		}
+		return val
+	}
+}
+
+func int16ToBytes(val int16) []byte {
+	return []byte{byte(val >> 8), byte(val)}
+}
+
+func int32ToBytes(val int32) []byte {
+	return []byte{byte(val >> 24), byte(val >> 16), byte(val >> 8), byte(val)}
+}
+
+func int64ToBytes(val int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(val))
+}
+
+func float64ToBytes(val float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(val))
+}
+
+// intToBytes converts various integer types to a byte slice of specified length
+func intToBytes(val interface{}, valByteLen int) []byte {
+	bs := make([]byte, valByteLen)
+	var v uint64
+
+	// Convert val to uint64 for unified processing
+	switch t := val.(type) {
+	case int:
+		v = uint64(t)
+	case int8:
+		v = uint64(t)
+	case int16:
+		v = uint64(t)
+	case int32:
+		v = uint64(t)
+	case int64:
+		v = uint64(t)
+	case uint:
+		v = uint64(t)
+	case uint8:
+		v = uint64(t)
+	case uint16:
+		v = uint64(t)
+	case uint32:
+		v = uint64(t)
+	case uint64:
+		v = t
+	default:
+		panic(fmt.Sprintf("Unsupported type: %T", val))
+	}
+
+	switch valByteLen {
+	case 1:
+		bs[0] = byte(v)
+	case 2:
+		binary.BigEndian.PutUint16(bs, uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(bs, uint32(v))
+	case 8:
+		binary.BigEndian.PutUint64(bs, v)
+	default:
+		// Custom length: manually encode from most significant byte down
+		slog.Debug("Encoding an integer of unusual length", "bytes", valByteLen)
+		for i := 0; i < valByteLen && i < 8; i++ {
+			bs[i] = byte(v >> ((valByteLen - 1 - i) * 8))
+		}
+	}
+
+	return bs
+}
+
+func writeAll(conn net.Conn, data []byte) error {
+	total := 0
+	for total < len(data) {
+		n, err := conn.Write(data[total:])
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+	return nil
+}
+
+// requestClientID reads the client id of a request header, it comes before
+// the tagged fields of flexible headers
+func requestClientID(buff []byte) string {
+	return deserializeRequestHeader(newByteReader(buff), false).ClientID
+}
+
+// readRequest reads one size delimited request, the returned buffer still
+// starts with the 4 byte message size like the deserializers expect. Requests
+// larger than maxSize are refused.
+func readRequest(conn net.Conn, maxSize int32) ([]byte, error) {
+	sizeBytes := make([]byte, 4)
+	if _, err := io.ReadFull(conn, sizeBytes); err != nil {
+		return nil, err
+	}
+
+	size := bytesToInt32(sizeBytes, 0, 4)
+	if size < 0 || size > maxSize {
+		return nil, fmt.Errorf("invalid request size %d", size)
+	}
+
+	buff := make([]byte, 4+int(size))
+	copy(buff, sizeBytes)
+	if _, err := io.ReadFull(conn, buff[4:]); err != nil {
+		return nil, err
+	}
+	return buff, nil
+}
+
+func encodeLength(l uint16) []byte {
+	out := make([]byte, 0)
+	if l == 0 {
+		out = append(out, 0)
+	} else {
+		for {
+			next := byte(l & 0x3f)
+			l = l >> 7
+			if l == 0 {
+				out = append(out, next)
+				break
+			} else {
+				next = next | 0x80
+				out = append(out, next)
+			}
+		}
+	}
+
+	return out
+}
+
+func bytesToInt16(buff []byte, start, end int) int16 {
+	if end-start == 2 {
+		return int16(buff[start])<<8 | int16(buff[start+1])
+	}
+	return 0
+}
+
+func bytesToInt32(buff []byte, start, end int) int32 {
+	if end-start == 4 {
+		return int32(buff[start])<<24 | int32(buff[start+1])<<16 | int32(buff[start+2])<<8 | int32(buff[start+3])
+	}
+	return 0
+}
+
+func FindTopicInGlobalMetadata(metadata file_metadata.ClusterMetaData, topic_name string) *file_metadata.TopicValue {
+	var found *file_metadata.TopicValue
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.TopicValue:
+				if value.TopicName == topic_name {
+					found = &value
+				}
+			case file_metadata.RemoveTopicValue:
+				// A later RemoveTopicRecord means the topic was deleted
+				if found != nil && found.TopicId == value.TopicId {
+					found = nil
+				}
+			}
+		}
+	}
+	return found
+}
+
+func FindTopicByIdInGlobalMetadata(metadata file_metadata.ClusterMetaData, topic_id uuid.UUID) *file_metadata.TopicValue {
+	var found *file_metadata.TopicValue
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.TopicValue:
+				if value.TopicId == topic_id {
+					found = &value
+				}
+			case file_metadata.RemoveTopicValue:
+				if value.TopicId == topic_id {
+					found = nil
+				}
+			}
+		}
+	}
+	return found
+}
+
+// ListTopicsInGlobalMetadata returns every topic that was not deleted, in log order
+func ListTopicsInGlobalMetadata(metadata file_metadata.ClusterMetaData) []file_metadata.TopicValue {
+	var topics []file_metadata.TopicValue
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			switch value := record.Value.(type) {
+			case file_metadata.TopicValue:
+				topics = append(topics, value)
+			case file_metadata.RemoveTopicValue:
+				for i, topic := range topics {
+					if topic.TopicId == value.TopicId {
+						topics = append(topics[:i], topics[i+1:]...)
+						break
+					}
+				}
+			}
+		}
+	}
+	return topics
+}
+
+// FindPartitionsInGlobalMetadata returns the PartitionRecords of a topic in log order
+func FindPartitionsInGlobalMetadata(metadata file_metadata.ClusterMetaData, topic_id uuid.UUID) []file_metadata.PartitionValue {
+	var partitions []file_metadata.PartitionValue
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			if partition, ok := record.Value.(file_metadata.PartitionValue); ok && partition.TopicId == topic_id {
+				partitions = append(partitions, partition)
+			}
+		}
+	}
+	return partitions
+}
+
+// byteReader walks a request buffer field by field. The first short read
+// records an error and turns every later read into a no-op, so a deserializer
+// only has to check err once it is done.
+type byteReader struct {
+	buff   []byte
+	offset int
+	err    error
+}
+
+func newByteReader(buff []byte) *byteReader {
+	return &byteReader{buff: buff}
+}
+
+func (r *byteReader) has(n int, field string) bool {
+	if r.err != nil {
+		return false
+	}
+	if n < 0 || len(r.buff) < r.offset+n {
+		r.err = fmt.Errorf("buffer too short for %s", field)
+		return false
+	}
+	return true
+}
+
+func (r *byteReader) int8(field string) int8 {
+	if !r.has(1, field) {
+		return 0
+	}
+	r.offset++
+	return int8(r.buff[r.offset-1])
+}
+
+func (r *byteReader) bool(field string) bool {
+	return r.int8(field) != 0
+}
+
+func (r *byteReader) int16(field string) int16 {
+	if !r.has(2, field) {
+		return 0
+	}
+	r.offset += 2
+	return bytesToInt16(r.buff, r.offset-2, r.offset)
+}
+
+func (r *byteReader) int32(field string) int32 {
+	if !r.has(4, field) {
+		return 0
+	}
+	r.offset += 4
+	return bytesToInt32(r.buff, r.offset-4, r.offset)
+}
+
+func (r *byteReader) int64(field string) int64 {
+	if !r.has(8, field) {
+		return 0
+	}
+	r.offset += 8
+	return int64(binary.BigEndian.Uint64(r.buff[r.offset-8 : r.offset]))
+}
+
+func (r *byteReader) float64(field string) float64 {
+	return math.Float64frombits(uint64(r.int64(field)))
+}
+
+func (r *byteReader) uuid(field string) [16]byte {
+	var id [16]byte
+	if !r.has(16, field) {
+		return id
+	}
+	copy(id[:], r.buff[r.offset:r.offset+16])
+	r.offset += 16
+	return id
+}
+
+func (r *byteReader) uvarint(field string) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	val, n, err := utils.ParseUvarint(r.buff[r.offset:])
+	if err != nil {
+		r.err = fmt.Errorf("invalid varint for %s: %w", field, err)
+		return 0
+	}
+	r.offset += n
+	return val
+}
+
+func (r *byteReader) bytes(n int, field string) []byte {
+	if !r.has(n, field) {
+		return nil
+	}
+	out := make([]byte, n)
+	copy(out, r.buff[r.offset:r.offset+n])
+	r.offset += n
+	return out
+}
+
+// compactArrayLength returns the element count of a COMPACT_ARRAY, -1 for a null array
+func (r *byteReader) compactArrayLength(field string) int {
+	return int(r.uvarint(field)) - 1
+}
+
+func (r *byteReader) compactString(field string) string {
+	s, _ := r.compactNullableString(field)
+	return s
+}
+
+// compactNullableString returns the string and whether it was null
+func (r *byteReader) compactNullableString(field string) (string, bool) {
+	length := int(r.uvarint(field))
+	if length == 0 {
+		return "", true
+	}
+	return string(r.bytes(length-1, field)), false
+}
+
+func (r *byteReader) compactBytes(field string) []byte {
+	length := int(r.uvarint(field))
+	if length == 0 {
+		return nil
+	}
+	return r.bytes(length-1, field)
+}
+
+// nullableString reads an INT16 length prefixed string, -1 means null
+func (r *byteReader) nullableString(field string) (string, bool) {
+	length := int(r.int16(field))
+	if length < 0 {
+		return "", true
+	}
+	return string(r.bytes(length, field)), false
+}
+
+func (r *byteReader) compactInt32Array(field string) []int32 {
+	count := r.compactArrayLength(field)
+	var out []int32
+	for i := 0; i < count && r.err == nil; i++ {
+		out = append(out, r.int32(field))
+	}
+	return out
+}
+
+// skipTaggedFields steps over a tag buffer, none of the tagged fields are used
+func (r *byteReader) skipTaggedFields(field string) {
+	count := int(r.uvarint(field))
+	for i := 0; i < count && r.err == nil; i++ {
+		r.uvarint(field) // tag
+		size := int(r.uvarint(field))
+		r.bytes(size, field)
+	}
+}
+
+func boolToBytes(val bool) []byte {
+	if val {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// compactArrayLengthToBytes encodes the element count of a COMPACT_ARRAY (length + 1)
+func compactArrayLengthToBytes(count int) []byte {
+	return utils.EncodeUvarint(uint64(count + 1))
+}
+
+func compactInt32ArrayToBytes(vals []int32) []byte {
+	out := compactArrayLengthToBytes(len(vals))
+	for _, val := range vals {
+		out = append(out, int32ToBytes(val)...)
+	}
+	return out
+}
+
+func compactStringToBytes(val string) []byte {
+	return append(compactArrayLengthToBytes(len(val)), val...)
+}
+
+func compactNullableStringToBytes(val string, isNull bool) []byte {
+	if isNull {
+		return []byte{0}
+	}
+	return compactStringToBytes(val)
+}
+
+func compactBytesToBytes(val []byte) []byte {
+	return append(compactArrayLengthToBytes(len(val)), val...)
+}
+
+// frameResponse prefixes a response body with its message size and header.
+// Flexible versions use response header v1, which ends in a tag buffer.
+func frameResponse(correlationID int32, flexible bool, body []byte) []byte {
+	var header []byte
+	header = append(header, int32ToBytes(correlationID)...)
+	if flexible {
+		header = append(header, 0)
+	}
+
+	buffer := int32ToBytes(int32(len(header) + len(body)))
+	buffer = append(buffer, header...)
+	return append(buffer, body...)
+}
+
+// FindNextProducerIdInGlobalMetadata returns the first producer id no broker has
+// been handed yet, from the last ProducerIdsRecord
+func FindNextProducerIdInGlobalMetadata(metadata file_metadata.ClusterMetaData) int64 {
+	var next int64
+	for _, batch := range metadata.Batches {
+		for _, record := range batch.Records {
+			if producerIds, ok := record.Value.(file_metadata.ProducerIdsValue); ok {
+				next = producerIds.NextProducerId
+			}
+		}
+	}
+	return next
+}
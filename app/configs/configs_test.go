@@ -0,0 +1,145 @@
+package configs
+
+import (
+	"testing"
+)
+
+func newTestStore() *Store {
+	brokerDefs := append(BrokerSynonymDefs(), ReadOnlyDef("node.id", Int, "1", "The node id"))
+	return NewStore("1", brokerDefs)
+}
+
+func TestResolution(t *testing.T) {
+	s := newTestStore()
+	orders := Resource{TopicResource, "orders"}
+
+	if got := s.TopicInt("orders", "retention.ms"); got != 604800000 {
+		t.Errorf("Expected the default retention, got %d", got)
+	}
+
+	s.SetStatic("log.retention.ms", "1000")
+	s.Apply(Resource{BrokerResource, ""}, "log.retention.ms", "2000", false)
+	s.Apply(Resource{BrokerResource, "1"}, "log.retention.ms", "3000", false)
+	s.Apply(Resource{BrokerResource, "2"}, "log.retention.ms", "9999", false)
+	s.Apply(orders, "retention.ms", "4000", false)
+
+	var retention Entry
+	for _, entry := range s.Describe(orders) {
+		if entry.Name == "retention.ms" {
+			retention = entry
+		}
+	}
+	want := []Synonym{
+		{"retention.ms", "4000", DynamicTopic},
+		{"log.retention.ms", "3000", DynamicBroker},
+		{"log.retention.ms", "2000", DynamicDefaultBroker},
+		{"log.retention.ms", "1000", StaticBroker},
+		{"log.retention.ms", "604800000", DefaultConfig},
+	}
+	if retention.Value != "4000" || retention.Source != DynamicTopic || len(retention.Synonyms) != len(want) {
+		t.Fatalf("Unexpected retention.ms entry: %+v", retention)
+	}
+	for i := range want {
+		if retention.Synonyms[i] != want[i] {
+			t.Errorf("Synonym %d: expected %+v, got %+v", i, want[i], retention.Synonyms[i])
+		}
+	}
+
+	// Removing a layer falls back to the next one
+	s.Apply(orders, "retention.ms", "", true)
+	s.Apply(Resource{BrokerResource, "1"}, "log.retention.ms", "", true)
+	if got := s.TopicInt("orders", "retention.ms"); got != 2000 {
+		t.Errorf("Expected the cluster wide default, got %d", got)
+	}
+
+	// The cluster wide resource only describes what is set
+	defaults := s.Describe(Resource{BrokerResource, ""})
+	if len(defaults) != 1 || defaults[0].Name != "log.retention.ms" || defaults[0].Source != DynamicDefaultBroker {
+		t.Errorf("Unexpected cluster wide configs: %+v", defaults)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := newTestStore()
+	for _, tc := range []struct {
+		resourceType   int8
+		name           string
+		value          string
+		valid          bool
+		invalidRequest bool
+	}{
+		{TopicResource, "retention.ms", "-1", true, false},
+		{TopicResource, "retention.ms", "-2", false, false},
+		{TopicResource, "retention.ms", "soon", false, false},
+		{TopicResource, "max.message.bytes", "3000000000", false, false},
+		{TopicResource, "cleanup.policy", "compact,delete", true, false},
+		{TopicResource, "cleanup.policy", "compact,archive", false, false},
+		{TopicResource, "compression.type", "brotli", false, false},
+		{TopicResource, "min.cleanable.dirty.ratio", "1.5", false, false},
+		{TopicResource, "unclean.leader.election.enable", "TRUE", true, false},
+		{TopicResource, "log.retention.ms", "1", false, false},
+		{BrokerResource, "log.retention.ms", "1", true, false},
+		{BrokerResource, "node.id", "2", false, true},
+	} {
+		err := s.Validate(tc.resourceType, tc.name, tc.value)
+		if (err == nil) != tc.valid || (err != nil && IsInvalidRequest(err) != tc.invalidRequest) {
+			t.Errorf("%s=%s: expected valid %v, got %v", tc.name, tc.value, tc.valid, err)
+		}
+	}
+}
+
+func TestAlter(t *testing.T) {
+	s := newTestStore()
+	orders := Resource{TopicResource, "orders"}
+	value := func(v string) *string { return &v }
+	s.Apply(orders, "retention.ms", "1000", false)
+	s.Apply(orders, "segment.ms", "2000", false)
+
+	// AlterConfigs removes what it does not list and skips what is unchanged
+	changes, err := s.Replace(orders, []Change{{"retention.ms", value("1000")}, {"cleanup.policy", value("compact")}})
+	if err != nil || len(changes) != 2 || changes[0].Name != "cleanup.policy" || changes[1].Name != "segment.ms" || changes[1].Value != nil {
+		t.Errorf("Unexpected AlterConfigs changes %+v, err %v", changes, err)
+	}
+	if _, err := s.Replace(orders, []Change{{"retention.ms", nil}}); err == nil || !IsInvalidRequest(err) {
+		t.Errorf("Expected null values to be rejected, got %v", err)
+	}
+
+	changes, err = s.Incremental(orders, []Op{
+		{"cleanup.policy", OpAppend, value("compact")},
+		{"segment.ms", OpDelete, nil},
+		{"retention.bytes", OpDelete, nil},
+	})
+	if err != nil || len(changes) != 2 || *changes[0].Value != "delete,compact" || changes[1].Name != "segment.ms" || changes[1].Value != nil {
+		t.Errorf("Unexpected IncrementalAlterConfigs changes %+v, err %v", changes, err)
+	}
+
+	s.Apply(orders, "cleanup.policy", "delete,compact", false)
+	changes, err = s.Incremental(orders, []Op{{"cleanup.policy", OpSubtract, value("delete")}})
+	if err != nil || len(changes) != 1 || *changes[0].Value != "compact" {
+		t.Errorf("Unexpected SUBTRACT changes %+v, err %v", changes, err)
+	}
+
+	for _, ops := range [][]Op{
+		{{"retention.ms", OpAppend, value("1")}},
+		{{"retention.ms", OpSet, value("1")}, {"retention.ms", OpDelete, nil}},
+		{{"retention.ms", OpSet, nil}},
+		{{"retention.ms", 7, value("1")}},
+		{{"unknown.config", OpSet, value("1")}},
+	} {
+		if _, err := s.Incremental(orders, ops); err == nil {
+			t.Errorf("Expected %+v to be rejected", ops)
+		}
+	}
+}
+
+func TestParseConnectionOverrides(t *testing.T) {
+	overrides, err := ParseConnectionOverrides("hostName:100, 127.0.0.1:200,::1:5")
+	if err != nil || len(overrides) != 3 || overrides["hostName"] != 100 || overrides["127.0.0.1"] != 200 || overrides["::1"] != 5 {
+		t.Errorf("Unexpected overrides %v, %v", overrides, err)
+	}
+	for _, value := range []string{"127.0.0.1", "host:many", "host:-1", ":3"} {
+		if _, err := ParseConnectionOverrides(value); err == nil {
+			t.Errorf("Expected %q to be invalid", value)
+		}
+	}
+}
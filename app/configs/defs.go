@@ -0,0 +1,224 @@
+package configs
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type uses the config_type codes of DescribeConfigs
+type Type int8
+
+const (
+	TypeUnknown Type = 0
+	Boolean     Type = 1
+	String      Type = 2
+	Int         Type = 3
+	Short       Type = 4
+	Long        Type = 5
+	Double      Type = 6
+	List        Type = 7
+	Class       Type = 8
+	Password    Type = 9
+)
+
+// Def describes a config, its type and the values it accepts
+type Def struct {
+	Name          string
+	Type          Type
+	Default       string
+	Documentation string
+	// BrokerSynonym is the broker config a topic config defaults to
+	BrokerSynonym string
+	// ReadOnly broker configs can not be changed while the broker runs
+	ReadOnly bool
+	// check validates a value that parsed as Type
+	check func(value string) error
+}
+
+// Validate parses a value as the config's type and checks its range
+func (d Def) Validate(value string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("Invalid value %s for configuration %s: %s", value, d.Name, reason)
+	}
+	switch d.Type {
+	case Boolean:
+		if !strings.EqualFold(value, "true") && !strings.EqualFold(value, "false") {
+			return invalid("Expected value to be either true or false")
+		}
+	case Int:
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32); err != nil {
+			return invalid("Not a number of type INT")
+		}
+	case Short:
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 16); err != nil {
+			return invalid("Not a number of type SHORT")
+		}
+	case Long:
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil {
+			return invalid("Not a number of type LONG")
+		}
+	case Double:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return invalid("Not a number of type DOUBLE")
+		}
+	}
+	if d.check != nil {
+		if err := d.check(value); err != nil {
+			return invalid(err.Error())
+		}
+	}
+	return nil
+}
+
+func atLeast(minimum float64) func(string) error {
+	return func(value string) error {
+		if parsed, _ := strconv.ParseFloat(strings.TrimSpace(value), 64); parsed < minimum {
+			return fmt.Errorf("Value must be at least %v", minimum)
+		}
+		return nil
+	}
+}
+
+func between(minimum float64, maximum float64) func(string) error {
+	return func(value string) error {
+		if parsed, _ := strconv.ParseFloat(strings.TrimSpace(value), 64); parsed < minimum || parsed > maximum {
+			return fmt.Errorf("Value must be no less than %v and no more than %v", minimum, maximum)
+		}
+		return nil
+	}
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		if !slices.Contains(allowed, value) {
+			return fmt.Errorf("String must be one of: %s", strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+}
+
+func listOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, item := range SplitList(value) {
+			if !slices.Contains(allowed, item) {
+				return fmt.Errorf("Invalid value %s, must be one of %s", item, strings.Join(allowed, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+// SplitList parses the value of a LIST config
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var (
+	maxInt  = strconv.FormatInt(math.MaxInt32, 10)
+	maxLong = strconv.FormatInt(math.MaxInt64, 10)
+)
+
+// TopicDefs are the topic configs with Kafka's defaults, each one defaults to
+// its broker synonym
+var TopicDefs = []Def{
+	{Name: "cleanup.policy", Type: List, Default: "delete", BrokerSynonym: "log.cleanup.policy", check: listOf("compact", "delete"),
+		Documentation: "This config designates the retention policy to use on log segments."},
+	{Name: "compression.type", Type: String, Default: "producer", BrokerSynonym: "compression.type", check: oneOf("uncompressed", "zstd", "lz4", "snappy", "gzip", "producer"),
+		Documentation: "Specify the final compression type for a given topic."},
+	{Name: "delete.retention.ms", Type: Long, Default: "86400000", BrokerSynonym: "log.cleaner.delete.retention.ms", check: atLeast(0),
+		Documentation: "The amount of time to retain delete tombstone markers for log compacted topics."},
+	{Name: "file.delete.delay.ms", Type: Long, Default: "60000", BrokerSynonym: "log.segment.delete.delay.ms", check: atLeast(0),
+		Documentation: "The time to wait before deleting a file from the filesystem."},
+	{Name: "max.compaction.lag.ms", Type: Long, Default: maxLong, BrokerSynonym: "log.cleaner.max.compaction.lag.ms", check: atLeast(1),
+		Documentation: "The maximum time a message will remain ineligible for compaction in the log."},
+	{Name: "max.message.bytes", Type: Int, Default: "1048588", BrokerSynonym: "message.max.bytes", check: atLeast(0),
+		Documentation: "The largest record batch size allowed by Kafka (after compression if compression is enabled)."},
+	{Name: "message.timestamp.type", Type: String, Default: "CreateTime", BrokerSynonym: "log.message.timestamp.type", check: oneOf("CreateTime", "LogAppendTime"),
+		Documentation: "Define whether the timestamp in the message is message create time or log append time."},
+	{Name: "min.cleanable.dirty.ratio", Type: Double, Default: "0.5", BrokerSynonym: "log.cleaner.min.cleanable.ratio", check: between(0, 1),
+		Documentation: "This configuration controls how frequently the log compactor will attempt to clean the log."},
+	{Name: "min.compaction.lag.ms", Type: Long, Default: "0", BrokerSynonym: "log.cleaner.min.compaction.lag.ms", check: atLeast(0),
+		Documentation: "The minimum time a message will remain uncompacted in the log."},
+	{Name: "min.insync.replicas", Type: Int, Default: "1", BrokerSynonym: "min.insync.replicas", check: atLeast(1),
+		Documentation: "When a producer sets acks to \"all\" (or \"-1\"), this configuration specifies the minimum number of replicas that must acknowledge a write for the write to be considered successful."},
+	{Name: "retention.bytes", Type: Long, Default: "-1", BrokerSynonym: "log.retention.bytes",
+		Documentation: "This configuration controls the maximum size a partition can grow to before we will discard old log segments to free up space if we are using the \"delete\" retention policy."},
+	{Name: "retention.ms", Type: Long, Default: "604800000", BrokerSynonym: "log.retention.ms", check: atLeast(-1),
+		Documentation: "This configuration controls the maximum time we will retain a log before we will discard old log segments to free up space if we are using the \"delete\" retention policy."},
+	{Name: "segment.bytes", Type: Int, Default: "1073741824", BrokerSynonym: "log.segment.bytes", check: atLeast(14),
+		Documentation: "This configuration controls the segment file size for the log."},
+	{Name: "segment.ms", Type: Long, Default: "604800000", BrokerSynonym: "log.roll.ms", check: atLeast(1),
+		Documentation: "This configuration controls the period of time after which Kafka will force the log to roll even if the segment file isn't full."},
+	{Name: "unclean.leader.election.enable", Type: Boolean, Default: "false", BrokerSynonym: "unclean.leader.election.enable",
+		Documentation: "Indicates whether to enable replicas not in the ISR set to be elected as leader as a last resort."},
+}
+
+// BrokerSynonymDefs are the broker configs the topic configs default to, they
+// can be changed per broker or cluster wide while the broker runs
+func BrokerSynonymDefs() []Def {
+	var defs []Def
+	for _, def := range TopicDefs {
+		def.Name = def.BrokerSynonym
+		def.BrokerSynonym = ""
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// ConnectionDefs are the broker configs limiting connections, they can be
+// changed while the broker runs
+var ConnectionDefs = []Def{
+	{Name: "max.connections", Type: Int, Default: maxInt, check: atLeast(0),
+		Documentation: "The maximum number of connections we allow in the broker at any time."},
+	{Name: "max.connections.per.ip", Type: Int, Default: maxInt, check: atLeast(0),
+		Documentation: "The maximum number of connections we allow from each ip address."},
+	{Name: "max.connections.per.ip.overrides", Type: String, Default: "", check: checkConnectionOverrides,
+		Documentation: "A comma-separated list of per-ip or hostname overrides to the default maximum number of connections. An example value is \"hostName:100,127.0.0.1:200\""},
+}
+
+// ParseConnectionOverrides parses max.connections.per.ip.overrides into the
+// limit of each host or ip
+func ParseConnectionOverrides(value string) (map[string]int, error) {
+	overrides := make(map[string]int)
+	for _, item := range SplitList(value) {
+		separator := strings.LastIndex(item, ":")
+		if separator <= 0 {
+			return nil, fmt.Errorf("Expected host:count, got %s", item)
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(item[separator+1:]), 10, 32)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("Invalid connection count %s for %s", item[separator+1:], item[:separator])
+		}
+		overrides[strings.TrimSpace(item[:separator])] = int(limit)
+	}
+	return overrides, nil
+}
+
+func checkConnectionOverrides(value string) error {
+	_, err := ParseConnectionOverrides(value)
+	return err
+}
+
+// Lookup finds the def of a config by name
+func Lookup(defs []Def, name string) (Def, bool) {
+	for _, def := range defs {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return Def{}, false
+}
+
+// ReadOnlyDef is a broker config that can only be set before the broker starts
+func ReadOnlyDef(name string, configType Type, value string, documentation string) Def {
+	return Def{Name: name, Type: configType, Default: value, ReadOnly: true, Documentation: documentation}
+}
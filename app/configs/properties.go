@@ -0,0 +1,121 @@
+package configs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Property is a key of a properties file and the line it starts on
+type Property struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// ParseProperties reads the format of Java's Properties.load, which Kafka uses
+// for server.properties. Lines starting with # or ! are comments, a key ends at
+// the first unescaped =, : or whitespace, and a line ending in a backslash
+// continues on the next one.
+func ParseProperties(r io.Reader) ([]Property, error) {
+	var properties []Property
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		start := lineNumber
+		for continues(line) && scanner.Scan() {
+			lineNumber++
+			line = line[:len(line)-1] + strings.TrimLeft(scanner.Text(), " \t\f")
+		}
+		if continues(line) {
+			line = line[:len(line)-1]
+		}
+
+		name, value, err := splitProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		properties = append(properties, Property{Name: name, Value: value, Line: start})
+	}
+	return properties, scanner.Err()
+}
+
+// continues reports a line ending in an odd number of backslashes
+func continues(line string) bool {
+	backslashes := len(line) - len(strings.TrimRight(line, "\\"))
+	return backslashes%2 == 1
+}
+
+func splitProperty(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	name, err := unescape(line[:end])
+	if err != nil {
+		return "", "", err
+	}
+	value, err := unescape(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return name, value, nil
+}
+
+func unescape(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(value) {
+				return "", fmt.Errorf("malformed \\uxxxx encoding")
+			}
+			code, err := strconv.ParseUint(value[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uxxxx encoding")
+			}
+			out.WriteRune(rune(code))
+			i += 4
+		default:
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String(), nil
+}
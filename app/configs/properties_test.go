@@ -0,0 +1,47 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	input := `# Comment
+! Also a comment
+
+node.id=2
+  log.dirs : /var/kafka
+listeners PLAINTEXT://:9092,\
+    SSL://:9093
+empty=
+key\=with\:separators=value
+unicode=caf\u00e9
+`
+	properties, err := ParseProperties(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	want := []Property{
+		{"node.id", "2", 4},
+		{"log.dirs", "/var/kafka", 5},
+		{"listeners", "PLAINTEXT://:9092,SSL://:9093", 6},
+		{"empty", "", 8},
+		{"key=with:separators", "value", 9},
+		{"unicode", "café", 10},
+	}
+	if len(properties) != len(want) {
+		t.Fatalf("Expected %d properties, got %+v", len(want), properties)
+	}
+	for i := range want {
+		if properties[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], properties[i])
+		}
+	}
+}
+
+func TestParsePropertiesMalformed(t *testing.T) {
+	if _, err := ParseProperties(strings.NewReader("a=1\nbad=\\u12\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected a malformed escape error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resource types of the config APIs and ConfigRecord
+const (
+	TopicResource  int8 = 2
+	BrokerResource int8 = 4
+)
+
+// Source uses the config_source codes of DescribeConfigs
+type Source int8
+
+const (
+	SourceUnknown        Source = 0
+	DynamicTopic         Source = 1
+	DynamicBroker        Source = 2
+	DynamicDefaultBroker Source = 3
+	StaticBroker         Source = 4
+	DefaultConfig        Source = 5
+)
+
+// Operations of IncrementalAlterConfigs
+const (
+	OpSet      int8 = 0
+	OpDelete   int8 = 1
+	OpAppend   int8 = 2
+	OpSubtract int8 = 3
+)
+
+// requestError is an error Kafka answers with INVALID_REQUEST rather than
+// INVALID_CONFIG
+type requestError struct {
+	message string
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+func invalidRequestf(format string, args ...any) error {
+	return requestError{fmt.Sprintf(format, args...)}
+}
+
+// IsInvalidRequest reports the errors of malformed requests, as opposed to
+// invalid config values
+func IsInvalidRequest(err error) bool {
+	return errors.As(err, &requestError{})
+}
+
+// Resource is a topic, a broker by id, or the cluster wide broker defaults
+// when a broker resource has no name
+type Resource struct {
+	Type int8
+	Name string
+}
+
+// Synonym is one of the places a config value can come from
+type Synonym struct {
+	Name   string
+	Value  string
+	Source Source
+}
+
+// Entry is a described config, Synonyms lists where its value could come from
+// with the one in effect first
+type Entry struct {
+	Def
+	Value    string
+	Source   Source
+	Synonyms []Synonym
+}
+
+// Op is a change of IncrementalAlterConfigs, Value is nil for deletes
+type Op struct {
+	Name      string
+	Operation int8
+	Value     *string
+}
+
+// Change sets a dynamic config, or removes it when Value is nil
+type Change struct {
+	Name  string
+	Value *string
+}
+
+// Store resolves configs from their dynamic values in the metadata log, the
+// static broker configs and the defaults
+type Store struct {
+	nodeID     string
+	brokerDefs []Def
+
+	mu      sync.RWMutex
+	static  map[string]string
+	dynamic map[Resource]map[string]string
+}
+
+func NewStore(nodeID string, brokerDefs []Def) *Store {
+	return &Store{
+		nodeID:     nodeID,
+		brokerDefs: brokerDefs,
+		static:     make(map[string]string),
+		dynamic:    make(map[Resource]map[string]string),
+	}
+}
+
+// SetStatic sets a broker config from the broker's startup configuration
+func (s *Store) SetStatic(name string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.static[name] = value
+}
+
+// Apply sets or removes a dynamic config, as a ConfigRecord does
+func (s *Store) Apply(resource Resource, name string, value string, removed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if removed {
+		delete(s.dynamic[resource], name)
+		if len(s.dynamic[resource]) == 0 {
+			delete(s.dynamic, resource)
+		}
+		return
+	}
+	if s.dynamic[resource] == nil {
+		s.dynamic[resource] = make(map[string]string)
+	}
+	s.dynamic[resource][name] = value
+}
+
+// Forget drops the dynamic configs of a deleted topic
+func (s *Store) Forget(resource Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dynamic, resource)
+}
+
+func (s *Store) defs(resourceType int8) []Def {
+	if resourceType == TopicResource {
+		return TopicDefs
+	}
+	return s.brokerDefs
+}
+
+func (s *Store) def(resourceType int8, name string) (Def, bool) {
+	return Lookup(s.defs(resourceType), name)
+}
+
+// Describe resolves every config of a resource. The cluster wide broker
+// resource only has the dynamic defaults that are set.
+func (s *Store) Describe(resource Resource) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []Entry
+	for _, def := range s.defs(resource.Type) {
+		var synonyms []Synonym
+		if resource.Type == BrokerResource && resource.Name == "" {
+			if value, ok := s.dynamic[resource][def.Name]; ok {
+				synonyms = append(synonyms, Synonym{def.Name, value, DynamicDefaultBroker})
+			}
+		} else {
+			synonyms = s.synonymsLocked(resource, def)
+		}
+		if len(synonyms) == 0 {
+			continue
+		}
+		entries = append(entries, Entry{Def: def, Value: synonyms[0].Value, Source: synonyms[0].Source, Synonyms: synonyms})
+	}
+	return entries
+}
+
+// synonymsLocked lists the values of a config from the most to the least
+// specific. Must be called with the lock held.
+func (s *Store) synonymsLocked(resource Resource, def Def) []Synonym {
+	var synonyms []Synonym
+	brokerName := def.Name
+	if resource.Type == TopicResource {
+		if value, ok := s.dynamic[resource][def.Name]; ok {
+			synonyms = append(synonyms, Synonym{def.Name, value, DynamicTopic})
+		}
+		if def.BrokerSynonym == "" {
+			return append(synonyms, Synonym{def.Name, def.Default, DefaultConfig})
+		}
+		brokerName = def.BrokerSynonym
+	}
+
+	if value, ok := s.dynamic[Resource{BrokerResource, s.nodeID}][brokerName]; ok {
+		synonyms = append(synonyms, Synonym{brokerName, value, DynamicBroker})
+	}
+	if value, ok := s.dynamic[Resource{BrokerResource, ""}][brokerName]; ok {
+		synonyms = append(synonyms, Synonym{brokerName, value, DynamicDefaultBroker})
+	}
+	if value, ok := s.static[brokerName]; ok {
+		synonyms = append(synonyms, Synonym{brokerName, value, StaticBroker})
+	}
+	return append(synonyms, Synonym{brokerName, def.Default, DefaultConfig})
+}
+
+// Value is the config in effect for a topic or this broker
+func (s *Store) Value(resource Resource, name string) string {
+	def, ok := s.def(resource.Type, name)
+	if !ok {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synonymsLocked(resource, def)[0].Value
+}
+
+// TopicInt is a numeric topic config in effect
+func (s *Store) TopicInt(topic string, name string) int64 {
+	value, _ := strconv.ParseInt(strings.TrimSpace(s.Value(Resource{TopicResource, topic}, name)), 10, 64)
+	return value
+}
+
+// BrokerValue is a config of this broker in effect
+func (s *Store) BrokerValue(name string) string {
+	return s.Value(Resource{BrokerResource, s.nodeID}, name)
+}
+
+// BrokerInt is a numeric config of this broker in effect
+func (s *Store) BrokerInt(name string) int64 {
+	value, _ := strconv.ParseInt(strings.TrimSpace(s.BrokerValue(name)), 10, 64)
+	return value
+}
+
+// Validate checks a new value of a config of the resource type
+func (s *Store) Validate(resourceType int8, name string, value string) error {
+	def, ok := s.def(resourceType, name)
+	switch {
+	case !ok && resourceType == TopicResource:
+		return fmt.Errorf("Unknown topic config name: %s", name)
+	case !ok:
+		return fmt.Errorf("Unknown broker config name: %s", name)
+	case def.ReadOnly:
+		return invalidRequestf("Cannot update these configs dynamically: Set(%s)", name)
+	}
+	return def.Validate(value)
+}
+
+// Replace computes the changes of AlterConfigs, which sets the dynamic configs
+// of a resource to exactly the given ones
+func (s *Store) Replace(resource Resource, configs []Change) ([]Change, error) {
+	wanted := make(map[string]string)
+	for _, config := range configs {
+		if _, ok := wanted[config.Name]; ok {
+			return nil, invalidRequestf("Error due to duplicate config keys")
+		}
+		if config.Value == nil {
+			return nil, invalidRequestf("Null value not supported for : %s", config.Name)
+		}
+		if err := s.Validate(resource.Type, config.Name, *config.Value); err != nil {
+			return nil, err
+		}
+		wanted[config.Name] = *config.Value
+	}
+
+	current := s.dynamicCopy(resource)
+	var changes []Change
+	for _, config := range configs {
+		if value, ok := current[config.Name]; !ok || value != *config.Value {
+			changes = append(changes, config)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		if _, keep := wanted[name]; !keep {
+			changes = append(changes, Change{Name: name})
+		}
+	}
+	return changes, nil
+}
+
+// Incremental computes the changes of IncrementalAlterConfigs. APPEND and
+// SUBTRACT only apply to LIST configs and start from the value in effect.
+func (s *Store) Incremental(resource Resource, ops []Op) ([]Change, error) {
+	seen := make(map[string]bool)
+	current := s.dynamicCopy(resource)
+	var changes []Change
+	for _, op := range ops {
+		if seen[op.Name] {
+			return nil, invalidRequestf("Error due to duplicate config keys")
+		}
+		seen[op.Name] = true
+
+		def, ok := s.def(resource.Type, op.Name)
+		if !ok {
+			return nil, s.Validate(resource.Type, op.Name, "")
+		}
+		if op.Operation != OpDelete && op.Value == nil {
+			return nil, invalidRequestf("Null value not supported for : %s", op.Name)
+		}
+
+		var value string
+		switch op.Operation {
+		case OpSet:
+			value = *op.Value
+		case OpDelete:
+			if def.ReadOnly {
+				return nil, s.Validate(resource.Type, op.Name, "")
+			}
+			if _, ok := current[op.Name]; ok {
+				changes = append(changes, Change{Name: op.Name})
+			}
+			continue
+		case OpAppend, OpSubtract:
+			if def.Type != List {
+				verb := map[int8]string{OpAppend: "append", OpSubtract: "subtract"}[op.Operation]
+				return nil, fmt.Errorf("Config value %s is not allowed for config key: %s", verb, op.Name)
+			}
+			items := SplitList(s.Value(resource, op.Name))
+			for _, item := range SplitList(*op.Value) {
+				index := slices.Index(items, item)
+				if op.Operation == OpAppend && index < 0 {
+					items = append(items, item)
+				} else if op.Operation == OpSubtract && index >= 0 {
+					items = append(items[:index], items[index+1:]...)
+				}
+			}
+			value = strings.Join(items, ",")
+		default:
+			return nil, invalidRequestf("Unknown config operation %d", op.Operation)
+		}
+
+		if err := s.Validate(resource.Type, op.Name, value); err != nil {
+			return nil, err
+		}
+		if existing, ok := current[op.Name]; !ok || existing != value {
+			changes = append(changes, Change{Name: op.Name, Value: &value})
+		}
+	}
+	return changes, nil
+}
+
+func (s *Store) dynamicCopy(resource Resource) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make(map[string]string, len(s.dynamic[resource]))
+	for name, value := range s.dynamic[resource] {
+		values[name] = value
+	}
+	return values
+}
@@ -1,6 +0,0 @@
-package main
-
-const (
-	ApiVersionAPIKEY              = 18
-	DescribeTopicPartitionsAPIKEY = 75
-)
@@ -2,6 +2,42 @@ package file_metadata
 
 import "github.com/google/uuid"
 
+// Metadata record types, stored in the value header of every record
+const (
+	RegisterBrokerRecordType            = 0
+	UnregisterBrokerRecordType          = 1
+	TopicRecordType                     = 2
+	PartitionRecordType                 = 3
+	ConfigRecordType                    = 4
+	RemoveTopicRecordType               = 9
+	UserScramCredentialRecordType       = 11
+	FeatureLevelRecordType              = 12
+	ClientQuotaRecordType               = 14
+	ProducerIdsRecordType               = 15
+	RemoveUserScramCredentialRecordType = 22
+	AccessControlEntryRecordType        = 23
+	RemoveAccessControlEntryRecordType  = 24
+)
+
+// Record batch attribute bits
+const (
+	CompressionCodecMask   = 0x07
+	TransactionalAttribute = 0x10
+	ControlAttribute       = 0x20
+)
+
+// Control record types, the second field of a control record key
+const (
+	ControlTypeAbort  = 0
+	ControlTypeCommit = 1
+)
+
+// Config resource types used by ConfigRecord
+const (
+	TopicConfigResource  = 2
+	BrokerConfigResource = 4
+)
+
 type ClusterMetaData struct {
 	Batches []RecordBatch
 }
@@ -24,10 +60,18 @@ type RecordBatch struct {
 type Record struct {
 	attributes     int8
 	timestampDelta int64
+	offsetDelta    int64
 	keySize        int64
 	ValueType      int8
-	key            interface{} // variable sized integer?
-	Value          interface{} // should be one of
+	Key            []byte      // nil for keyless records
+	RawValue       []byte      // value as stored, nil for tombstones
+	Value          interface{} // parsed metadata value, only set for the metadata log
+}
+
+// RecordData is a key and value about to be written, a nil value is a tombstone
+type RecordData struct {
+	Key   []byte
+	Value []byte
 }
 
 type ValueTypeHeader struct {
@@ -42,22 +86,112 @@ type FeatureLevelValue struct {
 	featureLevel int16
 }
 
+func (v FeatureLevelValue) FeatureLevel() int16 {
+	return v.featureLevel
+}
+
+type RegisterBrokerValue struct {
+	header   ValueTypeHeader
+	BrokerId int32
+}
+
+type UnregisterBrokerValue struct {
+	header   ValueTypeHeader
+	BrokerId int32
+}
+
 type TopicValue struct {
 	header    ValueTypeHeader
 	TopicName string
 	TopicId   uuid.UUID
 }
 
+type RemoveTopicValue struct {
+	header  ValueTypeHeader
+	TopicId uuid.UUID
+}
+
 type PartitionValue struct {
 	header               ValueTypeHeader
-	partitionId          int32
-	topicId              uuid.UUID
-	replicaIdArray       []int32
-	inSyncReplicaArray   []int32
-	removingReplicaArray []int32
-	addingReplicaArray   []int32
-	leaderId             int32
-	leaderEpoch          int32
-	partitionEpoch       int32
-	directoriesArray     []uuid.UUID
+	PartitionId          int32
+	TopicId              uuid.UUID
+	ReplicaIdArray       []int32
+	InSyncReplicaArray   []int32
+	RemovingReplicaArray []int32
+	AddingReplicaArray   []int32
+	LeaderId             int32
+	LeaderEpoch          int32
+	PartitionEpoch       int32
+	DirectoriesArray     []uuid.UUID
+}
+
+// ProducerIdsValue records the end of the last producer id block handed to a
+// broker, ids below NextProducerId are never given out again
+type ProducerIdsValue struct {
+	header         ValueTypeHeader
+	BrokerId       int32
+	BrokerEpoch    int64
+	NextProducerId int64
+}
+
+// UserScramCredentialValue is the SCRAM credential of a user for one
+// mechanism, 1 for SCRAM-SHA-256 and 2 for SCRAM-SHA-512
+type UserScramCredentialValue struct {
+	header     ValueTypeHeader
+	Name       string
+	Mechanism  int8
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+	Iterations int32
+}
+
+type RemoveUserScramCredentialValue struct {
+	header    ValueTypeHeader
+	Name      string
+	Mechanism int8
+}
+
+// AccessControlEntryValue is an ACL, the enums use the codes of the ACL APIs
+type AccessControlEntryValue struct {
+	header         ValueTypeHeader
+	Id             uuid.UUID
+	ResourceType   int8
+	ResourceName   string
+	PatternType    int8
+	Principal      string
+	Host           string
+	Operation      int8
+	PermissionType int8
+}
+
+type RemoveAccessControlEntryValue struct {
+	header ValueTypeHeader
+	Id     uuid.UUID
+}
+
+// ClientQuotaEntityData is one part of the entity a quota applies to, a null
+// name is the default entity of the type
+type ClientQuotaEntityData struct {
+	EntityType string
+	EntityName string
+	IsDefault  bool
+}
+
+// ClientQuotaValue sets the quota Key of an entity, or removes it
+type ClientQuotaValue struct {
+	header ValueTypeHeader
+	Entity []ClientQuotaEntityData
+	Key    string
+	Value  float64
+	Remove bool
+}
+
+type ConfigValue struct {
+	header       ValueTypeHeader
+	ResourceType int8
+	ResourceName string
+	Name         string
+	Value        string
+	Removed      bool // a null value deletes the config
 }
@@ -0,0 +1,263 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"toy_kafka/app/utils"
+
+	"github.com/google/uuid"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Inverse of createRecordHeader
+func encodeRecordHeader(valueType int8, version int8) []byte {
+	return []byte{1, byte(valueType), byte(version)}
+}
+
+func encodeCompactString(val string) []byte {
+	out := utils.EncodeUvarint(uint64(len(val) + 1))
+	return append(out, val...)
+}
+
+func encodeCompactInt32Array(vals []int32) []byte {
+	out := utils.EncodeUvarint(uint64(len(vals) + 1))
+	for _, val := range vals {
+		out = binary.BigEndian.AppendUint32(out, uint32(val))
+	}
+	return out
+}
+
+func EncodeTopicValue(topic TopicValue) []byte {
+	out := encodeRecordHeader(TopicRecordType, 0)
+	out = append(out, encodeCompactString(topic.TopicName)...)
+	out = append(out, topic.TopicId[:]...)
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeRemoveTopicValue(removal RemoveTopicValue) []byte {
+	out := encodeRecordHeader(RemoveTopicRecordType, 0)
+	out = append(out, removal.TopicId[:]...)
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+// EncodePartitionValue writes a version 1 PartitionRecord, the same version the
+// parser reads (version 1 added the directories array).
+func EncodePartitionValue(partition PartitionValue) []byte {
+	out := encodeRecordHeader(PartitionRecordType, 1)
+	out = binary.BigEndian.AppendUint32(out, uint32(partition.PartitionId))
+	out = append(out, partition.TopicId[:]...)
+	out = append(out, encodeCompactInt32Array(partition.ReplicaIdArray)...)
+	out = append(out, encodeCompactInt32Array(partition.InSyncReplicaArray)...)
+	out = append(out, encodeCompactInt32Array(partition.RemovingReplicaArray)...)
+	out = append(out, encodeCompactInt32Array(partition.AddingReplicaArray)...)
+	out = binary.BigEndian.AppendUint32(out, uint32(partition.LeaderId))
+	out = binary.BigEndian.AppendUint32(out, uint32(partition.LeaderEpoch))
+	out = binary.BigEndian.AppendUint32(out, uint32(partition.PartitionEpoch))
+
+	// Every replica needs a directory, unassigned replicas use the zero uuid
+	directories := partition.DirectoriesArray
+	for len(directories) < len(partition.ReplicaIdArray) {
+		directories = append(directories, uuid.Nil)
+	}
+	out = append(out, utils.EncodeUvarint(uint64(len(directories)+1))...)
+	for _, directory := range directories {
+		out = append(out, directory[:]...)
+	}
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeProducerIdsValue(producerIds ProducerIdsValue) []byte {
+	out := encodeRecordHeader(ProducerIdsRecordType, 0)
+	out = binary.BigEndian.AppendUint32(out, uint32(producerIds.BrokerId))
+	out = binary.BigEndian.AppendUint64(out, uint64(producerIds.BrokerEpoch))
+	out = binary.BigEndian.AppendUint64(out, uint64(producerIds.NextProducerId))
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeConfigValue(config ConfigValue) []byte {
+	out := encodeRecordHeader(ConfigRecordType, 0)
+	out = append(out, byte(config.ResourceType))
+	out = append(out, encodeCompactString(config.ResourceName)...)
+	out = append(out, encodeCompactString(config.Name)...)
+	if config.Removed {
+		out = append(out, 0)
+	} else {
+		out = append(out, encodeCompactString(config.Value)...)
+	}
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeClientQuotaValue(quota ClientQuotaValue) []byte {
+	out := encodeRecordHeader(ClientQuotaRecordType, 0)
+	out = append(out, utils.EncodeUvarint(uint64(len(quota.Entity)+1))...)
+	for _, entity := range quota.Entity {
+		out = append(out, encodeCompactString(entity.EntityType)...)
+		if entity.IsDefault {
+			out = append(out, 0)
+		} else {
+			out = append(out, encodeCompactString(entity.EntityName)...)
+		}
+		out = append(out, 0) // entity tagged fields
+	}
+	out = append(out, encodeCompactString(quota.Key)...)
+	out = binary.BigEndian.AppendUint64(out, math.Float64bits(quota.Value))
+	if quota.Remove {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeUserScramCredentialValue(credential UserScramCredentialValue) []byte {
+	out := encodeRecordHeader(UserScramCredentialRecordType, 0)
+	out = append(out, encodeCompactString(credential.Name)...)
+	out = append(out, byte(credential.Mechanism))
+	for _, field := range [][]byte{credential.Salt, credential.StoredKey, credential.ServerKey} {
+		out = append(out, utils.EncodeUvarint(uint64(len(field)+1))...)
+		out = append(out, field...)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(credential.Iterations))
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeRemoveUserScramCredentialValue(removal RemoveUserScramCredentialValue) []byte {
+	out := encodeRecordHeader(RemoveUserScramCredentialRecordType, 0)
+	out = append(out, encodeCompactString(removal.Name)...)
+	out = append(out, byte(removal.Mechanism))
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeAccessControlEntryValue(acl AccessControlEntryValue) []byte {
+	out := encodeRecordHeader(AccessControlEntryRecordType, 0)
+	out = append(out, acl.Id[:]...)
+	out = append(out, byte(acl.ResourceType))
+	out = append(out, encodeCompactString(acl.ResourceName)...)
+	out = append(out, byte(acl.PatternType))
+	out = append(out, encodeCompactString(acl.Principal)...)
+	out = append(out, encodeCompactString(acl.Host)...)
+	out = append(out, byte(acl.Operation))
+	out = append(out, byte(acl.PermissionType))
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+func EncodeRemoveAccessControlEntryValue(removal RemoveAccessControlEntryValue) []byte {
+	out := encodeRecordHeader(RemoveAccessControlEntryRecordType, 0)
+	out = append(out, removal.Id[:]...)
+
+	// Tagged Fields Count
+	return append(out, 0)
+}
+
+// encodeRecord wraps a key and value in a record. offsetDelta is the position of
+// the record inside its batch, a nil key or value is written as null.
+func encodeRecord(offsetDelta int, record RecordData) []byte {
+	var body []byte
+	body = append(body, 0)                                          // attributes
+	body = append(body, utils.EncodeVarint(0)...)                   // timestampDelta
+	body = append(body, utils.EncodeVarint(int64(offsetDelta))...)  // offsetDelta
+	body = append(body, encodeNullableVarintBytes(record.Key)...)   // key
+	body = append(body, encodeNullableVarintBytes(record.Value)...) // value
+	body = append(body, utils.EncodeUvarint(0)...)                  // headers array count
+
+	return append(utils.EncodeVarint(int64(len(body))), body...)
+}
+
+func encodeNullableVarintBytes(val []byte) []byte {
+	if val == nil {
+		return utils.EncodeVarint(-1)
+	}
+	return append(utils.EncodeVarint(int64(len(val))), val...)
+}
+
+// EncodeRecordBatch builds a v2 record batch holding one keyless record per
+// value, the inverse of CreateRecordBatch.
+func EncodeRecordBatch(baseOffset int64, timestamp int64, values [][]byte) []byte {
+	records := make([]RecordData, len(values))
+	for i, value := range values {
+		records[i] = RecordData{Value: value}
+	}
+	return EncodeKeyedRecordBatch(baseOffset, timestamp, records)
+}
+
+// EncodeKeyedRecordBatch builds a v2 record batch from keyed records, the
+// inverse of DecodeRecordBatch.
+func EncodeKeyedRecordBatch(baseOffset int64, timestamp int64, records []RecordData) []byte {
+	return encodeBatch(baseOffset, timestamp, batchProducer{id: -1, epoch: -1, baseSequence: -1}, 0, records)
+}
+
+// EncodeTransactionalRecordBatch builds a batch written as part of a transaction
+// by a coordinator on behalf of a producer, it carries no sequence numbers
+func EncodeTransactionalRecordBatch(baseOffset int64, timestamp int64, producerID int64, producerEpoch int16, records []RecordData) []byte {
+	return encodeBatch(baseOffset, timestamp, batchProducer{id: producerID, epoch: producerEpoch, baseSequence: -1}, TransactionalAttribute, records)
+}
+
+// Control record (version 0), the single record of a transaction marker batch
+// key:   00 00 (version) 00 01 (type, 0 for abort and 1 for commit)
+// value: 00 00 (version) 00 00 00 05 (coordinator epoch)
+
+// EncodeControlBatch builds the COMMIT or ABORT marker that ends a transaction
+func EncodeControlBatch(baseOffset int64, timestamp int64, producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32) []byte {
+	controlType := ControlTypeAbort
+	if commit {
+		controlType = ControlTypeCommit
+	}
+	key := binary.BigEndian.AppendUint16(nil, 0)
+	key = binary.BigEndian.AppendUint16(key, uint16(controlType))
+	value := binary.BigEndian.AppendUint16(nil, 0)
+	value = binary.BigEndian.AppendUint32(value, uint32(coordinatorEpoch))
+
+	producer := batchProducer{id: producerID, epoch: producerEpoch, baseSequence: -1}
+	return encodeBatch(baseOffset, timestamp, producer, TransactionalAttribute|ControlAttribute, []RecordData{{Key: key, Value: value}})
+}
+
+type batchProducer struct {
+	id           int64
+	epoch        int16
+	baseSequence int32
+}
+
+func encodeBatch(baseOffset int64, timestamp int64, producer batchProducer, attributes int16, records []RecordData) []byte {
+	// Everything after the CRC, the CRC covers exactly these bytes
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, uint16(attributes))            // attributes
+	body = binary.BigEndian.AppendUint32(body, uint32(len(records)-1))        // lastOffsetDelta
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))             // baseTimestamp
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))             // maxTimestamp
+	body = binary.BigEndian.AppendUint64(body, uint64(producer.id))           // producerId
+	body = binary.BigEndian.AppendUint16(body, uint16(producer.epoch))        // producerEpoch
+	body = binary.BigEndian.AppendUint32(body, uint32(producer.baseSequence)) // baseSequence
+	body = binary.BigEndian.AppendUint32(body, uint32(len(records)))          // recordsLength
+	for i, record := range records {
+		body = append(body, encodeRecord(i, record)...)
+	}
+
+	var out []byte
+	out = binary.BigEndian.AppendUint64(out, uint64(baseOffset))
+	// batchLength counts everything after itself: leader epoch, magic, crc and body
+	out = binary.BigEndian.AppendUint32(out, uint32(4+1+4+len(body)))
+	out = binary.BigEndian.AppendUint32(out, 0) // partitionLeaderEpoch
+	out = append(out, 2)                        // magicByte
+	out = binary.BigEndian.AppendUint32(out, crc32.Checksum(body, castagnoliTable))
+	return append(out, body...)
+}
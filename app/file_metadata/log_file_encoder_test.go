@@ -0,0 +1,265 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAppendRecordsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "__cluster_metadata-0", "00000000000000000000.log")
+	CreateAndPopulateLog(path)
+
+	cm, err := CreateClusterMetaData(ReadBin(path))
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	if cm.NextOffset() != 9 {
+		t.Fatalf("Expected next offset 9 after the fixture, got %d", cm.NextOffset())
+	}
+
+	topicId := uuid.New()
+	_, err = AppendRecords(path, cm,
+		EncodeTopicValue(TopicValue{TopicName: "created", TopicId: topicId}),
+		EncodePartitionValue(PartitionValue{PartitionId: 0, TopicId: topicId, ReplicaIdArray: []int32{1}, InSyncReplicaArray: []int32{1}, LeaderId: 1}),
+		EncodeConfigValue(ConfigValue{ResourceType: TopicConfigResource, ResourceName: "created", Name: "cleanup.policy", Value: "compact"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+
+	// Parse the whole file again, the appended batch must look like the in-memory one
+	reread, err := CreateClusterMetaData(ReadBin(path))
+	if err != nil {
+		t.Fatalf("Failed to parse log after append: %v", err)
+	}
+	if len(reread.Batches) != len(cm.Batches) {
+		t.Fatalf("Expected %d batches, got %d", len(cm.Batches), len(reread.Batches))
+	}
+
+	batch := reread.Batches[len(reread.Batches)-1]
+	if batch.baseOffset != 9 || len(batch.Records) != 3 {
+		t.Fatalf("Unexpected appended batch: base offset %d, %d records", batch.baseOffset, len(batch.Records))
+	}
+
+	topic, ok := batch.Records[0].Value.(TopicValue)
+	if !ok || topic.TopicName != "created" || topic.TopicId != topicId {
+		t.Errorf("Unexpected topic record: %+v", batch.Records[0].Value)
+	}
+	partition, ok := batch.Records[1].Value.(PartitionValue)
+	if !ok || partition.TopicId != topicId || partition.LeaderId != 1 || len(partition.DirectoriesArray) != 1 {
+		t.Errorf("Unexpected partition record: %+v", batch.Records[1].Value)
+	}
+	config, ok := batch.Records[2].Value.(ConfigValue)
+	if !ok || config.Name != "cleanup.policy" || config.Value != "compact" || config.Removed {
+		t.Errorf("Unexpected config record: %+v", batch.Records[2].Value)
+	}
+}
+
+func TestUserScramCredentialRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "__cluster_metadata-0", "00000000000000000000.log")
+	CreateAndPopulateLog(path)
+	cm, _ := CreateClusterMetaData(ReadBin(path))
+
+	credential := UserScramCredentialValue{Name: "alice", Mechanism: 2, Salt: []byte("salt"), StoredKey: []byte("stored"), ServerKey: []byte("server"), Iterations: 8192}
+	_, err := AppendRecords(path, cm,
+		EncodeUserScramCredentialValue(credential),
+		EncodeRemoveUserScramCredentialValue(RemoveUserScramCredentialValue{Name: "bob", Mechanism: 1}),
+		EncodeTopicValue(TopicValue{TopicName: "after", TopicId: uuid.New()}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+
+	reread, err := CreateClusterMetaData(ReadBin(path))
+	if err != nil {
+		t.Fatalf("Failed to parse log after append: %v", err)
+	}
+	records := reread.Batches[len(reread.Batches)-1].Records
+	parsed, ok := records[0].Value.(UserScramCredentialValue)
+	if !ok || parsed.Name != "alice" || parsed.Mechanism != 2 || string(parsed.Salt) != "salt" || string(parsed.StoredKey) != "stored" || string(parsed.ServerKey) != "server" || parsed.Iterations != 8192 {
+		t.Errorf("Unexpected credential record: %+v", records[0].Value)
+	}
+	if removal, ok := records[1].Value.(RemoveUserScramCredentialValue); !ok || removal.Name != "bob" || removal.Mechanism != 1 {
+		t.Errorf("Unexpected removal record: %+v", records[1].Value)
+	}
+	if topic, ok := records[2].Value.(TopicValue); !ok || topic.TopicName != "after" {
+		t.Errorf("Expected the topic after the credentials to parse, got %+v", records[2].Value)
+	}
+}
+
+func TestAccessControlEntryRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "__cluster_metadata-0", "00000000000000000000.log")
+	CreateAndPopulateLog(path)
+	cm, _ := CreateClusterMetaData(ReadBin(path))
+
+	acl := AccessControlEntryValue{Id: uuid.New(), ResourceType: 2, ResourceName: "orders-", PatternType: 4, Principal: "User:alice", Host: "*", Operation: 3, PermissionType: 3}
+	if _, err := AppendRecords(path, cm, EncodeAccessControlEntryValue(acl), EncodeRemoveAccessControlEntryValue(RemoveAccessControlEntryValue{Id: acl.Id})); err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+
+	reread, err := CreateClusterMetaData(ReadBin(path))
+	if err != nil {
+		t.Fatalf("Failed to parse log after append: %v", err)
+	}
+	records := reread.Batches[len(reread.Batches)-1].Records
+	if parsed, ok := records[0].Value.(AccessControlEntryValue); !ok || parsed.Id != acl.Id || parsed.ResourceName != "orders-" || parsed.PatternType != 4 || parsed.Principal != "User:alice" || parsed.Host != "*" || parsed.Operation != 3 || parsed.PermissionType != 3 {
+		t.Errorf("Unexpected ACL record: %+v", records[0].Value)
+	}
+	if removal, ok := records[1].Value.(RemoveAccessControlEntryValue); !ok || removal.Id != acl.Id {
+		t.Errorf("Unexpected ACL removal record: %+v", records[1].Value)
+	}
+}
+
+func TestClientQuotaRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "__cluster_metadata-0", "00000000000000000000.log")
+	CreateAndPopulateLog(path)
+	cm, _ := CreateClusterMetaData(ReadBin(path))
+
+	quota := ClientQuotaValue{
+		Entity: []ClientQuotaEntityData{{EntityType: "user", EntityName: "alice"}, {EntityType: "client-id", IsDefault: true}},
+		Key:    "producer_byte_rate",
+		Value:  1048576,
+	}
+	removal := ClientQuotaValue{Entity: []ClientQuotaEntityData{{EntityType: "client-id", EntityName: "app"}}, Key: "request_percentage", Remove: true}
+	if _, err := AppendRecords(path, cm, EncodeClientQuotaValue(quota), EncodeClientQuotaValue(removal)); err != nil {
+		t.Fatalf("Failed to append records: %v", err)
+	}
+
+	reread, err := CreateClusterMetaData(ReadBin(path))
+	if err != nil {
+		t.Fatalf("Failed to parse log after append: %v", err)
+	}
+	records := reread.Batches[len(reread.Batches)-1].Records
+	parsed, ok := records[0].Value.(ClientQuotaValue)
+	if !ok || len(parsed.Entity) != 2 || parsed.Entity[0] != quota.Entity[0] || parsed.Entity[1] != quota.Entity[1] || parsed.Key != quota.Key || parsed.Value != quota.Value || parsed.Remove {
+		t.Errorf("Unexpected quota record: %+v", records[0].Value)
+	}
+	parsed, ok = records[1].Value.(ClientQuotaValue)
+	if !ok || len(parsed.Entity) != 1 || parsed.Entity[0].EntityName != "app" || parsed.Key != "request_percentage" || !parsed.Remove {
+		t.Errorf("Unexpected quota removal record: %+v", records[1].Value)
+	}
+}
+
+func TestPartitionLogReopen(t *testing.T) {
+	logDir := t.TempDir()
+	log, batches, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil || len(batches) != 0 {
+		t.Fatalf("Expected an empty log, got %d batches, err %v", len(batches), err)
+	}
+
+	if _, err := log.Append([]RecordData{{Key: []byte("a"), Value: []byte("1")}, {Key: []byte("b"), Value: nil}}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if baseOffset, err := log.Append([]RecordData{{Key: []byte("a"), Value: []byte{}}}); err != nil || baseOffset != 2 {
+		t.Fatalf("Expected the second batch at offset 2, got %d, err %v", baseOffset, err)
+	}
+
+	// A torn write at the end is cut off when the log is opened again
+	append_bin(segmentPath(logDir, "events", 0), []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0})
+
+	reopened, batches, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil || len(batches) != 2 {
+		t.Fatalf("Expected 2 batches after reopening, got %d, err %v", len(batches), err)
+	}
+	first := batches[0].Records
+	if string(first[0].Key) != "a" || string(first[0].RawValue) != "1" || first[1].RawValue != nil {
+		t.Errorf("Unexpected records in the first batch: %+v", first)
+	}
+	if batches[1].Offset(0) != 2 || batches[1].Records[0].RawValue == nil {
+		t.Errorf("Expected an empty, non null value at offset 2, got %+v", batches[1].Records[0])
+	}
+	if baseOffset, _ := reopened.Append([]RecordData{{Value: []byte("x")}}); baseOffset != 3 {
+		t.Errorf("Expected appends to continue at offset 3, got %d", baseOffset)
+	}
+}
+
+// malformedBatch is a batch of a single record with key "k" and value "v",
+// changed by corrupt and given a valid CRC again
+func malformedBatch(corrupt func(record []byte, stream []byte)) []byte {
+	stream := EncodeKeyedRecordBatch(0, time.Now().UnixMilli(), []RecordData{{Key: []byte("k"), Value: []byte("v")}})
+	// The record is length, attributes, timestamp delta, offset delta, key
+	// length, 'k', value length, 'v' and headers count, a byte each
+	corrupt(stream[recordBatchHeaderSize:], stream)
+	binary.BigEndian.PutUint32(stream[17:21], crc32.Checksum(stream[21:], castagnoliTable))
+	return stream
+}
+
+func TestAppendBatchRejectsMalformedRecords(t *testing.T) {
+	logDir := t.TempDir()
+	log, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		corrupt  func(record []byte, stream []byte)
+		expected error
+	}{
+		{"key past the record", func(record []byte, _ []byte) { record[4] = 0x7e }, ErrCorruptBatch},
+		{"negative value length", func(record []byte, _ []byte) { record[6] = 0x05 }, ErrCorruptBatch},
+		{"missing header", func(record []byte, _ []byte) { record[8] = 0x02 }, ErrCorruptBatch},
+		{"record past the batch", func(record []byte, _ []byte) { record[0] = 0x7e }, ErrCorruptBatch},
+		{"wrong offset delta", func(record []byte, _ []byte) { record[3] = 0x02 }, ErrInvalidRecord},
+		{"record count", func(_ []byte, stream []byte) { binary.BigEndian.PutUint32(stream[57:61], 2) }, ErrInvalidRecord},
+	}
+	for _, c := range cases {
+		if _, err := log.AppendBatch(malformedBatch(c.corrupt)); !errors.Is(err, c.expected) {
+			t.Errorf("Expected %v for a %s, got %v", c.expected, c.name, err)
+		}
+	}
+	if end := log.EndOffset(); end != 0 {
+		t.Fatalf("Expected nothing to be appended, the log ends at %d", end)
+	}
+
+	if _, err := log.AppendBatch(malformedBatch(func([]byte, []byte) {})); err != nil {
+		t.Fatalf("Expected a well formed batch to be appended, got %v", err)
+	}
+}
+
+// A malformed batch with a valid CRC already in a segment is cut off like a
+// torn write instead of failing the open
+func TestOpenPartitionLogCutsOffMalformedBatches(t *testing.T) {
+	logDir := t.TempDir()
+	log, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+	if _, err := log.Append([]RecordData{{Value: []byte("kept")}}); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	append_bin(segmentPath(logDir, "events", 0), malformedBatch(func(record []byte, _ []byte) { record[8] = 0x02 }))
+
+	reopened, batches, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("Expected the well formed batch only, got %d batches, err %v", len(batches), err)
+	}
+	if end := reopened.EndOffset(); end != 1 {
+		t.Errorf("Expected the log to end at 1, got %d", end)
+	}
+	if _, _, err := DecodeRecordBatch(malformedBatch(func(record []byte, _ []byte) { record[4] = 0x7e }), 0); !errors.Is(err, ErrCorruptBatch) {
+		t.Errorf("Expected decoding a malformed batch to fail, got %v", err)
+	}
+}
+
+func TestCleanShutdownMarker(t *testing.T) {
+	logDir := t.TempDir()
+	if clean, err := RemoveCleanShutdownMarker(logDir); clean || err != nil {
+		t.Fatalf("Expected no marker in a new directory, got %v, err %v", clean, err)
+	}
+	if err := WriteCleanShutdownMarker(logDir); err != nil {
+		t.Fatalf("Failed to write the marker: %v", err)
+	}
+	if clean, err := RemoveCleanShutdownMarker(logDir); !clean || err != nil {
+		t.Fatalf("Expected the marker to be found, got %v, err %v", clean, err)
+	}
+	if clean, _ := RemoveCleanShutdownMarker(logDir); clean {
+		t.Errorf("Expected the marker to be gone after the start")
+	}
+}
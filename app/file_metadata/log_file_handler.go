@@ -1,7 +1,13 @@
 package file_metadata
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"time"
 	"toy_kafka/app/utils"
 
 	"github.com/google/uuid"
@@ -50,7 +56,10 @@ func CreateClusterMetaData(stream []byte) (*ClusterMetaData, error) {
 		// 	panic("record count does not match baseOffset")
 		// }
 		recordCount++
-		recordBatch, batch_offset := CreateRecordBatch(stream, offset)
+		recordBatch, batch_offset, err := CreateRecordBatch(stream, offset)
+		if err != nil {
+			return &ClusterMetaData{Batches: batches}, fmt.Errorf("batch at position %d: %w", offset, err)
+		}
 		batches = append(batches, recordBatch)
 		offset += batch_offset
 	}
@@ -59,9 +68,137 @@ func CreateClusterMetaData(stream []byte) (*ClusterMetaData, error) {
 	return metaData, nil
 }
 
-func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
+// OpenClusterMetaData reads the metadata log, recovered like a partition log:
+// a batch cut short by a crash or failing its checks is cut off together with
+// whatever follows, so appends start on a batch boundary
+func OpenClusterMetaData(path string) (*ClusterMetaData, error) {
+	stream, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []RecordBatch
+	valid := 0
+	for valid < len(stream) {
+		batch, size, err := CreateRecordBatch(stream, valid)
+		if err != nil {
+			slog.Warn("Truncating a torn write", "file", path, "bytes", len(stream)-valid, "error", err)
+			if err := os.Truncate(path, int64(valid)); err != nil {
+				return nil, err
+			}
+			break
+		}
+		batches = append(batches, batch)
+		valid += size
+	}
+	return &ClusterMetaData{Batches: batches}, nil
+}
+
+// NextOffset is the offset the next appended batch starts at
+func (cm *ClusterMetaData) NextOffset() int64 {
+	if len(cm.Batches) == 0 {
+		return 0
+	}
+	return cm.Batches[len(cm.Batches)-1].NextOffset()
+}
+
+// NextOffset is the offset right after the last record of the batch
+func (b RecordBatch) NextOffset() int64 {
+	return b.baseOffset + int64(b.lastOffsetDelta) + 1
+}
+
+// Offset is the absolute offset of the i-th record of the batch
+func (b RecordBatch) Offset(i int) int64 {
+	return b.baseOffset + b.Records[i].offsetDelta
+}
+
+func (b RecordBatch) BaseOffset() int64 {
+	return b.baseOffset
+}
+
+func (b RecordBatch) MaxTimestamp() int64 {
+	return b.maxTimestamp
+}
+
+// ProducerID is -1 for batches written without an idempotent producer
+func (b RecordBatch) ProducerID() int64 {
+	return b.producerId
+}
+
+func (b RecordBatch) ProducerEpoch() int16 {
+	return b.producerEpoch
+}
+
+func (b RecordBatch) BaseSequence() int32 {
+	return b.baseSequence
+}
+
+// LastSequence is the sequence of the last record, sequences wrap around
+// after math.MaxInt32
+func (b RecordBatch) LastSequence() int32 {
+	if b.baseSequence < 0 {
+		return b.baseSequence
+	}
+	return int32((int64(b.baseSequence) + int64(b.lastOffsetDelta)) % (math.MaxInt32 + 1))
+}
+
+func (b RecordBatch) IsTransactional() bool {
+	return b.attributes&TransactionalAttribute != 0
+}
+
+func (b RecordBatch) IsControl() bool {
+	return b.attributes&ControlAttribute != 0
+}
+
+// IsCommit reports whether a control batch is a COMMIT marker rather than an
+// ABORT one
+func (b RecordBatch) IsCommit() bool {
+	if len(b.Records) == 0 || len(b.Records[0].Key) < 4 {
+		return false
+	}
+	return binary.BigEndian.Uint16(b.Records[0].Key[2:4]) == ControlTypeCommit
+}
+
+// AppendRecords writes the encoded values as a single batch to the end of the
+// metadata log at path and adds the parsed batch to cm. The caller is expected
+// to serialize appends.
+func AppendRecords(path string, cm *ClusterMetaData, values ...[]byte) (RecordBatch, error) {
+	stream := EncodeRecordBatch(cm.NextOffset(), time.Now().UnixMilli(), values)
+	if err := append_bin(path, stream); err != nil {
+		return RecordBatch{}, err
+	}
+
+	// Read back what was written so memory always mirrors the file
+	batch, _, _ := CreateRecordBatch(stream, 0)
+	cm.Batches = append(cm.Batches, batch)
+	return batch, nil
+}
+
+func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int, error) {
+	return decodeRecordBatch(stream, offset, true)
+}
+
+// DecodeRecordBatch parses a batch without interpreting the record values as
+// metadata records, for logs holding any other kind of records
+func DecodeRecordBatch(stream []byte, offset int) (RecordBatch, int, error) {
+	return decodeRecordBatch(stream, offset, false)
+}
+
+// decodeRecordBatch parses the batch at offset, a batch cut short or failing
+// checkBatch is an error
+func decodeRecordBatch(stream []byte, offset int, metadata bool) (RecordBatch, int, error) {
+	if len(stream)-offset < 12 {
+		return RecordBatch{}, 0, ErrCorruptBatch
+	}
+	if end := offset + 12 + int(binary.BigEndian.Uint32(stream[offset+8:offset+12])); end > len(stream) {
+		return RecordBatch{}, 0, ErrCorruptBatch
+	} else if err := checkBatch(stream[offset:end]); err != nil {
+		return RecordBatch{}, 0, err
+	}
+
 	// Parse out a particular record. (how to know if we're at the end of a file?)
-	offset += 8 // initial offset (BaseOffset)
+	baseOffset := int64(utils.BytesToInt(stream, offset, offset+8))
+	offset += 8
 
 	batchLength := utils.BytesToInt(stream, offset, offset+4)
 	finalOffset := 12 + int(batchLength)
@@ -71,7 +208,7 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 	paritionLeaderEpochId := int32(utils.BytesToInt(stream, offset, offset+4))
 	offset += 4
 
-	// magicByte, _ := utils.BytesToInt8(stream[offset : offset+1])
+	magicByte := int8(utils.BytesToInt(stream, offset, offset+1))
 	// // fmt.Printf("[DEUBG] magicByte: %x - %d\n", stream[offset:offset+1], magicByte)
 	offset += 1
 
@@ -83,7 +220,7 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 	// // fmt.Printf("[DEUBG] attributes: %x - %d\n", stream[offset:offset+2], attributes)
 	offset += 2
 
-	// lastOffsetDelta, _ := utils.BytesToInt32(stream[offset : offset+4])
+	lastOffsetDelta := int32(utils.BytesToInt(stream, offset, offset+4))
 	offset += 4
 
 	baseTimestamp := int64(utils.BytesToInt(stream, offset, offset+8))
@@ -107,12 +244,17 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 	recordsLength := int32(utils.BytesToInt(stream, offset, offset+4))
 	offset += 4
 
+	// Compressed records are kept as written, only the batch header is parsed
+	if attributes&CompressionCodecMask != 0 {
+		recordsLength = 0
+	}
+
 	var records []Record
 	for i := 0; i < int(recordsLength); i++ {
 		// parsing the records
 		recordStartOffset := offset
-		recordLength, bytesConsumed, _ := utils.ParseVarint(stream[offset:])
-		offset += bytesConsumed
+		recordLength, recordLengthSize, _ := utils.ParseVarint(stream[offset:])
+		offset += recordLengthSize
 
 		// fmt.Printf("Record %d: recordLength=%d, startOffset=%d\n", i, recordLength, recordStartOffset)
 
@@ -122,16 +264,16 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 		timestampDelta, bytesConsumed, _ := utils.ParseVarint(stream[offset:])
 		offset += bytesConsumed
 
-		_, bytesConsumed, _ = utils.ParseVarint(stream[offset:])
+		offsetDelta, bytesConsumed, _ := utils.ParseVarint(stream[offset:])
 		offset += bytesConsumed
 
 		keyLength, bytesConsumed, _ := utils.ParseVarint(stream[offset:])
 		offset += bytesConsumed
 		// fmt.Printf("offset %d - size %d, keyLength: %d\n", offset, len(stream), keyLength)
 
+		var key []byte
 		if keyLength != -1 {
-			// parse the key value..
-			// key := any
+			key = bytes.Clone(stream[offset : offset+int(keyLength)])
 			offset += int(keyLength)
 		}
 
@@ -139,9 +281,16 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 		offset += bytesConsumed
 		// fmt.Printf("valueLength: %d, recordLength: %d\n", valueLength, recordLength)
 
+		var rawValue []byte
+		if valueLength != -1 {
+			rawValue = bytes.Clone(stream[offset : offset+int(valueLength)])
+		}
+
 		var value interface{}
 		valueType := int8(0)
-		if valueLength > 0 {
+		if valueLength > 0 && !metadata {
+			offset += int(valueLength)
+		} else if valueLength > 0 {
 			// Parsing the ValueHeader
 			header, newOffset := createRecordHeader(stream, offset)
 			valueType = int8(header.valueType)
@@ -163,7 +312,7 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 		}
 
 		// Ensure we've consumed exactly recordLength bytes from the record start
-		expectedOffset := recordStartOffset + int(recordLength) + bytesConsumed
+		expectedOffset := recordStartOffset + int(recordLength) + recordLengthSize
 		if offset != expectedOffset {
 			// fmt.Printf("WARNING: offset mismatch. Expected: %d, Actual: %d\n", expectedOffset, offset)
 			// Adjust offset to expected position
@@ -173,9 +322,11 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 		record := Record{
 			attributes:     attributes,
 			timestampDelta: timestampDelta,
+			offsetDelta:    offsetDelta,
 			keySize:        keyLength,
 			ValueType:      valueType,
-			key:            nil,
+			Key:            key,
+			RawValue:       rawValue,
 			Value:          value,
 		}
 		records = append(records, record)
@@ -186,26 +337,49 @@ func CreateRecordBatch(stream []byte, offset int) (RecordBatch, int) {
 	// // fmt.Printf("Final byte: %x\n", stream[offset])
 
 	return RecordBatch{
+		baseOffset:           baseOffset,
 		partitionLeaderEpoch: paritionLeaderEpochId,
+		magicByte:            magicByte,
 		CRC:                  CRC,
 		attributes:           attributes,
+		lastOffsetDelta:      lastOffsetDelta,
 		baseTimestamp:        baseTimestamp,
 		maxTimestamp:         maxTimestamp,
 		producerId:           producerId,
 		producerEpoch:        producerEpoch,
 		baseSequence:         baseSequenceId,
 		Records:              records,
-	}, finalOffset
+	}, finalOffset, nil
 }
 
 func parseValue(stream []byte, header ValueTypeHeader, offset int) (interface{}, int) {
 	switch header.valueType {
+	case 0: // Register Broker Record
+		return parseRegisterBrokerValue(stream, header, offset)
+	case 1: // Unregister Broker Record
+		return parseUnregisterBrokerValue(stream, header, offset)
 	case 2: // Topic
 		return parseTopicValue(stream, header, offset)
 	case 3: // Partition Record
 		return parsePartitionValue(stream, header, offset)
+	case 4: // Config Record
+		return parseConfigValue(stream, header, offset)
+	case 9: // Remove Topic Record
+		return parseRemoveTopicValue(stream, header, offset)
+	case 11: // User Scram Credential Record
+		return parseUserScramCredentialValue(stream, header, offset)
 	case 12: // Feature Level Record
 		return parseFeatureLevelValue(stream, header, offset)
+	case 14: // Client Quota Record
+		return parseClientQuotaValue(stream, header, offset)
+	case 15: // Producer Ids Record
+		return parseProducerIdsValue(stream, header, offset)
+	case 22: // Remove User Scram Credential Record
+		return parseRemoveUserScramCredentialValue(stream, header, offset)
+	case 23: // Access Control Entry Record
+		return parseAccessControlEntryValue(stream, header, offset)
+	case 24: // Remove Access Control Entry Record
+		return parseRemoveAccessControlEntryValue(stream, header, offset)
 	default:
 		// fmt.Printf("Unknown valueType: %d, skipping...\n", header.valueType)
 		// Return a placeholder value and don't advance offset much
@@ -213,6 +387,42 @@ func parseValue(stream []byte, header ValueTypeHeader, offset int) (interface{},
 	}
 }
 
+// Only the broker id is kept, the endpoints and features that follow it are
+// skipped since every record is realigned to its length after parsing
+func parseRegisterBrokerValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (RegisterBrokerValue, int) {
+	brokerId := int32(utils.BytesToInt(stream, offset, offset+4))
+	offset += 4
+
+	return RegisterBrokerValue{
+		header:   header,
+		BrokerId: brokerId,
+	}, offset
+}
+
+func parseUnregisterBrokerValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (UnregisterBrokerValue, int) {
+	brokerId := int32(utils.BytesToInt(stream, offset, offset+4))
+	offset += 4
+
+	// brokerEpoch
+	offset += 8
+
+	// Tagged Fields Count
+	offset += 1
+
+	return UnregisterBrokerValue{
+		header:   header,
+		BrokerId: brokerId,
+	}, offset
+}
+
 func parseTopicValue(
 	stream []byte,
 	header ValueTypeHeader,
@@ -243,6 +453,48 @@ func parseTopicValue(
 	}, offset
 }
 
+func parseRemoveTopicValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (RemoveTopicValue, int) {
+	topicId, _ := uuid.FromBytes(stream[offset : offset+16])
+	offset += 16
+
+	// Tagged Fields Count
+	offset += 1
+
+	return RemoveTopicValue{
+		header:  header,
+		TopicId: topicId,
+	}, offset
+}
+
+func parseProducerIdsValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (ProducerIdsValue, int) {
+	brokerId := int32(utils.BytesToInt(stream, offset, offset+4))
+	offset += 4
+
+	brokerEpoch := int64(utils.BytesToInt(stream, offset, offset+8))
+	offset += 8
+
+	nextProducerId := int64(utils.BytesToInt(stream, offset, offset+8))
+	offset += 8
+
+	// Tagged Fields Count
+	offset += 1
+
+	return ProducerIdsValue{
+		header:         header,
+		BrokerId:       brokerId,
+		BrokerEpoch:    brokerEpoch,
+		NextProducerId: nextProducerId,
+	}, offset
+}
+
 func parseFeatureLevelValue(
 	stream []byte,
 	header ValueTypeHeader,
@@ -267,6 +519,207 @@ func parseFeatureLevelValue(
 	}, offset
 }
 
+// parseCompactString reads a varint length (+1) prefixed string. A length of 0 is a null string.
+func parseCompactString(stream []byte, offset int) (string, bool, int) {
+	length, bytesConsumed, _ := utils.ParseUvarint(stream[offset:])
+	offset += bytesConsumed
+	if length == 0 {
+		return "", true, offset
+	}
+
+	value := string(stream[offset : offset+int(length)-1])
+	offset += int(length) - 1
+	return value, false, offset
+}
+
+func parseCompactBytes(stream []byte, offset int) ([]byte, int) {
+	length, bytesConsumed, _ := utils.ParseUvarint(stream[offset:])
+	offset += bytesConsumed
+	if length == 0 {
+		return nil, offset
+	}
+
+	value := append([]byte(nil), stream[offset:offset+int(length)-1]...)
+	offset += int(length) - 1
+	return value, offset
+}
+
+func parseUserScramCredentialValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (UserScramCredentialValue, int) {
+	name, _, offset := parseCompactString(stream, offset)
+
+	mechanism := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	salt, offset := parseCompactBytes(stream, offset)
+	storedKey, offset := parseCompactBytes(stream, offset)
+	serverKey, offset := parseCompactBytes(stream, offset)
+
+	iterations := int32(utils.BytesToInt(stream, offset, offset+4))
+	offset += 4
+
+	// Tagged Fields Count
+	offset++
+
+	return UserScramCredentialValue{
+		header:     header,
+		Name:       name,
+		Mechanism:  mechanism,
+		Salt:       salt,
+		StoredKey:  storedKey,
+		ServerKey:  serverKey,
+		Iterations: iterations,
+	}, offset
+}
+
+func parseRemoveUserScramCredentialValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (RemoveUserScramCredentialValue, int) {
+	name, _, offset := parseCompactString(stream, offset)
+
+	mechanism := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	// Tagged Fields Count
+	offset++
+
+	return RemoveUserScramCredentialValue{
+		header:    header,
+		Name:      name,
+		Mechanism: mechanism,
+	}, offset
+}
+
+func parseAccessControlEntryValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (AccessControlEntryValue, int) {
+	id, _ := uuid.FromBytes(stream[offset : offset+16])
+	offset += 16
+
+	resourceType := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	resourceName, _, offset := parseCompactString(stream, offset)
+
+	patternType := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	principal, _, offset := parseCompactString(stream, offset)
+	host, _, offset := parseCompactString(stream, offset)
+
+	operation := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	permissionType := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	// Tagged Fields Count
+	offset++
+
+	return AccessControlEntryValue{
+		header:         header,
+		Id:             id,
+		ResourceType:   resourceType,
+		ResourceName:   resourceName,
+		PatternType:    patternType,
+		Principal:      principal,
+		Host:           host,
+		Operation:      operation,
+		PermissionType: permissionType,
+	}, offset
+}
+
+func parseRemoveAccessControlEntryValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (RemoveAccessControlEntryValue, int) {
+	id, _ := uuid.FromBytes(stream[offset : offset+16])
+	offset += 16
+
+	// Tagged Fields Count
+	offset++
+
+	return RemoveAccessControlEntryValue{
+		header: header,
+		Id:     id,
+	}, offset
+}
+
+func parseClientQuotaValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (ClientQuotaValue, int) {
+	entityCount, bytesConsumed, _ := utils.ParseUvarint(stream[offset:])
+	offset += bytesConsumed
+
+	var entity []ClientQuotaEntityData
+	for i := 0; i < int(entityCount)-1; i++ {
+		entityType, _, next := parseCompactString(stream, offset)
+		entityName, isDefault, next := parseCompactString(stream, next)
+		offset = next
+
+		// Tagged Fields Count
+		offset++
+
+		entity = append(entity, ClientQuotaEntityData{EntityType: entityType, EntityName: entityName, IsDefault: isDefault})
+	}
+
+	key, _, offset := parseCompactString(stream, offset)
+
+	value := math.Float64frombits(binary.BigEndian.Uint64(stream[offset : offset+8]))
+	offset += 8
+
+	remove := stream[offset] != 0
+	offset++
+
+	// Tagged Fields Count
+	offset++
+
+	return ClientQuotaValue{
+		header: header,
+		Entity: entity,
+		Key:    key,
+		Value:  value,
+		Remove: remove,
+	}, offset
+}
+
+func parseConfigValue(
+	stream []byte,
+	header ValueTypeHeader,
+	offset int,
+) (ConfigValue, int) {
+	resourceType := int8(utils.BytesToInt(stream, offset, offset+1))
+	offset++
+
+	resourceName, _, offset := parseCompactString(stream, offset)
+	name, _, offset := parseCompactString(stream, offset)
+
+	// A null value means the config was removed
+	value, removed, offset := parseCompactString(stream, offset)
+
+	// Tagged Fields Count
+	offset++
+
+	return ConfigValue{
+		header:       header,
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Name:         name,
+		Value:        value,
+		Removed:      removed,
+	}, offset
+}
+
 func parsePartitionValue(
 	stream []byte,
 	header ValueTypeHeader,
@@ -350,15 +803,15 @@ func parsePartitionValue(
 
 	return PartitionValue{
 		header:               header,
-		partitionId:          partitionId,
-		topicId:              topicId,
-		replicaIdArray:       replicaArray,
-		inSyncReplicaArray:   syncReplicaArray,
-		removingReplicaArray: removingReplicaArray,
-		addingReplicaArray:   addingReplicaArray,
-		leaderId:             replicaLeaderId,
-		leaderEpoch:          replicaLeaderEpoch,
-		partitionEpoch:       partitionEpoch,
-		directoriesArray:     directoryArray,
+		PartitionId:          partitionId,
+		TopicId:              topicId,
+		ReplicaIdArray:       replicaArray,
+		InSyncReplicaArray:   syncReplicaArray,
+		RemovingReplicaArray: removingReplicaArray,
+		AddingReplicaArray:   addingReplicaArray,
+		LeaderId:             replicaLeaderId,
+		LeaderEpoch:          replicaLeaderEpoch,
+		PartitionEpoch:       partitionEpoch,
+		DirectoriesArray:     directoryArray,
 	}, offset
 }
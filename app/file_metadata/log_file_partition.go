@@ -0,0 +1,560 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"toy_kafka/app/utils"
+)
+
+// ProducerSnapshotInterval is how many offsets a partition advances between two
+// producer state snapshots, one is also taken when the log is closed
+var ProducerSnapshotInterval int64 = 10000
+
+// Size of the record batch header, up to and including the records count
+const recordBatchHeaderSize = 61
+
+var (
+	ErrCorruptBatch     = errors.New("record batch is corrupt")
+	ErrInvalidBatch     = errors.New("expected exactly one record batch")
+	ErrInvalidRecord    = errors.New("record batch holds invalid records")
+	ErrOffsetOutOfRange = errors.New("offset is out of range")
+)
+
+// PartitionLog is the log of a single topic partition, kept as one segment in
+// the same record batch format as the metadata log
+type PartitionLog struct {
+	mu         sync.Mutex
+	path       string
+	nextOffset int64
+	size       int64
+	positions  []batchPosition
+
+	producers  *ProducerState
+	snapshotAt int64 // offset of the last producer state snapshot
+	aborted    []AbortedTxn
+
+	// onAppend is called after every append, once the lock is released
+	onAppend func()
+	appended bool
+}
+
+// batchPosition locates a batch in the segment
+type batchPosition struct {
+	baseOffset int64
+	lastOffset int64
+	position   int64
+	size       int64
+}
+
+// OpenPartitionLog opens the log of a topic partition, creating it when missing,
+// and returns it together with the batches it already holds
+func OpenPartitionLog(logDir string, topic string, partition int32) (*PartitionLog, []RecordBatch, error) {
+	if err := CreatePartitionDir(logDir, topic, partition); err != nil {
+		return nil, nil, err
+	}
+
+	path := segmentPath(logDir, topic, partition)
+	stream, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batches, valid := DecodeRecordBatches(stream)
+	if valid < len(stream) {
+		// A batch cut short by a crash is dropped so appends start on a batch boundary
+		slog.Warn("Truncating a torn write", "file", path, "bytes", len(stream)-valid)
+		if err := os.Truncate(path, int64(valid)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	log := &PartitionLog{path: path, producers: newProducerState(filepath.Dir(path))}
+	position := int64(0)
+	for _, batch := range batches {
+		size := 12 + int64(binary.BigEndian.Uint32(stream[position+8:position+12]))
+		log.positions = append(log.positions, batchPosition{baseOffset: batch.BaseOffset(), lastOffset: batch.NextOffset() - 1, position: position, size: size})
+		position += size
+	}
+	log.size = position
+	if len(batches) > 0 {
+		log.nextOffset = batches[len(batches)-1].NextOffset()
+	}
+
+	if log.aborted, err = readTxnIndex(txnIndexPath(path), log.nextOffset); err != nil {
+		return nil, nil, err
+	}
+
+	// The snapshot covers everything before its offset, later batches are replayed
+	log.snapshotAt = log.producers.loadSnapshot(log.nextOffset)
+	for _, batch := range batches {
+		if batch.BaseOffset() < log.snapshotAt {
+			continue
+		}
+		if !batch.IsControl() {
+			log.producers.update(batch, batch.BaseOffset())
+			continue
+		}
+		aborted, ok := log.producers.completeTxn(batch, batch.BaseOffset(), -1)
+		if ok && (len(log.aborted) == 0 || log.aborted[len(log.aborted)-1].LastOffset < aborted.LastOffset) {
+			aborted.LastStableOffset = log.lastStableOffset()
+			log.aborted = append(log.aborted, aborted)
+		}
+	}
+	return log, batches, nil
+}
+
+// DecodeRecordBatches parses every complete batch of a partition log and returns
+// them along with the number of bytes they cover
+func DecodeRecordBatches(stream []byte) ([]RecordBatch, int) {
+	var batches []RecordBatch
+	offset := 0
+	for offset+12 <= len(stream) {
+		batchLength := utils.BytesToInt(stream, offset+8, offset+12)
+		if offset+12+int(batchLength) > len(stream) {
+			break
+		}
+		batch, size, err := DecodeRecordBatch(stream, offset)
+		if err != nil {
+			// Recovered like a torn write, appends start over from here
+			break
+		}
+		batches = append(batches, batch)
+		offset += size
+	}
+	return batches, offset
+}
+
+// Append writes the records as a single batch and returns its base offset
+func (l *PartitionLog) Append(records []RecordData) (int64, error) {
+	l.mu.Lock()
+	defer l.unlockAppended()
+
+	stream := EncodeKeyedRecordBatch(l.nextOffset, time.Now().UnixMilli(), records)
+	batch, _ := DecodeBatchHeader(stream)
+	return l.appendLocked(stream, batch)
+}
+
+// AppendBatch writes a record batch as produced by a client, giving it the next
+// offset of the log. Batches from idempotent producers are checked against the
+// producer state first, a retried batch is not written again and the base
+// offset it was first written at is returned instead.
+func (l *PartitionLog) AppendBatch(stream []byte) (int64, error) {
+	batch, err := DecodeBatchHeader(stream)
+	if err != nil {
+		return 0, err
+	}
+	if batch.IsControl() {
+		return 0, ErrInvalidBatch
+	}
+
+	l.mu.Lock()
+	defer l.unlockAppended()
+
+	duplicate, err := l.producers.check(batch)
+	if err != nil {
+		return 0, err
+	}
+	if duplicate != nil {
+		return duplicate.FirstOffset(), nil
+	}
+	return l.appendLocked(stream, batch)
+}
+
+// AppendTransactional writes records on behalf of a transactional producer, as
+// the group coordinator does for offsets committed in a transaction
+func (l *PartitionLog) AppendTransactional(producerID int64, producerEpoch int16, records []RecordData) (int64, error) {
+	l.mu.Lock()
+	defer l.unlockAppended()
+
+	stream := EncodeTransactionalRecordBatch(l.nextOffset, time.Now().UnixMilli(), producerID, producerEpoch, records)
+	batch, _ := DecodeBatchHeader(stream)
+	if _, err := l.producers.check(batch); err != nil {
+		return 0, err
+	}
+	return l.appendLocked(stream, batch)
+}
+
+// AppendMarker ends the open transaction of a producer with a COMMIT or ABORT
+// control batch and returns the offset of the marker. Aborted transactions are
+// added to the transaction index.
+func (l *PartitionLog) AppendMarker(producerID int64, producerEpoch int16, commit bool, coordinatorEpoch int32) (int64, error) {
+	l.mu.Lock()
+	defer l.unlockAppended()
+
+	stream := EncodeControlBatch(l.nextOffset, time.Now().UnixMilli(), producerID, producerEpoch, commit, coordinatorEpoch)
+	batch, _, _ := DecodeRecordBatch(stream, 0)
+	if _, err := l.producers.check(batch); err != nil {
+		return 0, err
+	}
+
+	offset, err := l.appendLocked(stream, batch)
+	if err != nil {
+		return 0, err
+	}
+	if aborted, ok := l.producers.completeTxn(batch, offset, coordinatorEpoch); ok {
+		aborted.LastStableOffset = l.lastStableOffset()
+		if err := appendTxnIndex(txnIndexPath(l.path), aborted); err != nil {
+			return 0, err
+		}
+		l.aborted = append(l.aborted, aborted)
+	}
+	return offset, nil
+}
+
+// appendLocked writes a batch at the end of the log, updating the producer
+// state for data batches. Must be called with the log lock held.
+func (l *PartitionLog) appendLocked(stream []byte, batch RecordBatch) (int64, error) {
+	baseOffset := l.nextOffset
+	written := make([]byte, len(stream))
+	copy(written, stream)
+	binary.BigEndian.PutUint64(written[0:8], uint64(baseOffset))
+	binary.BigEndian.PutUint32(written[12:16], 0) // partitionLeaderEpoch
+	if err := append_bin(l.path, written); err != nil {
+		return 0, err
+	}
+
+	l.nextOffset = baseOffset + batch.NextOffset() - batch.BaseOffset()
+	l.positions = append(l.positions, batchPosition{baseOffset: baseOffset, lastOffset: l.nextOffset - 1, position: l.size, size: int64(len(written))})
+	l.size += int64(len(written))
+	if !batch.IsControl() {
+		l.producers.update(batch, baseOffset)
+	}
+	if l.nextOffset-l.snapshotAt >= ProducerSnapshotInterval {
+		l.snapshot()
+	}
+
+	l.appended = true
+	return baseOffset, nil
+}
+
+// FetchData is what a read returns, Records holds whole batches as written
+type FetchData struct {
+	Records          []byte
+	HighWatermark    int64
+	LastStableOffset int64
+	LogStartOffset   int64
+	Aborted          []AbortedTxn // only filled for read_committed reads
+}
+
+// Read returns the batches starting with the one holding offset, at least one
+// batch and then as many as fit in maxBytes. read_committed reads stop at the
+// last stable offset and list the aborted transactions they cover.
+func (l *PartitionLog) Read(offset int64, maxBytes int32, readCommitted bool) (FetchData, error) {
+	l.mu.Lock()
+	data := FetchData{HighWatermark: l.nextOffset, LastStableOffset: l.lastStableOffset(), LogStartOffset: 0}
+	if offset < 0 || offset > l.nextOffset {
+		l.mu.Unlock()
+		return data, ErrOffsetOutOfRange
+	}
+
+	upper := data.HighWatermark
+	if readCommitted {
+		upper = data.LastStableOffset
+	}
+
+	first := sort.Search(len(l.positions), func(i int) bool { return l.positions[i].lastOffset >= offset })
+	last := first
+	var size int64
+	for last < len(l.positions) && l.positions[last].baseOffset < upper {
+		if size > 0 && size+l.positions[last].size > int64(maxBytes) {
+			break
+		}
+		size += l.positions[last].size
+		last++
+	}
+	if last == first {
+		l.mu.Unlock()
+		return data, nil
+	}
+
+	start := l.positions[first].position
+	end := l.positions[last-1].lastOffset + 1
+	if readCommitted {
+		for _, aborted := range l.aborted {
+			if aborted.LastOffset >= offset && aborted.FirstOffset < end {
+				data.Aborted = append(data.Aborted, aborted)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	// The segment is only ever appended to, the range stays valid without the lock
+	file, err := os.Open(l.path)
+	if err != nil {
+		return data, err
+	}
+	defer file.Close()
+	data.Records = make([]byte, size)
+	if _, err := file.ReadAt(data.Records, start); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// OnAppend sets the function called after every append, readers waiting for
+// new data are woken by it
+func (l *PartitionLog) OnAppend(f func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onAppend = f
+}
+
+// unlockAppended releases the lock taken by an append, then calls onAppend
+// if a batch was written
+func (l *PartitionLog) unlockAppended() {
+	appended, onAppend := l.appended, l.onAppend
+	l.appended = false
+	l.mu.Unlock()
+	if appended && onAppend != nil {
+		onAppend()
+	}
+}
+
+// Available is the size of the batches from offset on that a read would
+// return without its size limit, the log is not read
+func (l *PartitionLog) Available(offset int64, readCommitted bool) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if offset < 0 || offset > l.nextOffset {
+		return 0, ErrOffsetOutOfRange
+	}
+
+	upper := l.nextOffset
+	if readCommitted {
+		upper = l.lastStableOffset()
+	}
+	var size int64
+	first := sort.Search(len(l.positions), func(i int) bool { return l.positions[i].lastOffset >= offset })
+	for i := first; i < len(l.positions) && l.positions[i].baseOffset < upper; i++ {
+		size += l.positions[i].size
+	}
+	return size, nil
+}
+
+// EndOffset is the offset the next append gets
+func (l *PartitionLog) EndOffset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextOffset
+}
+
+// SegmentInfo describes a segment of a partition log
+type SegmentInfo struct {
+	Path       string
+	BaseOffset int64
+	// EndOffset is the offset after the last batch of the segment
+	EndOffset           int64
+	Size                int64
+	Batches             int
+	AbortedTransactions int
+	// SnapshotOffset is the offset of the last producer state snapshot
+	SnapshotOffset int64
+}
+
+// Segments describes the segments of the log, a log is a single segment for
+// now
+func (l *PartitionLog) Segments() []SegmentInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return []SegmentInfo{{
+		Path:                l.path,
+		BaseOffset:          0,
+		EndOffset:           l.nextOffset,
+		Size:                l.size,
+		Batches:             len(l.positions),
+		AbortedTransactions: len(l.aborted),
+		SnapshotOffset:      l.snapshotAt,
+	}}
+}
+
+// LastStableOffset is the first offset read_committed consumers may not read,
+// the start of the oldest open transaction or the end of the log
+func (l *PartitionLog) LastStableOffset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastStableOffset()
+}
+
+// Must be called with the log lock held.
+func (l *PartitionLog) lastStableOffset() int64 {
+	if first := l.producers.firstUnstableOffset(); first >= 0 {
+		return first
+	}
+	return l.nextOffset
+}
+
+// Producer returns what the log knows about an idempotent producer
+func (l *PartitionLog) Producer(producerID int64) (ProducerStateEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.producers.Entry(producerID)
+}
+
+// Close persists the producer state so the next open does not have to replay
+// the whole log
+func (l *PartitionLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot()
+}
+
+// Must be called with the log lock held.
+func (l *PartitionLog) snapshot() error {
+	l.producers.expire(time.Now())
+	if err := l.producers.writeSnapshot(l.nextOffset); err != nil {
+		slog.Error("Failed to snapshot the producer state", "file", l.path, "error", err)
+		return err
+	}
+	l.snapshotAt = l.nextOffset
+	return nil
+}
+
+// DecodeBatchHeader validates a single record batch written by a client and
+// parses its header. The records are checked to fit the batch but not parsed.
+func DecodeBatchHeader(stream []byte) (RecordBatch, error) {
+	if len(stream) < recordBatchHeaderSize {
+		return RecordBatch{}, ErrCorruptBatch
+	}
+	batchLength := int(binary.BigEndian.Uint32(stream[8:12]))
+	if 12+batchLength < len(stream) {
+		return RecordBatch{}, ErrInvalidBatch
+	}
+	if 12+batchLength > len(stream) {
+		return RecordBatch{}, ErrCorruptBatch
+	}
+	if err := checkBatch(stream); err != nil {
+		return RecordBatch{}, err
+	}
+
+	return RecordBatch{
+		baseOffset:           int64(binary.BigEndian.Uint64(stream[0:8])),
+		partitionLeaderEpoch: int32(binary.BigEndian.Uint32(stream[12:16])),
+		magicByte:            int8(stream[16]),
+		CRC:                  int32(binary.BigEndian.Uint32(stream[17:21])),
+		attributes:           int16(binary.BigEndian.Uint16(stream[21:23])),
+		lastOffsetDelta:      int32(binary.BigEndian.Uint32(stream[23:27])),
+		baseTimestamp:        int64(binary.BigEndian.Uint64(stream[27:35])),
+		maxTimestamp:         int64(binary.BigEndian.Uint64(stream[35:43])),
+		producerId:           int64(binary.BigEndian.Uint64(stream[43:51])),
+		producerEpoch:        int16(binary.BigEndian.Uint16(stream[51:53])),
+		baseSequence:         int32(binary.BigEndian.Uint32(stream[53:57])),
+	}, nil
+}
+
+// checkBatch validates a complete record batch, its magic byte, CRC and record
+// count. The records of an uncompressed batch are walked too: every length has
+// to stay inside its record, and the records have to fill the batch exactly,
+// so decoding the batch later can't run off its end.
+func checkBatch(batch []byte) error {
+	if len(batch) < recordBatchHeaderSize || batch[16] != 2 {
+		return ErrCorruptBatch
+	}
+	if binary.BigEndian.Uint32(batch[17:21]) != crc32.Checksum(batch[21:], castagnoliTable) {
+		return ErrCorruptBatch
+	}
+	lastOffsetDelta := int32(binary.BigEndian.Uint32(batch[23:27]))
+	if lastOffsetDelta < 0 {
+		return ErrCorruptBatch
+	}
+	count := int32(binary.BigEndian.Uint32(batch[57:61]))
+	if count != lastOffsetDelta+1 {
+		return fmt.Errorf("%w: %d records for a last offset delta of %d", ErrInvalidRecord, count, lastOffsetDelta)
+	}
+
+	// Compressed records are kept as written
+	if int16(binary.BigEndian.Uint16(batch[21:23]))&CompressionCodecMask != 0 {
+		return nil
+	}
+
+	records := recordReader{buff: batch, offset: recordBatchHeaderSize}
+	for i := int32(0); i < count; i++ {
+		length := records.varint()
+		if records.failed || length <= 0 || length > int64(len(batch)-records.offset) {
+			return fmt.Errorf("%w: record %d does not fit the batch", ErrCorruptBatch, i)
+		}
+		if err := checkRecord(batch[records.offset:records.offset+int(length)], i); err != nil {
+			return err
+		}
+		records.offset += int(length)
+	}
+	if records.offset != len(batch) {
+		return fmt.Errorf("%w: %d bytes after the last record", ErrCorruptBatch, len(batch)-records.offset)
+	}
+	return nil
+}
+
+// checkRecord walks the fields of the record at index i of a batch
+func checkRecord(record []byte, i int32) error {
+	r := recordReader{buff: record}
+	r.skip(1)  // attributes
+	r.varint() // timestamp delta
+	if offsetDelta := r.varint(); !r.failed && offsetDelta != int64(i) {
+		return fmt.Errorf("%w: record %d has offset delta %d", ErrInvalidRecord, i, offsetDelta)
+	}
+	r.bytes(true) // key
+	r.bytes(true) // value
+
+	headers := r.varint()
+	if headers < 0 || headers > int64(len(record)) {
+		r.failed = true
+	}
+	for h := int64(0); h < headers && !r.failed; h++ {
+		r.bytes(false) // header key
+		r.bytes(true)  // header value
+	}
+
+	if r.failed || r.offset != len(record) {
+		return fmt.Errorf("%w: record %d is malformed", ErrCorruptBatch, i)
+	}
+	return nil
+}
+
+// recordReader reads the fields of records, the first read past the end of
+// buff sets failed and turns the later ones into no-ops
+type recordReader struct {
+	buff   []byte
+	offset int
+	failed bool
+}
+
+func (r *recordReader) skip(n int) {
+	if r.failed || n > len(r.buff)-r.offset {
+		r.failed = true
+		return
+	}
+	r.offset += n
+}
+
+func (r *recordReader) varint() int64 {
+	if r.failed {
+		return 0
+	}
+	value, n, err := utils.ParseVarint(r.buff[r.offset:])
+	if err != nil {
+		r.failed = true
+		return 0
+	}
+	r.offset += n
+	return value
+}
+
+// bytes skips a varint length followed by that many bytes, a length of -1 is
+// null
+func (r *recordReader) bytes(nullable bool) {
+	length := r.varint()
+	if r.failed || length < -1 || length == -1 && !nullable || length > int64(len(r.buff)-r.offset) {
+		r.failed = true
+		return
+	}
+	if length > 0 {
+		r.offset += int(length)
+	}
+}
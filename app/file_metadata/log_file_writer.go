@@ -3,15 +3,18 @@ package file_metadata
 import (
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+
+	"github.com/google/uuid"
 )
 
 func write_bin(path string, hexData string) {
 	// Decode hex string into bytes
 	data, err := hex.DecodeString(hexData)
 	if err != nil {
-		fmt.Println("Error in bin decode to hex")
+		slog.Error("Failed to decode the hex of a log", "error", err)
 	}
 
 	// Ensure parent directories exist
@@ -23,5 +26,82 @@ func write_bin(path string, hexData string) {
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		panic(err)
 	}
-	fmt.Println("Wrote", len(data), "bytes to .log file")
+	slog.Debug("Wrote a log", "file", path, "bytes", len(data))
+}
+
+func append_bin(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func partitionDir(logDir string, topic string, partition int32) string {
+	return filepath.Join(logDir, fmt.Sprintf("%s-%d", topic, partition))
+}
+
+func segmentPath(logDir string, topic string, partition int32) string {
+	return filepath.Join(partitionDir(logDir, topic, partition), "00000000000000000000.log")
+}
+
+// CreatePartitionDir creates the <topic>-<partition> log directory with an empty first segment
+func CreatePartitionDir(logDir string, topic string, partition int32) error {
+	if err := os.MkdirAll(partitionDir(logDir, topic, partition), 0755); err != nil {
+		return err
+	}
+
+	segment, err := os.OpenFile(segmentPath(logDir, topic, partition), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return segment.Close()
+}
+
+// DeletePartitionDir renames the <topic>-<partition> directory out of the way
+// with a -delete suffix, so the topic can be recreated right away, and removes
+// it in the background.
+func DeletePartitionDir(logDir string, topic string, partition int32) error {
+	dir := partitionDir(logDir, topic, partition)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	id := uuid.New()
+	deleted := fmt.Sprintf("%s.%s-delete", dir, hex.EncodeToString(id[:]))
+	if err := os.Rename(dir, deleted); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := os.RemoveAll(deleted); err != nil {
+			slog.Error("Failed to remove a deleted partition", "dir", deleted, "error", err)
+		}
+	}()
+	return nil
+}
+
+// Same file name as Kafka, its presence tells the next start that the logs of
+// the directory were closed
+const cleanShutdownFile = ".kafka_cleanshutdown"
+
+// WriteCleanShutdownMarker marks a log directory as cleanly shut down, once
+// every log in it is closed
+func WriteCleanShutdownMarker(logDir string) error {
+	return os.WriteFile(filepath.Join(logDir, cleanShutdownFile), []byte(`{"version":0,"brokerEpoch":0}`), 0644)
+}
+
+// RemoveCleanShutdownMarker removes the marker of the last shutdown as the
+// broker starts, and reports whether there was one
+func RemoveCleanShutdownMarker(logDir string) (bool, error) {
+	err := os.Remove(filepath.Join(logDir, cleanShutdownFile))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
 }
@@ -0,0 +1,392 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Same as Kafka, a producer can have at most five batches in flight so the last
+// five are enough to recognise any retry
+const producerBatchesToRetain = 5
+
+// ProducerIDExpiration matches Kafka's producer.id.expiration.ms default, the
+// state of producers that stay silent for longer is dropped on the next snapshot
+var ProducerIDExpiration = 24 * time.Hour
+
+const (
+	producerSnapshotSuffix  = ".snapshot"
+	producerSnapshotVersion = 1
+)
+
+var (
+	ErrOutOfOrderSequence   = errors.New("out of order sequence number")
+	ErrInvalidProducerEpoch = errors.New("producer epoch is older than the current one")
+)
+
+// ProducerBatch is what is remembered of a batch written by an idempotent producer
+type ProducerBatch struct {
+	FirstSeq    int32
+	LastSeq     int32
+	LastOffset  int64
+	OffsetDelta int32 // LastOffset minus the base offset of the batch
+	Timestamp   int64
+}
+
+func (b ProducerBatch) FirstOffset() int64 {
+	return b.LastOffset - int64(b.OffsetDelta)
+}
+
+type ProducerStateEntry struct {
+	ProducerID    int64
+	Epoch         int16
+	Batches       []ProducerBatch // oldest first, at most producerBatchesToRetain
+	LastTimestamp int64
+
+	// Offset of the first batch of the open transaction, -1 outside of one
+	CurrentTxnFirstOffset int64
+	CoordinatorEpoch      int32
+}
+
+// AbortedTxn is an entry of the aborted transaction index, read_committed
+// consumers drop the batches of the producer between the two offsets
+type AbortedTxn struct {
+	ProducerID       int64
+	FirstOffset      int64
+	LastOffset       int64 // offset of the ABORT marker
+	LastStableOffset int64 // last stable offset once the marker was written
+}
+
+func (e *ProducerStateEntry) lastSeq() int32 {
+	if len(e.Batches) == 0 {
+		return -1
+	}
+	return e.Batches[len(e.Batches)-1].LastSeq
+}
+
+// duplicateOf returns the retained batch with the same sequence range, nil when
+// the batch was never written
+func (e *ProducerStateEntry) duplicateOf(epoch int16, firstSeq int32, lastSeq int32) *ProducerBatch {
+	if epoch != e.Epoch {
+		return nil
+	}
+	for i := range e.Batches {
+		if e.Batches[i].FirstSeq == firstSeq && e.Batches[i].LastSeq == lastSeq {
+			return &e.Batches[i]
+		}
+	}
+	return nil
+}
+
+// ProducerState tracks the idempotent producers of one partition. It is not
+// safe for concurrent use, the owning PartitionLog serializes access.
+type ProducerState struct {
+	dir       string
+	producers map[int64]*ProducerStateEntry
+}
+
+func newProducerEntry(producerID int64, epoch int16) *ProducerStateEntry {
+	return &ProducerStateEntry{ProducerID: producerID, Epoch: epoch, LastTimestamp: -1, CurrentTxnFirstOffset: -1, CoordinatorEpoch: -1}
+}
+
+func newProducerState(dir string) *ProducerState {
+	return &ProducerState{dir: dir, producers: make(map[int64]*ProducerStateEntry)}
+}
+
+func (s *ProducerState) Entry(producerID int64) (ProducerStateEntry, bool) {
+	entry, ok := s.producers[producerID]
+	if !ok {
+		return ProducerStateEntry{}, false
+	}
+	return *entry, true
+}
+
+// inSequence reports whether next directly follows last, sequences wrap around
+// after math.MaxInt32
+func inSequence(last int32, next int32) bool {
+	return next == last+1 || (last == math.MaxInt32 && next == 0)
+}
+
+// check validates a batch against the producer state. A batch that was already
+// written comes back as its retained copy instead of an error.
+func (s *ProducerState) check(batch RecordBatch) (*ProducerBatch, error) {
+	producerID := batch.ProducerID()
+	if producerID < 0 {
+		return nil, nil
+	}
+
+	entry, ok := s.producers[producerID]
+	if !ok {
+		// The producer is new to this partition or its state expired, like
+		// Kafka any sequence is taken as the starting point
+		return nil, nil
+	}
+
+	if duplicate := entry.duplicateOf(batch.ProducerEpoch(), batch.BaseSequence(), batch.LastSequence()); duplicate != nil {
+		return duplicate, nil
+	}
+
+	switch {
+	case batch.ProducerEpoch() < entry.Epoch:
+		return nil, ErrInvalidProducerEpoch
+	case batch.BaseSequence() < 0:
+		// Markers and coordinator writes carry no sequence, only the epoch counts
+	case batch.ProducerEpoch() > entry.Epoch:
+		// A bumped epoch restarts the sequence
+		if batch.BaseSequence() != 0 {
+			return nil, ErrOutOfOrderSequence
+		}
+	case !inSequence(entry.lastSeq(), batch.BaseSequence()):
+		return nil, ErrOutOfOrderSequence
+	}
+	return nil, nil
+}
+
+// entryFor returns the state of the producer of batch, moving it to the epoch
+// of the batch
+func (s *ProducerState) entryFor(batch RecordBatch) *ProducerStateEntry {
+	entry, ok := s.producers[batch.ProducerID()]
+	if !ok {
+		entry = newProducerEntry(batch.ProducerID(), batch.ProducerEpoch())
+		s.producers[batch.ProducerID()] = entry
+	}
+	if batch.ProducerEpoch() != entry.Epoch {
+		entry.Epoch = batch.ProducerEpoch()
+		entry.Batches = nil
+	}
+	entry.LastTimestamp = batch.MaxTimestamp()
+	return entry
+}
+
+// update records a data batch written at baseOffset, batches without a
+// producer id are ignored
+func (s *ProducerState) update(batch RecordBatch, baseOffset int64) {
+	if batch.ProducerID() < 0 {
+		return
+	}
+	entry := s.entryFor(batch)
+
+	if batch.IsTransactional() && entry.CurrentTxnFirstOffset < 0 {
+		entry.CurrentTxnFirstOffset = baseOffset
+	}
+	if batch.BaseSequence() < 0 {
+		return
+	}
+
+	offsetDelta := int32(batch.NextOffset() - 1 - batch.BaseOffset())
+	entry.Batches = append(entry.Batches, ProducerBatch{
+		FirstSeq:    batch.BaseSequence(),
+		LastSeq:     batch.LastSequence(),
+		LastOffset:  baseOffset + int64(offsetDelta),
+		OffsetDelta: offsetDelta,
+		Timestamp:   batch.MaxTimestamp(),
+	})
+	if len(entry.Batches) > producerBatchesToRetain {
+		entry.Batches = entry.Batches[len(entry.Batches)-producerBatchesToRetain:]
+	}
+}
+
+// completeTxn applies a transaction marker written at offset and returns the
+// aborted transaction it closes, if any
+func (s *ProducerState) completeTxn(marker RecordBatch, offset int64, coordinatorEpoch int32) (AbortedTxn, bool) {
+	entry := s.entryFor(marker)
+	entry.CoordinatorEpoch = coordinatorEpoch
+
+	firstOffset := entry.CurrentTxnFirstOffset
+	entry.CurrentTxnFirstOffset = -1
+	if marker.IsCommit() || firstOffset < 0 {
+		return AbortedTxn{}, false
+	}
+	return AbortedTxn{ProducerID: entry.ProducerID, FirstOffset: firstOffset, LastOffset: offset}, true
+}
+
+// firstUnstableOffset is the first offset of the oldest open transaction, -1
+// when no transaction is open
+func (s *ProducerState) firstUnstableOffset() int64 {
+	first := int64(-1)
+	for _, entry := range s.producers {
+		if entry.CurrentTxnFirstOffset >= 0 && (first < 0 || entry.CurrentTxnFirstOffset < first) {
+			first = entry.CurrentTxnFirstOffset
+		}
+	}
+	return first
+}
+
+// expire drops producers that have not written since before now minus
+// ProducerIDExpiration, producers in the middle of a transaction are kept
+func (s *ProducerState) expire(now time.Time) {
+	cutoff := now.Add(-ProducerIDExpiration).UnixMilli()
+	for id, entry := range s.producers {
+		if entry.CurrentTxnFirstOffset < 0 && entry.LastTimestamp < cutoff {
+			delete(s.producers, id)
+		}
+	}
+}
+
+// Producer snapshot (version 1), the layout Kafka uses for <offset>.snapshot files
+// 00 01        // version
+// xx xx xx xx  // crc (CRC-32C of everything after it)
+// 00 00 00 01  // producer entries count
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 00 00 00 04  // last_sequence
+// 00 00 00 00 00 00 00 09  // last_offset
+// 00 00 00 04  // offset_delta
+// 00 00 01 8f ...  // timestamp
+// ff ff ff ff  // coordinator_epoch
+// ff ff ff ff ff ff ff ff  // current_txn_first_offset
+//
+// Only the last batch of every producer is kept, like Kafka does, a producer
+// that never wrote with a sequence has a last_sequence and last_offset of -1
+
+func snapshotPath(dir string, offset int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", offset, producerSnapshotSuffix))
+}
+
+// snapshotOffsets lists the offsets of the snapshots in dir, oldest first
+func snapshotOffsets(dir string) []int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var offsets []int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, producerSnapshotSuffix) {
+			continue
+		}
+		offset, err := strconv.ParseInt(strings.TrimSuffix(name, producerSnapshotSuffix), 10, 64)
+		if err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// writeSnapshot persists the producer state as of offset and removes all but
+// the latest two snapshots
+func (s *ProducerState) writeSnapshot(offset int64) error {
+	entries := make([]*ProducerStateEntry, 0, len(s.producers))
+	for _, entry := range s.producers {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ProducerID < entries[j].ProducerID })
+
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, uint32(len(entries)))
+	for _, entry := range entries {
+		last := ProducerBatch{FirstSeq: -1, LastSeq: -1, LastOffset: -1}
+		if len(entry.Batches) > 0 {
+			last = entry.Batches[len(entry.Batches)-1]
+		}
+		body = binary.BigEndian.AppendUint64(body, uint64(entry.ProducerID))
+		body = binary.BigEndian.AppendUint16(body, uint16(entry.Epoch))
+		body = binary.BigEndian.AppendUint32(body, uint32(last.LastSeq))
+		body = binary.BigEndian.AppendUint64(body, uint64(last.LastOffset))
+		body = binary.BigEndian.AppendUint32(body, uint32(last.OffsetDelta))
+		body = binary.BigEndian.AppendUint64(body, uint64(entry.LastTimestamp))
+		body = binary.BigEndian.AppendUint32(body, uint32(entry.CoordinatorEpoch))
+		body = binary.BigEndian.AppendUint64(body, uint64(entry.CurrentTxnFirstOffset))
+	}
+
+	var out []byte
+	out = binary.BigEndian.AppendUint16(out, producerSnapshotVersion)
+	out = binary.BigEndian.AppendUint32(out, crc32.Checksum(body, castagnoliTable))
+	out = append(out, body...)
+
+	// Written aside and renamed so a crash never leaves half a snapshot behind
+	path := snapshotPath(s.dir, offset)
+	if err := os.WriteFile(path+".tmp", out, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	offsets := snapshotOffsets(s.dir)
+	for i := 0; i < len(offsets)-2; i++ {
+		os.Remove(snapshotPath(s.dir, offsets[i]))
+	}
+	return nil
+}
+
+// loadSnapshot restores the latest valid snapshot at or below logEnd and
+// returns its offset, 0 when there is none. Snapshots past the end of the log
+// are left over from a truncated tail and are removed.
+func (s *ProducerState) loadSnapshot(logEnd int64) int64 {
+	offsets := snapshotOffsets(s.dir)
+	for i := len(offsets) - 1; i >= 0; i-- {
+		path := snapshotPath(s.dir, offsets[i])
+		if offsets[i] > logEnd {
+			os.Remove(path)
+			continue
+		}
+
+		producers, err := readSnapshot(path)
+		if err != nil {
+			slog.Warn("Ignoring a producer snapshot", "file", path, "error", err)
+			os.Remove(path)
+			continue
+		}
+		s.producers = producers
+		return offsets[i]
+	}
+	return 0
+}
+
+func readSnapshot(path string) (map[int64]*ProducerStateEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 10 {
+		return nil, fmt.Errorf("snapshot too short")
+	}
+	if version := binary.BigEndian.Uint16(data[0:2]); version != producerSnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if crc := binary.BigEndian.Uint32(data[2:6]); crc != crc32.Checksum(data[6:], castagnoliTable) {
+		return nil, fmt.Errorf("snapshot crc mismatch")
+	}
+
+	const entrySize = 8 + 2 + 4 + 8 + 4 + 8 + 4 + 8
+	count := int(binary.BigEndian.Uint32(data[6:10]))
+	if len(data) != 10+count*entrySize {
+		return nil, fmt.Errorf("snapshot holds %d bytes for %d entries", len(data)-10, count)
+	}
+
+	producers := make(map[int64]*ProducerStateEntry, count)
+	for i := 0; i < count; i++ {
+		data := data[10+i*entrySize:]
+		producerID := int64(binary.BigEndian.Uint64(data[0:8]))
+		lastSeq := int32(binary.BigEndian.Uint32(data[10:14]))
+		offsetDelta := int32(binary.BigEndian.Uint32(data[22:26]))
+
+		entry := newProducerEntry(producerID, int16(binary.BigEndian.Uint16(data[8:10])))
+		entry.LastTimestamp = int64(binary.BigEndian.Uint64(data[26:34]))
+		entry.CoordinatorEpoch = int32(binary.BigEndian.Uint32(data[34:38]))
+		entry.CurrentTxnFirstOffset = int64(binary.BigEndian.Uint64(data[38:46]))
+		if lastSeq >= 0 {
+			entry.Batches = []ProducerBatch{{
+				FirstSeq:    int32((int64(lastSeq) - int64(offsetDelta) + math.MaxInt32 + 1) % (math.MaxInt32 + 1)),
+				LastSeq:     lastSeq,
+				LastOffset:  int64(binary.BigEndian.Uint64(data[14:22])),
+				OffsetDelta: offsetDelta,
+				Timestamp:   entry.LastTimestamp,
+			}}
+		}
+		producers[producerID] = entry
+	}
+	return producers, nil
+}
@@ -0,0 +1,160 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// producerBatch builds a batch of count records as an idempotent producer sends it
+func producerBatch(producerID int64, epoch int16, baseSequence int32, count int) []byte {
+	return encodeProducerBatch(producerID, epoch, baseSequence, count, 0)
+}
+
+// txnBatch builds a batch of count records sent by a transactional producer
+func txnBatch(producerID int64, epoch int16, baseSequence int32, count int) []byte {
+	return encodeProducerBatch(producerID, epoch, baseSequence, count, TransactionalAttribute)
+}
+
+func encodeProducerBatch(producerID int64, epoch int16, baseSequence int32, count int, attributes uint16) []byte {
+	records := make([]RecordData, count)
+	for i := range records {
+		records[i] = RecordData{Value: []byte("v")}
+	}
+	stream := EncodeKeyedRecordBatch(0, time.Now().UnixMilli(), records)
+	binary.BigEndian.PutUint16(stream[21:23], attributes)
+	binary.BigEndian.PutUint64(stream[43:51], uint64(producerID))
+	binary.BigEndian.PutUint16(stream[51:53], uint16(epoch))
+	binary.BigEndian.PutUint32(stream[53:57], uint32(baseSequence))
+	binary.BigEndian.PutUint32(stream[17:21], crc32.Checksum(stream[21:], castagnoliTable))
+	return stream
+}
+
+func TestAppendBatchSequences(t *testing.T) {
+	log, _, err := OpenPartitionLog(t.TempDir(), "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+
+	if offset, err := log.AppendBatch(producerBatch(1000, 0, 0, 3)); err != nil || offset != 0 {
+		t.Fatalf("Expected the first batch at offset 0, got %d, err %v", offset, err)
+	}
+	if offset, err := log.AppendBatch(producerBatch(1000, 0, 3, 2)); err != nil || offset != 3 {
+		t.Fatalf("Expected the second batch at offset 3, got %d, err %v", offset, err)
+	}
+
+	// A retry of an earlier batch is answered with its original offset
+	if offset, err := log.AppendBatch(producerBatch(1000, 0, 0, 3)); err != nil || offset != 0 {
+		t.Errorf("Expected the retried batch to map to offset 0, got %d, err %v", offset, err)
+	}
+	if _, err := log.AppendBatch(producerBatch(1000, 0, 7, 1)); err != ErrOutOfOrderSequence {
+		t.Errorf("Expected a sequence gap to fail, got %v", err)
+	}
+	if _, err := log.AppendBatch(producerBatch(1000, 1, 5, 1)); err != ErrOutOfOrderSequence {
+		t.Errorf("Expected a new epoch to start at sequence 0, got %v", err)
+	}
+	if offset, err := log.AppendBatch(producerBatch(1000, 1, 0, 1)); err != nil || offset != 5 {
+		t.Errorf("Expected the bumped epoch to write at offset 5, got %d, err %v", offset, err)
+	}
+	if _, err := log.AppendBatch(producerBatch(1000, 0, 5, 1)); err != ErrInvalidProducerEpoch {
+		t.Errorf("Expected the old epoch to be fenced, got %v", err)
+	}
+
+	corrupt := producerBatch(-1, -1, -1, 1)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if _, err := log.AppendBatch(corrupt); err != ErrCorruptBatch {
+		t.Errorf("Expected a crc mismatch to be rejected, got %v", err)
+	}
+	if _, err := log.AppendBatch(append(producerBatch(-1, -1, -1, 1), producerBatch(-1, -1, -1, 1)...)); err != ErrInvalidBatch {
+		t.Errorf("Expected two batches to be rejected, got %v", err)
+	}
+}
+
+func TestProducerStateSurvivesReopen(t *testing.T) {
+	logDir := t.TempDir()
+	log, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+	log.AppendBatch(producerBatch(7, 2, 0, 2))
+	log.AppendBatch(producerBatch(8, 0, 0, 1))
+	if err := log.Close(); err != nil {
+		t.Fatalf("Failed to close the log: %v", err)
+	}
+	// Written after the snapshot, only known from replaying the log
+	log.AppendBatch(producerBatch(7, 2, 2, 2))
+
+	reopened, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen the log: %v", err)
+	}
+	entry, ok := reopened.Producer(7)
+	if !ok || entry.Epoch != 2 || len(entry.Batches) != 2 || entry.Batches[1].LastSeq != 3 || entry.Batches[1].LastOffset != 4 {
+		t.Fatalf("Unexpected producer state after reopening: %+v", entry)
+	}
+	if offset, err := reopened.AppendBatch(producerBatch(7, 2, 2, 2)); err != nil || offset != 3 {
+		t.Errorf("Expected the retry to map to offset 3, got %d, err %v", offset, err)
+	}
+	if _, err := reopened.AppendBatch(producerBatch(8, 0, 2, 1)); err != ErrOutOfOrderSequence {
+		t.Errorf("Expected the snapshot to restore the sequence of producer 8, got %v", err)
+	}
+}
+
+func TestTransactionsAndReadCommitted(t *testing.T) {
+	logDir := t.TempDir()
+	log, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to open the log: %v", err)
+	}
+
+	log.AppendBatch(producerBatch(-1, -1, -1, 1)) // offset 0
+	log.AppendBatch(txnBatch(1, 0, 0, 2))         // offsets 1-2, aborted below
+	log.AppendBatch(txnBatch(2, 0, 0, 1))         // offset 3, committed below
+	if lso := log.LastStableOffset(); lso != 1 {
+		t.Fatalf("Expected the open transactions to hold the last stable offset at 1, got %d", lso)
+	}
+	if data, _ := log.Read(0, 1<<20, true); len(data.Records) == 0 || data.HighWatermark != 4 || data.LastStableOffset != 1 {
+		t.Errorf("Expected read_committed to stop before the open transactions, got %+v", data)
+	}
+
+	if offset, err := log.AppendMarker(1, 0, false, 0); err != nil || offset != 4 {
+		t.Fatalf("Expected the abort marker at offset 4, got %d, err %v", offset, err)
+	}
+	if lso := log.LastStableOffset(); lso != 3 {
+		t.Errorf("Expected the last stable offset to move to the committed producer's transaction, got %d", lso)
+	}
+	log.AppendMarker(2, 0, true, 0) // offset 5
+	if lso := log.LastStableOffset(); lso != 6 {
+		t.Errorf("Expected the last stable offset to reach the end of the log, got %d", lso)
+	}
+	if _, err := log.AppendMarker(2, -1, true, 0); err != ErrInvalidProducerEpoch {
+		t.Errorf("Expected a marker with an old epoch to be fenced, got %v", err)
+	}
+
+	data, err := log.Read(1, 1<<20, true)
+	if err != nil || len(data.Aborted) != 1 || data.Aborted[0] != (AbortedTxn{ProducerID: 1, FirstOffset: 1, LastOffset: 4, LastStableOffset: 3}) {
+		t.Errorf("Expected the aborted transaction of producer 1, got %+v, err %v", data.Aborted, err)
+	}
+	batches, _ := DecodeRecordBatches(data.Records)
+	if len(batches) != 4 || !batches[2].IsControl() || batches[2].IsCommit() || !batches[3].IsCommit() {
+		t.Errorf("Expected the data batches followed by the abort and commit markers, got %d batches", len(batches))
+	}
+	if _, err := log.Read(7, 1<<20, false); err != ErrOffsetOutOfRange {
+		t.Errorf("Expected reading past the end to fail, got %v", err)
+	}
+
+	// A transaction left open survives through the snapshot, aborted ones through the index
+	log.AppendBatch(txnBatch(1, 1, 0, 1)) // offset 6
+	log.Close()
+	reopened, _, err := OpenPartitionLog(logDir, "events", 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen the log: %v", err)
+	}
+	if lso := reopened.LastStableOffset(); lso != 6 {
+		t.Errorf("Expected the open transaction to hold the last stable offset at 6, got %d", lso)
+	}
+	if data, _ := reopened.Read(0, 1<<20, true); len(data.Aborted) != 1 {
+		t.Errorf("Expected the aborted transaction to be reloaded, got %+v", data.Aborted)
+	}
+}
@@ -0,0 +1,69 @@
+package file_metadata
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+)
+
+// Transaction index entry (version 0), the layout of Kafka's .txnindex files
+// 00 00        // version
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00 00 00 00 00 00 05  // first_offset
+// 00 00 00 00 00 00 00 09  // last_offset
+// 00 00 00 00 00 00 00 0a  // last_stable_offset
+
+const txnIndexEntrySize = 2 + 8 + 8 + 8 + 8
+
+func txnIndexPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, ".log") + ".txnindex"
+}
+
+func encodeTxnIndexEntry(aborted AbortedTxn) []byte {
+	out := binary.BigEndian.AppendUint16(nil, 0)
+	out = binary.BigEndian.AppendUint64(out, uint64(aborted.ProducerID))
+	out = binary.BigEndian.AppendUint64(out, uint64(aborted.FirstOffset))
+	out = binary.BigEndian.AppendUint64(out, uint64(aborted.LastOffset))
+	return binary.BigEndian.AppendUint64(out, uint64(aborted.LastStableOffset))
+}
+
+func appendTxnIndex(path string, aborted AbortedTxn) error {
+	return append_bin(path, encodeTxnIndexEntry(aborted))
+}
+
+// readTxnIndex loads the aborted transactions of a segment. Entries whose
+// marker is past logEnd were cut off with the tail of the log and are dropped
+// from the file as well.
+func readTxnIndex(path string, logEnd int64) ([]AbortedTxn, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var aborted []AbortedTxn
+	valid := 0
+	for offset := 0; offset+txnIndexEntrySize <= len(data); offset += txnIndexEntrySize {
+		entry := data[offset : offset+txnIndexEntrySize]
+		txn := AbortedTxn{
+			ProducerID:       int64(binary.BigEndian.Uint64(entry[2:10])),
+			FirstOffset:      int64(binary.BigEndian.Uint64(entry[10:18])),
+			LastOffset:       int64(binary.BigEndian.Uint64(entry[18:26])),
+			LastStableOffset: int64(binary.BigEndian.Uint64(entry[26:34])),
+		}
+		if txn.LastOffset >= logEnd {
+			break
+		}
+		aborted = append(aborted, txn)
+		valid = offset + txnIndexEntrySize
+	}
+
+	if valid < len(data) {
+		if err := os.Truncate(path, int64(valid)); err != nil {
+			return nil, err
+		}
+	}
+	return aborted, nil
+}
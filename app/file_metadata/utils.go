@@ -27,7 +27,7 @@ func PrettyPrintClusterMetaData(cm ClusterMetaData) {
 			fmt.Printf("    TimestampDelta: %d\n", record.timestampDelta)
 			fmt.Printf("    KeySize: %d\n", record.keySize)
 			fmt.Printf("    ValueType: %d\n", record.ValueType)
-			fmt.Printf("    Key: %v\n", record.key)
+			fmt.Printf("    Key: %v\n", record.Key)
 			if topic, ok := record.Value.(TopicValue); ok {
 				fmt.Printf("    Value: %v uuid: %s\n", topic.TopicName, topic.TopicId.String())
 			} else {
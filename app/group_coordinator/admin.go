@@ -0,0 +1,223 @@
+package group_coordinator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"toy_kafka/app/file_metadata"
+)
+
+const (
+	ErrorCodeNonEmptyGroup = 68
+)
+
+const (
+	GroupTypeClassic  = "classic"
+	GroupTypeConsumer = "consumer"
+)
+
+type GroupOverview struct {
+	GroupID      string
+	ProtocolType string
+	State        string
+	Type         string
+}
+
+// ListGroups lists every group the coordinator knows, including groups that
+// only have committed offsets. Empty filters match every group, both filters
+// are case insensitive.
+func (gc *GroupCoordinator) ListGroups(states []string, types []string) []GroupOverview {
+	matches := func(filter []string, val string) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, f := range filter {
+			if strings.EqualFold(f, val) {
+				return true
+			}
+		}
+		return false
+	}
+
+	gc.mu.Lock()
+	overviews := make(map[string]GroupOverview)
+	for id, group := range gc.groups {
+		group.mu.Lock()
+		overviews[id] = GroupOverview{GroupID: id, ProtocolType: group.protocolType, State: group.state.String(), Type: GroupTypeClassic}
+		group.mu.Unlock()
+	}
+	for id, group := range gc.consumerGroups {
+		overviews[id] = GroupOverview{GroupID: id, ProtocolType: GroupTypeConsumer, State: group.State().String(), Type: GroupTypeConsumer}
+	}
+	gc.mu.Unlock()
+
+	// Offsets committed from outside of any group, e.g. by admin tools, make
+	// an empty simple group
+	gc.offsetsMu.RLock()
+	for id := range gc.offsets {
+		if _, ok := overviews[id]; !ok {
+			overviews[id] = GroupOverview{GroupID: id, State: Empty.String(), Type: GroupTypeClassic}
+		}
+	}
+	gc.offsetsMu.RUnlock()
+
+	var result []GroupOverview
+	for _, overview := range overviews {
+		if matches(states, overview.State) && matches(types, overview.Type) {
+			result = append(result, overview)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GroupID < result[j].GroupID })
+	return result
+}
+
+type GroupMemberDescription struct {
+	MemberID        string
+	GroupInstanceID string
+	ClientID        string
+	ClientHost      string
+	Metadata        []byte
+	Assignment      []byte
+}
+
+type GroupDescription struct {
+	ErrorCode    int16
+	ErrorMessage string
+	GroupID      string
+	State        string
+	ProtocolType string
+	Protocol     string
+	Members      []GroupMemberDescription
+}
+
+// DescribeGroups describes classic groups. Unknown groups and groups running
+// the consumer protocol come back Dead with GROUP_ID_NOT_FOUND set, older
+// DescribeGroups versions drop the error and only report the Dead state.
+func (gc *GroupCoordinator) DescribeGroups(groupIDs []string) []GroupDescription {
+	var descriptions []GroupDescription
+	for _, id := range groupIDs {
+		gc.mu.Lock()
+		group, ok := gc.groups[id]
+		_, consumer := gc.consumerGroups[id]
+		gc.mu.Unlock()
+
+		switch {
+		case ok:
+			descriptions = append(descriptions, group.describe())
+		case consumer:
+			descriptions = append(descriptions, GroupDescription{GroupID: id, State: Dead.String(), ErrorCode: ErrorCodeGroupIDNotFound, ErrorMessage: fmt.Sprintf("Group %s is not a classic group.", id)})
+		case len(gc.FetchOffsets(id)) > 0:
+			descriptions = append(descriptions, GroupDescription{GroupID: id, State: Empty.String(), ErrorCode: ErrorCodeNone})
+		default:
+			descriptions = append(descriptions, GroupDescription{GroupID: id, State: Dead.String(), ErrorCode: ErrorCodeGroupIDNotFound, ErrorMessage: fmt.Sprintf("Group %s not found.", id)})
+		}
+	}
+	return descriptions
+}
+
+// describe reports the members in join order, their metadata and assignment
+// are only meaningful once the group is stable
+func (g *Group) describe() GroupDescription {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	description := GroupDescription{
+		ErrorCode:    ErrorCodeNone,
+		GroupID:      g.ID,
+		State:        g.state.String(),
+		ProtocolType: g.protocolType,
+	}
+	if g.state == Stable {
+		description.Protocol = g.protocolName
+	}
+	for _, id := range g.memberOrder {
+		member, ok := g.members[id]
+		if !ok {
+			continue
+		}
+		memberDescription := GroupMemberDescription{
+			MemberID:        member.ID,
+			GroupInstanceID: member.GroupInstanceID,
+			ClientID:        member.ClientID,
+			ClientHost:      member.ClientHost,
+		}
+		if g.state == Stable {
+			memberDescription.Metadata = member.metadata(g.protocolName)
+			memberDescription.Assignment = member.Assignment
+		}
+		description.Members = append(description.Members, memberDescription)
+	}
+	return description
+}
+
+// DeleteGroups removes empty groups together with their committed offsets, it
+// returns an error code per group
+func (gc *GroupCoordinator) DeleteGroups(groupIDs []string) []int16 {
+	codes := make([]int16, len(groupIDs))
+	for i, id := range groupIDs {
+		codes[i] = gc.deleteGroup(id)
+	}
+	return codes
+}
+
+func (gc *GroupCoordinator) deleteGroup(id string) int16 {
+	if id == "" {
+		return ErrorCodeInvalidGroupID
+	}
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	found := false
+	if group, ok := gc.groups[id]; ok {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+		if group.state != Empty && group.state != Dead {
+			return ErrorCodeNonEmptyGroup
+		}
+		found = true
+	}
+	if group, ok := gc.consumerGroups[id]; ok {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+		if len(group.members) > 0 {
+			return ErrorCodeNonEmptyGroup
+		}
+		found = true
+	}
+
+	gc.offsetsMu.Lock()
+	defer gc.offsetsMu.Unlock()
+
+	offsets := gc.offsets[id]
+	if !found && len(offsets) == 0 {
+		return ErrorCodeGroupIDNotFound
+	}
+
+	if len(offsets) > 0 {
+		if len(gc.offsetLogs) == 0 {
+			return ErrorCodeCoordinatorNotAvailable
+		}
+		records := make([]file_metadata.RecordData, 0, len(offsets))
+		for tp := range offsets {
+			records = append(records, file_metadata.RecordData{Key: encodeOffsetCommitKey(id, tp)})
+		}
+		log := gc.offsetLogs[offsetsPartitionFor(id, len(gc.offsetLogs))]
+		if _, err := log.Append(records); err != nil {
+			gc.Logger.Error("Failed to delete the offsets of a group", "group_id", id, "error", err)
+			return ErrorCodeUnknownServerError
+		}
+		delete(gc.offsets, id)
+	}
+
+	if group, ok := gc.groups[id]; ok {
+		group.state = Dead
+		delete(gc.groups, id)
+	}
+	if group, ok := gc.consumerGroups[id]; ok {
+		group.dead = true
+		delete(gc.consumerGroups, id)
+	}
+	return ErrorCodeNone
+}
@@ -0,0 +1,71 @@
+package group_coordinator
+
+import "testing"
+
+func TestListAndDescribeGroups(t *testing.T) {
+	gc := newTestCoordinator()
+	if err := gc.LoadOffsets(t.TempDir(), 1); err != nil {
+		t.Fatalf("Failed to load offsets: %v", err)
+	}
+
+	member := joinDynamic(t, gc)
+	gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: member.GenerationID, MemberID: member.MemberID,
+		Assignments: []SyncGroupAssignment{{MemberID: member.MemberID, Assignment: []byte("all")}}})
+	gc.CommitOffsets(CommitOffsetsRequest{GroupID: "simple", GenerationID: -1,
+		Offsets: []OffsetCommit{{TopicPartition: TopicPartition{Topic: "foo"}, OffsetAndMetadata: OffsetAndMetadata{Offset: 1}}}})
+
+	groups := gc.ListGroups(nil, nil)
+	if len(groups) != 2 || groups[0].GroupID != "group" || groups[0].State != "Stable" || groups[1].GroupID != "simple" || groups[1].State != "Empty" {
+		t.Fatalf("Unexpected groups %+v", groups)
+	}
+	if groups := gc.ListGroups([]string{"stable"}, []string{"Classic"}); len(groups) != 1 || groups[0].GroupID != "group" {
+		t.Errorf("Expected the filters to match case insensitively, got %+v", groups)
+	}
+	if groups := gc.ListGroups(nil, []string{GroupTypeConsumer}); len(groups) != 0 {
+		t.Errorf("Expected no consumer groups, got %+v", groups)
+	}
+
+	descriptions := gc.DescribeGroups([]string{"group", "missing"})
+	described := descriptions[0]
+	if described.ErrorCode != ErrorCodeNone || described.Protocol != "range" || len(described.Members) != 1 ||
+		string(described.Members[0].Metadata) != "\x01" || string(described.Members[0].Assignment) != "all" {
+		t.Errorf("Unexpected description %+v", described)
+	}
+	if descriptions[1].ErrorCode != ErrorCodeGroupIDNotFound || descriptions[1].State != "Dead" {
+		t.Errorf("Expected an unknown group to be Dead, got %+v", descriptions[1])
+	}
+}
+
+func TestDeleteGroups(t *testing.T) {
+	logDir := t.TempDir()
+	gc := newTestCoordinator()
+	if err := gc.LoadOffsets(logDir, 1); err != nil {
+		t.Fatalf("Failed to load offsets: %v", err)
+	}
+
+	member := joinDynamic(t, gc)
+	gc.CommitOffsets(CommitOffsetsRequest{GroupID: "simple", GenerationID: -1,
+		Offsets: []OffsetCommit{{TopicPartition: TopicPartition{Topic: "foo"}, OffsetAndMetadata: OffsetAndMetadata{Offset: 1}}}})
+
+	codes := gc.DeleteGroups([]string{"group", "simple", "missing"})
+	if codes[0] != ErrorCodeNonEmptyGroup || codes[1] != ErrorCodeNone || codes[2] != ErrorCodeGroupIDNotFound {
+		t.Fatalf("Unexpected delete codes %v", codes)
+	}
+
+	gc.LeaveGroup("group", []LeaveGroupMember{{MemberID: member.MemberID}})
+	if codes := gc.DeleteGroups([]string{"group"}); codes[0] != ErrorCodeNone {
+		t.Errorf("Expected the empty group to be deleted, got %d", codes[0])
+	}
+	if groups := gc.ListGroups(nil, nil); len(groups) != 0 {
+		t.Errorf("Expected no groups left, got %+v", groups)
+	}
+
+	// The offsets tombstones are replayed on reload
+	reloaded := newTestCoordinator()
+	if err := reloaded.LoadOffsets(logDir, 1); err != nil {
+		t.Fatalf("Failed to reload offsets: %v", err)
+	}
+	if offsets := reloaded.FetchOffsets("simple"); len(offsets) != 0 {
+		t.Errorf("Expected the deleted offsets to stay deleted, got %+v", offsets)
+	}
+}
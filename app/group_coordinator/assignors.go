@@ -0,0 +1,200 @@
+package group_coordinator
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Assignment holds the partitions of every topic handed to a member
+type Assignment map[uuid.UUID][]int32
+
+func (a Assignment) count() int {
+	total := 0
+	for _, partitions := range a {
+		total += len(partitions)
+	}
+	return total
+}
+
+func (a Assignment) contains(topicID uuid.UUID, partition int32) bool {
+	for _, p := range a[topicID] {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Assignment) add(topicID uuid.UUID, partition int32) {
+	a[topicID] = append(a[topicID], partition)
+}
+
+// filter keeps the partitions keep returns true for, topics left empty are dropped
+func (a Assignment) filter(keep func(topicID uuid.UUID, partition int32) bool) Assignment {
+	out := make(Assignment)
+	for topicID, partitions := range a {
+		for _, partition := range partitions {
+			if keep(topicID, partition) {
+				out.add(topicID, partition)
+			}
+		}
+	}
+	return out
+}
+
+func (a Assignment) intersect(other Assignment) Assignment {
+	return a.filter(other.contains)
+}
+
+func (a Assignment) minus(other Assignment) Assignment {
+	return a.filter(func(topicID uuid.UUID, partition int32) bool { return !other.contains(topicID, partition) })
+}
+
+func (a Assignment) equal(other Assignment) bool {
+	return a.count() == other.count() && a.minus(other).count() == 0
+}
+
+// sorted returns the topics in a stable order with their partitions ascending
+func (a Assignment) sorted() []uuid.UUID {
+	topicIDs := make([]uuid.UUID, 0, len(a))
+	for topicID, partitions := range a {
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		topicIDs = append(topicIDs, topicID)
+	}
+	sort.Slice(topicIDs, func(i, j int) bool { return topicIDs[i].String() < topicIDs[j].String() })
+	return topicIDs
+}
+
+type topicIDPartition struct {
+	topicID   uuid.UUID
+	partition int32
+}
+
+// AssignmentSpec is what an assignor works from: the topics each member is
+// subscribed to, the partition count of those topics and the last target
+type AssignmentSpec struct {
+	Subscriptions map[string][]uuid.UUID // member id -> subscribed topic ids
+	Partitions    map[uuid.UUID]int32
+	Previous      map[string]Assignment
+}
+
+// membersOf returns the members subscribed to a topic, sorted by member id
+func (spec AssignmentSpec) membersOf(topicID uuid.UUID) []string {
+	var members []string
+	for memberID, topicIDs := range spec.Subscriptions {
+		for _, id := range topicIDs {
+			if id == topicID {
+				members = append(members, memberID)
+				break
+			}
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (spec AssignmentSpec) topics() []uuid.UUID {
+	topicIDs := make([]uuid.UUID, 0, len(spec.Partitions))
+	for topicID := range spec.Partitions {
+		topicIDs = append(topicIDs, topicID)
+	}
+	sort.Slice(topicIDs, func(i, j int) bool { return topicIDs[i].String() < topicIDs[j].String() })
+	return topicIDs
+}
+
+// PartitionAssignor computes the target assignment of a consumer group on the broker
+type PartitionAssignor interface {
+	Name() string
+	Assign(spec AssignmentSpec) map[string]Assignment
+}
+
+func newAssignments(spec AssignmentSpec) map[string]Assignment {
+	assignments := make(map[string]Assignment, len(spec.Subscriptions))
+	for memberID := range spec.Subscriptions {
+		assignments[memberID] = make(Assignment)
+	}
+	return assignments
+}
+
+// RangeAssignor splits every topic into contiguous ranges over the members
+// subscribed to it, the first members get one partition more when it does not
+// divide evenly
+type RangeAssignor struct{}
+
+func (RangeAssignor) Name() string { return "range" }
+
+func (RangeAssignor) Assign(spec AssignmentSpec) map[string]Assignment {
+	assignments := newAssignments(spec)
+	for _, topicID := range spec.topics() {
+		members := spec.membersOf(topicID)
+		if len(members) == 0 {
+			continue
+		}
+
+		partitions := spec.Partitions[topicID]
+		quota, extra := partitions/int32(len(members)), partitions%int32(len(members))
+		next := int32(0)
+		for i, memberID := range members {
+			count := quota
+			if int32(i) < extra {
+				count++
+			}
+			for p := next; p < next+count; p++ {
+				assignments[memberID].add(topicID, p)
+			}
+			next += count
+		}
+	}
+	return assignments
+}
+
+// UniformAssignor spreads all partitions evenly over the members while keeping
+// as many partitions as possible where the previous target put them
+type UniformAssignor struct{}
+
+func (UniformAssignor) Name() string { return "uniform" }
+
+func (UniformAssignor) Assign(spec AssignmentSpec) map[string]Assignment {
+	assignments := newAssignments(spec)
+	if len(assignments) == 0 {
+		return assignments
+	}
+
+	total := int32(0)
+	for _, partitions := range spec.Partitions {
+		total += partitions
+	}
+	quota := int((total + int32(len(assignments)) - 1) / int32(len(assignments)))
+
+	var unassigned []topicIDPartition
+	for _, topicID := range spec.topics() {
+		subscribed := spec.membersOf(topicID)
+		for p := int32(0); p < spec.Partitions[topicID]; p++ {
+			// Stay with the previous owner while it is still subscribed and under quota
+			kept := false
+			for _, memberID := range subscribed {
+				if spec.Previous[memberID].contains(topicID, p) && assignments[memberID].count() < quota {
+					assignments[memberID].add(topicID, p)
+					kept = true
+					break
+				}
+			}
+			if !kept && len(subscribed) > 0 {
+				unassigned = append(unassigned, topicIDPartition{topicID, p})
+			}
+		}
+	}
+
+	// Everything else goes to the least loaded subscribed member
+	for _, tp := range unassigned {
+		var target string
+		for _, memberID := range spec.membersOf(tp.topicID) {
+			if target == "" || assignments[memberID].count() < assignments[target].count() {
+				target = memberID
+			}
+		}
+		assignments[target].add(tp.topicID, tp.partition)
+	}
+	return assignments
+}
@@ -0,0 +1,729 @@
+package group_coordinator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Member epochs a ConsumerGroupHeartbeat uses to leave the group, the static
+// variant keeps the member's partitions until its session expires
+const (
+	LeaveGroupMemberEpoch       = -1
+	LeaveGroupStaticMemberEpoch = -2
+)
+
+// Same defaults as Kafka's group.consumer.session.timeout.ms and
+// group.consumer.heartbeat.interval.ms
+const (
+	DefaultConsumerGroupSessionTimeout    = 45 * time.Second
+	DefaultConsumerGroupHeartbeatInterval = 5 * time.Second
+)
+
+type ConsumerGroupState int
+
+const (
+	ConsumerGroupEmpty ConsumerGroupState = iota
+	ConsumerGroupAssigning
+	ConsumerGroupReconciling
+	ConsumerGroupStable
+	ConsumerGroupDead
+)
+
+func (s ConsumerGroupState) String() string {
+	switch s {
+	case ConsumerGroupEmpty:
+		return "Empty"
+	case ConsumerGroupAssigning:
+		return "Assigning"
+	case ConsumerGroupReconciling:
+		return "Reconciling"
+	case ConsumerGroupStable:
+		return "Stable"
+	case ConsumerGroupDead:
+		return "Dead"
+	}
+	return "Unknown"
+}
+
+// TopicMetadata is what consumer groups need to know about a topic to resolve
+// subscriptions and assign its partitions
+type TopicMetadata struct {
+	ID         uuid.UUID
+	Name       string
+	Partitions int32
+	Internal   bool
+}
+
+type memberState int
+
+const (
+	memberStable               memberState = iota
+	memberUnrevokedPartitions              // waiting for the member to give up partitions
+	memberUnreleasedPartitions             // waiting for other members to give up partitions
+)
+
+type ConsumerGroupMember struct {
+	ID                   string
+	InstanceID           string // "" for dynamic members
+	RackID               string
+	ClientID             string
+	ClientHost           string
+	SubscribedTopicNames []string
+	SubscribedTopicRegex string
+	ServerAssignor       string
+	RebalanceTimeout     time.Duration
+
+	Epoch             int32
+	PreviousEpoch     int32
+	state             memberState
+	Assigned          Assignment // partitions the member owns
+	PendingRevocation Assignment // partitions the member was asked to give up
+
+	regex             *regexp.Regexp
+	assignmentChanged bool // the assignment goes out with the next response
+	lastSeen          time.Time
+	sessionTimer      *time.Timer
+	revocationTimer   *time.Timer
+}
+
+func (m *ConsumerGroupMember) subscribes(topic TopicMetadata) bool {
+	if contains(m.SubscribedTopicNames, topic.Name) {
+		return true
+	}
+	return m.regex != nil && !topic.Internal && m.regex.MatchString(topic.Name)
+}
+
+// ConsumerGroup is a group running the consumer protocol of KIP-848, the broker
+// computes the target assignment and every member converges to it through its
+// heartbeats. Every exported method takes the group lock, timers re-enter
+// through the same lock.
+type ConsumerGroup struct {
+	mu sync.Mutex
+	gc *GroupCoordinator
+
+	ID               string
+	epoch            int32
+	assignmentEpoch  int32
+	assignorName     string
+	members          map[string]*ConsumerGroupMember
+	staticMembers    map[string]string // instance id -> member id
+	targetAssignment map[string]Assignment
+	subscribedTopics map[string]TopicMetadata // what the target assignment was computed from
+	dead             bool
+}
+
+func newConsumerGroup(id string, gc *GroupCoordinator) *ConsumerGroup {
+	return &ConsumerGroup{
+		gc:               gc,
+		ID:               id,
+		members:          make(map[string]*ConsumerGroupMember),
+		staticMembers:    make(map[string]string),
+		targetAssignment: make(map[string]Assignment),
+		subscribedTopics: make(map[string]TopicMetadata),
+	}
+}
+
+func (g *ConsumerGroup) State() ConsumerGroupState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state()
+}
+
+func (g *ConsumerGroup) state() ConsumerGroupState {
+	switch {
+	case g.dead:
+		return ConsumerGroupDead
+	case len(g.members) == 0:
+		return ConsumerGroupEmpty
+	case g.epoch > g.assignmentEpoch:
+		return ConsumerGroupAssigning
+	}
+	for _, member := range g.members {
+		if member.Epoch != g.assignmentEpoch || member.state != memberStable {
+			return ConsumerGroupReconciling
+		}
+	}
+	return ConsumerGroupStable
+}
+
+type ConsumerGroupHeartbeatRequest struct {
+	GroupID              string
+	MemberID             string
+	MemberEpoch          int32
+	InstanceID           string
+	RackID               string
+	ClientID             string
+	ClientHost           string
+	RebalanceTimeout     time.Duration // 0 when unchanged
+	SubscribedTopicNames []string      // nil when unchanged
+	SubscribedTopicRegex *string       // nil when unchanged
+	ServerAssignor       *string       // nil when unchanged
+	OwnedPartitions      Assignment    // nil when unchanged
+}
+
+type ConsumerGroupHeartbeatResult struct {
+	ErrorCode         int16
+	ErrorMessage      string
+	MemberID          string
+	MemberEpoch       int32
+	HeartbeatInterval time.Duration
+	Assignment        Assignment // nil when the member already knows its assignment
+}
+
+func heartbeatError(code int16, format string, args ...interface{}) ConsumerGroupHeartbeatResult {
+	return ConsumerGroupHeartbeatResult{ErrorCode: code, ErrorMessage: fmt.Sprintf(format, args...)}
+}
+
+// ConsumerGroupHeartbeat joins, leaves or keeps a member in a consumer group and
+// hands it the next step towards its target assignment. It never blocks.
+func (gc *GroupCoordinator) ConsumerGroupHeartbeat(req ConsumerGroupHeartbeatRequest) ConsumerGroupHeartbeatResult {
+	if result := gc.validateConsumerGroupHeartbeat(req); result.ErrorCode != ErrorCodeNone {
+		return result
+	}
+
+	group, result := gc.consumerGroup(req.GroupID, req.MemberEpoch == 0)
+	if result.ErrorCode != ErrorCodeNone {
+		return result
+	}
+	if group == nil {
+		if req.MemberEpoch < 0 {
+			return ConsumerGroupHeartbeatResult{MemberID: req.MemberID, MemberEpoch: req.MemberEpoch}
+		}
+		return heartbeatError(ErrorCodeUnknownMemberID, "Member %s is not a member of group %s.", req.MemberID, req.GroupID)
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	return group.heartbeat(req)
+}
+
+func (gc *GroupCoordinator) validateConsumerGroupHeartbeat(req ConsumerGroupHeartbeatRequest) ConsumerGroupHeartbeatResult {
+	switch {
+	case req.GroupID == "":
+		return heartbeatError(ErrorCodeInvalidRequest, "GroupId can't be empty.")
+	case req.MemberEpoch < LeaveGroupStaticMemberEpoch:
+		return heartbeatError(ErrorCodeInvalidRequest, "MemberEpoch is invalid.")
+	case req.MemberEpoch != 0 && req.MemberID == "":
+		return heartbeatError(ErrorCodeInvalidRequest, "MemberId can't be empty.")
+	case req.MemberEpoch == LeaveGroupStaticMemberEpoch && req.InstanceID == "":
+		return heartbeatError(ErrorCodeInvalidRequest, "InstanceId can't be null.")
+	case req.MemberEpoch == 0 && req.RebalanceTimeout <= 0:
+		return heartbeatError(ErrorCodeInvalidRequest, "RebalanceTimeoutMs must be provided in first request.")
+	case req.MemberEpoch == 0 && req.SubscribedTopicNames == nil && req.SubscribedTopicRegex == nil:
+		return heartbeatError(ErrorCodeInvalidRequest, "SubscribedTopicNames or SubscribedTopicRegex must be set in first request.")
+	}
+
+	if req.ServerAssignor != nil && *req.ServerAssignor != "" && gc.assignor(*req.ServerAssignor) == nil {
+		var names []string
+		for _, assignor := range gc.Assignors {
+			names = append(names, assignor.Name())
+		}
+		return heartbeatError(ErrorCodeUnsupportedAssignor, "ServerAssignor %s is not supported. Supported assignors: %v.", *req.ServerAssignor, names)
+	}
+	if req.SubscribedTopicRegex != nil && *req.SubscribedTopicRegex != "" {
+		if _, err := compileSubscriptionRegex(*req.SubscribedTopicRegex); err != nil {
+			return heartbeatError(ErrorCodeInvalidRegularExpression, "SubscribedTopicRegex %s is invalid: %v", *req.SubscribedTopicRegex, err)
+		}
+	}
+	return ConsumerGroupHeartbeatResult{ErrorCode: ErrorCodeNone}
+}
+
+// Subscription patterns have to match the whole topic name, like Java's Matcher.matches
+func compileSubscriptionRegex(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func (gc *GroupCoordinator) assignor(name string) PartitionAssignor {
+	for _, assignor := range gc.Assignors {
+		if assignor.Name() == name {
+			return assignor
+		}
+	}
+	return nil
+}
+
+// consumerGroup returns the consumer group with the given id, creating it when
+// create is set. An empty classic group with the same id is replaced, any other
+// classic group makes the id unavailable.
+func (gc *GroupCoordinator) consumerGroup(id string, create bool) (*ConsumerGroup, ConsumerGroupHeartbeatResult) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if classic, ok := gc.groups[id]; ok {
+		if classic.State() != Empty {
+			return nil, heartbeatError(ErrorCodeGroupIDNotFound, "Group %s is not a consumer group.", id)
+		}
+		if !create {
+			return nil, ConsumerGroupHeartbeatResult{}
+		}
+		delete(gc.groups, id)
+	}
+
+	group, ok := gc.consumerGroups[id]
+	if !ok && create {
+		group = newConsumerGroup(id, gc)
+		gc.consumerGroups[id] = group
+	}
+	return group, ConsumerGroupHeartbeatResult{}
+}
+
+// Must be called with the group lock held.
+func (g *ConsumerGroup) heartbeat(req ConsumerGroupHeartbeatRequest) ConsumerGroupHeartbeatResult {
+	if g.dead {
+		return heartbeatError(ErrorCodeUnknownMemberID, "Group %s was removed.", g.ID)
+	}
+	if req.MemberEpoch == LeaveGroupMemberEpoch || req.MemberEpoch == LeaveGroupStaticMemberEpoch {
+		return g.leave(req)
+	}
+
+	member, result := g.memberFor(req)
+	if result.ErrorCode != ErrorCodeNone {
+		return result
+	}
+	g.touch(member)
+
+	subscriptionChanged := member.update(req)
+	if g.refreshSubscribedTopics() || subscriptionChanged {
+		g.epoch++
+	}
+	if g.epoch > g.assignmentEpoch {
+		g.computeTargetAssignment()
+	}
+	g.reconcile(member, req.OwnedPartitions)
+
+	result = ConsumerGroupHeartbeatResult{
+		ErrorCode:         ErrorCodeNone,
+		MemberID:          member.ID,
+		MemberEpoch:       member.Epoch,
+		HeartbeatInterval: g.gc.ConsumerGroupHeartbeatInterval,
+	}
+	if member.assignmentChanged || req.MemberEpoch != member.Epoch || (req.OwnedPartitions != nil && !req.OwnedPartitions.equal(member.Assigned)) {
+		result.Assignment = member.Assigned.filter(func(uuid.UUID, int32) bool { return true })
+		member.assignmentChanged = false
+	}
+	return result
+}
+
+// memberFor finds the member a heartbeat comes from, members joining with epoch
+// 0 are created, or take over the identity of their static instance
+func (g *ConsumerGroup) memberFor(req ConsumerGroupHeartbeatRequest) (*ConsumerGroupMember, ConsumerGroupHeartbeatResult) {
+	if req.InstanceID != "" {
+		current, ok := g.staticMembers[req.InstanceID]
+		switch {
+		case req.MemberEpoch == 0 && ok && current != req.MemberID:
+			old := g.members[current]
+			if old.Epoch != LeaveGroupStaticMemberEpoch {
+				return nil, heartbeatError(ErrorCodeUnreleasedInstanceID, "Static member %s with instance id %s is not released yet.", current, req.InstanceID)
+			}
+			return g.replaceStaticMember(old, req.MemberID), ConsumerGroupHeartbeatResult{}
+		case req.MemberEpoch != 0 && !ok:
+			return nil, heartbeatError(ErrorCodeUnknownMemberID, "Instance id %s is unknown.", req.InstanceID)
+		case req.MemberEpoch != 0 && current != req.MemberID:
+			return nil, heartbeatError(ErrorCodeFencedInstanceID, "Static member %s with instance id %s was fenced by member %s.", req.MemberID, req.InstanceID, current)
+		}
+	}
+
+	member := g.members[req.MemberID]
+	if req.MemberEpoch == 0 {
+		if member == nil {
+			id := req.MemberID
+			if id == "" {
+				id = uuid.New().String()
+			}
+			member = &ConsumerGroupMember{ID: id, InstanceID: req.InstanceID, Assigned: make(Assignment), PendingRevocation: make(Assignment)}
+			g.members[id] = member
+			if member.InstanceID != "" {
+				g.staticMembers[member.InstanceID] = id
+			}
+		} else {
+			// A fenced member rejoins owning nothing
+			g.stopRevocation(member)
+			member.Epoch, member.PreviousEpoch = 0, 0
+			member.state = memberStable
+			member.Assigned = make(Assignment)
+			member.PendingRevocation = make(Assignment)
+		}
+		return member, ConsumerGroupHeartbeatResult{}
+	}
+
+	if member == nil {
+		return nil, heartbeatError(ErrorCodeUnknownMemberID, "Member %s is not a member of group %s.", req.MemberID, g.ID)
+	}
+	if req.MemberEpoch > member.Epoch {
+		return nil, heartbeatError(ErrorCodeFencedMemberEpoch, "The consumer group member has a greater member epoch (%d) than the one known by the group coordinator (%d). The member must abandon all its partitions and rejoin.", req.MemberEpoch, member.Epoch)
+	}
+	if req.MemberEpoch < member.Epoch {
+		// A member that missed the response moving it to its new epoch may still
+		// use the previous one, as long as it does not own more than it should
+		if req.MemberEpoch != member.PreviousEpoch || req.OwnedPartitions == nil || req.OwnedPartitions.minus(member.Assigned).count() > 0 {
+			return nil, heartbeatError(ErrorCodeFencedMemberEpoch, "The consumer group member has a smaller member epoch (%d) than the one known by the group coordinator (%d). The member must abandon all its partitions and rejoin.", req.MemberEpoch, member.Epoch)
+		}
+	}
+	return member, ConsumerGroupHeartbeatResult{}
+}
+
+// update applies the fields the member sent and reports whether its
+// subscription changed
+func (m *ConsumerGroupMember) update(req ConsumerGroupHeartbeatRequest) bool {
+	changed := m.Epoch == 0
+	m.ClientID = req.ClientID
+	m.ClientHost = req.ClientHost
+	if req.RackID != "" {
+		m.RackID = req.RackID
+	}
+	if req.RebalanceTimeout > 0 {
+		m.RebalanceTimeout = req.RebalanceTimeout
+	}
+	if req.SubscribedTopicNames != nil {
+		names := append([]string(nil), req.SubscribedTopicNames...)
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(m.SubscribedTopicNames) {
+			m.SubscribedTopicNames = names
+			changed = true
+		}
+	}
+	if req.SubscribedTopicRegex != nil && *req.SubscribedTopicRegex != m.SubscribedTopicRegex {
+		m.SubscribedTopicRegex = *req.SubscribedTopicRegex
+		m.regex = nil
+		if m.SubscribedTopicRegex != "" {
+			m.regex, _ = compileSubscriptionRegex(m.SubscribedTopicRegex)
+		}
+		changed = true
+	}
+	if req.ServerAssignor != nil && *req.ServerAssignor != m.ServerAssignor {
+		m.ServerAssignor = *req.ServerAssignor
+		changed = true
+	}
+	return changed
+}
+
+func (g *ConsumerGroup) leave(req ConsumerGroupHeartbeatRequest) ConsumerGroupHeartbeatResult {
+	member, ok := g.members[req.MemberID]
+	if !ok {
+		return heartbeatError(ErrorCodeUnknownMemberID, "Member %s is not a member of group %s.", req.MemberID, g.ID)
+	}
+	if req.InstanceID != "" && member.InstanceID != req.InstanceID {
+		return heartbeatError(ErrorCodeFencedInstanceID, "Member %s does not have instance id %s.", req.MemberID, req.InstanceID)
+	}
+
+	// A static member keeps its partitions, the same instance may come back
+	// within the session timeout
+	if req.MemberEpoch == LeaveGroupStaticMemberEpoch {
+		g.stopRevocation(member)
+		if member.Epoch != LeaveGroupStaticMemberEpoch {
+			member.PreviousEpoch = member.Epoch
+		}
+		member.Epoch = LeaveGroupStaticMemberEpoch
+		return ConsumerGroupHeartbeatResult{ErrorCode: ErrorCodeNone, MemberID: member.ID, MemberEpoch: LeaveGroupStaticMemberEpoch}
+	}
+
+	g.removeMember(member)
+	return ConsumerGroupHeartbeatResult{ErrorCode: ErrorCodeNone, MemberID: member.ID, MemberEpoch: LeaveGroupMemberEpoch}
+}
+
+// replaceStaticMember hands a temporarily departed static member, with its
+// partitions, to the new member id of the same instance
+func (g *ConsumerGroup) replaceStaticMember(old *ConsumerGroupMember, newID string) *ConsumerGroupMember {
+	if newID == "" {
+		newID = uuid.New().String()
+	}
+	target := g.targetAssignment[old.ID]
+	delete(g.members, old.ID)
+	delete(g.targetAssignment, old.ID)
+
+	old.ID = newID
+	old.Epoch = old.PreviousEpoch
+	old.assignmentChanged = true
+	g.members[newID] = old
+	g.targetAssignment[newID] = target
+	g.staticMembers[old.InstanceID] = newID
+	return old
+}
+
+func (g *ConsumerGroup) removeMember(member *ConsumerGroupMember) {
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+	g.stopRevocation(member)
+	delete(g.members, member.ID)
+	delete(g.targetAssignment, member.ID)
+	if member.InstanceID != "" && g.staticMembers[member.InstanceID] == member.ID {
+		delete(g.staticMembers, member.InstanceID)
+	}
+
+	// The remaining members move on to a target without the member right away
+	g.epoch++
+	g.refreshSubscribedTopics()
+	g.computeTargetAssignment()
+}
+
+func (g *ConsumerGroup) touch(member *ConsumerGroupMember) {
+	member.lastSeen = time.Now()
+	timeout := g.gc.ConsumerGroupSessionTimeout
+	if member.sessionTimer == nil {
+		member.sessionTimer = time.AfterFunc(timeout, func() { g.onSessionTimeout(member) })
+	} else {
+		member.sessionTimer.Reset(timeout)
+	}
+}
+
+func (g *ConsumerGroup) onSessionTimeout(member *ConsumerGroupMember) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.members[member.ID] != member {
+		return
+	}
+	if remaining := g.gc.ConsumerGroupSessionTimeout - time.Since(member.lastSeen); remaining > 0 {
+		member.sessionTimer.Reset(remaining)
+		return
+	}
+
+	g.gc.Logger.Info("Member has failed, removing it from the consumer group", "group_id", g.ID, "member_id", member.ID)
+	g.removeMember(member)
+}
+
+func (g *ConsumerGroup) stopRevocation(member *ConsumerGroupMember) {
+	if member.revocationTimer != nil {
+		member.revocationTimer.Stop()
+		member.revocationTimer = nil
+	}
+}
+
+func (g *ConsumerGroup) onRevocationTimeout(member *ConsumerGroupMember) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.members[member.ID] != member || member.state != memberUnrevokedPartitions {
+		return
+	}
+	g.gc.Logger.Info("Member did not revoke its partitions in time, removing it from the consumer group", "group_id", g.ID, "member_id", member.ID)
+	g.removeMember(member)
+}
+
+// refreshSubscribedTopics records the metadata of every topic a member is
+// subscribed to and reports whether it changed since the last target
+func (g *ConsumerGroup) refreshSubscribedTopics() bool {
+	subscribed := make(map[string]TopicMetadata)
+	if g.gc.Topics != nil {
+		for _, topic := range g.gc.Topics() {
+			for _, member := range g.members {
+				if member.subscribes(topic) {
+					subscribed[topic.Name] = topic
+					break
+				}
+			}
+		}
+	}
+
+	changed := len(subscribed) != len(g.subscribedTopics)
+	for name, topic := range subscribed {
+		if g.subscribedTopics[name] != topic {
+			changed = true
+		}
+	}
+	g.subscribedTopics = subscribed
+	return changed
+}
+
+// preferredAssignor is the server assignor most members asked for, or the
+// default one when none did
+func (g *ConsumerGroup) preferredAssignor() PartitionAssignor {
+	votes := make(map[string]int)
+	for _, member := range g.members {
+		if member.ServerAssignor != "" {
+			votes[member.ServerAssignor]++
+		}
+	}
+
+	preferred := g.gc.Assignors[0]
+	for _, assignor := range g.gc.Assignors {
+		if votes[assignor.Name()] > votes[preferred.Name()] {
+			preferred = assignor
+		}
+	}
+	return preferred
+}
+
+func (g *ConsumerGroup) computeTargetAssignment() {
+	spec := AssignmentSpec{
+		Subscriptions: make(map[string][]uuid.UUID),
+		Partitions:    make(map[uuid.UUID]int32),
+		Previous:      g.targetAssignment,
+	}
+	for _, topic := range g.subscribedTopics {
+		spec.Partitions[topic.ID] = topic.Partitions
+	}
+	for id, member := range g.members {
+		topicIDs := []uuid.UUID{}
+		for _, topic := range g.subscribedTopics {
+			if member.subscribes(topic) {
+				topicIDs = append(topicIDs, topic.ID)
+			}
+		}
+		spec.Subscriptions[id] = topicIDs
+	}
+
+	assignor := g.preferredAssignor()
+	g.targetAssignment = assignor.Assign(spec)
+	g.assignorName = assignor.Name()
+	g.assignmentEpoch = g.epoch
+}
+
+// ownedByOther reports a partition some other member still holds
+func (g *ConsumerGroup) ownedByOther(member *ConsumerGroupMember, topicID uuid.UUID, partition int32) bool {
+	for _, other := range g.members {
+		if other != member && (other.Assigned.contains(topicID, partition) || other.PendingRevocation.contains(topicID, partition)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile moves the member one step closer to its target assignment. Partitions
+// it has to give up are revoked first and only once it confirmed the revocation
+// does it move to the new epoch and receive partitions nobody else owns.
+func (g *ConsumerGroup) reconcile(member *ConsumerGroupMember, owned Assignment) {
+	if member.state == memberUnrevokedPartitions {
+		if owned == nil || owned.intersect(member.PendingRevocation).count() > 0 {
+			return
+		}
+		g.stopRevocation(member)
+		member.PendingRevocation = make(Assignment)
+		member.state = memberStable
+	}
+	if member.state == memberStable && member.Epoch == g.assignmentEpoch {
+		return
+	}
+
+	target := g.targetAssignment[member.ID]
+	if revoke := member.Assigned.minus(target); revoke.count() > 0 {
+		member.Assigned = member.Assigned.intersect(target)
+		member.PendingRevocation = revoke
+		member.state = memberUnrevokedPartitions
+		member.assignmentChanged = true
+		member.revocationTimer = time.AfterFunc(member.RebalanceTimeout, func() { g.onRevocationTimeout(member) })
+		return
+	}
+
+	assigned := member.Assigned.filter(func(uuid.UUID, int32) bool { return true })
+	unreleased := false
+	for topicID, partitions := range target.minus(member.Assigned) {
+		for _, partition := range partitions {
+			if g.ownedByOther(member, topicID, partition) {
+				unreleased = true
+			} else {
+				assigned.add(topicID, partition)
+			}
+		}
+	}
+
+	if !assigned.equal(member.Assigned) {
+		member.assignmentChanged = true
+	}
+	member.Assigned = assigned
+	if member.Epoch != g.assignmentEpoch {
+		member.PreviousEpoch = member.Epoch
+		member.Epoch = g.assignmentEpoch
+	}
+	member.state = memberStable
+	if unreleased {
+		member.state = memberUnreleasedPartitions
+	}
+}
+
+// validateOffsetCommit checks the committer is a member of the group at its
+// current epoch. Must be called with the group lock held.
+func (g *ConsumerGroup) validateOffsetCommit(memberID string, memberEpoch int32) int16 {
+	if memberEpoch < 0 && memberID == "" && len(g.members) == 0 {
+		return ErrorCodeNone
+	}
+	member, ok := g.members[memberID]
+	if !ok {
+		return ErrorCodeUnknownMemberID
+	}
+	if memberEpoch != member.Epoch {
+		return ErrorCodeStaleMemberEpoch
+	}
+	return ErrorCodeNone
+}
+
+type ConsumerGroupMemberDescription struct {
+	MemberID             string
+	InstanceID           string
+	RackID               string
+	MemberEpoch          int32
+	ClientID             string
+	ClientHost           string
+	SubscribedTopicNames []string
+	SubscribedTopicRegex string
+	Assignment           Assignment
+	TargetAssignment     Assignment
+}
+
+type ConsumerGroupDescription struct {
+	ErrorCode       int16
+	ErrorMessage    string
+	GroupID         string
+	State           string
+	Epoch           int32
+	AssignmentEpoch int32
+	AssignorName    string
+	Members         []ConsumerGroupMemberDescription
+}
+
+// DescribeConsumerGroups describes every group, in the order they were asked for
+func (gc *GroupCoordinator) DescribeConsumerGroups(groupIDs []string) []ConsumerGroupDescription {
+	var descriptions []ConsumerGroupDescription
+	for _, id := range groupIDs {
+		gc.mu.Lock()
+		group, ok := gc.consumerGroups[id]
+		_, classic := gc.groups[id]
+		gc.mu.Unlock()
+
+		switch {
+		case ok:
+			descriptions = append(descriptions, group.describe())
+		case classic:
+			descriptions = append(descriptions, ConsumerGroupDescription{GroupID: id, ErrorCode: ErrorCodeGroupIDNotFound, ErrorMessage: fmt.Sprintf("Group %s is not a consumer group.", id)})
+		default:
+			descriptions = append(descriptions, ConsumerGroupDescription{GroupID: id, ErrorCode: ErrorCodeGroupIDNotFound, ErrorMessage: fmt.Sprintf("Group %s not found.", id)})
+		}
+	}
+	return descriptions
+}
+
+func (g *ConsumerGroup) describe() ConsumerGroupDescription {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	description := ConsumerGroupDescription{
+		ErrorCode:       ErrorCodeNone,
+		GroupID:         g.ID,
+		State:           g.state().String(),
+		Epoch:           g.epoch,
+		AssignmentEpoch: g.assignmentEpoch,
+		AssignorName:    g.assignorName,
+	}
+	for _, member := range g.members {
+		description.Members = append(description.Members, ConsumerGroupMemberDescription{
+			MemberID:             member.ID,
+			InstanceID:           member.InstanceID,
+			RackID:               member.RackID,
+			MemberEpoch:          member.Epoch,
+			ClientID:             member.ClientID,
+			ClientHost:           member.ClientHost,
+			SubscribedTopicNames: member.SubscribedTopicNames,
+			SubscribedTopicRegex: member.SubscribedTopicRegex,
+			Assignment:           member.Assigned,
+			TargetAssignment:     g.targetAssignment[member.ID],
+		})
+	}
+	sort.Slice(description.Members, func(i, j int) bool { return description.Members[i].MemberID < description.Members[j].MemberID })
+	return description
+}
@@ -0,0 +1,141 @@
+package group_coordinator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var fooID = uuid.New()
+
+func newConsumerTestCoordinator(partitions int32) *GroupCoordinator {
+	gc := newTestCoordinator()
+	gc.Topics = func() []TopicMetadata {
+		return []TopicMetadata{{ID: fooID, Name: "foo", Partitions: partitions}}
+	}
+	return gc
+}
+
+func consumerHeartbeat(gc *GroupCoordinator, memberID string, epoch int32, owned Assignment) ConsumerGroupHeartbeatResult {
+	req := ConsumerGroupHeartbeatRequest{GroupID: "group", MemberID: memberID, MemberEpoch: epoch, OwnedPartitions: owned}
+	if epoch == 0 {
+		req.RebalanceTimeout = time.Second
+		req.SubscribedTopicNames = []string{"foo"}
+	}
+	return gc.ConsumerGroupHeartbeat(req)
+}
+
+func TestConsumerGroupRevokesBeforeReassigning(t *testing.T) {
+	gc := newConsumerTestCoordinator(4)
+
+	first := consumerHeartbeat(gc, "a", 0, nil)
+	if first.ErrorCode != ErrorCodeNone || first.MemberEpoch != 1 || first.Assignment.count() != 4 {
+		t.Fatalf("Expected the first member to own every partition at epoch 1, got %+v", first)
+	}
+	owned := first.Assignment
+
+	// The second member is assigned half, but nothing the first one still owns
+	second := consumerHeartbeat(gc, "b", 0, nil)
+	if second.MemberEpoch != 2 || second.Assignment.count() != 0 {
+		t.Fatalf("Expected the second member at epoch 2 without partitions, got %+v", second)
+	}
+
+	// The first member is told to give up half and stays on its epoch until it does
+	revoking := consumerHeartbeat(gc, "a", 1, owned)
+	if revoking.MemberEpoch != 1 || revoking.Assignment.count() != 2 {
+		t.Fatalf("Expected a revocation down to 2 partitions at epoch 1, got %+v", revoking)
+	}
+	if state := gc.consumerGroups["group"].State(); state != ConsumerGroupReconciling {
+		t.Errorf("Expected the group to be Reconciling, got %s", state)
+	}
+
+	confirmed := consumerHeartbeat(gc, "a", 1, revoking.Assignment)
+	if confirmed.MemberEpoch != 2 {
+		t.Fatalf("Expected the first member to move to epoch 2 after revoking, got %+v", confirmed)
+	}
+
+	released := consumerHeartbeat(gc, "b", 2, Assignment{})
+	if released.Assignment.count() != 2 || released.Assignment.intersect(revoking.Assignment).count() != 0 {
+		t.Fatalf("Expected the second member to get the 2 released partitions, got %+v", released)
+	}
+	if state := gc.consumerGroups["group"].State(); state != ConsumerGroupStable {
+		t.Errorf("Expected the group to be Stable, got %s", state)
+	}
+
+	if stale := consumerHeartbeat(gc, "b", 5, nil); stale.ErrorCode != ErrorCodeFencedMemberEpoch {
+		t.Errorf("Expected FENCED_MEMBER_EPOCH for an epoch from the future, got %+v", stale)
+	}
+}
+
+func TestConsumerGroupLeaveFreesPartitions(t *testing.T) {
+	gc := newConsumerTestCoordinator(2)
+
+	a := consumerHeartbeat(gc, "a", 0, nil)
+	consumerHeartbeat(gc, "b", 0, nil)
+	revoking := consumerHeartbeat(gc, "a", a.MemberEpoch, a.Assignment)
+	consumerHeartbeat(gc, "a", revoking.MemberEpoch, revoking.Assignment)
+
+	if left := consumerHeartbeat(gc, "a", LeaveGroupMemberEpoch, nil); left.MemberEpoch != LeaveGroupMemberEpoch {
+		t.Fatalf("Unexpected leave response %+v", left)
+	}
+
+	b := consumerHeartbeat(gc, "b", 2, Assignment{})
+	if b.ErrorCode != ErrorCodeNone || b.MemberEpoch != 3 || b.Assignment.count() != 2 {
+		t.Fatalf("Expected the remaining member to own both partitions at epoch 3, got %+v", b)
+	}
+}
+
+func TestStaticConsumerRejoinKeepsAssignment(t *testing.T) {
+	gc := newConsumerTestCoordinator(3)
+
+	join := ConsumerGroupHeartbeatRequest{GroupID: "group", MemberID: "a", InstanceID: "instance-1", RebalanceTimeout: time.Second, SubscribedTopicNames: []string{"foo"}}
+	first := gc.ConsumerGroupHeartbeat(join)
+	if first.Assignment.count() != 3 {
+		t.Fatalf("Unexpected first join %+v", first)
+	}
+
+	gc.ConsumerGroupHeartbeat(ConsumerGroupHeartbeatRequest{GroupID: "group", MemberID: "a", InstanceID: "instance-1", MemberEpoch: LeaveGroupStaticMemberEpoch})
+
+	join.MemberID = "a2"
+	rejoined := gc.ConsumerGroupHeartbeat(join)
+	if rejoined.ErrorCode != ErrorCodeNone || rejoined.MemberID != "a2" || rejoined.MemberEpoch != first.MemberEpoch || rejoined.Assignment.count() != 3 {
+		t.Fatalf("Expected the instance to come back with its partitions, got %+v", rejoined)
+	}
+
+	join.MemberID = "a3"
+	if taken := gc.ConsumerGroupHeartbeat(join); taken.ErrorCode != ErrorCodeUnreleasedInstanceID {
+		t.Errorf("Expected UNRELEASED_INSTANCE_ID while the instance is active, got %+v", taken)
+	}
+}
+
+func TestRangeAndUniformAssignors(t *testing.T) {
+	barID := uuid.New()
+	spec := AssignmentSpec{
+		Subscriptions: map[string][]uuid.UUID{"a": {fooID, barID}, "b": {fooID, barID}},
+		Partitions:    map[uuid.UUID]int32{fooID: 3, barID: 3},
+	}
+
+	ranged := RangeAssignor{}.Assign(spec)
+	if len(ranged["a"][fooID]) != 2 || len(ranged["a"][barID]) != 2 || ranged["b"].count() != 2 {
+		t.Errorf("Range should give the first member the extra partition of every topic, got %v", ranged)
+	}
+
+	uniform := UniformAssignor{}.Assign(spec)
+	if uniform["a"].count() != 3 || uniform["b"].count() != 3 {
+		t.Errorf("Uniform should balance across topics, got %v", uniform)
+	}
+
+	// A third member only takes over partitions, the rest stays put
+	spec.Subscriptions["c"] = []uuid.UUID{fooID, barID}
+	spec.Previous = uniform
+	next := UniformAssignor{}.Assign(spec)
+	for _, memberID := range []string{"a", "b"} {
+		if next[memberID].count() != 2 || next[memberID].minus(uniform[memberID]).count() != 0 {
+			t.Errorf("Member %s should keep 2 of its previous partitions, got %v (was %v)", memberID, next[memberID], uniform[memberID])
+		}
+	}
+	if next["c"].count() != 2 {
+		t.Errorf("The new member should get 2 partitions, got %v", next["c"])
+	}
+}
@@ -0,0 +1,534 @@
+package group_coordinator
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+	"toy_kafka/app/file_metadata"
+)
+
+// Error codes returned to group members
+const (
+	ErrorCodeUnknownServerError        = -1
+	ErrorCodeNone                      = 0
+	ErrorCodeOffsetMetadataTooLarge    = 12
+	ErrorCodeCoordinatorNotAvailable   = 15
+	ErrorCodeIllegalGeneration         = 22
+	ErrorCodeInconsistentGroupProtocol = 23
+	ErrorCodeInvalidGroupID            = 24
+	ErrorCodeUnknownMemberID           = 25
+	ErrorCodeInvalidSessionTimeout     = 26
+	ErrorCodeRebalanceInProgress       = 27
+	ErrorCodeInvalidRequest            = 42
+	ErrorCodeGroupIDNotFound           = 69
+	ErrorCodeProducerFenced            = 90
+	ErrorCodeMemberIDRequired          = 79
+	ErrorCodeFencedInstanceID          = 82
+	ErrorCodeFencedMemberEpoch         = 110
+	ErrorCodeUnreleasedInstanceID      = 111
+	ErrorCodeUnsupportedAssignor       = 112
+	ErrorCodeStaleMemberEpoch          = 113
+	ErrorCodeInvalidRegularExpression  = 130
+)
+
+// Same defaults as Kafka's group.min.session.timeout.ms, group.max.session.timeout.ms
+// and group.initial.rebalance.delay.ms
+const (
+	DefaultMinSessionTimeout     = 6 * time.Second
+	DefaultMaxSessionTimeout     = 30 * time.Minute
+	DefaultInitialRebalanceDelay = 3 * time.Second
+)
+
+type GroupCoordinator struct {
+	mu     sync.Mutex
+	groups map[string]*Group
+	// closed is set by Close, the groups created later are closed too
+	closed bool
+
+	// Groups running the consumer protocol, the broker assigns their partitions
+	consumerGroups map[string]*ConsumerGroup
+
+	// Committed offsets by group, mirrored to the __consumer_offsets partitions
+	offsetsMu  sync.RWMutex
+	offsets    map[string]map[TopicPartition]OffsetAndMetadata
+	offsetLogs []*file_metadata.PartitionLog
+
+	// Offsets committed in open transactions, by producer id then group
+	pendingOffsets map[int64]map[string]map[TopicPartition]OffsetAndMetadata
+
+	MinSessionTimeout     time.Duration
+	MaxSessionTimeout     time.Duration
+	InitialRebalanceDelay time.Duration
+
+	// Topics lists the topics of the cluster, consumer groups resolve their
+	// subscriptions against it
+	Topics                         func() []TopicMetadata
+	Assignors                      []PartitionAssignor // the first one is the default
+	ConsumerGroupSessionTimeout    time.Duration
+	ConsumerGroupHeartbeatInterval time.Duration
+
+	// Logger receives the membership changes and persistence failures
+	Logger *slog.Logger
+}
+
+func NewGroupCoordinator() *GroupCoordinator {
+	return &GroupCoordinator{
+		groups:                make(map[string]*Group),
+		offsets:               make(map[string]map[TopicPartition]OffsetAndMetadata),
+		pendingOffsets:        make(map[int64]map[string]map[TopicPartition]OffsetAndMetadata),
+		MinSessionTimeout:     DefaultMinSessionTimeout,
+		MaxSessionTimeout:     DefaultMaxSessionTimeout,
+		InitialRebalanceDelay: DefaultInitialRebalanceDelay,
+
+		consumerGroups:                 make(map[string]*ConsumerGroup),
+		Assignors:                      []PartitionAssignor{UniformAssignor{}, RangeAssignor{}},
+		ConsumerGroupSessionTimeout:    DefaultConsumerGroupSessionTimeout,
+		ConsumerGroupHeartbeatInterval: DefaultConsumerGroupHeartbeatInterval,
+		Logger:                         slog.Default(),
+	}
+}
+
+// group returns the group with the given id, creating it when create is set
+func (gc *GroupCoordinator) group(id string, create bool) *Group {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	group, ok := gc.groups[id]
+	if !ok && create {
+		group = newGroup(id, gc.InitialRebalanceDelay, gc.Logger)
+		group.closed = gc.closed
+		gc.groups[id] = group
+	}
+	return group
+}
+
+// hasConsumerGroup reports whether a consumer group with members holds the id,
+// an empty one is dropped so a classic group can take its place
+func (gc *GroupCoordinator) hasConsumerGroup(id string) bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	group, ok := gc.consumerGroups[id]
+	if !ok {
+		return false
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	if len(group.members) > 0 {
+		return true
+	}
+	group.dead = true
+	delete(gc.consumerGroups, id)
+	return false
+}
+
+// Close answers the members of classic groups still waiting for a join or
+// sync phase with COORDINATOR_NOT_AVAILABLE, later JoinGroup and SyncGroup
+// requests get the same answer
+func (gc *GroupCoordinator) Close() {
+	gc.mu.Lock()
+	gc.closed = true
+	groups := make([]*Group, 0, len(gc.groups))
+	for _, group := range gc.groups {
+		groups = append(groups, group)
+	}
+	gc.mu.Unlock()
+
+	for _, group := range groups {
+		group.close()
+	}
+}
+
+type JoinGroupRequest struct {
+	GroupID          string
+	MemberID         string
+	GroupInstanceID  string
+	ClientID         string
+	ClientHost       string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	ProtocolType     string
+	Protocols        []Protocol
+}
+
+type JoinGroupMember struct {
+	MemberID        string
+	GroupInstanceID string
+	Metadata        []byte
+}
+
+type JoinGroupResult struct {
+	ErrorCode    int16
+	GenerationID int32
+	ProtocolType string
+	ProtocolName string
+	LeaderID     string
+	MemberID     string
+	Members      []JoinGroupMember
+}
+
+// JoinGroup adds the member to the group and blocks until the rebalance it
+// takes part in is complete
+func (gc *GroupCoordinator) JoinGroup(req JoinGroupRequest) JoinGroupResult {
+	result := make(chan JoinGroupResult, 1)
+	gc.HandleJoinGroup(req, func(joined JoinGroupResult) { result <- joined })
+	return <-result
+}
+
+// HandleJoinGroup adds the member to the group without waiting, respond is
+// called once the rebalance it takes part in is complete. respond is never
+// called with the group lock held.
+func (gc *GroupCoordinator) HandleJoinGroup(req JoinGroupRequest, respond func(JoinGroupResult)) {
+	failed := JoinGroupResult{GenerationID: -1, MemberID: req.MemberID}
+	switch {
+	case req.GroupID == "":
+		failed.ErrorCode = ErrorCodeInvalidGroupID
+	case req.SessionTimeout < gc.MinSessionTimeout || req.SessionTimeout > gc.MaxSessionTimeout:
+		failed.ErrorCode = ErrorCodeInvalidSessionTimeout
+	case gc.hasConsumerGroup(req.GroupID):
+		failed.ErrorCode = ErrorCodeInconsistentGroupProtocol
+	}
+	if failed.ErrorCode != ErrorCodeNone {
+		respond(failed)
+		return
+	}
+
+	group := gc.group(req.GroupID, req.MemberID == "")
+	if group == nil {
+		failed.ErrorCode = ErrorCodeUnknownMemberID
+		respond(failed)
+		return
+	}
+
+	if result, waiting := group.join(req, respond); !waiting {
+		respond(result)
+	}
+}
+
+// join either answers right away or reports that the member waits for the
+// join phase, respond is called once the group completes it
+func (g *Group) join(req JoinGroupRequest, respond func(JoinGroupResult)) (JoinGroupResult, bool) {
+	g.mu.Lock()
+	defer g.unlock()
+
+	failed := func(code int16) (JoinGroupResult, bool) {
+		return JoinGroupResult{ErrorCode: code, GenerationID: -1, MemberID: req.MemberID}, false
+	}
+
+	if g.closed {
+		return failed(ErrorCodeCoordinatorNotAvailable)
+	}
+	if g.state == Dead {
+		return failed(ErrorCodeUnknownMemberID)
+	}
+
+	existing, known := g.members[req.MemberID]
+	if !known && !g.supportsProtocols(req.ProtocolType, req.Protocols) {
+		return failed(ErrorCodeInconsistentGroupProtocol)
+	}
+	if known && !g.supportsProtocolsExcept(existing, req.ProtocolType, req.Protocols) {
+		return failed(ErrorCodeInconsistentGroupProtocol)
+	}
+
+	// Static members are identified by their instance id, the member id only
+	// tells apart restarts of the same instance
+	if req.GroupInstanceID != "" {
+		oldID, exists := g.staticMembers[req.GroupInstanceID]
+		switch {
+		case !exists && req.MemberID != "":
+			return failed(ErrorCodeUnknownMemberID)
+		case exists && req.MemberID != "" && req.MemberID != oldID:
+			return failed(ErrorCodeFencedInstanceID)
+		case exists && req.MemberID == "":
+			member := g.replaceStaticMember(oldID, newMemberID(req.GroupInstanceID))
+			return g.rejoin(member, req, respond)
+		case !exists:
+			return g.addAndJoin(newMemberID(req.GroupInstanceID), req, respond)
+		}
+	}
+
+	if req.MemberID == "" {
+		// Dynamic members first get an id and then join again with it
+		memberID := newMemberID(req.ClientID)
+		g.pendingMembers[memberID] = time.AfterFunc(req.SessionTimeout, func() { g.onPendingTimeout(memberID) })
+		return JoinGroupResult{ErrorCode: ErrorCodeMemberIDRequired, GenerationID: -1, MemberID: memberID}, false
+	}
+
+	if _, pending := g.pendingMembers[req.MemberID]; pending {
+		return g.addAndJoin(req.MemberID, req, respond)
+	}
+	if !known {
+		return failed(ErrorCodeUnknownMemberID)
+	}
+	return g.rejoin(existing, req, respond)
+}
+
+// supportsProtocolsExcept is supportsProtocols for a member that is already in
+// the group and may change what it supports
+func (g *Group) supportsProtocolsExcept(member *Member, protocolType string, protocols []Protocol) bool {
+	if len(g.members) == 1 {
+		return protocolType != "" && len(protocols) > 0
+	}
+
+	previous := member.Protocols
+	member.Protocols = protocols
+	defer func() { member.Protocols = previous }()
+
+	return protocolType == g.protocolType && len(g.candidateProtocols()) > 0
+}
+
+func (g *Group) onPendingTimeout(memberID string) {
+	g.mu.Lock()
+	defer g.unlock()
+
+	if _, ok := g.pendingMembers[memberID]; ok {
+		delete(g.pendingMembers, memberID)
+		g.tryCompleteJoin()
+	}
+}
+
+func (g *Group) addAndJoin(memberID string, req JoinGroupRequest, respond func(JoinGroupResult)) (JoinGroupResult, bool) {
+	member := &Member{
+		ID:               memberID,
+		GroupInstanceID:  req.GroupInstanceID,
+		ClientID:         req.ClientID,
+		ClientHost:       req.ClientHost,
+		SessionTimeout:   req.SessionTimeout,
+		RebalanceTimeout: req.RebalanceTimeout,
+		Protocols:        req.Protocols,
+	}
+	if len(g.members) == 0 {
+		g.protocolType = req.ProtocolType
+	}
+	g.addMember(member)
+
+	return g.awaitJoin(member, respond)
+}
+
+func (g *Group) rejoin(member *Member, req JoinGroupRequest, respond func(JoinGroupResult)) (JoinGroupResult, bool) {
+	unchanged := sameProtocols(member.Protocols, req.Protocols)
+	member.ClientID = req.ClientID
+	member.ClientHost = req.ClientHost
+	member.SessionTimeout = req.SessionTimeout
+	member.RebalanceTimeout = req.RebalanceTimeout
+	member.Protocols = req.Protocols
+
+	// A follower rejoining with nothing new just gets the current generation back
+	if unchanged && member.ID != g.leaderID && (g.state == Stable || g.state == CompletingRebalance) {
+		g.touch(member)
+		return g.joinResult(member), false
+	}
+	return g.awaitJoin(member, respond)
+}
+
+func (g *Group) awaitJoin(member *Member, respond func(JoinGroupResult)) (JoinGroupResult, bool) {
+	// The member's previous join is superseded by this one
+	g.answerJoin(member, JoinGroupResult{ErrorCode: ErrorCodeRebalanceInProgress, GenerationID: -1, MemberID: member.ID})
+	member.awaitingJoin = respond
+
+	if g.state != PreparingRebalance {
+		g.prepareRebalance()
+	}
+	g.tryCompleteJoin()
+	return JoinGroupResult{}, true
+}
+
+type SyncGroupAssignment struct {
+	MemberID   string
+	Assignment []byte
+}
+
+type SyncGroupRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+	ProtocolType    string // "" when the client did not send it
+	ProtocolName    string
+	Assignments     []SyncGroupAssignment
+}
+
+type SyncGroupResult struct {
+	ErrorCode    int16
+	ProtocolType string
+	ProtocolName string
+	Assignment   []byte
+}
+
+// SyncGroup hands the leader's assignment to every member, followers block
+// until the leader has sent it
+func (gc *GroupCoordinator) SyncGroup(req SyncGroupRequest) SyncGroupResult {
+	result := make(chan SyncGroupResult, 1)
+	gc.HandleSyncGroup(req, func(synced SyncGroupResult) { result <- synced })
+	return <-result
+}
+
+// HandleSyncGroup is SyncGroup without waiting, respond is called once the
+// leader has sent the assignment. Like for HandleJoinGroup, respond is never
+// called with the group lock held.
+func (gc *GroupCoordinator) HandleSyncGroup(req SyncGroupRequest, respond func(SyncGroupResult)) {
+	group := gc.group(req.GroupID, false)
+	if group == nil {
+		respond(SyncGroupResult{ErrorCode: ErrorCodeUnknownMemberID})
+		return
+	}
+
+	if result, waiting := group.sync(req, respond); !waiting {
+		respond(result)
+	}
+}
+
+func (g *Group) sync(req SyncGroupRequest, respond func(SyncGroupResult)) (SyncGroupResult, bool) {
+	g.mu.Lock()
+	defer g.unlock()
+
+	if g.closed {
+		return SyncGroupResult{ErrorCode: ErrorCodeCoordinatorNotAvailable}, false
+	}
+
+	member, code := g.validateMember(req.MemberID, req.GroupInstanceID, req.GenerationID)
+	if code != ErrorCodeNone {
+		return SyncGroupResult{ErrorCode: code}, false
+	}
+	if (req.ProtocolType != "" && req.ProtocolType != g.protocolType) || (req.ProtocolName != "" && req.ProtocolName != g.protocolName) {
+		return SyncGroupResult{ErrorCode: ErrorCodeInconsistentGroupProtocol}, false
+	}
+	g.touch(member)
+
+	switch g.state {
+	case PreparingRebalance:
+		return SyncGroupResult{ErrorCode: ErrorCodeRebalanceInProgress}, false
+
+	case Stable:
+		return g.syncResult(member), false
+
+	case CompletingRebalance:
+		member.awaitingSync = respond
+
+		if member.ID == g.leaderID {
+			for _, assignment := range req.Assignments {
+				if target, ok := g.members[assignment.MemberID]; ok {
+					target.Assignment = assignment.Assignment
+				}
+			}
+
+			g.state = Stable
+			for _, waiting := range g.members {
+				g.answerSync(waiting, g.syncResult(waiting))
+			}
+		}
+		return SyncGroupResult{}, true
+	}
+
+	return SyncGroupResult{ErrorCode: ErrorCodeUnknownMemberID}, false
+}
+
+func (g *Group) syncResult(member *Member) SyncGroupResult {
+	return SyncGroupResult{
+		ErrorCode:    ErrorCodeNone,
+		ProtocolType: g.protocolType,
+		ProtocolName: g.protocolName,
+		Assignment:   member.Assignment,
+	}
+}
+
+// validateMember checks the member belongs to the given generation. Must be
+// called with the group lock held.
+func (g *Group) validateMember(memberID string, groupInstanceID string, generationID int32) (*Member, int16) {
+	if g.state == Dead || g.state == Empty {
+		return nil, ErrorCodeUnknownMemberID
+	}
+	if groupInstanceID != "" {
+		if current, ok := g.staticMembers[groupInstanceID]; ok && current != memberID {
+			return nil, ErrorCodeFencedInstanceID
+		}
+	}
+
+	member, ok := g.members[memberID]
+	if !ok {
+		return nil, ErrorCodeUnknownMemberID
+	}
+	if generationID != g.generationID {
+		return nil, ErrorCodeIllegalGeneration
+	}
+	return member, ErrorCodeNone
+}
+
+type HeartbeatRequest struct {
+	GroupID         string
+	GenerationID    int32
+	MemberID        string
+	GroupInstanceID string
+}
+
+// Heartbeat keeps the member's session alive and tells it when to rejoin
+func (gc *GroupCoordinator) Heartbeat(req HeartbeatRequest) int16 {
+	group := gc.group(req.GroupID, false)
+	if group == nil {
+		return ErrorCodeUnknownMemberID
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	member, code := group.validateMember(req.MemberID, req.GroupInstanceID, req.GenerationID)
+	if code != ErrorCodeNone {
+		return code
+	}
+	group.touch(member)
+
+	if group.state == PreparingRebalance {
+		return ErrorCodeRebalanceInProgress
+	}
+	return ErrorCodeNone
+}
+
+type LeaveGroupMember struct {
+	MemberID        string
+	GroupInstanceID string
+}
+
+// LeaveGroup removes members from the group and returns an error code per member
+func (gc *GroupCoordinator) LeaveGroup(groupID string, members []LeaveGroupMember) []int16 {
+	codes := make([]int16, len(members))
+	group := gc.group(groupID, false)
+	if group == nil {
+		for i := range codes {
+			codes[i] = ErrorCodeUnknownMemberID
+		}
+		return codes
+	}
+
+	group.mu.Lock()
+	defer group.unlock()
+
+	removed := false
+	for i, leaving := range members {
+		memberID := leaving.MemberID
+		if leaving.GroupInstanceID != "" {
+			current, ok := group.staticMembers[leaving.GroupInstanceID]
+			switch {
+			case !ok:
+				codes[i] = ErrorCodeUnknownMemberID
+				continue
+			case memberID != "" && memberID != current:
+				codes[i] = ErrorCodeFencedInstanceID
+				continue
+			}
+			memberID = current
+		}
+
+		if _, ok := group.members[memberID]; !ok {
+			codes[i] = ErrorCodeUnknownMemberID
+			continue
+		}
+		group.removeMember(memberID)
+		removed = true
+	}
+
+	if removed {
+		group.onMembershipChange()
+	}
+	return codes
+}
@@ -0,0 +1,192 @@
+package group_coordinator
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCoordinator() *GroupCoordinator {
+	gc := NewGroupCoordinator()
+	gc.MinSessionTimeout = time.Millisecond
+	gc.InitialRebalanceDelay = 0
+	return gc
+}
+
+func joinRequest(memberID string, instanceID string) JoinGroupRequest {
+	return JoinGroupRequest{
+		GroupID:          "group",
+		MemberID:         memberID,
+		GroupInstanceID:  instanceID,
+		ClientID:         "client",
+		SessionTimeout:   200 * time.Millisecond,
+		RebalanceTimeout: 500 * time.Millisecond,
+		ProtocolType:     "consumer",
+		Protocols:        []Protocol{{Name: "range", Metadata: []byte{1}}},
+	}
+}
+
+// joinDynamic runs the two step join of a dynamic member
+func joinDynamic(t *testing.T, gc *GroupCoordinator) JoinGroupResult {
+	first := gc.JoinGroup(joinRequest("", ""))
+	if first.ErrorCode != ErrorCodeMemberIDRequired || first.MemberID == "" {
+		t.Fatalf("Expected MEMBER_ID_REQUIRED with a member id, got %+v", first)
+	}
+	return gc.JoinGroup(joinRequest(first.MemberID, ""))
+}
+
+func TestJoinAndSyncTwoMembers(t *testing.T) {
+	gc := newTestCoordinator()
+
+	// The first member forms generation 1 on its own
+	leader := joinDynamic(t, gc)
+	if leader.ErrorCode != ErrorCodeNone || leader.GenerationID != 1 || leader.LeaderID != leader.MemberID {
+		t.Fatalf("Unexpected first join: %+v", leader)
+	}
+	synced := gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: 1, MemberID: leader.MemberID,
+		Assignments: []SyncGroupAssignment{{MemberID: leader.MemberID, Assignment: []byte("all")}}})
+	if synced.ErrorCode != ErrorCodeNone || string(synced.Assignment) != "all" {
+		t.Fatalf("Unexpected sync: %+v", synced)
+	}
+
+	// A second member triggers a rebalance the leader learns about through its heartbeat
+	var wg sync.WaitGroup
+	var follower JoinGroupResult
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first := gc.JoinGroup(joinRequest("", ""))
+		follower = gc.JoinGroup(joinRequest(first.MemberID, ""))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for gc.Heartbeat(HeartbeatRequest{GroupID: "group", GenerationID: 1, MemberID: leader.MemberID}) != ErrorCodeRebalanceInProgress {
+		if time.Now().After(deadline) {
+			t.Fatal("Leader never saw the rebalance")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rejoined := gc.JoinGroup(joinRequest(leader.MemberID, ""))
+	wg.Wait()
+	if rejoined.GenerationID != 2 || follower.GenerationID != 2 {
+		t.Fatalf("Expected generation 2, got leader %+v follower %+v", rejoined, follower)
+	}
+	if len(rejoined.Members) != 2 || len(follower.Members) != 0 {
+		t.Fatalf("Only the leader should see the members: leader %d, follower %d", len(rejoined.Members), len(follower.Members))
+	}
+
+	// The follower waits for the leader's assignment
+	followerSync := make(chan SyncGroupResult, 1)
+	go func() {
+		followerSync <- gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: 2, MemberID: follower.MemberID})
+	}()
+	gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: 2, MemberID: leader.MemberID,
+		Assignments: []SyncGroupAssignment{
+			{MemberID: leader.MemberID, Assignment: []byte("p0")},
+			{MemberID: follower.MemberID, Assignment: []byte("p1")},
+		}})
+	if result := <-followerSync; result.ErrorCode != ErrorCodeNone || string(result.Assignment) != "p1" {
+		t.Fatalf("Unexpected follower sync: %+v", result)
+	}
+
+	if code := gc.Heartbeat(HeartbeatRequest{GroupID: "group", GenerationID: 1, MemberID: leader.MemberID}); code != ErrorCodeIllegalGeneration {
+		t.Errorf("Expected ILLEGAL_GENERATION for a stale generation, got %d", code)
+	}
+}
+
+func TestSessionTimeoutRemovesMember(t *testing.T) {
+	gc := newTestCoordinator()
+
+	member := joinDynamic(t, gc)
+	gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: member.GenerationID, MemberID: member.MemberID})
+
+	time.Sleep(400 * time.Millisecond)
+	if code := gc.Heartbeat(HeartbeatRequest{GroupID: "group", GenerationID: member.GenerationID, MemberID: member.MemberID}); code != ErrorCodeUnknownMemberID {
+		t.Fatalf("Expected UNKNOWN_MEMBER_ID after the session expired, got %d", code)
+	}
+	if state := gc.group("group", false).State(); state != Empty {
+		t.Errorf("Expected the group to be Empty, got %s", state)
+	}
+}
+
+func TestStaticMemberRejoinFencesOldMemberID(t *testing.T) {
+	gc := newTestCoordinator()
+
+	first := gc.JoinGroup(joinRequest("", "instance-1"))
+	if first.ErrorCode != ErrorCodeNone {
+		t.Fatalf("Static members should not need a member id round trip, got %+v", first)
+	}
+	gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: first.GenerationID, MemberID: first.MemberID, GroupInstanceID: "instance-1"})
+
+	// A restart of the same instance takes over its identity
+	second := gc.JoinGroup(joinRequest("", "instance-1"))
+	if second.ErrorCode != ErrorCodeNone || second.MemberID == first.MemberID {
+		t.Fatalf("Unexpected rejoin: %+v", second)
+	}
+
+	code := gc.Heartbeat(HeartbeatRequest{GroupID: "group", GenerationID: second.GenerationID, MemberID: first.MemberID, GroupInstanceID: "instance-1"})
+	if code != ErrorCodeFencedInstanceID {
+		t.Errorf("Expected FENCED_INSTANCE_ID for the old member id, got %d", code)
+	}
+}
+
+// Close answers the members waiting for a join or sync phase, their callbacks
+// run without the group lock so they may call back into the coordinator
+func TestCloseAnswersWaitingMembers(t *testing.T) {
+	gc := newTestCoordinator()
+	inGroup := func(groupID string, req JoinGroupRequest) JoinGroupRequest {
+		req.GroupID = groupID
+		return req
+	}
+
+	// A new member waits for the leader of generation 1 to rejoin
+	leader := gc.JoinGroup(joinRequest("", "leader"))
+	if leader.ErrorCode != ErrorCodeNone {
+		t.Fatalf("Unexpected first join: %+v", leader)
+	}
+	joined := make(chan JoinGroupResult, 1)
+	heartbeat := make(chan int16, 1)
+	gc.HandleJoinGroup(joinRequest("", "waiting"), func(result JoinGroupResult) {
+		heartbeat <- gc.Heartbeat(HeartbeatRequest{GroupID: "group", GenerationID: result.GenerationID, MemberID: result.MemberID})
+		joined <- result
+	})
+
+	// A follower of generation 2 of another group waits for its leader's
+	// assignment
+	first := gc.JoinGroup(inGroup("synced", joinRequest("", "first")))
+	gc.SyncGroup(SyncGroupRequest{GroupID: "synced", GenerationID: first.GenerationID, MemberID: first.MemberID})
+	second := make(chan JoinGroupResult, 1)
+	gc.HandleJoinGroup(inGroup("synced", joinRequest("", "second")), func(result JoinGroupResult) { second <- result })
+	gc.JoinGroup(inGroup("synced", joinRequest(first.MemberID, "first")))
+	follower := <-second
+	if follower.ErrorCode != ErrorCodeNone || follower.GenerationID != 2 || follower.LeaderID == follower.MemberID {
+		t.Fatalf("Unexpected follower join: %+v", follower)
+	}
+	synced := make(chan SyncGroupResult, 1)
+	gc.HandleSyncGroup(SyncGroupRequest{GroupID: "synced", GenerationID: 2, MemberID: follower.MemberID, GroupInstanceID: "second"},
+		func(result SyncGroupResult) { synced <- result })
+
+	select {
+	case result := <-joined:
+		t.Fatalf("Expected the join to wait, got %+v", result)
+	case result := <-synced:
+		t.Fatalf("Expected the sync to wait, got %+v", result)
+	default:
+	}
+
+	gc.Close()
+	if result := <-joined; result.ErrorCode != ErrorCodeCoordinatorNotAvailable {
+		t.Errorf("Expected COORDINATOR_NOT_AVAILABLE for the waiting join, got %+v", result)
+	}
+	<-heartbeat
+	if result := <-synced; result.ErrorCode != ErrorCodeCoordinatorNotAvailable {
+		t.Errorf("Expected COORDINATOR_NOT_AVAILABLE for the waiting sync, got %+v", result)
+	}
+
+	for _, groupID := range []string{"group", "new"} {
+		if result := gc.JoinGroup(inGroup(groupID, joinRequest("", "later"))); result.ErrorCode != ErrorCodeCoordinatorNotAvailable {
+			t.Errorf("Expected COORDINATOR_NOT_AVAILABLE joining %s after Close, got %+v", groupID, result)
+		}
+	}
+}
@@ -0,0 +1,490 @@
+package group_coordinator
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GroupState int
+
+const (
+	Empty GroupState = iota
+	PreparingRebalance
+	CompletingRebalance
+	Stable
+	Dead
+)
+
+func (s GroupState) String() string {
+	switch s {
+	case Empty:
+		return "Empty"
+	case PreparingRebalance:
+		return "PreparingRebalance"
+	case CompletingRebalance:
+		return "CompletingRebalance"
+	case Stable:
+		return "Stable"
+	case Dead:
+		return "Dead"
+	}
+	return "Unknown"
+}
+
+type Protocol struct {
+	Name     string
+	Metadata []byte
+}
+
+type Member struct {
+	ID               string
+	GroupInstanceID  string // "" for dynamic members
+	ClientID         string
+	ClientHost       string
+	SessionTimeout   time.Duration
+	RebalanceTimeout time.Duration
+	Protocols        []Protocol
+	Assignment       []byte
+
+	lastSeen     time.Time
+	sessionTimer *time.Timer
+
+	// Set while the member waits for the join / sync phase to complete, they
+	// answer the waiting request. They are called through the group's replies,
+	// never with the group lock held.
+	awaitingJoin func(JoinGroupResult)
+	awaitingSync func(SyncGroupResult)
+}
+
+func (m *Member) isStatic() bool {
+	return m.GroupInstanceID != ""
+}
+
+func (m *Member) metadata(protocol string) []byte {
+	for _, p := range m.Protocols {
+		if p.Name == protocol {
+			return p.Metadata
+		}
+	}
+	return nil
+}
+
+func sameProtocols(a []Protocol, b []Protocol) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || string(a[i].Metadata) != string(b[i].Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// Group is the state machine of a single classic consumer group. Every exported
+// method takes the group lock, timers re-enter through the same lock.
+type Group struct {
+	mu sync.Mutex
+	// replies answer the members whose wait ended while the lock was held,
+	// unlock calls them once it is released
+	replies []func()
+	// closed is set once the coordinator shuts down, nobody waits on the
+	// group anymore
+	closed bool
+
+	ID           string
+	state        GroupState
+	protocolType string
+	protocolName string
+	generationID int32
+	leaderID     string
+
+	members       map[string]*Member
+	memberOrder   []string          // member ids in join order, used to pick a leader
+	staticMembers map[string]string // group instance id -> member id
+
+	// Member ids handed out with MEMBER_ID_REQUIRED that have not joined yet
+	pendingMembers map[string]*time.Timer
+
+	initialDelay   time.Duration
+	delayingJoin   bool
+	rebalanceTimer *time.Timer
+	rebalanceID    int // bumped on every rebalance so stale timers can tell
+
+	log *slog.Logger
+}
+
+func newGroup(id string, initialDelay time.Duration, logger *slog.Logger) *Group {
+	return &Group{
+		ID:             id,
+		log:            logger.With("group_id", id),
+		state:          Empty,
+		members:        make(map[string]*Member),
+		staticMembers:  make(map[string]string),
+		pendingMembers: make(map[string]*time.Timer),
+		initialDelay:   initialDelay,
+	}
+}
+
+func newMemberID(prefix string) string {
+	return fmt.Sprintf("%s-%s", prefix, uuid.New().String())
+}
+
+// unlock releases the group lock and then answers the waiting members, so
+// their callbacks may block or call back into the coordinator
+func (g *Group) unlock() {
+	replies := g.replies
+	g.replies = nil
+	g.mu.Unlock()
+	for _, reply := range replies {
+		reply()
+	}
+}
+
+// answerJoin ends the member's wait for the join phase, if it waits
+func (g *Group) answerJoin(member *Member, result JoinGroupResult) {
+	if respond := member.awaitingJoin; respond != nil {
+		member.awaitingJoin = nil
+		g.replies = append(g.replies, func() { respond(result) })
+	}
+}
+
+// answerSync ends the member's wait for the sync phase, if it waits
+func (g *Group) answerSync(member *Member, result SyncGroupResult) {
+	if respond := member.awaitingSync; respond != nil {
+		member.awaitingSync = nil
+		g.replies = append(g.replies, func() { respond(result) })
+	}
+}
+
+// close answers every waiting member with COORDINATOR_NOT_AVAILABLE, their
+// clients find the coordinator again once the broker is back
+func (g *Group) close() {
+	g.mu.Lock()
+	defer g.unlock()
+
+	g.closed = true
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+		g.rebalanceTimer = nil
+	}
+	g.rebalanceID++
+	for _, member := range g.members {
+		g.answerJoin(member, JoinGroupResult{ErrorCode: ErrorCodeCoordinatorNotAvailable, GenerationID: -1, MemberID: member.ID})
+		g.answerSync(member, SyncGroupResult{ErrorCode: ErrorCodeCoordinatorNotAvailable})
+	}
+}
+
+func (g *Group) State() GroupState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// rebalanceTimeout is the longest rebalance timeout of any member
+func (g *Group) rebalanceTimeout() time.Duration {
+	var timeout time.Duration
+	for _, member := range g.members {
+		if member.RebalanceTimeout > timeout {
+			timeout = member.RebalanceTimeout
+		}
+	}
+	return timeout
+}
+
+// candidateProtocols are the protocols every member supports, in the order the
+// first member prefers them
+func (g *Group) candidateProtocols() []string {
+	var candidates []string
+	for i, id := range g.memberOrder {
+		member := g.members[id]
+		if i == 0 {
+			for _, p := range member.Protocols {
+				candidates = append(candidates, p.Name)
+			}
+			continue
+		}
+
+		var kept []string
+		for _, name := range candidates {
+			if member.metadata(name) != nil {
+				kept = append(kept, name)
+			}
+		}
+		candidates = kept
+	}
+	return candidates
+}
+
+// supportsProtocols checks a joining member could be part of the group
+func (g *Group) supportsProtocols(protocolType string, protocols []Protocol) bool {
+	if len(g.members) == 0 {
+		return protocolType != "" && len(protocols) > 0
+	}
+	if protocolType != g.protocolType {
+		return false
+	}
+	for _, candidate := range g.candidateProtocols() {
+		for _, p := range protocols {
+			if p.Name == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectProtocol lets every member vote for its most preferred candidate
+func (g *Group) selectProtocol() string {
+	candidates := g.candidateProtocols()
+	votes := make(map[string]int)
+	for _, member := range g.members {
+		for _, p := range member.Protocols {
+			if contains(candidates, p.Name) {
+				votes[p.Name]++
+				break
+			}
+		}
+	}
+
+	selected := ""
+	for _, name := range candidates {
+		if selected == "" || votes[name] > votes[selected] {
+			selected = name
+		}
+	}
+	return selected
+}
+
+func contains(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) addMember(member *Member) {
+	g.members[member.ID] = member
+	g.memberOrder = append(g.memberOrder, member.ID)
+	if member.isStatic() {
+		g.staticMembers[member.GroupInstanceID] = member.ID
+	}
+	if timer, ok := g.pendingMembers[member.ID]; ok {
+		timer.Stop()
+		delete(g.pendingMembers, member.ID)
+	}
+}
+
+func (g *Group) removeMember(id string) {
+	member, ok := g.members[id]
+	if !ok {
+		return
+	}
+	if member.sessionTimer != nil {
+		member.sessionTimer.Stop()
+	}
+	g.answerJoin(member, JoinGroupResult{ErrorCode: ErrorCodeUnknownMemberID, MemberID: id})
+	g.answerSync(member, SyncGroupResult{ErrorCode: ErrorCodeUnknownMemberID})
+	if member.isStatic() && g.staticMembers[member.GroupInstanceID] == id {
+		delete(g.staticMembers, member.GroupInstanceID)
+	}
+
+	delete(g.members, id)
+	for i, memberID := range g.memberOrder {
+		if memberID == id {
+			g.memberOrder = append(g.memberOrder[:i], g.memberOrder[i+1:]...)
+			break
+		}
+	}
+	if g.leaderID == id {
+		g.leaderID = ""
+	}
+}
+
+// replaceStaticMember hands the identity of a static member to a new member id,
+// fencing whatever the old member id was still waiting on
+func (g *Group) replaceStaticMember(oldID string, newID string) *Member {
+	member := g.members[oldID]
+	g.answerJoin(member, JoinGroupResult{ErrorCode: ErrorCodeFencedInstanceID, MemberID: oldID})
+	g.answerSync(member, SyncGroupResult{ErrorCode: ErrorCodeFencedInstanceID})
+
+	delete(g.members, oldID)
+	member.ID = newID
+	g.members[newID] = member
+	g.staticMembers[member.GroupInstanceID] = newID
+	for i, memberID := range g.memberOrder {
+		if memberID == oldID {
+			g.memberOrder[i] = newID
+		}
+	}
+	if g.leaderID == oldID {
+		g.leaderID = newID
+	}
+	return member
+}
+
+// touch records activity from a member and restarts its session timer
+func (g *Group) touch(member *Member) {
+	member.lastSeen = time.Now()
+	if member.sessionTimer == nil {
+		member.sessionTimer = time.AfterFunc(member.SessionTimeout, func() { g.onSessionTimeout(member) })
+	} else {
+		member.sessionTimer.Reset(member.SessionTimeout)
+	}
+}
+
+func (g *Group) onSessionTimeout(member *Member) {
+	g.mu.Lock()
+	defer g.unlock()
+
+	if g.members[member.ID] != member {
+		return
+	}
+	// Members waiting on a join are bound by the rebalance timeout instead
+	if member.awaitingJoin != nil {
+		return
+	}
+	if remaining := member.SessionTimeout - time.Since(member.lastSeen); remaining > 0 {
+		member.sessionTimer.Reset(remaining)
+		return
+	}
+
+	g.log.Info("Member has failed, removing it from the group", "member_id", member.ID)
+	g.removeMember(member.ID)
+	g.onMembershipChange()
+}
+
+// onMembershipChange moves the group along after a member left or expired
+func (g *Group) onMembershipChange() {
+	switch g.state {
+	case Stable, CompletingRebalance:
+		g.prepareRebalance()
+		g.tryCompleteJoin()
+	case PreparingRebalance:
+		g.tryCompleteJoin()
+	}
+}
+
+func (g *Group) prepareRebalance() {
+	// Whoever waits on a sync for the old generation has to rejoin
+	if g.state == CompletingRebalance {
+		for _, member := range g.members {
+			g.answerSync(member, SyncGroupResult{ErrorCode: ErrorCodeRebalanceInProgress})
+		}
+	}
+	for _, member := range g.members {
+		member.Assignment = nil
+	}
+
+	initial := g.state == Empty
+	g.state = PreparingRebalance
+
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+	}
+	g.rebalanceID++
+	rebalanceID := g.rebalanceID
+	g.rebalanceTimer = time.AfterFunc(g.rebalanceTimeout(), func() { g.onRebalanceTimeout(rebalanceID) })
+
+	// A new group waits a little for more members before the first generation
+	if initial && g.initialDelay > 0 {
+		g.delayingJoin = true
+		time.AfterFunc(g.initialDelay, func() {
+			g.mu.Lock()
+			defer g.unlock()
+			if g.rebalanceID == rebalanceID && g.state == PreparingRebalance {
+				g.delayingJoin = false
+				g.tryCompleteJoin()
+			}
+		})
+	}
+}
+
+func (g *Group) onRebalanceTimeout(rebalanceID int) {
+	g.mu.Lock()
+	defer g.unlock()
+
+	if g.rebalanceID != rebalanceID || g.state != PreparingRebalance {
+		return
+	}
+
+	// Members that did not rejoin in time are out of the group
+	for _, id := range append([]string(nil), g.memberOrder...) {
+		if g.members[id].awaitingJoin == nil {
+			g.log.Info("Member did not rejoin in time, removing it from the group", "member_id", id)
+			g.removeMember(id)
+		}
+	}
+	g.delayingJoin = false
+	g.completeJoin()
+}
+
+func (g *Group) tryCompleteJoin() {
+	if g.state != PreparingRebalance || g.delayingJoin || len(g.pendingMembers) > 0 {
+		return
+	}
+	for _, member := range g.members {
+		if member.awaitingJoin == nil {
+			return
+		}
+	}
+	g.completeJoin()
+}
+
+// completeJoin starts the next generation and answers every waiting join
+func (g *Group) completeJoin() {
+	if g.rebalanceTimer != nil {
+		g.rebalanceTimer.Stop()
+		g.rebalanceTimer = nil
+	}
+	g.rebalanceID++
+
+	g.generationID++
+	if len(g.members) == 0 {
+		g.state = Empty
+		g.protocolName = ""
+		g.leaderID = ""
+		return
+	}
+
+	g.protocolName = g.selectProtocol()
+	if _, ok := g.members[g.leaderID]; !ok {
+		g.leaderID = g.memberOrder[0]
+	}
+	g.state = CompletingRebalance
+
+	for _, member := range g.members {
+		g.answerJoin(member, g.joinResult(member))
+		g.touch(member)
+	}
+}
+
+// joinResult is the JoinGroup answer for a member of the current generation,
+// only the leader gets to see the other members
+func (g *Group) joinResult(member *Member) JoinGroupResult {
+	result := JoinGroupResult{
+		ErrorCode:    ErrorCodeNone,
+		GenerationID: g.generationID,
+		ProtocolType: g.protocolType,
+		ProtocolName: g.protocolName,
+		LeaderID:     g.leaderID,
+		MemberID:     member.ID,
+	}
+	if member.ID == g.leaderID {
+		for _, id := range g.memberOrder {
+			other := g.members[id]
+			result.Members = append(result.Members, JoinGroupMember{
+				MemberID:        other.ID,
+				GroupInstanceID: other.GroupInstanceID,
+				Metadata:        other.metadata(g.protocolName),
+			})
+		}
+	}
+	return result
+}
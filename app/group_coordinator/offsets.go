@@ -0,0 +1,446 @@
+package group_coordinator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/utils"
+)
+
+// Internal topic committed offsets are persisted to
+const OffsetsTopic = "__consumer_offsets"
+
+// Same default as Kafka's offset.metadata.max.bytes
+const MaxOffsetMetadataSize = 4096
+
+// Versions of the __consumer_offsets records this coordinator writes
+const (
+	offsetCommitKeyVersion   = 1
+	offsetCommitValueVersion = 3
+)
+
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+type OffsetAndMetadata struct {
+	Offset          int64
+	LeaderEpoch     int32
+	Metadata        string
+	CommitTimestamp int64
+}
+
+// LoadOffsets opens the partitions of the offsets topic and replays them into
+// the offsets cache, later commits are appended to the same partitions
+func (gc *GroupCoordinator) LoadOffsets(logDir string, partitions int) error {
+	gc.offsetsMu.Lock()
+	defer gc.offsetsMu.Unlock()
+
+	// Every partition is opened before the replay, transaction markers need the
+	// partition count to find the groups of their partition
+	gc.offsetLogs = nil
+	var loaded [][]file_metadata.RecordBatch
+	for partition := 0; partition < partitions; partition++ {
+		log, batches, err := file_metadata.OpenPartitionLog(logDir, OffsetsTopic, int32(partition))
+		if err != nil {
+			return err
+		}
+		gc.offsetLogs = append(gc.offsetLogs, log)
+		loaded = append(loaded, batches)
+	}
+
+	for partition, batches := range loaded {
+		for _, batch := range batches {
+			if batch.IsControl() {
+				gc.completePendingOffsets(batch.ProducerID(), batch.IsCommit(), partition)
+				continue
+			}
+			for _, record := range batch.Records {
+				var err error
+				if batch.IsTransactional() {
+					err = gc.replayPendingOffsetRecord(batch.ProducerID(), record.Key, record.RawValue)
+				} else {
+					err = gc.replayOffsetRecord(record.Key, record.RawValue)
+				}
+				if err != nil {
+					gc.Logger.Warn("Skipping a record", "topic", OffsetsTopic, "partition", partition, "error", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// replayOffsetRecord applies a single __consumer_offsets record, a null value
+// removes the offset. Must be called with offsetsMu held.
+func (gc *GroupCoordinator) replayOffsetRecord(key []byte, value []byte) error {
+	groupID, tp, err := decodeOffsetCommitKey(key)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(gc.offsets[groupID], tp)
+		if len(gc.offsets[groupID]) == 0 {
+			delete(gc.offsets, groupID)
+		}
+		return nil
+	}
+
+	offset, err := decodeOffsetCommitValue(value)
+	if err != nil {
+		return err
+	}
+	gc.storeOffset(groupID, tp, offset)
+	return nil
+}
+
+// replayPendingOffsetRecord applies a record committed in a transaction, it
+// stays pending until the transaction's marker. Must be called with offsetsMu
+// held.
+func (gc *GroupCoordinator) replayPendingOffsetRecord(producerID int64, key []byte, value []byte) error {
+	groupID, tp, err := decodeOffsetCommitKey(key)
+	if err != nil {
+		return err
+	}
+	offset, err := decodeOffsetCommitValue(value)
+	if err != nil {
+		return err
+	}
+	gc.storePendingOffset(producerID, groupID, tp, offset)
+	return nil
+}
+
+func (gc *GroupCoordinator) storeOffset(groupID string, tp TopicPartition, offset OffsetAndMetadata) {
+	if gc.offsets[groupID] == nil {
+		gc.offsets[groupID] = make(map[TopicPartition]OffsetAndMetadata)
+	}
+	gc.offsets[groupID][tp] = offset
+}
+
+func (gc *GroupCoordinator) storePendingOffset(producerID int64, groupID string, tp TopicPartition, offset OffsetAndMetadata) {
+	if gc.pendingOffsets[producerID] == nil {
+		gc.pendingOffsets[producerID] = make(map[string]map[TopicPartition]OffsetAndMetadata)
+	}
+	if gc.pendingOffsets[producerID][groupID] == nil {
+		gc.pendingOffsets[producerID][groupID] = make(map[TopicPartition]OffsetAndMetadata)
+	}
+	gc.pendingOffsets[producerID][groupID][tp] = offset
+}
+
+// completePendingOffsets applies or drops the offsets a producer committed in
+// its transaction to the groups of an offsets partition. Must be called with
+// offsetsMu held.
+func (gc *GroupCoordinator) completePendingOffsets(producerID int64, commit bool, partition int) {
+	for groupID, offsets := range gc.pendingOffsets[producerID] {
+		if offsetsPartitionFor(groupID, len(gc.offsetLogs)) != partition {
+			continue
+		}
+		if commit {
+			for tp, offset := range offsets {
+				gc.storeOffset(groupID, tp, offset)
+			}
+		}
+		delete(gc.pendingOffsets[producerID], groupID)
+	}
+	if len(gc.pendingOffsets[producerID]) == 0 {
+		delete(gc.pendingOffsets, producerID)
+	}
+}
+
+// OffsetsPartitionFor returns the __consumer_offsets partition holding the
+// offsets of a group
+func (gc *GroupCoordinator) OffsetsPartitionFor(groupID string) int32 {
+	gc.offsetsMu.RLock()
+	defer gc.offsetsMu.RUnlock()
+	return int32(offsetsPartitionFor(groupID, max(len(gc.offsetLogs), 1)))
+}
+
+// OffsetLogs returns the partitions of the offsets topic
+func (gc *GroupCoordinator) OffsetLogs() []*file_metadata.PartitionLog {
+	gc.offsetsMu.RLock()
+	defer gc.offsetsMu.RUnlock()
+	return append([]*file_metadata.PartitionLog(nil), gc.offsetLogs...)
+}
+
+// offsetsPartitionFor maps a group to its __consumer_offsets partition the way
+// Kafka does, from the Java hash code of the group id
+func offsetsPartitionFor(groupID string, partitions int) int {
+	return utils.CoordinatorPartition(groupID, partitions)
+}
+
+type OffsetCommit struct {
+	TopicPartition
+	OffsetAndMetadata
+}
+
+type CommitOffsetsRequest struct {
+	GroupID         string
+	GenerationID    int32 // the member epoch for consumer groups, -1 for commits from outside of the group
+	MemberID        string
+	GroupInstanceID string
+	Offsets         []OffsetCommit
+}
+
+// CommitOffsets validates the committer against the group and persists the
+// offsets, it returns an error code per offset
+func (gc *GroupCoordinator) CommitOffsets(req CommitOffsetsRequest) []int16 {
+	return gc.commitOffsets(req, nil)
+}
+
+// TxnProducer identifies the transactional producer committing offsets
+type TxnProducer struct {
+	ProducerID    int64
+	ProducerEpoch int16
+}
+
+// CommitTxnOffsets persists offsets committed in a transaction. They stay
+// pending, invisible to OffsetFetch, until CompleteTxn sees the transaction
+// end. A producer without group metadata commits with a negative generation
+// and is not validated against the group.
+func (gc *GroupCoordinator) CommitTxnOffsets(req CommitOffsetsRequest, producer TxnProducer) []int16 {
+	return gc.commitOffsets(req, &producer)
+}
+
+func (gc *GroupCoordinator) commitOffsets(req CommitOffsetsRequest, producer *TxnProducer) []int16 {
+	codes := make([]int16, len(req.Offsets))
+	fail := func(code int16) []int16 {
+		for i := range codes {
+			codes[i] = code
+		}
+		return codes
+	}
+
+	if req.GroupID == "" {
+		return fail(ErrorCodeInvalidGroupID)
+	}
+
+	gc.mu.Lock()
+	consumerGroup := gc.consumerGroups[req.GroupID]
+	gc.mu.Unlock()
+
+	group := gc.group(req.GroupID, false)
+	if producer != nil && req.GenerationID < 0 && req.MemberID == "" {
+		// Offsets sent by a producer that does not know the group
+	} else if consumerGroup != nil {
+		consumerGroup.mu.Lock()
+		defer consumerGroup.mu.Unlock()
+
+		if code := consumerGroup.validateOffsetCommit(req.MemberID, req.GenerationID); code != ErrorCodeNone {
+			return fail(code)
+		}
+	} else if group != nil {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+
+		if code := group.validateOffsetCommit(req); code != ErrorCodeNone {
+			return fail(code)
+		}
+	} else if req.GenerationID >= 0 {
+		return fail(ErrorCodeIllegalGeneration)
+	}
+
+	var records []file_metadata.RecordData
+	var accepted []OffsetCommit
+	for i, commit := range req.Offsets {
+		if len(commit.Metadata) > MaxOffsetMetadataSize {
+			codes[i] = ErrorCodeOffsetMetadataTooLarge
+			continue
+		}
+		if commit.CommitTimestamp == 0 {
+			commit.CommitTimestamp = time.Now().UnixMilli()
+		}
+		records = append(records, file_metadata.RecordData{
+			Key:   encodeOffsetCommitKey(req.GroupID, commit.TopicPartition),
+			Value: encodeOffsetCommitValue(commit.OffsetAndMetadata),
+		})
+		accepted = append(accepted, commit)
+	}
+	if len(records) == 0 {
+		return codes
+	}
+
+	gc.offsetsMu.Lock()
+	defer gc.offsetsMu.Unlock()
+
+	if len(gc.offsetLogs) == 0 {
+		return fail(ErrorCodeCoordinatorNotAvailable)
+	}
+	log := gc.offsetLogs[offsetsPartitionFor(req.GroupID, len(gc.offsetLogs))]
+	var err error
+	if producer != nil {
+		_, err = log.AppendTransactional(producer.ProducerID, producer.ProducerEpoch, records)
+	} else {
+		_, err = log.Append(records)
+	}
+	if errors.Is(err, file_metadata.ErrInvalidProducerEpoch) {
+		return fail(ErrorCodeProducerFenced)
+	}
+	if err != nil {
+		gc.Logger.Error("Failed to persist the offsets of a group", "group_id", req.GroupID, "error", err)
+		for i := range codes {
+			if codes[i] == ErrorCodeNone {
+				codes[i] = ErrorCodeUnknownServerError
+			}
+		}
+		return codes
+	}
+
+	for _, commit := range accepted {
+		if producer != nil {
+			gc.storePendingOffset(producer.ProducerID, req.GroupID, commit.TopicPartition, commit.OffsetAndMetadata)
+		} else {
+			gc.storeOffset(req.GroupID, commit.TopicPartition, commit.OffsetAndMetadata)
+		}
+	}
+	return codes
+}
+
+// validateOffsetCommit checks the committer may commit for the group. Must be
+// called with the group lock held.
+func (g *Group) validateOffsetCommit(req CommitOffsetsRequest) int16 {
+	if g.state == Dead {
+		return ErrorCodeCoordinatorNotAvailable
+	}
+	// Commits from outside of the group are only allowed while it has no members
+	if req.GenerationID < 0 && g.state == Empty {
+		return ErrorCodeNone
+	}
+	if g.state == CompletingRebalance {
+		return ErrorCodeRebalanceInProgress
+	}
+
+	member, code := g.validateMember(req.MemberID, req.GroupInstanceID, req.GenerationID)
+	if code != ErrorCodeNone {
+		return code
+	}
+	// A commit counts as a heartbeat
+	g.touch(member)
+	return ErrorCodeNone
+}
+
+// CompleteTxn writes the marker ending a producer's transaction to an offsets
+// partition, the offsets it committed there are applied on commit and dropped
+// on abort
+func (gc *GroupCoordinator) CompleteTxn(producerID int64, producerEpoch int16, commit bool, partition int32, coordinatorEpoch int32) error {
+	gc.offsetsMu.Lock()
+	defer gc.offsetsMu.Unlock()
+
+	if int(partition) < 0 || int(partition) >= len(gc.offsetLogs) {
+		return fmt.Errorf("unknown %s partition %d", OffsetsTopic, partition)
+	}
+	if _, err := gc.offsetLogs[partition].AppendMarker(producerID, producerEpoch, commit, coordinatorEpoch); err != nil {
+		return err
+	}
+	gc.completePendingOffsets(producerID, commit, int(partition))
+	return nil
+}
+
+// HasPendingOffset reports whether an open transaction committed an offset for
+// the partition, OffsetFetch requiring stable offsets has to wait for it
+func (gc *GroupCoordinator) HasPendingOffset(groupID string, tp TopicPartition) bool {
+	gc.offsetsMu.RLock()
+	defer gc.offsetsMu.RUnlock()
+
+	for _, groups := range gc.pendingOffsets {
+		if _, ok := groups[groupID][tp]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOffsetFetch checks a member of a consumer group fetching offsets is at
+// its current epoch, fetches from outside of the group are always allowed
+func (gc *GroupCoordinator) ValidateOffsetFetch(groupID string, memberID string, memberEpoch int32) int16 {
+	if memberID == "" && memberEpoch < 0 {
+		return ErrorCodeNone
+	}
+
+	gc.mu.Lock()
+	group := gc.consumerGroups[groupID]
+	gc.mu.Unlock()
+	if group == nil {
+		return ErrorCodeNone
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	member, ok := group.members[memberID]
+	if !ok {
+		return ErrorCodeUnknownMemberID
+	}
+	if memberEpoch != member.Epoch {
+		return ErrorCodeStaleMemberEpoch
+	}
+	return ErrorCodeNone
+}
+
+// FetchOffsets returns a copy of the offsets committed by the group
+func (gc *GroupCoordinator) FetchOffsets(groupID string) map[TopicPartition]OffsetAndMetadata {
+	gc.offsetsMu.RLock()
+	defer gc.offsetsMu.RUnlock()
+
+	offsets := make(map[TopicPartition]OffsetAndMetadata, len(gc.offsets[groupID]))
+	for tp, offset := range gc.offsets[groupID] {
+		offsets[tp] = offset
+	}
+	return offsets
+}
+
+// OffsetCommitKey (version 1)
+// 00 01        // version
+// 00 03 67 72 70  // group (string)
+// 00 03 66 6f 6f  // topic (string)
+// 00 00 00 00  // partition
+
+func encodeOffsetCommitKey(groupID string, tp TopicPartition) []byte {
+	out := binary.BigEndian.AppendUint16(nil, offsetCommitKeyVersion)
+	out = appendString(out, groupID)
+	out = appendString(out, tp.Topic)
+	return binary.BigEndian.AppendUint32(out, uint32(tp.Partition))
+}
+
+func decodeOffsetCommitKey(key []byte) (string, TopicPartition, error) {
+	r := &recordReader{buff: key}
+	version := r.int16()
+	if version != 0 && version != 1 {
+		return "", TopicPartition{}, fmt.Errorf("unsupported offset commit key version %d", version)
+	}
+	groupID := r.string()
+	tp := TopicPartition{Topic: r.string(), Partition: r.int32()}
+	return groupID, tp, r.err
+}
+
+// OffsetCommitValue (version 3)
+// 00 03        // version
+// 00 00 00 00 00 00 00 2a  // offset
+// ff ff ff ff  // leader_epoch
+// 00 00        // metadata (string)
+// 00 00 01 8f ...  // commit_timestamp
+
+func encodeOffsetCommitValue(offset OffsetAndMetadata) []byte {
+	out := binary.BigEndian.AppendUint16(nil, offsetCommitValueVersion)
+	out = binary.BigEndian.AppendUint64(out, uint64(offset.Offset))
+	out = binary.BigEndian.AppendUint32(out, uint32(offset.LeaderEpoch))
+	out = appendString(out, offset.Metadata)
+	return binary.BigEndian.AppendUint64(out, uint64(offset.CommitTimestamp))
+}
+
+func decodeOffsetCommitValue(value []byte) (OffsetAndMetadata, error) {
+	r := &recordReader{buff: value}
+	version := r.int16()
+	if version != offsetCommitValueVersion {
+		return OffsetAndMetadata{}, fmt.Errorf("unsupported offset commit value version %d", version)
+	}
+	offset := OffsetAndMetadata{
+		Offset:          r.int64(),
+		LeaderEpoch:     r.int32(),
+		Metadata:        r.string(),
+		CommitTimestamp: r.int64(),
+	}
+	return offset, r.err
+}
@@ -0,0 +1,119 @@
+package group_coordinator
+
+import "testing"
+
+func TestCommittedOffsetsSurviveReload(t *testing.T) {
+	logDir := t.TempDir()
+	gc := newTestCoordinator()
+	if err := gc.LoadOffsets(logDir, 3); err != nil {
+		t.Fatalf("Failed to load offsets: %v", err)
+	}
+
+	foo0 := TopicPartition{Topic: "foo", Partition: 0}
+	foo1 := TopicPartition{Topic: "foo", Partition: 1}
+	codes := gc.CommitOffsets(CommitOffsetsRequest{GroupID: "simple", GenerationID: -1, Offsets: []OffsetCommit{
+		{TopicPartition: foo0, OffsetAndMetadata: OffsetAndMetadata{Offset: 10, LeaderEpoch: -1, Metadata: "m"}},
+		{TopicPartition: foo1, OffsetAndMetadata: OffsetAndMetadata{Offset: 20, LeaderEpoch: -1, Metadata: string(make([]byte, MaxOffsetMetadataSize+1))}},
+	}})
+	if codes[0] != ErrorCodeNone || codes[1] != ErrorCodeOffsetMetadataTooLarge {
+		t.Fatalf("Unexpected commit codes %v", codes)
+	}
+	gc.CommitOffsets(CommitOffsetsRequest{GroupID: "simple", GenerationID: -1, Offsets: []OffsetCommit{
+		{TopicPartition: foo0, OffsetAndMetadata: OffsetAndMetadata{Offset: 11, LeaderEpoch: 2}},
+	}})
+
+	reloaded := newTestCoordinator()
+	if err := reloaded.LoadOffsets(logDir, 3); err != nil {
+		t.Fatalf("Failed to reload offsets: %v", err)
+	}
+	offsets := reloaded.FetchOffsets("simple")
+	if len(offsets) != 1 || offsets[foo0].Offset != 11 || offsets[foo0].LeaderEpoch != 2 || offsets[foo0].CommitTimestamp == 0 {
+		t.Errorf("Unexpected offsets after reload: %+v", offsets)
+	}
+}
+
+func TestOffsetCommitRequiresCurrentGeneration(t *testing.T) {
+	gc := newTestCoordinator()
+	if err := gc.LoadOffsets(t.TempDir(), 1); err != nil {
+		t.Fatalf("Failed to load offsets: %v", err)
+	}
+
+	member := joinDynamic(t, gc)
+	commit := func(generationID int32, memberID string) int16 {
+		return gc.CommitOffsets(CommitOffsetsRequest{GroupID: "group", GenerationID: generationID, MemberID: memberID,
+			Offsets: []OffsetCommit{{TopicPartition: TopicPartition{Topic: "foo"}, OffsetAndMetadata: OffsetAndMetadata{Offset: 1}}}})[0]
+	}
+
+	if code := commit(member.GenerationID, member.MemberID); code != ErrorCodeRebalanceInProgress {
+		t.Errorf("Expected REBALANCE_IN_PROGRESS before the sync, got %d", code)
+	}
+	gc.SyncGroup(SyncGroupRequest{GroupID: "group", GenerationID: member.GenerationID, MemberID: member.MemberID})
+
+	if code := commit(-1, ""); code != ErrorCodeUnknownMemberID {
+		t.Errorf("Expected UNKNOWN_MEMBER_ID for a commit from outside of an active group, got %d", code)
+	}
+	if code := commit(member.GenerationID+1, member.MemberID); code != ErrorCodeIllegalGeneration {
+		t.Errorf("Expected ILLEGAL_GENERATION, got %d", code)
+	}
+	if code := commit(member.GenerationID, member.MemberID); code != ErrorCodeNone {
+		t.Errorf("Expected the member to commit, got %d", code)
+	}
+}
+
+func TestTxnOffsetsApplyOnCommit(t *testing.T) {
+	logDir := t.TempDir()
+	gc := newTestCoordinator()
+	if err := gc.LoadOffsets(logDir, 1); err != nil {
+		t.Fatalf("Failed to load offsets: %v", err)
+	}
+
+	foo0 := TopicPartition{Topic: "foo", Partition: 0}
+	commit := func(producerID int64, offset int64) []int16 {
+		return gc.CommitTxnOffsets(CommitOffsetsRequest{GroupID: "txn-group", GenerationID: -1, Offsets: []OffsetCommit{
+			{TopicPartition: foo0, OffsetAndMetadata: OffsetAndMetadata{Offset: offset, LeaderEpoch: -1}},
+		}}, TxnProducer{ProducerID: producerID, ProducerEpoch: 0})
+	}
+
+	if codes := commit(1, 5); codes[0] != ErrorCodeNone {
+		t.Fatalf("Failed to commit in a transaction, got %v", codes)
+	}
+	if len(gc.FetchOffsets("txn-group")) != 0 || !gc.HasPendingOffset("txn-group", foo0) {
+		t.Errorf("Expected the offset to stay pending until the transaction ends")
+	}
+	if err := gc.CompleteTxn(1, 0, true, 0, 0); err != nil {
+		t.Fatalf("Failed to complete the transaction: %v", err)
+	}
+	if offsets := gc.FetchOffsets("txn-group"); offsets[foo0].Offset != 5 || gc.HasPendingOffset("txn-group", foo0) {
+		t.Errorf("Expected the committed transaction's offset, got %+v", offsets)
+	}
+
+	commit(2, 9)
+	gc.CompleteTxn(2, 0, false, 0, 0)
+	commit(3, 12) // left open
+
+	reloaded := newTestCoordinator()
+	if err := reloaded.LoadOffsets(logDir, 1); err != nil {
+		t.Fatalf("Failed to reload offsets: %v", err)
+	}
+	if offsets := reloaded.FetchOffsets("txn-group"); offsets[foo0].Offset != 5 {
+		t.Errorf("Expected the aborted offset to be dropped on reload, got %+v", offsets)
+	}
+	if !reloaded.HasPendingOffset("txn-group", foo0) {
+		t.Errorf("Expected the open transaction's offset to be pending after reload")
+	}
+}
+
+// Groups land on the partitions Kafka puts them on, negative and MinInt32
+// hash codes and characters outside the BMP included
+func TestOffsetsPartitionMatchesKafka(t *testing.T) {
+	for groupID, expected := range map[string]int{
+		"payments":           13,
+		"orders-consumer":    40,
+		"polygenelubricants": 0,
+		"group-😀":            7,
+	} {
+		if partition := offsetsPartitionFor(groupID, 50); partition != expected {
+			t.Errorf("Expected %q on partition %d, got %d", groupID, expected, partition)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package group_coordinator
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// recordReader reads the fixed width fields of __consumer_offsets records, the
+// first short read sticks in err
+type recordReader struct {
+	buff   []byte
+	offset int
+	err    error
+}
+
+func (r *recordReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.offset+n > len(r.buff) {
+		r.err = fmt.Errorf("record too short, need %d bytes at %d", n, r.offset)
+		return nil
+	}
+	out := r.buff[r.offset : r.offset+n]
+	r.offset += n
+	return out
+}
+
+func (r *recordReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *recordReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *recordReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *recordReader) string() string {
+	length := r.int16()
+	if length < 0 {
+		return ""
+	}
+	return string(r.next(int(length)))
+}
+
+func appendString(out []byte, val string) []byte {
+	out = binary.BigEndian.AppendUint16(out, uint16(len(val)))
+	return append(out, val...)
+}
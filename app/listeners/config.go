@@ -0,0 +1,200 @@
+package listeners
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SecurityProtocol is how clients of a listener connect and authenticate
+type SecurityProtocol string
+
+const (
+	Plaintext     SecurityProtocol = "PLAINTEXT"
+	Ssl           SecurityProtocol = "SSL"
+	SaslPlaintext SecurityProtocol = "SASL_PLAINTEXT"
+	SaslSsl       SecurityProtocol = "SASL_SSL"
+)
+
+func (p SecurityProtocol) UsesTLS() bool {
+	return p == Ssl || p == SaslSsl
+}
+
+func (p SecurityProtocol) UsesSASL() bool {
+	return p == SaslPlaintext || p == SaslSsl
+}
+
+func parseSecurityProtocol(value string) (SecurityProtocol, error) {
+	switch protocol := SecurityProtocol(strings.ToUpper(value)); protocol {
+	case Plaintext, Ssl, SaslPlaintext, SaslSsl:
+		return protocol, nil
+	}
+	return "", fmt.Errorf("unknown security protocol %q", value)
+}
+
+// Same as Kafka's listener.security.protocol.map default, every protocol is a
+// listener name of its own
+const DefaultSecurityProtocolMap = "PLAINTEXT:PLAINTEXT,SSL:SSL,SASL_PLAINTEXT:SASL_PLAINTEXT,SASL_SSL:SASL_SSL"
+
+// ParseSecurityProtocolMap parses NAME:PROTOCOL pairs
+func ParseSecurityProtocolMap(value string) (map[string]SecurityProtocol, error) {
+	protocols := make(map[string]SecurityProtocol)
+	for _, entry := range splitList(value) {
+		name, protocolName, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid listener.security.protocol.map entry %q", entry)
+		}
+		protocol, err := parseSecurityProtocol(protocolName)
+		if err != nil {
+			return nil, err
+		}
+		name = strings.ToUpper(name)
+		if _, ok := protocols[name]; ok {
+			return nil, fmt.Errorf("listener %s is mapped twice", name)
+		}
+		protocols[name] = protocol
+	}
+	return protocols, nil
+}
+
+// Endpoint is one entry of listeners or advertised.listeners
+type Endpoint struct {
+	Name string
+	Host string // empty binds every interface
+	Port int
+}
+
+func (e Endpoint) String() string {
+	return e.Name + "://" + net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// ParseEndpoints parses NAME://host:port entries, listener names must be
+// unique
+func ParseEndpoints(value string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	seen := make(map[string]bool)
+	for _, entry := range splitList(value) {
+		name, address, ok := strings.Cut(entry, "://")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid listener %q, expected NAME://host:port", entry)
+		}
+		host, portValue, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listener %q: %w", entry, err)
+		}
+		port, err := strconv.Atoi(portValue)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in listener %q", entry)
+		}
+
+		name = strings.ToUpper(name)
+		if seen[name] {
+			return nil, fmt.Errorf("listener %s is configured twice", name)
+		}
+		seen[name] = true
+		endpoints = append(endpoints, Endpoint{Name: name, Host: host, Port: port})
+	}
+	return endpoints, nil
+}
+
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Listener is where the broker accepts connections and the address clients of
+// that listener are told to use
+type Listener struct {
+	Name             string
+	SecurityProtocol SecurityProtocol
+	Host             string
+	Port             int
+	AdvertisedHost   string
+	AdvertisedPort   int
+}
+
+func (l Listener) Address() string {
+	return net.JoinHostPort(l.Host, strconv.Itoa(l.Port))
+}
+
+// Config mirrors listeners, advertised.listeners and
+// listener.security.protocol.map
+type Config struct {
+	Listeners           string
+	AdvertisedListeners string // listeners that are not in it advertise their bind address
+	SecurityProtocolMap string
+	// DefaultHost is advertised for listeners bound to every interface
+	DefaultHost string
+}
+
+// Resolve checks the config and returns its listeners in the configured order
+func (c Config) Resolve() ([]Listener, error) {
+	protocols, err := ParseSecurityProtocolMap(c.SecurityProtocolMap)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := ParseEndpoints(c.Listeners)
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no listeners configured")
+	}
+	advertised, err := ParseEndpoints(c.AdvertisedListeners)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []Listener
+	ports := make(map[int]string)
+	for _, endpoint := range endpoints {
+		protocol, ok := protocols[endpoint.Name]
+		if !ok {
+			return nil, fmt.Errorf("listener %s is not in listener.security.protocol.map", endpoint.Name)
+		}
+		if other, ok := ports[endpoint.Port]; ok && endpoint.Port != 0 {
+			return nil, fmt.Errorf("listeners %s and %s use the same port %d", other, endpoint.Name, endpoint.Port)
+		}
+		ports[endpoint.Port] = endpoint.Name
+
+		listener := Listener{
+			Name:             endpoint.Name,
+			SecurityProtocol: protocol,
+			Host:             endpoint.Host,
+			Port:             endpoint.Port,
+			AdvertisedHost:   endpoint.Host,
+			AdvertisedPort:   endpoint.Port,
+		}
+		for _, a := range advertised {
+			if a.Name == endpoint.Name {
+				listener.AdvertisedHost, listener.AdvertisedPort = a.Host, a.Port
+			}
+		}
+		if listener.AdvertisedHost == "" || net.ParseIP(listener.AdvertisedHost).IsUnspecified() {
+			listener.AdvertisedHost = c.DefaultHost
+		}
+		resolved = append(resolved, listener)
+	}
+
+	for _, a := range advertised {
+		if !hasListener(resolved, a.Name) {
+			return nil, fmt.Errorf("advertised listener %s is not in listeners", a.Name)
+		}
+	}
+	return resolved, nil
+}
+
+func hasListener(listeners []Listener, name string) bool {
+	for _, l := range listeners {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
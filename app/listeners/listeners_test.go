@@ -0,0 +1,186 @@
+package listeners
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	config := Config{
+		Listeners:           "internal://0.0.0.0:9092, EXTERNAL://:9094,SSL://127.0.0.1:9093",
+		AdvertisedListeners: "EXTERNAL://kafka.example.com:19094",
+		SecurityProtocolMap: "INTERNAL:PLAINTEXT,EXTERNAL:SASL_SSL," + DefaultSecurityProtocolMap,
+		DefaultHost:         "localhost",
+	}
+	resolved, err := config.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve listeners: %v", err)
+	}
+
+	expected := []Listener{
+		{Name: "INTERNAL", SecurityProtocol: Plaintext, Host: "0.0.0.0", Port: 9092, AdvertisedHost: "localhost", AdvertisedPort: 9092},
+		{Name: "EXTERNAL", SecurityProtocol: SaslSsl, Host: "", Port: 9094, AdvertisedHost: "kafka.example.com", AdvertisedPort: 19094},
+		{Name: "SSL", SecurityProtocol: Ssl, Host: "127.0.0.1", Port: 9093, AdvertisedHost: "127.0.0.1", AdvertisedPort: 9093},
+	}
+	if len(resolved) != len(expected) {
+		t.Fatalf("Expected %d listeners, got %+v", len(expected), resolved)
+	}
+	for i := range expected {
+		if resolved[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], resolved[i])
+		}
+	}
+
+	for _, tc := range []struct {
+		config Config
+		err    string
+	}{
+		{Config{Listeners: "INTERNAL://:9092", SecurityProtocolMap: DefaultSecurityProtocolMap}, "not in listener.security.protocol.map"},
+		{Config{Listeners: "PLAINTEXT://:9092,SSL://:9092", SecurityProtocolMap: DefaultSecurityProtocolMap}, "same port"},
+		{Config{Listeners: "PLAINTEXT://:9092,plaintext://:9093", SecurityProtocolMap: DefaultSecurityProtocolMap}, "configured twice"},
+		{Config{Listeners: "PLAINTEXT://:9092", AdvertisedListeners: "SSL://host:9093", SecurityProtocolMap: DefaultSecurityProtocolMap}, "not in listeners"},
+		{Config{Listeners: "PLAINTEXT:9092", SecurityProtocolMap: DefaultSecurityProtocolMap}, "expected NAME://host:port"},
+		{Config{Listeners: "A://:9092", SecurityProtocolMap: "A:KERBEROS"}, "unknown security protocol"},
+	} {
+		if _, err := tc.config.Resolve(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%+v: expected an error containing %q, got %v", tc.config, tc.err, err)
+		}
+	}
+}
+
+func TestManagerStartsAndStopsListenersIndependently(t *testing.T) {
+	accepted := make(chan string, 4)
+	manager := NewManager(func(ctx context.Context, conn net.Conn, listener Listener) {
+		accepted <- listener.Name
+		conn.Close()
+	})
+	defer manager.StopAll()
+
+	internal, err := manager.Start(context.Background(), Listener{Name: "INTERNAL", SecurityProtocol: Plaintext, Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := manager.Start(context.Background(), Listener{Name: "EXTERNAL", SecurityProtocol: Plaintext, Host: "127.0.0.1", AdvertisedHost: "example.com", AdvertisedPort: 19092})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if internal.Port == 0 || internal.AdvertisedPort != internal.Port || external.AdvertisedPort != 19092 {
+		t.Errorf("Expected the bound ports to be filled in, got %+v and %+v", internal, external)
+	}
+	if _, err := manager.Start(context.Background(), Listener{Name: "SECURE", SecurityProtocol: Ssl, Host: "127.0.0.1"}); err == nil {
+		t.Errorf("Expected an SSL listener without certificate to fail")
+	}
+
+	for _, listener := range []Listener{internal, external} {
+		conn, err := net.Dial("tcp", listener.Address())
+		if err != nil {
+			t.Fatalf("Failed to connect to %s: %v", listener.Name, err)
+		}
+		conn.Close()
+		if name := <-accepted; name != listener.Name {
+			t.Errorf("Expected the connection to be handed over with %s, got %s", listener.Name, name)
+		}
+	}
+
+	if err := manager.Stop("EXTERNAL"); err != nil {
+		t.Fatalf("Failed to stop the listener: %v", err)
+	}
+	if _, err := net.Dial("tcp", external.Address()); err == nil {
+		t.Errorf("Expected the stopped listener to refuse connections")
+	}
+	if conn, err := net.Dial("tcp", internal.Address()); err != nil {
+		t.Errorf("Expected the other listener to keep running: %v", err)
+	} else {
+		conn.Close()
+	}
+	if running := manager.Listeners(); len(running) != 1 || running[0].Name != "INTERNAL" {
+		t.Errorf("Expected only INTERNAL to be running, got %+v", running)
+	}
+}
+
+func TestManagerDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	manager := NewManager(func(ctx context.Context, conn net.Conn, listener Listener) {
+		defer conn.Close()
+		close(served)
+		<-ctx.Done()
+		conn.Write([]byte("bye"))
+	})
+
+	listener, err := manager.Start(ctx, Listener{Name: "PLAINTEXT", SecurityProtocol: Plaintext, Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", listener.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-served
+
+	manager.StopAll()
+	timeout, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+	if err := manager.Drain(timeout); err != context.DeadlineExceeded {
+		t.Fatalf("Expected a handler that keeps running to exceed the deadline, got %v", err)
+	}
+
+	cancel()
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatalf("Expected the handler to return once its context is done, got %v", err)
+	}
+}
+
+func TestManagerAdmit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := NewManager(func(ctx context.Context, conn net.Conn, listener Listener) {
+		defer conn.Close()
+		conn.Write([]byte("hi"))
+		io.ReadAll(conn)
+	})
+	var admitted atomic.Int32
+	released := make(chan struct{})
+	manager.Admit = func(conn net.Conn, listener Listener) (func(), error) {
+		if admitted.Add(1) > 1 {
+			return nil, errors.New("too many connections")
+		}
+		return func() { close(released) }, nil
+	}
+
+	listener, err := manager.Start(ctx, Listener{Name: "PLAINTEXT", SecurityProtocol: Plaintext, Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := net.Dial("tcp", listener.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(first, greeting); err != nil {
+		t.Fatalf("Expected the first connection to be served, got %v", err)
+	}
+
+	second, err := net.Dial("tcp", listener.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if n, err := second.Read(greeting); err == nil {
+		t.Fatalf("Expected the second connection to be closed, read %d bytes", n)
+	}
+
+	first.Close()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the admitted connection to be released once closed")
+	}
+}
@@ -0,0 +1,180 @@
+package listeners
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Handler serves one accepted connection, TLS connections are handed over
+// before their handshake. It should return once ctx is done and the request it
+// is handling is answered.
+type Handler func(ctx context.Context, conn net.Conn, listener Listener)
+
+// Admit decides whether an accepted connection is served, before a goroutine
+// is started for it. Refused connections are closed right away, release is
+// called once an admitted one is closed.
+type Admit func(conn net.Conn, listener Listener) (release func(), err error)
+
+// Manager runs listeners independently of each other, each with its own
+// accept loop
+type Manager struct {
+	handler Handler
+	// TLSConfig is used by SSL and SASL_SSL listeners
+	TLSConfig *tls.Config
+	// Admit is optional, every connection is served without it
+	Admit Admit
+
+	mu      sync.Mutex
+	running map[string]*runningListener
+	conns   map[net.Conn]struct{}
+
+	// handlers counts the connections still being served
+	handlers sync.WaitGroup
+
+	// Logger receives the accept errors
+	Logger *slog.Logger
+}
+
+type runningListener struct {
+	Listener
+	ln   net.Listener
+	done chan struct{}
+}
+
+func NewManager(handler Handler) *Manager {
+	return &Manager{handler: handler, running: make(map[string]*runningListener), conns: make(map[net.Conn]struct{}), Logger: slog.Default()}
+}
+
+// Start binds a listener and starts accepting on it. Port 0 binds any free
+// port, which is also advertised unless another port is. The handlers of its
+// connections get ctx.
+func (m *Manager) Start(ctx context.Context, listener Listener) (Listener, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[listener.Name]; ok {
+		return listener, fmt.Errorf("listener %s is already running", listener.Name)
+	}
+	if listener.SecurityProtocol.UsesTLS() && m.TLSConfig == nil {
+		return listener, fmt.Errorf("listener %s needs an SSL certificate", listener.Name)
+	}
+
+	ln, err := net.Listen("tcp", listener.Address())
+	if err != nil {
+		return listener, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if listener.AdvertisedPort == 0 {
+		listener.AdvertisedPort = port
+	}
+	listener.Port = port
+	if listener.SecurityProtocol.UsesTLS() {
+		ln = tls.NewListener(ln, m.TLSConfig)
+	}
+
+	running := &runningListener{Listener: listener, ln: ln, done: make(chan struct{})}
+	m.running[listener.Name] = running
+	go m.accept(ctx, running)
+	return listener, nil
+}
+
+func (m *Manager) accept(ctx context.Context, running *runningListener) {
+	defer close(running.done)
+	for {
+		conn, err := running.ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			m.Logger.Error("Failed to accept a connection", "listener", running.Name, "error", err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		release := func() {}
+		if m.Admit != nil {
+			if release, err = m.Admit(conn, running.Listener); err != nil {
+				m.Logger.Info("Refused a connection", "listener", running.Name, "remote", conn.RemoteAddr().String(), "error", err)
+				conn.Close()
+				continue
+			}
+		}
+		m.mu.Lock()
+		m.conns[conn] = struct{}{}
+		m.handlers.Add(1)
+		m.mu.Unlock()
+		go m.serve(ctx, conn, running.Listener, release)
+	}
+}
+
+func (m *Manager) serve(ctx context.Context, conn net.Conn, listener Listener, release func()) {
+	defer m.handlers.Done()
+	defer release()
+	m.handler(ctx, conn, listener)
+
+	m.mu.Lock()
+	delete(m.conns, conn)
+	m.mu.Unlock()
+}
+
+// Stop closes a listener and waits for its accept loop to end, connections
+// it accepted are left open
+func (m *Manager) Stop(name string) error {
+	m.mu.Lock()
+	running, ok := m.running[name]
+	delete(m.running, name)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("listener %s is not running", name)
+	}
+
+	err := running.ln.Close()
+	<-running.done
+	return err
+}
+
+func (m *Manager) StopAll() {
+	for _, listener := range m.Listeners() {
+		m.Stop(listener.Name)
+	}
+}
+
+// Drain waits for the handlers of the accepted connections to return. Once ctx
+// is done the connections still open are closed and Drain gives up on them.
+func (m *Manager) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	for conn := range m.conns {
+		conn.Close()
+	}
+	m.mu.Unlock()
+	return ctx.Err()
+}
+
+// Listeners returns the running listeners sorted by name
+func (m *Manager) Listeners() []Listener {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	listeners := make([]Listener, 0, len(m.running))
+	for _, running := range m.running {
+		listeners = append(listeners, running.Listener)
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].Name < listeners[j].Name })
+	return listeners
+}
@@ -1,39 +1,54 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net"
+	"log/slog"
 	"os"
-	"toy_kafka/app/file_metadata"
+	"os/signal"
+	"syscall"
+	"toy_kafka/app/broker"
 )
 
-var global_metadata *file_metadata.ClusterMetaData
-
 func main() {
-	path := "/tmp/kraft-combined-logs/__cluster_metadata-0/00000000000000000000.log"
-	// file_metadata.CreateAndPopulateLog(path)
-	stream := file_metadata.ReadBin(path)
-	global_metadata, _ = file_metadata.CreateClusterMetaData(stream)
-	file_metadata.PrettyPrintClusterMetaData(*global_metadata)
+	config, err := broker.LoadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 
-	fmt.Println("Logs from your program will appear here!")
+	logger := config.Logger
+	// The packages without a logger of their own log through the default one
+	slog.SetDefault(logger)
 
-	l, err := net.Listen("tcp", "0.0.0.0:9092")
+	server, err := broker.New(config)
 	if err != nil {
-		fmt.Println("Failed to bind to port 9092")
+		logger.Error("Invalid server config", "error", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Start listening on 9092")
-
-	for {
-		conn, err := l.Accept()
-		if err != nil {
-			fmt.Println("Error accepting connection: ", err.Error())
-			os.Exit(1)
-		}
-		go handleConnection(conn)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if err := server.Start(ctx); err != nil {
+		logger.Error("Failed to start the broker", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Started the broker", "addr", server.Addr())
+
+	<-ctx.Done()
+	// A second signal kills the broker right away
+	stop()
+	logger.Info("Shutting down")
+	if err := server.Close(); err != nil {
+		logger.Error("Unclean shutdown", "error", err)
+		os.Exit(1)
 	}
+	logger.Info("Shut down cleanly")
 }
 
 // echo -n "00000031004b00000bcefe56000c6b61666b612d746573746572000212756e6b6e6f776e2d746f7069632d71757a0000000001ff00"  | xxd -r -p | nc localhost 9092 | hexdump -C
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests\nby type", "request", "version")
+	requests.Inc("Produce", "9")
+	requests.Add(2, "Fetch", "16")
+	r.Gauge("unused", "Has no series yet")
+	r.GaugeFunc("end_offset", "End offsets", []string{"topic"}, func(emit func(float64, ...string)) {
+		emit(42, `say "hi"`)
+	})
+	latency := r.Histogram("time_ms", "Latency", []float64{10, 1})
+	latency.Observe(0.5)
+	latency.Observe(5)
+	latency.Observe(50)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP end_offset End offsets
+# TYPE end_offset gauge
+end_offset{topic="say \"hi\""} 42
+# HELP requests_total Requests\nby type
+# TYPE requests_total counter
+requests_total{request="Fetch",version="16"} 2
+requests_total{request="Produce",version="9"} 1
+# HELP time_ms Latency
+# TYPE time_ms histogram
+time_ms_bucket{le="1"} 1
+time_ms_bucket{le="10"} 2
+time_ms_bucket{le="+Inf"} 3
+time_ms_sum 55.5
+time_ms_count 3
+`
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for missing label values")
+		}
+	}()
+	NewRegistry().Counter("c", "", "a").Inc()
+}
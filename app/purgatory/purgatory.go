@@ -0,0 +1,183 @@
+package purgatory
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation is a request that cannot be answered yet, like a Fetch waiting
+// for min_bytes or a Produce waiting for its acks
+type Operation interface {
+	// TryComplete reports whether the operation can complete now. It is
+	// called again every time one of its keys is checked, never at the same
+	// time as another call for the same operation.
+	TryComplete() bool
+	// OnComplete answers the request, it is called exactly once. expired is
+	// set when the timeout passed, or the purgatory was closed, before
+	// TryComplete succeeded.
+	OnComplete(expired bool)
+}
+
+// Purgatory holds operations until they can complete or their timeout
+// passes, like Kafka's DelayedOperationPurgatory. Operations are watched by
+// keys, checking a key tries to complete the operations watching it. The
+// timeouts share a hierarchical timing wheel, so thousands of operations
+// wait without a goroutine each.
+type Purgatory[K comparable] struct {
+	timer *timer
+
+	mu       sync.Mutex
+	watchers map[K]*list.List
+	// waiting has every operation watched and not completed yet
+	waiting map[*delayed[K]]struct{}
+	closed  bool
+}
+
+// delayed is an operation in the purgatory
+type delayed[K comparable] struct {
+	op Operation
+	// mu keeps TryComplete and OnComplete from running at the same time
+	mu        sync.Mutex
+	completed atomic.Bool
+	task      *timerTask
+
+	// watches are the places of the operation in the watcher lists, guarded
+	// by the purgatory's lock
+	watches []watch[K]
+}
+
+type watch[K comparable] struct {
+	key     K
+	element *list.Element
+}
+
+// New creates an empty purgatory, its timer starts with the first operation
+// that waits
+func New[K comparable]() *Purgatory[K] {
+	return &Purgatory[K]{timer: newTimer(), watchers: make(map[K]*list.List), waiting: make(map[*delayed[K]]struct{})}
+}
+
+// TryCompleteElseWatch completes the operation if it can already, otherwise
+// it watches the keys until then or until timeout. It reports whether the
+// operation completed right away, either way it is answered exactly once.
+func (p *Purgatory[K]) TryCompleteElseWatch(op Operation, timeout time.Duration, keys ...K) bool {
+	d := &delayed[K]{op: op}
+	d.task = &timerTask{run: func() { p.expire(d) }}
+	if p.tryComplete(d) {
+		return true
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.expire(d)
+		return false
+	}
+	for _, key := range keys {
+		watchers, ok := p.watchers[key]
+		if !ok {
+			watchers = list.New()
+			p.watchers[key] = watchers
+		}
+		d.watches = append(d.watches, watch[K]{key: key, element: watchers.PushBack(d)})
+	}
+	p.waiting[d] = struct{}{}
+	p.mu.Unlock()
+
+	// A key checked between the first try and the watch would be missed
+	if p.tryComplete(d) {
+		return true
+	}
+	p.timer.schedule(d.task, timeout)
+	return false
+}
+
+// CheckAndComplete tries to complete the operations watching the key, it
+// returns how many completed
+func (p *Purgatory[K]) CheckAndComplete(key K) int {
+	p.mu.Lock()
+	var watching []*delayed[K]
+	if watchers, ok := p.watchers[key]; ok {
+		for e := watchers.Front(); e != nil; e = e.Next() {
+			watching = append(watching, e.Value.(*delayed[K]))
+		}
+	}
+	p.mu.Unlock()
+
+	completed := 0
+	for _, d := range watching {
+		if p.tryComplete(d) {
+			completed++
+		}
+	}
+	return completed
+}
+
+// Delayed is the number of operations waiting
+func (p *Purgatory[K]) Delayed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.waiting)
+}
+
+// Close expires every operation waiting and stops the timer, operations
+// watched later expire right away
+func (p *Purgatory[K]) Close() {
+	p.mu.Lock()
+	p.closed = true
+	waiting := make([]*delayed[K], 0, len(p.waiting))
+	for d := range p.waiting {
+		waiting = append(waiting, d)
+	}
+	p.mu.Unlock()
+
+	for _, d := range waiting {
+		p.expire(d)
+	}
+	p.timer.stop()
+}
+
+func (p *Purgatory[K]) tryComplete(d *delayed[K]) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.completed.Load() || !d.op.TryComplete() {
+		return false
+	}
+	return p.complete(d, false)
+}
+
+func (p *Purgatory[K]) expire(d *delayed[K]) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p.complete(d, true)
+}
+
+// complete answers the operation unless it was already, it must be called
+// with the operation's lock held
+func (p *Purgatory[K]) complete(d *delayed[K], expired bool) bool {
+	if !d.completed.CompareAndSwap(false, true) {
+		return false
+	}
+	p.timer.cancel(d.task)
+	p.unwatch(d)
+	d.op.OnComplete(expired)
+	return true
+}
+
+// unwatch takes a completed operation out of the watcher lists, so keys that
+// are never checked again do not hold on to it
+func (p *Purgatory[K]) unwatch(d *delayed[K]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiting, d)
+	for _, w := range d.watches {
+		watchers := p.watchers[w.key]
+		watchers.Remove(w.element)
+		if watchers.Len() == 0 {
+			delete(p.watchers, w.key)
+		}
+	}
+	d.watches = nil
+}
@@ -0,0 +1,105 @@
+package purgatory
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testOperation struct {
+	ready   atomic.Bool
+	expired chan bool
+}
+
+func newTestOperation() *testOperation {
+	return &testOperation{expired: make(chan bool, 1)}
+}
+
+func (o *testOperation) TryComplete() bool {
+	return o.ready.Load()
+}
+
+func (o *testOperation) OnComplete(expired bool) {
+	o.expired <- expired
+}
+
+func TestCheckAndComplete(t *testing.T) {
+	p := New[string]()
+	defer p.Close()
+
+	ready := newTestOperation()
+	ready.ready.Store(true)
+	if !p.TryCompleteElseWatch(ready, time.Hour, "a") || <-ready.expired {
+		t.Error("Expected an operation that can complete to complete right away")
+	}
+
+	op := newTestOperation()
+	if p.TryCompleteElseWatch(op, time.Hour, "a", "b") {
+		t.Fatal("Expected the operation to wait")
+	}
+	if p.Delayed() != 1 {
+		t.Errorf("Expected one operation waiting, got %d", p.Delayed())
+	}
+	if completed := p.CheckAndComplete("b"); completed != 0 {
+		t.Errorf("Expected nothing to complete before the operation is ready, got %d", completed)
+	}
+
+	op.ready.Store(true)
+	if completed := p.CheckAndComplete("b"); completed != 1 {
+		t.Errorf("Expected the operation to complete, got %d", completed)
+	}
+	if <-op.expired {
+		t.Error("Expected the operation not to expire")
+	}
+	if completed := p.CheckAndComplete("a"); completed != 0 || p.Delayed() != 0 || len(p.watchers) != 0 {
+		t.Errorf("Expected the operation to be unwatched, %d completed, %d waiting, %d keys", completed, p.Delayed(), len(p.watchers))
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	goroutines := runtime.NumGoroutine()
+	ops := make([]*testOperation, 10000)
+	for i := range ops {
+		ops[i] = newTestOperation()
+		p.TryCompleteElseWatch(ops[i], time.Duration(20+i%30)*time.Millisecond, i%100)
+	}
+	// Only the timer's goroutine is added
+	if n := runtime.NumGoroutine(); n > goroutines+1 {
+		t.Errorf("Expected the operations to wait without goroutines, went from %d to %d", goroutines, n)
+	}
+
+	for i, op := range ops {
+		select {
+		case expired := <-op.expired:
+			if !expired {
+				t.Fatalf("Expected operation %d to expire", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected operation %d to expire", i)
+		}
+	}
+	if p.Delayed() != 0 || len(p.watchers) != 0 {
+		t.Errorf("Expected nothing left waiting, got %d operations and %d keys", p.Delayed(), len(p.watchers))
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := New[string]()
+
+	op := newTestOperation()
+	p.TryCompleteElseWatch(op, time.Hour)
+	p.Close()
+	if !<-op.expired {
+		t.Error("Expected closing to expire the operation")
+	}
+
+	late := newTestOperation()
+	p.TryCompleteElseWatch(late, time.Hour, "a")
+	if !<-late.expired {
+		t.Error("Expected an operation watched after closing to expire right away")
+	}
+}
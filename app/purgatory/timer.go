@@ -0,0 +1,280 @@
+package purgatory
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Kafka's purgatories tick every millisecond on wheels of 20 buckets
+const (
+	tickMs    = 1
+	wheelSize = 20
+)
+
+// timerTask runs once its expiration passed, unless it was cancelled first
+type timerTask struct {
+	run        func()
+	expiration int64
+	cancelled  bool
+
+	// bucket is the one the task waits in, nil while it is not in the wheel
+	bucket     *bucket
+	prev, next *timerTask
+}
+
+// bucket is a slot of a timing wheel, its tasks expire within the same tick.
+// It is queued by the expiration of that tick while it holds tasks.
+type bucket struct {
+	// expiration is -1 while the bucket is not queued
+	expiration int64
+	// index is the bucket's place in the queue
+	index int
+	head  timerTask
+}
+
+func newBucket() *bucket {
+	b := &bucket{expiration: -1}
+	b.head.prev, b.head.next = &b.head, &b.head
+	return b
+}
+
+func (b *bucket) add(task *timerTask) {
+	task.bucket = b
+	task.prev, task.next = b.head.prev, &b.head
+	b.head.prev.next = task
+	b.head.prev = task
+}
+
+func (b *bucket) remove(task *timerTask) {
+	task.prev.next = task.next
+	task.next.prev = task.prev
+	task.bucket, task.prev, task.next = nil, nil, nil
+}
+
+// setExpiration reports whether the expiration changed, which is when the
+// bucket needs to be queued again
+func (b *bucket) setExpiration(expiration int64) bool {
+	changed := b.expiration != expiration
+	b.expiration = expiration
+	return changed
+}
+
+// flush empties the bucket and returns its tasks
+func (b *bucket) flush() []*timerTask {
+	var tasks []*timerTask
+	for b.head.next != &b.head {
+		task := b.head.next
+		b.remove(task)
+		tasks = append(tasks, task)
+	}
+	b.expiration = -1
+	return tasks
+}
+
+// bucketQueue orders the queued buckets by expiration, it takes the place of
+// the DelayQueue of Kafka's SystemTimer
+type bucketQueue []*bucket
+
+func (q bucketQueue) Len() int           { return len(q) }
+func (q bucketQueue) Less(i, j int) bool { return q[i].expiration < q[j].expiration }
+func (q bucketQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *bucketQueue) Push(x any) {
+	b := x.(*bucket)
+	b.index = len(*q)
+	*q = append(*q, b)
+}
+
+func (q *bucketQueue) Pop() any {
+	old := *q
+	b := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return b
+}
+
+// timingWheel is a level of Kafka's hierarchical timing wheel. Each bucket
+// covers a tick, and tasks expiring past the wheel's interval go to an
+// overflow wheel whose tick is that interval, created when first needed.
+type timingWheel struct {
+	tick        int64
+	interval    int64
+	currentTime int64
+	buckets     []*bucket
+	overflow    *timingWheel
+}
+
+func newTimingWheel(tick int64, size int, startMs int64) *timingWheel {
+	w := &timingWheel{
+		tick:        tick,
+		interval:    tick * int64(size),
+		currentTime: startMs - startMs%tick,
+		buckets:     make([]*bucket, size),
+	}
+	for i := range w.buckets {
+		w.buckets[i] = newBucket()
+	}
+	return w
+}
+
+// add puts the task in the bucket of its expiration, queueing the bucket
+// when it was empty. It reports false when the task expires within the
+// current tick already.
+func (w *timingWheel) add(task *timerTask, queue *bucketQueue) bool {
+	switch {
+	case task.expiration < w.currentTime+w.tick:
+		return false
+	case task.expiration < w.currentTime+w.interval:
+		virtualID := task.expiration / w.tick
+		b := w.buckets[virtualID%int64(len(w.buckets))]
+		b.add(task)
+		if b.setExpiration(virtualID * w.tick) {
+			heap.Push(queue, b)
+		}
+		return true
+	default:
+		if w.overflow == nil {
+			w.overflow = newTimingWheel(w.interval, len(w.buckets), w.currentTime)
+		}
+		return w.overflow.add(task, queue)
+	}
+}
+
+// advanceClock moves the wheels to the tick of timeMs
+func (w *timingWheel) advanceClock(timeMs int64) {
+	if timeMs >= w.currentTime+w.tick {
+		w.currentTime = timeMs - timeMs%w.tick
+		if w.overflow != nil {
+			w.overflow.advanceClock(w.currentTime)
+		}
+	}
+}
+
+// timer runs tasks after their delay with a single goroutine, which sleeps
+// until the earliest queued bucket expires, like Kafka's SystemTimer with its
+// reaper thread. Adding and cancelling tasks is O(1) however many wait.
+type timer struct {
+	mu    sync.Mutex
+	wheel *timingWheel
+	queue bucketQueue
+	// epoch is what the monotonic clock of the wheel counts from
+	epoch time.Time
+
+	started sync.Once
+	// wake is signalled when a bucket is queued ahead of the one slept for
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newTimer() *timer {
+	return &timer{
+		wheel:   newTimingWheel(tickMs, wheelSize, 0),
+		epoch:   time.Now(),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (t *timer) nowMs() int64 {
+	return time.Since(t.epoch).Milliseconds()
+}
+
+// schedule runs the task after delay, right away when it is due already. The
+// timer's goroutine is started by the first task.
+func (t *timer) schedule(task *timerTask, delay time.Duration) {
+	t.started.Do(func() { go t.run() })
+	// The clock reads whole milliseconds, the expiration is rounded up so
+	// the task does not run up to a tick before its delay passed
+	due := time.Since(t.epoch) + delay
+	task.expiration = int64((due + time.Millisecond - 1) / time.Millisecond)
+	if !t.add(task) {
+		task.run()
+	}
+}
+
+// add reports false when the task is due, it is not added then
+func (t *timer) add(task *timerTask) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if task.cancelled {
+		return true
+	}
+	if !t.wheel.add(task, &t.queue) {
+		return false
+	}
+	if t.queue[0] == task.bucket {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// cancel keeps the task from running, unless it is running already
+func (t *timer) cancel(task *timerTask) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	task.cancelled = true
+	if task.bucket != nil {
+		task.bucket.remove(task)
+	}
+}
+
+// advance expires the buckets due at nowMs. Their tasks are added again,
+// which moves those of the overflow wheels to finer wheels and returns the
+// ones due.
+func (t *timer) advance(nowMs int64) []*timerTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var due []*timerTask
+	for len(t.queue) > 0 && t.queue[0].expiration <= nowMs {
+		b := heap.Pop(&t.queue).(*bucket)
+		t.wheel.advanceClock(b.expiration)
+		for _, task := range b.flush() {
+			if !t.wheel.add(task, &t.queue) {
+				due = append(due, task)
+			}
+		}
+	}
+	return due
+}
+
+func (t *timer) run() {
+	defer close(t.stopped)
+	alarm := time.NewTimer(time.Hour)
+	defer alarm.Stop()
+	for {
+		t.mu.Lock()
+		wait := time.Hour
+		if len(t.queue) > 0 {
+			wait = time.Duration(t.queue[0].expiration-t.nowMs()) * time.Millisecond
+		}
+		t.mu.Unlock()
+		alarm.Reset(wait)
+
+		select {
+		case <-alarm.C:
+		case <-t.wake:
+		case <-t.done:
+			return
+		}
+		for _, task := range t.advance(t.nowMs()) {
+			task.run()
+		}
+	}
+}
+
+// stop ends the timer's goroutine, the tasks still waiting never run
+func (t *timer) stop() {
+	t.started.Do(func() { close(t.stopped) })
+	close(t.done)
+	<-t.stopped
+}
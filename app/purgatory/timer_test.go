@@ -0,0 +1,91 @@
+package purgatory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingWheel(t *testing.T) {
+	timer := newTimer()
+	var ran []int64
+	for _, expiration := range []int64{5, 19, 20, 450, 9000} {
+		task := &timerTask{expiration: expiration}
+		task.run = func() { ran = append(ran, expiration) }
+		if !timer.add(task) {
+			t.Fatalf("Expected the task expiring at %d to be added", expiration)
+		}
+	}
+	cancelled := &timerTask{expiration: 30, run: func() { ran = append(ran, 30) }}
+	timer.add(cancelled)
+	timer.cancel(cancelled)
+
+	// 450 and 9000 are held by the overflow wheels, they move down as the
+	// clock gets closer
+	if timer.wheel.overflow == nil || timer.wheel.overflow.overflow == nil || timer.wheel.overflow.overflow.overflow == nil {
+		t.Fatal("Expected three overflow wheels")
+	}
+	for _, step := range []struct {
+		now int64
+		ran int
+	}{{4, 0}, {5, 1}, {19, 2}, {20, 3}, {449, 3}, {450, 4}, {8999, 4}, {9000, 5}} {
+		for _, task := range timer.advance(step.now) {
+			task.run()
+		}
+		if len(ran) != step.ran {
+			t.Errorf("Expected %d tasks to have run at %d, got %v", step.ran, step.now, ran)
+		}
+	}
+	if len(timer.queue) != 0 {
+		t.Errorf("Expected no bucket left in the queue, got %d", len(timer.queue))
+	}
+
+	// A task due already is not added
+	if timer.add(&timerTask{expiration: 9000}) {
+		t.Error("Expected a task expiring in the current tick to be due")
+	}
+}
+
+func TestTimerSchedule(t *testing.T) {
+	timer := newTimer()
+	defer timer.stop()
+
+	ran := make(chan int, 3)
+	timer.schedule(&timerTask{run: func() { ran <- 2 }}, 40*time.Millisecond)
+	timer.schedule(&timerTask{run: func() { ran <- 1 }}, 10*time.Millisecond)
+	timer.schedule(&timerTask{run: func() { ran <- 0 }}, 0)
+
+	for expected := range 3 {
+		select {
+		case got := <-ran:
+			if got != expected {
+				t.Errorf("Expected task %d to run next, got %d", expected, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected task %d to run", expected)
+		}
+	}
+}
+
+func TestTimerNeverRunsEarly(t *testing.T) {
+	timer := newTimer()
+	defer timer.stop()
+
+	const tasks = 50
+	early := make(chan time.Duration, tasks)
+	for i := range tasks {
+		delay := time.Duration(i%5+1) * time.Millisecond
+		scheduled := time.Now()
+		timer.schedule(&timerTask{run: func() { early <- delay - time.Since(scheduled) }}, delay)
+		time.Sleep(300 * time.Microsecond)
+	}
+	for range tasks {
+		select {
+		case by := <-early:
+			if by > 0 {
+				t.Errorf("Expected no task to run before its delay, one ran %v early", by)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected every task to run")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package quotas
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Match types of a DescribeClientQuotas filter component
+const (
+	MatchExact     = 0
+	MatchDefault   = 1
+	MatchSpecified = 2
+)
+
+// FilterComponent selects entities by one of their parts. Exact matches the
+// named entity, default the default entity, and specified any entity having
+// the type.
+type FilterComponent struct {
+	EntityType string
+	MatchType  int8
+	Match      *string
+}
+
+// Describe returns the quotas of the entities matching every component. A
+// strict filter only matches entities without any other part.
+func (m *Manager) Describe(components []FilterComponent, strict bool) (map[Entity]map[string]float64, error) {
+	exact := make(map[string]string)
+	specified := make(map[string]bool)
+	for _, component := range components {
+		if _, ok := exact[component.EntityType]; ok || specified[component.EntityType] {
+			return nil, fmt.Errorf("Entity type %s cannot appear more than once in the filter.", component.EntityType)
+		}
+		if component.EntityType != UserEntity && component.EntityType != ClientIDEntity {
+			return nil, fmt.Errorf("Unknown entity type %s", component.EntityType)
+		}
+		switch component.MatchType {
+		case MatchExact:
+			if component.Match == nil {
+				return nil, errors.New("Request specified MATCH_TYPE_EXACT, but set match string to null.")
+			}
+			exact[component.EntityType] = *component.Match
+		case MatchDefault:
+			if component.Match != nil {
+				return nil, errors.New("Request specified MATCH_TYPE_DEFAULT, but also specified a match string.")
+			}
+			exact[component.EntityType] = Default
+		case MatchSpecified:
+			specified[component.EntityType] = true
+		default:
+			return nil, fmt.Errorf("Unknown match type %d", component.MatchType)
+		}
+	}
+
+	matched := make(map[Entity]map[string]float64)
+	for entity, values := range m.Quotas() {
+		if strict && len(entity.Parts()) != len(exact)+len(specified) {
+			continue
+		}
+		matches := true
+		for entityType, name := range exact {
+			if entity.part(entityType) != name {
+				matches = false
+			}
+		}
+		for entityType := range specified {
+			if entity.part(entityType) == "" {
+				matches = false
+			}
+		}
+		if matches {
+			matched[entity] = values
+		}
+	}
+	return matched, nil
+}
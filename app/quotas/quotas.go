@@ -0,0 +1,263 @@
+package quotas
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Entity types quotas can be set on
+const (
+	UserEntity     = "user"
+	ClientIDEntity = "client-id"
+)
+
+// Quota keys of the user and client-id entities. Byte rates are in bytes per
+// second, request_percentage is the share of one request handler's time.
+const (
+	ProducerByteRate  = "producer_byte_rate"
+	ConsumerByteRate  = "consumer_byte_rate"
+	RequestPercentage = "request_percentage"
+)
+
+// Default stands for the default entity of a type, it is how Kafka names it in
+// ZooKeeper
+const Default = "<default>"
+
+// Same as Kafka's quota.window.num and quota.window.size.seconds defaults
+const (
+	DefaultWindowNum  = 11
+	DefaultWindowSize = time.Second
+)
+
+// Entity is what a quota applies to, a part is empty when the entity has no
+// such part and Default for the default entity of the type
+type Entity struct {
+	User     string
+	ClientID string
+}
+
+// EntityPart is one element of an entity on the wire, a nil name is the
+// default entity of the type
+type EntityPart struct {
+	Type string
+	Name *string
+}
+
+// NewEntity builds an entity from its parts, validated like Kafka's controller
+// does
+func NewEntity(parts []EntityPart) (Entity, error) {
+	var entity Entity
+	if len(parts) == 0 {
+		return entity, errors.New("Invalid empty client quota entity")
+	}
+	for _, part := range parts {
+		name := Default
+		if part.Name != nil {
+			if *part.Name == "" {
+				return entity, fmt.Errorf("Empty %s name is not allowed", part.Type)
+			}
+			name = *part.Name
+		}
+
+		var field *string
+		switch part.Type {
+		case UserEntity:
+			field = &entity.User
+		case ClientIDEntity:
+			field = &entity.ClientID
+		default:
+			return entity, fmt.Errorf("Unhandled client quota entity type: %s", part.Type)
+		}
+		if *field != "" {
+			return entity, fmt.Errorf("Duplicate %s entity type in client quota entity", part.Type)
+		}
+		*field = name
+	}
+	return entity, nil
+}
+
+// Parts is the inverse of NewEntity
+func (e Entity) Parts() []EntityPart {
+	var parts []EntityPart
+	add := func(entityType string, name string) {
+		if name == "" {
+			return
+		}
+		part := EntityPart{Type: entityType}
+		if name != Default {
+			part.Name = &name
+		}
+		parts = append(parts, part)
+	}
+	add(UserEntity, e.User)
+	add(ClientIDEntity, e.ClientID)
+	return parts
+}
+
+func (e Entity) part(entityType string) string {
+	if entityType == UserEntity {
+		return e.User
+	}
+	return e.ClientID
+}
+
+// ValidateQuota checks a quota value the way Kafka's configs define them, byte
+// rates are longs and every quota has to be positive
+func ValidateQuota(key string, value float64) error {
+	switch key {
+	case ProducerByteRate, ConsumerByteRate:
+		if value != math.Trunc(value) || value > math.MaxInt64 {
+			return fmt.Errorf("Configuration %s must be a Long value", key)
+		}
+	case RequestPercentage:
+	default:
+		return fmt.Errorf("Invalid configuration key %s", key)
+	}
+	if value <= 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("Configuration %s must be positive", key)
+	}
+	return nil
+}
+
+// Manager keeps the configured quotas and measures clients against them
+type Manager struct {
+	windowSize time.Duration
+	windowNum  int
+
+	mu     sync.Mutex
+	quotas map[Entity]map[string]float64
+	rates  map[rateKey]*Rate
+}
+
+// rateKey is a quota, the entity it was found on and the client measured
+// against it. Like the tags of Kafka's quota metrics, the client is the found
+// entity with the user and client-id of the client in place of its parts, so
+// every user falling back to a default quota is measured on its own, while the
+// clients of one user share the user's quota.
+type rateKey struct {
+	key    string
+	entity Entity
+	client Entity
+}
+
+func newRateKey(key string, entity Entity, user string, clientID string) rateKey {
+	client := entity
+	if client.User != "" {
+		client.User = user
+	}
+	if client.ClientID != "" {
+		client.ClientID = clientID
+	}
+	return rateKey{key: key, entity: entity, client: client}
+}
+
+func NewManager(windowSize time.Duration, windowNum int) *Manager {
+	return &Manager{
+		windowSize: windowSize,
+		windowNum:  windowNum,
+		quotas:     make(map[Entity]map[string]float64),
+		rates:      make(map[rateKey]*Rate),
+	}
+}
+
+func (m *Manager) Set(entity Entity, key string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quotas[entity] == nil {
+		m.quotas[entity] = make(map[string]float64)
+	}
+	m.quotas[entity][key] = value
+}
+
+func (m *Manager) Remove(entity Entity, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.quotas[entity], key)
+	if len(m.quotas[entity]) == 0 {
+		delete(m.quotas, entity)
+	}
+	for rk := range m.rates {
+		if rk.key == key && rk.entity == entity {
+			delete(m.rates, rk)
+		}
+	}
+}
+
+// Quotas returns a copy of the configured quotas
+func (m *Manager) Quotas() map[Entity]map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	quotas := make(map[Entity]map[string]float64, len(m.quotas))
+	for entity, values := range m.quotas {
+		quotas[entity] = make(map[string]float64, len(values))
+		for key, value := range values {
+			quotas[entity][key] = value
+		}
+	}
+	return quotas
+}
+
+// resolve finds the quota of a client in the same order of precedence as
+// Kafka, from the most specific user and client-id pair down to the default
+// client-id
+func (m *Manager) resolve(key string, user string, clientID string) (Entity, float64, bool) {
+	for _, entity := range []Entity{
+		{User: user, ClientID: clientID},
+		{User: user, ClientID: Default},
+		{User: user},
+		{User: Default, ClientID: clientID},
+		{User: Default, ClientID: Default},
+		{User: Default},
+		{ClientID: clientID},
+		{ClientID: Default},
+	} {
+		if value, ok := m.quotas[entity][key]; ok {
+			return entity, value, true
+		}
+	}
+	return Entity{}, 0, false
+}
+
+// Record adds value to the client's rate for a quota and returns how long the
+// client has to be throttled for, zero while it is within the quota. Clients
+// without a quota are not measured.
+func (m *Manager) Record(key string, user string, clientID string, value float64, now time.Time) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entity, quota, ok := m.resolve(key, user, clientID)
+	if !ok {
+		return 0
+	}
+	rk := newRateKey(key, entity, user, clientID)
+	rate := m.rates[rk]
+	if rate == nil {
+		rate = NewRate(m.windowSize, m.windowNum)
+		m.rates[rk] = rate
+	}
+	rate.Record(value, now)
+
+	observed := rate.Measure(now)
+	if observed <= quota {
+		return 0
+	}
+	throttle := time.Duration((observed - quota) / quota * float64(rate.WindowSize(now)))
+	// Like Kafka, a client is never throttled for longer than the whole window
+	return min(throttle, time.Duration(m.windowNum)*m.windowSize)
+}
+
+// Unrecord takes back a recorded value, for responses that were throttled
+// instead of sent
+func (m *Manager) Unrecord(key string, user string, clientID string, value float64, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entity, _, ok := m.resolve(key, user, clientID); ok {
+		if rate := m.rates[newRateKey(key, entity, user, clientID)]; rate != nil {
+			rate.Record(-value, now)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package quotas
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	start := time.Unix(1000, 0)
+	rate := NewRate(time.Second, 11)
+
+	// A new rate is measured over ten windows at least
+	rate.Record(1000, start)
+	if got := rate.Measure(start); got != 100 {
+		t.Errorf("Expected 100/s right after the first sample, got %v", got)
+	}
+
+	// Samples older than the whole window stop counting
+	rate.Record(500, start.Add(5*time.Second))
+	if got := rate.Measure(start.Add(12 * time.Second)); got != 50 {
+		t.Errorf("Expected only the second sample to count, got %v", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	m := NewManager(time.Second, 11)
+	now := time.Unix(1000, 0)
+	alice := "alice"
+	entity, err := NewEntity([]EntityPart{{Type: UserEntity, Name: &alice}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(entity, ProducerByteRate, 1000)
+
+	if d := m.Record(ProducerByteRate, "bob", "app", 1e9, now); d != 0 {
+		t.Errorf("Expected clients without a quota to be left alone, got %v", d)
+	}
+	if d := m.Record(ProducerByteRate, "alice", "app", 5000, now); d != 0 {
+		t.Errorf("Expected 500/s to be within the quota, got %v", d)
+	}
+	// 15000 bytes over 10s is 1500/s, half over the quota for 10s
+	if d := m.Record(ProducerByteRate, "alice", "other", 10000, now); d != 5*time.Second {
+		t.Errorf("Expected a 5s throttle shared by alice's clients, got %v", d)
+	}
+	m.Unrecord(ProducerByteRate, "alice", "other", 10000, now)
+	if d := m.Record(ProducerByteRate, "alice", "app", 0, now); d != 0 {
+		t.Errorf("Expected the unrecorded bytes not to count, got %v", d)
+	}
+
+	// A more specific quota takes precedence
+	app := "app"
+	m.Set(Entity{User: "alice", ClientID: app}, ProducerByteRate, 1e6)
+	if d := m.Record(ProducerByteRate, "alice", "app", 10000, now); d != 0 {
+		t.Errorf("Expected the user and client-id quota to apply, got %v", d)
+	}
+
+	// Throttles are bounded by the whole window
+	if d := m.Record(ProducerByteRate, "alice", "third", 1e9, now); d != 11*time.Second {
+		t.Errorf("Expected an 11s throttle bound, got %v", d)
+	}
+}
+
+// Every user falling back to the default quota is measured on its own
+func TestDefaultQuotaPerUser(t *testing.T) {
+	m := NewManager(time.Second, 11)
+	now := time.Unix(1000, 0)
+	m.Set(Entity{User: Default}, ProducerByteRate, 1000)
+
+	if d := m.Record(ProducerByteRate, "alice", "app", 1e6, now); d == 0 {
+		t.Fatal("Expected alice to go over the default quota")
+	}
+	if d := m.Record(ProducerByteRate, "bob", "app", 1, now); d != 0 {
+		t.Errorf("Expected bob not to be throttled for alice's bytes, got %v", d)
+	}
+	if d := m.Record(ProducerByteRate, "alice", "other", 1, now); d == 0 {
+		t.Error("Expected alice's other client to share her throttled rate")
+	}
+
+	// Removing the quota drops the rates measured against it
+	m.Remove(Entity{User: Default}, ProducerByteRate)
+	m.Set(Entity{User: Default}, ProducerByteRate, 1000)
+	if d := m.Record(ProducerByteRate, "alice", "app", 1, now); d != 0 {
+		t.Errorf("Expected alice to start over after the quota was set again, got %v", d)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	m := NewManager(time.Second, 11)
+	m.Set(Entity{User: "alice"}, ProducerByteRate, 1)
+	m.Set(Entity{User: "alice", ClientID: "app"}, ConsumerByteRate, 2)
+	m.Set(Entity{User: Default}, RequestPercentage, 3)
+	m.Set(Entity{ClientID: "app"}, ConsumerByteRate, 4)
+
+	alice := "alice"
+	for _, tc := range []struct {
+		components []FilterComponent
+		strict     bool
+		matches    int
+	}{
+		{nil, false, 4},
+		{nil, true, 0},
+		{[]FilterComponent{{EntityType: UserEntity, MatchType: MatchExact, Match: &alice}}, false, 2},
+		{[]FilterComponent{{EntityType: UserEntity, MatchType: MatchExact, Match: &alice}}, true, 1},
+		{[]FilterComponent{{EntityType: UserEntity, MatchType: MatchDefault}}, false, 1},
+		{[]FilterComponent{{EntityType: UserEntity, MatchType: MatchSpecified}}, false, 3},
+		{[]FilterComponent{{EntityType: ClientIDEntity, MatchType: MatchSpecified}}, true, 1},
+	} {
+		matched, err := m.Describe(tc.components, tc.strict)
+		if err != nil || len(matched) != tc.matches {
+			t.Errorf("Filter %+v strict %v: expected %d entities, got %v, err %v", tc.components, tc.strict, tc.matches, matched, err)
+		}
+	}
+
+	for _, components := range [][]FilterComponent{
+		{{EntityType: UserEntity, MatchType: MatchDefault}, {EntityType: UserEntity, MatchType: MatchSpecified}},
+		{{EntityType: "ip", MatchType: MatchSpecified}},
+		{{EntityType: UserEntity, MatchType: MatchExact}},
+		{{EntityType: UserEntity, MatchType: MatchDefault, Match: &alice}},
+		{{EntityType: UserEntity, MatchType: 3}},
+	} {
+		if _, err := m.Describe(components, false); err == nil {
+			t.Errorf("Expected filter %+v to be rejected", components)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	empty := ""
+	for _, parts := range [][]EntityPart{
+		nil,
+		{{Type: "ip"}},
+		{{Type: UserEntity}, {Type: UserEntity}},
+		{{Type: ClientIDEntity, Name: &empty}},
+	} {
+		if _, err := NewEntity(parts); err == nil {
+			t.Errorf("Expected entity %+v to be rejected", parts)
+		}
+	}
+	if entity, err := NewEntity([]EntityPart{{Type: ClientIDEntity}, {Type: UserEntity}}); err != nil || entity != (Entity{User: Default, ClientID: Default}) {
+		t.Errorf("Expected the default user and client-id, got %+v, err %v", entity, err)
+	}
+
+	for _, tc := range []struct {
+		key   string
+		value float64
+		valid bool
+	}{
+		{ProducerByteRate, 1024, true},
+		{ProducerByteRate, 10.5, false},
+		{ConsumerByteRate, 0, false},
+		{RequestPercentage, 12.5, true},
+		{RequestPercentage, -1, false},
+		{"controller_mutation_rate", 1, false},
+	} {
+		if err := ValidateQuota(tc.key, tc.value); (err == nil) != tc.valid {
+			t.Errorf("%s=%v: expected valid %v, got %v", tc.key, tc.value, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package quotas
+
+import "time"
+
+type sample struct {
+	start time.Time
+	value float64
+}
+
+// Rate is the per-second rate of the values recorded in a sliding window of
+// samples, computed the way Kafka's Rate stat does
+type Rate struct {
+	sampleWindow time.Duration
+	numSamples   int
+	samples      []sample
+}
+
+func NewRate(sampleWindow time.Duration, numSamples int) *Rate {
+	return &Rate{sampleWindow: sampleWindow, numSamples: numSamples}
+}
+
+// Record adds value to the current sample, starting a new one when the
+// current sample is older than the sample window
+func (r *Rate) Record(value float64, now time.Time) {
+	r.purge(now)
+	if n := len(r.samples); n == 0 || now.Sub(r.samples[n-1].start) >= r.sampleWindow {
+		r.samples = append(r.samples, sample{start: now})
+		if len(r.samples) > r.numSamples {
+			r.samples = r.samples[1:]
+		}
+	}
+	r.samples[len(r.samples)-1].value += value
+}
+
+// Measure is the total of the live samples per second of the window
+func (r *Rate) Measure(now time.Time) float64 {
+	r.purge(now)
+	total := 0.0
+	for _, s := range r.samples {
+		total += s.value
+	}
+	return total / r.WindowSize(now).Seconds()
+}
+
+// WindowSize is the time the rate is measured over. It is never shorter than
+// all samples but the current one, so a new client is not measured over a
+// few milliseconds.
+func (r *Rate) WindowSize(now time.Time) time.Duration {
+	var elapsed time.Duration
+	if len(r.samples) > 0 {
+		elapsed = now.Sub(r.samples[0].start)
+	}
+	fullWindows := int(elapsed / r.sampleWindow)
+	if minimum := r.numSamples - 1; fullWindows < minimum {
+		elapsed += time.Duration(minimum-fullWindows) * r.sampleWindow
+	}
+	return elapsed
+}
+
+// purge drops the samples that started before the whole window
+func (r *Rate) purge(now time.Time) {
+	expired := now.Add(-time.Duration(r.numSamples) * r.sampleWindow)
+	for len(r.samples) > 0 && r.samples[0].start.Before(expired) {
+		r.samples = r.samples[1:]
+	}
+}
@@ -0,0 +1,72 @@
+package sasl
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// Authenticator runs the server side of a SASL exchange, one client message at
+// a time
+type Authenticator interface {
+	// Evaluate takes the next client message and returns the server's answer
+	Evaluate(response []byte) ([]byte, error)
+	// Complete reports whether the client is authenticated
+	Complete() bool
+	// Username is the authenticated user once complete
+	Username() string
+}
+
+// NewAuthenticator starts an exchange for one of Mechanisms
+func NewAuthenticator(mechanism string, store *CredentialStore) (Authenticator, error) {
+	switch mechanism {
+	case MechanismPlain:
+		return &plainAuthenticator{store: store}, nil
+	case MechanismScramSHA256, MechanismScramSHA512:
+		newHash, _ := scramHash(mechanism)
+		return &scramAuthenticator{mechanism: mechanism, newHash: newHash, store: store}, nil
+	}
+	return nil, ErrUnsupportedMechanism
+}
+
+// plainAuthenticator implements RFC 4616, a single message holding
+// authzid NUL authcid NUL passwd
+type plainAuthenticator struct {
+	store    *CredentialStore
+	username string
+	complete bool
+}
+
+func (a *plainAuthenticator) Evaluate(response []byte) ([]byte, error) {
+	if a.complete {
+		return nil, fmt.Errorf("PLAIN exchange already complete")
+	}
+
+	parts := strings.Split(string(response), "\x00")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid PLAIN message, expected 3 tokens")
+	}
+	authzid, username, password := parts[0], parts[1], parts[2]
+	if username == "" {
+		return nil, fmt.Errorf("PLAIN message without a username")
+	}
+	if authzid != "" && authzid != username {
+		return nil, fmt.Errorf("authorization id %q does not match user %q", authzid, username)
+	}
+
+	expected, ok := a.store.password(username)
+	if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		return nil, ErrAuthenticationFailed
+	}
+	a.username = username
+	a.complete = true
+	return []byte{}, nil
+}
+
+func (a *plainAuthenticator) Complete() bool {
+	return a.complete
+}
+
+func (a *plainAuthenticator) Username() string {
+	return a.username
+}
@@ -0,0 +1,210 @@
+package sasl
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SASL mechanisms the broker supports
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismScramSHA256 = "SCRAM-SHA-256"
+	MechanismScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Mechanisms lists the supported mechanisms in the order SaslHandshake
+// advertises them
+var Mechanisms = []string{MechanismPlain, MechanismScramSHA256, MechanismScramSHA512}
+
+// Same as Kafka's default iteration count for SCRAM credentials
+const DefaultScramIterations = 4096
+
+var (
+	ErrAuthenticationFailed = errors.New("invalid username or password")
+	ErrUnsupportedMechanism = errors.New("unsupported SASL mechanism")
+)
+
+// ScramCredential is what the broker keeps of a SCRAM password, as stored in
+// UserScramCredentialRecords
+type ScramCredential struct {
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+	Iterations int
+}
+
+// ScramMechanismName maps the mechanism of a UserScramCredentialRecord to its
+// SASL name
+func ScramMechanismName(mechanism int8) (string, bool) {
+	switch mechanism {
+	case 1:
+		return MechanismScramSHA256, true
+	case 2:
+		return MechanismScramSHA512, true
+	}
+	return "", false
+}
+
+func scramHash(mechanism string) (func() hash.Hash, bool) {
+	switch mechanism {
+	case MechanismScramSHA256:
+		return sha256.New, true
+	case MechanismScramSHA512:
+		return sha512.New, true
+	}
+	return nil, false
+}
+
+// NewScramCredential derives the SCRAM credential of a password with a random
+// salt
+func NewScramCredential(mechanism string, password string, iterations int) (ScramCredential, error) {
+	newHash, ok := scramHash(mechanism)
+	if !ok {
+		return ScramCredential{}, ErrUnsupportedMechanism
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return ScramCredential{}, err
+	}
+
+	salted, err := pbkdf2.Key(newHash, password, salt, iterations, newHash().Size())
+	if err != nil {
+		return ScramCredential{}, err
+	}
+	clientKey := hmacOf(newHash, salted, []byte("Client Key"))
+	storedKey := newHash()
+	storedKey.Write(clientKey)
+	return ScramCredential{
+		Salt:       salt,
+		StoredKey:  storedKey.Sum(nil),
+		ServerKey:  hmacOf(newHash, salted, []byte("Server Key")),
+		Iterations: iterations,
+	}, nil
+}
+
+func hmacOf(newHash func() hash.Hash, key []byte, message []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// CredentialStore holds the users allowed to authenticate. PLAIN needs the
+// password itself, so only users from the credentials file can use it.
+type CredentialStore struct {
+	mu        sync.RWMutex
+	passwords map[string]string
+	scram     map[string]map[string]ScramCredential // by mechanism, then user
+}
+
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{
+		passwords: make(map[string]string),
+		scram:     make(map[string]map[string]ScramCredential),
+	}
+}
+
+// LoadFile reads a credentials file of user=password lines, blank lines and
+// lines starting with # are skipped. Every user gets SCRAM credentials too.
+func (s *CredentialStore) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, password, ok := strings.Cut(text, "=")
+		if !ok || strings.TrimSpace(user) == "" {
+			return fmt.Errorf("%s:%d: expected user=password", path, line)
+		}
+		if err := s.SetPassword(strings.TrimSpace(user), password); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// SetPassword adds a user with a plain password, usable with every mechanism
+func (s *CredentialStore) SetPassword(user string, password string) error {
+	credentials := make(map[string]ScramCredential)
+	for _, mechanism := range []string{MechanismScramSHA256, MechanismScramSHA512} {
+		credential, err := NewScramCredential(mechanism, password, DefaultScramIterations)
+		if err != nil {
+			return err
+		}
+		credentials[mechanism] = credential
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwords[user] = password
+	for mechanism, credential := range credentials {
+		s.setScramCredentialLocked(mechanism, user, credential)
+	}
+	return nil
+}
+
+// SetScramCredential adds or replaces the SCRAM credential of a user
+func (s *CredentialStore) SetScramCredential(mechanism string, user string, credential ScramCredential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setScramCredentialLocked(mechanism, user, credential)
+}
+
+func (s *CredentialStore) setScramCredentialLocked(mechanism string, user string, credential ScramCredential) {
+	if s.scram[mechanism] == nil {
+		s.scram[mechanism] = make(map[string]ScramCredential)
+	}
+	s.scram[mechanism][user] = credential
+}
+
+// RemoveScramCredential drops the SCRAM credential of a user
+func (s *CredentialStore) RemoveScramCredential(mechanism string, user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scram[mechanism], user)
+}
+
+// Empty reports whether no user has any credential
+func (s *CredentialStore) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.passwords) > 0 {
+		return false
+	}
+	for _, users := range s.scram {
+		if len(users) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *CredentialStore) password(user string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	password, ok := s.passwords[user]
+	return password, ok
+}
+
+func (s *CredentialStore) scramCredential(mechanism string, user string) (ScramCredential, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	credential, ok := s.scram[mechanism][user]
+	return credential, ok
+}
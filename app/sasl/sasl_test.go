@@ -0,0 +1,145 @@
+package sasl
+
+import (
+	"crypto/pbkdf2"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *CredentialStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "credentials")
+	contents := "# test users\nalice=alice-secret\n\nbob = pass=word\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewCredentialStore()
+	if err := store.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load credentials: %v", err)
+	}
+	return store
+}
+
+func TestPlain(t *testing.T) {
+	store := newTestStore(t)
+
+	for _, tc := range []struct {
+		message string
+		err     bool
+	}{
+		{"\x00alice\x00alice-secret", false},
+		{"alice\x00alice\x00alice-secret", false},
+		{"\x00bob\x00 pass=word", false},
+		{"\x00alice\x00wrong", true},
+		{"\x00carol\x00alice-secret", true},
+		{"bob\x00alice\x00alice-secret", true},
+		{"alice-secret", true},
+	} {
+		auth, _ := NewAuthenticator(MechanismPlain, store)
+		_, err := auth.Evaluate([]byte(tc.message))
+		if (err != nil) != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.message, tc.err, err)
+		}
+		if err == nil && (!auth.Complete() || auth.Username() == "") {
+			t.Errorf("%q: expected a completed exchange", tc.message)
+		}
+	}
+}
+
+// scramClient runs the client side of a SCRAM exchange against an authenticator
+func scramClient(auth Authenticator, mechanism string, user string, password string) error {
+	newHash, _ := scramHash(mechanism)
+	clientFirstBare := "n=" + strings.NewReplacer("=", "=3D", ",", "=2C").Replace(user) + ",r=clientnonce"
+	serverFirst, err := auth.Evaluate([]byte("n,," + clientFirstBare))
+	if err != nil {
+		return err
+	}
+
+	attributes := scramAttributes(string(serverFirst))
+	if !strings.HasPrefix(attributes["r"], "clientnonce") {
+		return fmt.Errorf("server nonce does not extend the client nonce: %s", serverFirst)
+	}
+	salt, _ := base64.StdEncoding.DecodeString(attributes["s"])
+	iterations, _ := strconv.Atoi(attributes["i"])
+	salted, _ := pbkdf2.Key(newHash, password, salt, iterations, newHash().Size())
+	clientKey := hmacOf(newHash, salted, []byte("Client Key"))
+	storedKey := newHash()
+	storedKey.Write(clientKey)
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + attributes["r"]
+	authMessage := []byte(clientFirstBare + "," + string(serverFirst) + "," + withoutProof)
+	signature := hmacOf(newHash, storedKey.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	serverFinal, err := auth.Evaluate([]byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)))
+	if err != nil {
+		return err
+	}
+
+	expected := hmacOf(newHash, hmacOf(newHash, salted, []byte("Server Key")), authMessage)
+	if string(serverFinal) != "v="+base64.StdEncoding.EncodeToString(expected) {
+		return fmt.Errorf("unexpected server signature %s", serverFinal)
+	}
+	return nil
+}
+
+func TestScram(t *testing.T) {
+	store := newTestStore(t)
+
+	for _, mechanism := range []string{MechanismScramSHA256, MechanismScramSHA512} {
+		auth, _ := NewAuthenticator(mechanism, store)
+		if err := scramClient(auth, mechanism, "alice", "alice-secret"); err != nil || !auth.Complete() || auth.Username() != "alice" {
+			t.Errorf("%s: expected alice to authenticate, got %v", mechanism, err)
+		}
+
+		auth, _ = NewAuthenticator(mechanism, store)
+		if err := scramClient(auth, mechanism, "alice", "wrong"); !errors.Is(err, ErrAuthenticationFailed) || auth.Complete() {
+			t.Errorf("%s: expected a wrong password to fail, got %v", mechanism, err)
+		}
+
+		auth, _ = NewAuthenticator(mechanism, store)
+		if err := scramClient(auth, mechanism, "carol", "alice-secret"); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("%s: expected an unknown user to fail, got %v", mechanism, err)
+		}
+	}
+
+	auth, _ := NewAuthenticator(MechanismScramSHA256, store)
+	if _, err := auth.Evaluate([]byte("p=tls-unique,,n=alice,r=abc")); err == nil {
+		t.Errorf("Expected channel binding to be rejected")
+	}
+}
+
+func TestScramCredentialFromMetadata(t *testing.T) {
+	store := NewCredentialStore()
+	credential, err := NewScramCredential(MechanismScramSHA512, "s3cret", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetScramCredential(MechanismScramSHA512, "a,b=c", credential)
+	if store.Empty() {
+		t.Fatalf("Expected the store to hold a credential")
+	}
+
+	auth, _ := NewAuthenticator(MechanismScramSHA512, store)
+	if err := scramClient(auth, MechanismScramSHA512, "a,b=c", "s3cret"); err != nil || auth.Username() != "a,b=c" {
+		t.Errorf("Expected the escaped user to authenticate, got %v", err)
+	}
+	// Without a password the user cannot use PLAIN
+	plain, _ := NewAuthenticator(MechanismPlain, store)
+	if _, err := plain.Evaluate([]byte("\x00a,b=c\x00s3cret")); err == nil {
+		t.Errorf("Expected PLAIN to fail for a SCRAM-only user")
+	}
+
+	store.RemoveScramCredential(MechanismScramSHA512, "a,b=c")
+	if !store.Empty() {
+		t.Errorf("Expected the store to be empty after removing the credential")
+	}
+}
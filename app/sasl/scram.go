@@ -0,0 +1,163 @@
+package sasl
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// scramAuthenticator implements the server side of RFC 5802 without channel
+// binding, the way Kafka does for SCRAM-SHA-256 and SCRAM-SHA-512
+type scramAuthenticator struct {
+	mechanism string
+	newHash   func() hash.Hash
+	store     *CredentialStore
+
+	step            int
+	username        string
+	credential      ScramCredential
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+}
+
+func (a *scramAuthenticator) Evaluate(response []byte) ([]byte, error) {
+	switch a.step {
+	case 0:
+		return a.clientFirst(string(response))
+	case 1:
+		return a.clientFinal(string(response))
+	}
+	return nil, fmt.Errorf("%s exchange already complete", a.mechanism)
+}
+
+func (a *scramAuthenticator) Complete() bool {
+	return a.step == 2
+}
+
+func (a *scramAuthenticator) Username() string {
+	return a.username
+}
+
+// clientFirst handles "n,[a=authzid],n=user,r=nonce[,extensions]" and answers
+// with "r=nonce,s=salt,i=iterations"
+func (a *scramAuthenticator) clientFirst(message string) ([]byte, error) {
+	parts := strings.SplitN(message, ",", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid SCRAM client first message")
+	}
+	if parts[0] != "n" && parts[0] != "y" {
+		return nil, fmt.Errorf("SCRAM channel binding is not supported")
+	}
+	a.gs2Header = parts[0] + "," + parts[1] + ","
+	a.clientFirstBare = parts[2]
+
+	attributes := scramAttributes(a.clientFirstBare)
+	username, err := scramUnescape(attributes["n"])
+	if err != nil || username == "" {
+		return nil, fmt.Errorf("invalid SCRAM username")
+	}
+	if _, ok := attributes["m"]; ok {
+		return nil, fmt.Errorf("SCRAM mandatory extensions are not supported")
+	}
+	clientNonce := attributes["r"]
+	if clientNonce == "" {
+		return nil, fmt.Errorf("SCRAM client first message without a nonce")
+	}
+	if authzid, ok := strings.CutPrefix(parts[1], "a="); ok {
+		if authzid, err := scramUnescape(authzid); err != nil || authzid != username {
+			return nil, fmt.Errorf("authorization id does not match user %q", username)
+		}
+	}
+
+	credential, ok := a.store.scramCredential(a.mechanism, username)
+	if !ok {
+		return nil, ErrAuthenticationFailed
+	}
+
+	serverNonce := make([]byte, 24)
+	if _, err := rand.Read(serverNonce); err != nil {
+		return nil, err
+	}
+	a.username = username
+	a.credential = credential
+	a.nonce = clientNonce + base64.RawURLEncoding.EncodeToString(serverNonce)
+	a.serverFirst = fmt.Sprintf("r=%s,s=%s,i=%d", a.nonce, base64.StdEncoding.EncodeToString(credential.Salt), credential.Iterations)
+	a.step = 1
+	return []byte(a.serverFirst), nil
+}
+
+// clientFinal checks the proof in "c=binding,r=nonce,p=proof" and answers with
+// the server signature "v=signature"
+func (a *scramAuthenticator) clientFinal(message string) ([]byte, error) {
+	withoutProof, proof, ok := strings.Cut(message, ",p=")
+	if !ok {
+		return nil, fmt.Errorf("SCRAM client final message without a proof")
+	}
+	attributes := scramAttributes(withoutProof)
+	if attributes["c"] != base64.StdEncoding.EncodeToString([]byte(a.gs2Header)) {
+		return nil, fmt.Errorf("SCRAM channel binding does not match")
+	}
+	if attributes["r"] != a.nonce {
+		return nil, fmt.Errorf("SCRAM nonce does not match")
+	}
+	clientProof, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil || len(clientProof) != len(a.credential.StoredKey) {
+		return nil, ErrAuthenticationFailed
+	}
+
+	authMessage := []byte(a.clientFirstBare + "," + a.serverFirst + "," + withoutProof)
+	clientSignature := hmacOf(a.newHash, a.credential.StoredKey, authMessage)
+	clientKey := make([]byte, len(clientProof))
+	for i := range clientProof {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+	storedKey := a.newHash()
+	storedKey.Write(clientKey)
+	if subtle.ConstantTimeCompare(storedKey.Sum(nil), a.credential.StoredKey) != 1 {
+		return nil, ErrAuthenticationFailed
+	}
+
+	serverSignature := hmacOf(a.newHash, a.credential.ServerKey, authMessage)
+	a.step = 2
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), nil
+}
+
+// scramAttributes splits "k=v,k=v" into a map, values may contain '='
+func scramAttributes(message string) map[string]string {
+	attributes := make(map[string]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(attribute, "="); ok {
+			attributes[key] = value
+		}
+	}
+	return attributes
+}
+
+// scramUnescape decodes the =2C and =3D escapes of SCRAM usernames
+func scramUnescape(name string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '=' {
+			out.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", fmt.Errorf("invalid escape in %q", name)
+		}
+		switch name[i+1 : i+3] {
+		case "2C":
+			out.WriteByte(',')
+		case "3D":
+			out.WriteByte('=')
+		default:
+			return "", fmt.Errorf("invalid escape in %q", name)
+		}
+		i += 2
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,195 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientAuth mirrors ssl.client.auth
+type ClientAuth int
+
+const (
+	ClientAuthNone ClientAuth = iota
+	ClientAuthRequested
+	ClientAuthRequired
+)
+
+func ParseClientAuth(value string) (ClientAuth, error) {
+	switch value {
+	case "none":
+		return ClientAuthNone, nil
+	case "requested":
+		return ClientAuthRequested, nil
+	case "required":
+		return ClientAuthRequired, nil
+	}
+	return ClientAuthNone, fmt.Errorf("invalid ssl.client.auth %q, expected none, requested or required", value)
+}
+
+func (c ClientAuth) String() string {
+	switch c {
+	case ClientAuthRequested:
+		return "requested"
+	case ClientAuthRequired:
+		return "required"
+	}
+	return "none"
+}
+
+func (c ClientAuth) tlsClientAuth() tls.ClientAuthType {
+	switch c {
+	case ClientAuthRequested:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		return tls.RequireAndVerifyClientCert
+	}
+	return tls.NoClientCert
+}
+
+// Files are checked for changes this often
+const DefaultReloadInterval = 10 * time.Second
+
+// Config holds PEM files, the certificate file may contain the chain after the
+// broker certificate. Client certificates are verified against CAFile.
+type Config struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ClientAuth ClientAuth
+}
+
+// Reloader serves the current certificate and CA of a Config, new handshakes
+// pick up changed files once they are reloaded
+type Reloader struct {
+	config Config
+
+	mu        sync.RWMutex
+	cert      tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// Logger receives the reloads done by Watch
+	Logger *slog.Logger
+}
+
+func NewReloader(config Config) (*Reloader, error) {
+	if config.ClientAuth != ClientAuthNone && config.CAFile == "" {
+		return nil, fmt.Errorf("ssl.client.auth %s needs a CA file", config.ClientAuth)
+	}
+
+	r := &Reloader{config: config, stop: make(chan struct{}), Logger: slog.Default()}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.CAFile != "" {
+		files = append(files, r.config.CAFile)
+	}
+	return files
+}
+
+// Reload reads the files again, on error the previous certificate stays in use
+func (r *Reloader) Reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", r.config.CertFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.CAFile != "" {
+		pem, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", r.config.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any file was modified since the last reload
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files whenever they change until Close
+func (r *Reloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					r.Logger.Error("Failed to reload the SSL certificate, keeping the previous one", "error", err)
+					continue
+				}
+				r.Logger.Info("Reloaded the SSL certificate", "file", r.config.CertFile)
+			}
+		}
+	}()
+}
+
+func (r *Reloader) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// TLSConfig returns a server config that looks up the current certificate and
+// CA on every handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{r.cert},
+				ClientAuth:   r.config.ClientAuth.tlsClientAuth(),
+				ClientCAs:    r.clientCAs,
+			}, nil
+		},
+	}
+}
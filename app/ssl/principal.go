@@ -0,0 +1,133 @@
+package ssl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Principal of clients that did not present a certificate
+const AnonymousPrincipal = "ANONYMOUS"
+
+// MappingRule is one rule of ssl.principal.mapping.rules, either DEFAULT or
+// RULE:pattern/replacement/[LU]
+type MappingRule struct {
+	isDefault   bool
+	pattern     *regexp.Regexp
+	replacement string
+	toLower     bool
+	toUpper     bool
+}
+
+// DefaultMappingRules keeps the distinguished name as the principal
+var DefaultMappingRules = []MappingRule{{isDefault: true}}
+
+var javaGroupReference = regexp.MustCompile(`\$(\d+)`)
+
+// ParseMappingRules parses a comma separated list of rules, commas inside a
+// RULE belong to its pattern or replacement
+func ParseMappingRules(rules string) ([]MappingRule, error) {
+	var parsed []MappingRule
+	rest := rules
+	for {
+		rest = strings.TrimLeft(rest, " \t\n,")
+		if rest == "" {
+			break
+		}
+
+		if after, ok := strings.CutPrefix(rest, "DEFAULT"); ok {
+			parsed = append(parsed, MappingRule{isDefault: true})
+			rest = after
+			continue
+		}
+		after, ok := strings.CutPrefix(rest, "RULE:")
+		if !ok {
+			return nil, fmt.Errorf("invalid principal mapping rule at %q", rest)
+		}
+
+		pattern, after, ok := cutUnescaped(after)
+		if !ok {
+			return nil, fmt.Errorf("principal mapping rule %q has no replacement", rest)
+		}
+		replacement, after, ok := cutUnescaped(after)
+		if !ok {
+			return nil, fmt.Errorf("principal mapping rule %q is not terminated by /", rest)
+		}
+		compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid principal mapping pattern %q: %w", pattern, err)
+		}
+
+		// $1 in a replacement is a group like in Java, Go would read $1x as a
+		// group named 1x
+		replacement = javaGroupReference.ReplaceAllString(replacement, "$${$1}")
+		rule := MappingRule{pattern: compiled, replacement: replacement}
+		switch {
+		case strings.HasPrefix(after, "L"):
+			rule.toLower = true
+			after = after[1:]
+		case strings.HasPrefix(after, "U"):
+			rule.toUpper = true
+			after = after[1:]
+		}
+		parsed = append(parsed, rule)
+		rest = after
+	}
+
+	if len(parsed) == 0 {
+		return DefaultMappingRules, nil
+	}
+	return parsed, nil
+}
+
+// cutUnescaped splits s at the first / not preceded by a backslash, escaped
+// slashes are unescaped
+func cutUnescaped(s string) (string, string, bool) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '/':
+			out.WriteByte('/')
+			i++
+		case s[i] == '/':
+			return out.String(), s[i+1:], true
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
+// MapPrincipal applies the first rule that matches the distinguished name
+func MapPrincipal(rules []MappingRule, dn string) (string, error) {
+	for _, rule := range rules {
+		if rule.isDefault {
+			return dn, nil
+		}
+		if !rule.pattern.MatchString(dn) {
+			continue
+		}
+		principal := rule.pattern.ReplaceAllString(dn, rule.replacement)
+		switch {
+		case rule.toLower:
+			principal = strings.ToLower(principal)
+		case rule.toUpper:
+			principal = strings.ToUpper(principal)
+		}
+		if principal == "" {
+			return "", fmt.Errorf("principal mapping of %q is empty", dn)
+		}
+		return principal, nil
+	}
+	return "", fmt.Errorf("no principal mapping rule matches %q", dn)
+}
+
+// Principal returns the principal of a completed handshake, from the subject
+// of the client certificate
+func Principal(state tls.ConnectionState, rules []MappingRule) (string, error) {
+	if len(state.PeerCertificates) == 0 {
+		return AnonymousPrincipal, nil
+	}
+	return MapPrincipal(rules, state.PeerCertificates[0].Subject.String())
+}
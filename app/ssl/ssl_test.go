@@ -0,0 +1,238 @@
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA when
+// parent is nil
+func newTestCert(t *testing.T, subject pkix.Name, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	t.Helper()
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+type testServer struct {
+	listener   net.Listener
+	principals chan string
+}
+
+// startTestServer accepts connections and reports the principal of each one,
+// or "" when the handshake fails
+func startTestServer(t *testing.T, reloader *Reloader) *testServer {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testServer{listener: listener, principals: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			principal := ""
+			if tlsConn.Handshake() == nil {
+				principal, _ = Principal(tlsConn.ConnectionState(), DefaultMappingRules)
+				tlsConn.Write([]byte{1})
+			}
+			conn.Close()
+			server.principals <- principal
+		}
+	}()
+	return server
+}
+
+// dial connects as a client and returns the certificate the server presented
+func (s *testServer) dial(roots *x509.CertPool, clientCert *testCert) (*x509.Certificate, error) {
+	config := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{clientCert.tlsCertificate()}
+	}
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// TLS 1.3 reports a rejected client certificate on the first read
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, pkix.Name{CommonName: "test-ca"}, nil)
+	server := newTestCert(t, pkix.Name{CommonName: "broker"}, ca)
+	client := newTestCert(t, pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"eng"}, Organization: []string{"Acme"}}, ca)
+	stranger := newTestCert(t, pkix.Name{CommonName: "mallory"}, newTestCert(t, pkix.Name{CommonName: "other-ca"}, nil))
+
+	config := Config{
+		CertFile:   filepath.Join(dir, "server.pem"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		ClientAuth: ClientAuthRequired,
+	}
+	server.write(t, config.CertFile, config.KeyFile)
+	ca.write(t, config.CAFile, "")
+	reloader, err := NewReloader(config)
+	if err != nil {
+		t.Fatalf("Failed to load the certificates: %v", err)
+	}
+	listener := startTestServer(t, reloader)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := listener.dial(roots, client); err != nil {
+		t.Fatalf("Expected the client certificate to be accepted: %v", err)
+	}
+	if principal := <-listener.principals; principal != "CN=alice,OU=eng,O=Acme" {
+		t.Errorf("Expected the principal to be the client's DN, got %q", principal)
+	}
+
+	if _, err := listener.dial(roots, nil); err == nil {
+		t.Errorf("Expected a client without certificate to be rejected")
+	}
+	<-listener.principals
+	if _, err := listener.dial(roots, stranger); err == nil {
+		t.Errorf("Expected a certificate from another CA to be rejected")
+	}
+	<-listener.principals
+}
+
+func TestReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, pkix.Name{CommonName: "test-ca"}, nil)
+	first := newTestCert(t, pkix.Name{CommonName: "broker"}, ca)
+	config := Config{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key")}
+	first.write(t, config.CertFile, config.KeyFile)
+
+	reloader, err := NewReloader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Close()
+	reloader.Watch(10 * time.Millisecond)
+	listener := startTestServer(t, reloader)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if presented, err := listener.dial(roots, nil); err != nil || !presented.Equal(first.cert) {
+		t.Fatalf("Expected the first certificate, got err %v", err)
+	}
+
+	// A broken key must not replace the working certificate
+	os.WriteFile(config.KeyFile, []byte("garbage"), 0o600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(config.KeyFile, later, later)
+	time.Sleep(50 * time.Millisecond)
+	if presented, err := listener.dial(roots, nil); err != nil || !presented.Equal(first.cert) {
+		t.Fatalf("Expected the first certificate after a failed reload, got err %v", err)
+	}
+
+	second := newTestCert(t, pkix.Name{CommonName: "broker"}, ca)
+	second.write(t, config.CertFile, config.KeyFile)
+	later = later.Add(time.Second)
+	os.Chtimes(config.CertFile, later, later)
+	os.Chtimes(config.KeyFile, later, later)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		presented, err := listener.dial(roots, nil)
+		if err == nil && presented.Equal(second.cert) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the rotated certificate to be served without a restart")
+}
+
+func TestMappingRules(t *testing.T) {
+	rules, err := ParseMappingRules(`RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/, RULE:^CN=(.*?),OU=(.*?),O=(.*?)$/$1@$2/L, RULE:^cn=([^,]*).*$/svc\/$1/U, DEFAULT`)
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	for dn, expected := range map[string]string{
+		"CN=kafka,OU=ServiceUsers,O=Acme": "kafka",
+		"CN=Alice,OU=Eng,O=Acme":          "alice@eng",
+		"cn=batch,o=Acme":                 "SVC/BATCH",
+		"CN=bob":                          "CN=bob",
+	} {
+		if principal, err := MapPrincipal(rules, dn); err != nil || principal != expected {
+			t.Errorf("%s: expected %q, got %q (%v)", dn, expected, principal, err)
+		}
+	}
+
+	strict, _ := ParseMappingRules(`RULE:^CN=(.*)$/$1/`)
+	if _, err := MapPrincipal(strict, "O=Acme"); err == nil {
+		t.Errorf("Expected an error when no rule matches")
+	}
+	if _, err := ParseMappingRules("RULE:^CN=(.*)$"); err == nil {
+		t.Errorf("Expected an error for a rule without replacement")
+	}
+}
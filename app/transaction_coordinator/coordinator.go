@@ -0,0 +1,484 @@
+package transaction_coordinator
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+	"toy_kafka/app/file_metadata"
+	"toy_kafka/app/utils"
+)
+
+// Internal topic the state of transactions is persisted to
+const TransactionStateTopic = "__transaction_state"
+
+// Error codes returned to transactional producers
+const (
+	ErrorCodeUnknownServerError        = -1
+	ErrorCodeNone                      = 0
+	ErrorCodeUnknownTopicOrPartition   = 3
+	ErrorCodeCoordinatorNotAvailable   = 15
+	ErrorCodeInvalidRequest            = 42
+	ErrorCodeInvalidTxnState           = 48
+	ErrorCodeInvalidProducerIDMapping  = 49
+	ErrorCodeInvalidTransactionTimeout = 50
+	ErrorCodeConcurrentTransactions    = 51
+	ErrorCodeOperationNotAttempted     = 55
+	ErrorCodeProducerFenced            = 90
+)
+
+// Same default as Kafka's transaction.max.timeout.ms
+const DefaultMaxTransactionTimeout = 15 * time.Minute
+
+type TransactionCoordinator struct {
+	mu   sync.Mutex
+	txns map[string]*Transaction
+
+	// Mirrors the transactions to the __transaction_state partitions
+	logsMu    sync.Mutex
+	stateLogs []*file_metadata.PartitionLog
+
+	MaxTransactionTimeout time.Duration
+
+	// NextProducerID hands out producer ids to new transactional ids
+	NextProducerID func() (int64, error)
+	// WriteMarkers ends the transaction of a producer in each of its partitions
+	WriteMarkers func(producerID int64, producerEpoch int16, commit bool, partitions []TopicPartition) error
+	// PartitionExists reports whether a partition may join a transaction, every
+	// partition may when it is nil
+	PartitionExists func(tp TopicPartition) bool
+
+	// Logger receives the transactions aborted or failing in the background
+	Logger *slog.Logger
+}
+
+func NewTransactionCoordinator() *TransactionCoordinator {
+	return &TransactionCoordinator{
+		txns:                  make(map[string]*Transaction),
+		MaxTransactionTimeout: DefaultMaxTransactionTimeout,
+		Logger:                slog.Default(),
+	}
+}
+
+// transaction returns the transaction with the given id, creating it when
+// create is set
+func (tc *TransactionCoordinator) transaction(id string, create bool) *Transaction {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	txn, ok := tc.txns[id]
+	if !ok && create {
+		txn = &Transaction{TransactionMetadata: newTransactionMetadata(id)}
+		tc.txns[id] = txn
+	}
+	return txn
+}
+
+// Transaction returns a copy of the state of a transactional id
+func (tc *TransactionCoordinator) Transaction(id string) (TransactionMetadata, bool) {
+	txn := tc.transaction(id, false)
+	if txn == nil {
+		return TransactionMetadata{}, false
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	return txn.TransactionMetadata.copy(), true
+}
+
+// Load opens the partitions of the transaction state topic and replays them.
+// Transactions that were being committed or aborted are completed and the
+// timeouts of open ones restarted, so WriteMarkers must already work.
+func (tc *TransactionCoordinator) Load(logDir string, partitions int) error {
+	tc.logsMu.Lock()
+	tc.stateLogs = nil
+	loaded := make(map[string]TransactionMetadata)
+	for partition := 0; partition < partitions; partition++ {
+		log, batches, err := file_metadata.OpenPartitionLog(logDir, TransactionStateTopic, int32(partition))
+		if err != nil {
+			tc.logsMu.Unlock()
+			return err
+		}
+		tc.stateLogs = append(tc.stateLogs, log)
+
+		for _, batch := range batches {
+			for _, record := range batch.Records {
+				id, err := decodeTransactionLogKey(record.Key)
+				if err != nil {
+					tc.Logger.Warn("Skipping a record", "topic", TransactionStateTopic, "partition", partition, "error", err)
+					continue
+				}
+				if record.RawValue == nil {
+					delete(loaded, id)
+					continue
+				}
+				metadata, err := decodeTransactionLogValue(id, record.RawValue)
+				if err != nil {
+					tc.Logger.Warn("Skipping a record", "topic", TransactionStateTopic, "partition", partition, "error", err)
+					continue
+				}
+				loaded[id] = metadata
+			}
+		}
+	}
+	tc.logsMu.Unlock()
+
+	tc.mu.Lock()
+	tc.txns = make(map[string]*Transaction, len(loaded))
+	txns := make([]*Transaction, 0, len(loaded))
+	for id, metadata := range loaded {
+		txn := &Transaction{TransactionMetadata: metadata}
+		tc.txns[id] = txn
+		txns = append(txns, txn)
+	}
+	tc.mu.Unlock()
+
+	for _, txn := range txns {
+		txn.mu.Lock()
+		switch txn.State {
+		case PrepareCommit, PrepareAbort:
+			if code := tc.completeLocked(txn); code != ErrorCodeNone {
+				tc.Logger.Error("Failed to complete a transaction", "transactional_id", txn.TransactionalID, "error_code", code)
+			}
+		case Ongoing:
+			elapsed := time.Duration(time.Now().UnixMilli()-txn.StartTimestamp) * time.Millisecond
+			tc.startTimer(txn, max(txn.timeout()-elapsed, 0))
+		}
+		txn.mu.Unlock()
+	}
+	return nil
+}
+
+// StateLogs returns the partitions of the transaction state topic
+func (tc *TransactionCoordinator) StateLogs() []*file_metadata.PartitionLog {
+	tc.logsMu.Lock()
+	defer tc.logsMu.Unlock()
+	return append([]*file_metadata.PartitionLog(nil), tc.stateLogs...)
+}
+
+// stateLogFor maps a transactional id to its __transaction_state partition the
+// way Kafka does, from the Java hash code of the id
+func stateLogFor(transactionalID string, partitions int) int {
+	return utils.CoordinatorPartition(transactionalID, partitions)
+}
+
+// transition moves a transaction to its next state through update and persists
+// it, the change is rolled back when the write fails. Must be called with the
+// transaction lock held.
+func (tc *TransactionCoordinator) transition(txn *Transaction, update func(m *TransactionMetadata)) error {
+	previous := txn.TransactionMetadata.copy()
+	update(&txn.TransactionMetadata)
+	txn.LastUpdateTimestamp = time.Now().UnixMilli()
+
+	tc.logsMu.Lock()
+	defer tc.logsMu.Unlock()
+
+	err := fmt.Errorf("%s is not loaded", TransactionStateTopic)
+	if len(tc.stateLogs) > 0 {
+		log := tc.stateLogs[stateLogFor(txn.TransactionalID, len(tc.stateLogs))]
+		_, err = log.Append([]file_metadata.RecordData{{
+			Key:   encodeTransactionLogKey(txn.TransactionalID),
+			Value: encodeTransactionLogValue(txn.TransactionMetadata),
+		}})
+	}
+	if err != nil {
+		tc.Logger.Error("Failed to persist a transaction", "transactional_id", txn.TransactionalID, "error", err)
+		txn.TransactionMetadata = previous
+		return err
+	}
+	return nil
+}
+
+func (m TransactionMetadata) timeout() time.Duration {
+	return time.Duration(m.TimeoutMs) * time.Millisecond
+}
+
+// startTimer aborts the transaction once after is over, unless it ended or
+// the producer moved to another epoch in the meantime. Must be called with
+// the transaction lock held.
+func (tc *TransactionCoordinator) startTimer(txn *Transaction, after time.Duration) {
+	if txn.timer != nil {
+		txn.timer.Stop()
+	}
+	producerID, epoch := txn.ProducerID, txn.ProducerEpoch
+	txn.timer = time.AfterFunc(after, func() {
+		txn.mu.Lock()
+		defer txn.mu.Unlock()
+		if txn.State != Ongoing || txn.ProducerID != producerID || txn.ProducerEpoch != epoch {
+			return
+		}
+		tc.Logger.Info("Aborting a transaction that timed out", "transactional_id", txn.TransactionalID, "timeout_ms", txn.TimeoutMs)
+		tc.endLocked(txn, false, true)
+	})
+}
+
+type InitProducerIDRequest struct {
+	TransactionalID      string
+	TransactionTimeoutMs int32
+	ProducerID           int64 // -1 unless an existing producer asks for a bumped epoch
+	ProducerEpoch        int16
+}
+
+type InitProducerIDResult struct {
+	ErrorCode     int16
+	ProducerID    int64
+	ProducerEpoch int16
+}
+
+// InitProducerID registers a transactional producer. A new transactional id
+// gets a fresh producer id, an existing one a bumped epoch that fences its
+// previous incarnation, whose open transaction is aborted.
+func (tc *TransactionCoordinator) InitProducerID(req InitProducerIDRequest) InitProducerIDResult {
+	fail := func(code int16) InitProducerIDResult {
+		return InitProducerIDResult{ErrorCode: code, ProducerID: -1, ProducerEpoch: -1}
+	}
+
+	if req.TransactionalID == "" {
+		return fail(ErrorCodeInvalidRequest)
+	}
+	if req.TransactionTimeoutMs <= 0 || time.Duration(req.TransactionTimeoutMs)*time.Millisecond > tc.MaxTransactionTimeout {
+		return fail(ErrorCodeInvalidTransactionTimeout)
+	}
+
+	txn := tc.transaction(req.TransactionalID, true)
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	// A producer asking to bump its own epoch must still be the current one
+	if txn.ProducerID >= 0 && req.ProducerID >= 0 && (req.ProducerID != txn.ProducerID || req.ProducerEpoch != txn.ProducerEpoch) {
+		return fail(ErrorCodeProducerFenced)
+	}
+
+	switch txn.State {
+	case PrepareCommit, PrepareAbort, PrepareEpochFence:
+		return fail(ErrorCodeConcurrentTransactions)
+	case Ongoing:
+		if code := tc.endLocked(txn, false, true); code != ErrorCodeNone {
+			return fail(ErrorCodeConcurrentTransactions)
+		}
+	}
+
+	producerID, epoch := txn.ProducerID, txn.ProducerEpoch+1
+	// A new transactional id, or an epoch about to overflow, takes a new producer id
+	if producerID < 0 || epoch >= math.MaxInt16 {
+		id, err := tc.NextProducerID()
+		if err != nil {
+			tc.Logger.Error("Failed to allocate a producer id", "transactional_id", req.TransactionalID, "error", err)
+			return fail(ErrorCodeUnknownServerError)
+		}
+		producerID, epoch = id, 0
+	}
+
+	err := tc.transition(txn, func(m *TransactionMetadata) {
+		m.ProducerID = producerID
+		m.ProducerEpoch = epoch
+		m.TimeoutMs = req.TransactionTimeoutMs
+		m.State = Empty
+		m.Partitions = make(map[TopicPartition]struct{})
+		m.StartTimestamp = -1
+	})
+	if err != nil {
+		return fail(ErrorCodeCoordinatorNotAvailable)
+	}
+	return InitProducerIDResult{ErrorCode: ErrorCodeNone, ProducerID: producerID, ProducerEpoch: epoch}
+}
+
+// validateProducer checks the producer is the current incarnation of the
+// transactional id. Must be called with the transaction lock held.
+func (txn *Transaction) validateProducer(producerID int64, producerEpoch int16) int16 {
+	if txn.ProducerID < 0 || txn.ProducerID != producerID {
+		return ErrorCodeInvalidProducerIDMapping
+	}
+	if producerEpoch != txn.ProducerEpoch {
+		return ErrorCodeProducerFenced
+	}
+	return ErrorCodeNone
+}
+
+type AddPartitionsRequest struct {
+	TransactionalID string
+	ProducerID      int64
+	ProducerEpoch   int16
+	Partitions      []TopicPartition
+}
+
+// AddPartitions adds partitions to the transaction of the producer, starting
+// one when none is open. It returns an error code per partition, a single
+// unknown partition fails the whole request.
+func (tc *TransactionCoordinator) AddPartitions(req AddPartitionsRequest) []int16 {
+	codes := make([]int16, len(req.Partitions))
+	fail := func(code int16) []int16 {
+		for i := range codes {
+			codes[i] = code
+		}
+		return codes
+	}
+
+	unknown := false
+	for i, tp := range req.Partitions {
+		if tc.PartitionExists != nil && !tc.PartitionExists(tp) {
+			codes[i] = ErrorCodeUnknownTopicOrPartition
+			unknown = true
+		}
+	}
+	if unknown {
+		for i := range codes {
+			if codes[i] == ErrorCodeNone {
+				codes[i] = ErrorCodeOperationNotAttempted
+			}
+		}
+		return codes
+	}
+
+	txn := tc.transaction(req.TransactionalID, false)
+	if txn == nil {
+		return fail(ErrorCodeInvalidProducerIDMapping)
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if code := txn.validateProducer(req.ProducerID, req.ProducerEpoch); code != ErrorCodeNone {
+		return fail(code)
+	}
+	switch txn.State {
+	case PrepareCommit, PrepareAbort, PrepareEpochFence:
+		return fail(ErrorCodeConcurrentTransactions)
+	case Dead:
+		return fail(ErrorCodeInvalidTxnState)
+	}
+
+	added := false
+	for _, tp := range req.Partitions {
+		if _, ok := txn.Partitions[tp]; !ok {
+			added = true
+		}
+	}
+	if !added && txn.State == Ongoing {
+		return codes
+	}
+
+	starting := txn.State != Ongoing
+	err := tc.transition(txn, func(m *TransactionMetadata) {
+		if starting {
+			m.State = Ongoing
+			m.Partitions = make(map[TopicPartition]struct{})
+			m.StartTimestamp = time.Now().UnixMilli()
+		}
+		for _, tp := range req.Partitions {
+			m.Partitions[tp] = struct{}{}
+		}
+	})
+	if err != nil {
+		return fail(ErrorCodeCoordinatorNotAvailable)
+	}
+	if starting {
+		tc.startTimer(txn, txn.timeout())
+	}
+	return codes
+}
+
+// EndTransaction commits or aborts the open transaction of the producer,
+// writing the markers before it returns. Retrying the same outcome succeeds.
+func (tc *TransactionCoordinator) EndTransaction(transactionalID string, producerID int64, producerEpoch int16, commit bool) int16 {
+	txn := tc.transaction(transactionalID, false)
+	if txn == nil {
+		return ErrorCodeInvalidProducerIDMapping
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if code := txn.validateProducer(producerID, producerEpoch); code != ErrorCodeNone {
+		return code
+	}
+
+	switch txn.State {
+	case Ongoing:
+		return tc.endLocked(txn, commit, false)
+	case PrepareCommit, PrepareAbort:
+		// The markers of an earlier attempt could not all be written
+		if (txn.State == PrepareCommit) != commit {
+			return ErrorCodeInvalidTxnState
+		}
+		return tc.completeLocked(txn)
+	case CompleteCommit:
+		if commit {
+			return ErrorCodeNone
+		}
+	case CompleteAbort:
+		if !commit {
+			return ErrorCodeNone
+		}
+	case PrepareEpochFence:
+		return ErrorCodeConcurrentTransactions
+	}
+	return ErrorCodeInvalidTxnState
+}
+
+// endLocked prepares the commit or abort of an open transaction and completes
+// it. A transaction aborted on behalf of the coordinator first bumps the epoch
+// of the producer to fence it. Must be called with the transaction lock held.
+func (tc *TransactionCoordinator) endLocked(txn *Transaction, commit bool, fence bool) int16 {
+	if txn.timer != nil {
+		txn.timer.Stop()
+		txn.timer = nil
+	}
+
+	err := tc.transition(txn, func(m *TransactionMetadata) {
+		m.State = PrepareAbort
+		if commit {
+			m.State = PrepareCommit
+		}
+		if fence && m.ProducerEpoch < math.MaxInt16 {
+			m.ProducerEpoch++
+		}
+	})
+	if err != nil {
+		return ErrorCodeCoordinatorNotAvailable
+	}
+	return tc.completeLocked(txn)
+}
+
+// completeLocked writes the markers of a prepared transaction and moves it to
+// its complete state. Must be called with the transaction lock held.
+func (tc *TransactionCoordinator) completeLocked(txn *Transaction) int16 {
+	commit := txn.State == PrepareCommit
+	if err := tc.WriteMarkers(txn.ProducerID, txn.ProducerEpoch, commit, txn.sortedPartitions()); err != nil {
+		tc.Logger.Error("Failed to write the markers of a transaction", "transactional_id", txn.TransactionalID, "error", err)
+		return ErrorCodeCoordinatorNotAvailable
+	}
+
+	err := tc.transition(txn, func(m *TransactionMetadata) {
+		m.State = CompleteAbort
+		if commit {
+			m.State = CompleteCommit
+		}
+		m.Partitions = make(map[TopicPartition]struct{})
+	})
+	if err != nil {
+		return ErrorCodeCoordinatorNotAvailable
+	}
+	return ErrorCodeNone
+}
+
+// WithinTransaction runs write while the partition is part of the open
+// transaction of the producer, holding the transaction so it cannot end
+// halfway. write returns the error code of the request.
+func (tc *TransactionCoordinator) WithinTransaction(transactionalID string, producerID int64, producerEpoch int16, tp TopicPartition, write func() int16) int16 {
+	txn := tc.transaction(transactionalID, false)
+	if txn == nil {
+		return ErrorCodeInvalidProducerIDMapping
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if code := txn.validateProducer(producerID, producerEpoch); code != ErrorCodeNone {
+		return code
+	}
+	if txn.State != Ongoing {
+		return ErrorCodeInvalidTxnState
+	}
+	if _, ok := txn.Partitions[tp]; !ok {
+		return ErrorCodeInvalidTxnState
+	}
+	return write()
+}
@@ -0,0 +1,180 @@
+package transaction_coordinator
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// markerLog records the markers a coordinator writes
+type markerLog struct {
+	mu      sync.Mutex
+	markers []marker
+}
+
+type marker struct {
+	producerID int64
+	epoch      int16
+	commit     bool
+	partitions []TopicPartition
+}
+
+func (l *markerLog) write(producerID int64, epoch int16, commit bool, partitions []TopicPartition) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.markers = append(l.markers, marker{producerID: producerID, epoch: epoch, commit: commit, partitions: partitions})
+	return nil
+}
+
+func (l *markerLog) all() []marker {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]marker(nil), l.markers...)
+}
+
+func newTestCoordinator(t *testing.T, logDir string, markers *markerLog) *TransactionCoordinator {
+	t.Helper()
+	var nextID int64 = 1000
+	tc := NewTransactionCoordinator()
+	tc.NextProducerID = func() (int64, error) {
+		nextID++
+		return nextID, nil
+	}
+	tc.WriteMarkers = markers.write
+	tc.PartitionExists = func(tp TopicPartition) bool { return tp.Topic == "foo" }
+	if err := tc.Load(logDir, 1); err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	return tc
+}
+
+func TestCommitAndAbort(t *testing.T) {
+	markers := &markerLog{}
+	tc := newTestCoordinator(t, t.TempDir(), markers)
+
+	producer := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 60000, ProducerID: -1, ProducerEpoch: -1})
+	if producer.ErrorCode != ErrorCodeNone || producer.ProducerEpoch != 0 {
+		t.Fatalf("Unexpected InitProducerId result %+v", producer)
+	}
+	add := func(partitions ...TopicPartition) []int16 {
+		return tc.AddPartitions(AddPartitionsRequest{TransactionalID: "txn", ProducerID: producer.ProducerID, ProducerEpoch: producer.ProducerEpoch, Partitions: partitions})
+	}
+
+	foo0, bar0 := TopicPartition{Topic: "foo", Partition: 0}, TopicPartition{Topic: "bar", Partition: 0}
+	if codes := add(foo0, bar0); codes[0] != ErrorCodeOperationNotAttempted || codes[1] != ErrorCodeUnknownTopicOrPartition {
+		t.Errorf("Expected the unknown partition to fail the request, got %v", codes)
+	}
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, true); code != ErrorCodeInvalidTxnState {
+		t.Errorf("Expected INVALID_TXN_STATE without an open transaction, got %d", code)
+	}
+	if codes := add(foo0); codes[0] != ErrorCodeNone {
+		t.Fatalf("Failed to add the partition, got %v", codes)
+	}
+	if code := tc.WithinTransaction("txn", producer.ProducerID, producer.ProducerEpoch, TopicPartition{Topic: "foo", Partition: 1}, func() int16 { return ErrorCodeNone }); code != ErrorCodeInvalidTxnState {
+		t.Errorf("Expected a write outside of the transaction's partitions to be rejected, got %d", code)
+	}
+
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, true); code != ErrorCodeNone {
+		t.Fatalf("Failed to commit, got %d", code)
+	}
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, true); code != ErrorCodeNone {
+		t.Errorf("Expected a retried commit to succeed, got %d", code)
+	}
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, false); code != ErrorCodeInvalidTxnState {
+		t.Errorf("Expected an abort after the commit to fail, got %d", code)
+	}
+
+	add(foo0)
+	tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, false)
+
+	written := markers.all()
+	if len(written) != 2 || !written[0].commit || written[1].commit || len(written[0].partitions) != 1 || written[0].partitions[0] != foo0 {
+		t.Errorf("Expected a commit marker then an abort marker for foo-0, got %+v", written)
+	}
+}
+
+func TestInitProducerIDFencesAndAbortsOpenTransaction(t *testing.T) {
+	logDir := t.TempDir()
+	markers := &markerLog{}
+	tc := newTestCoordinator(t, logDir, markers)
+
+	first := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 60000, ProducerID: -1, ProducerEpoch: -1})
+	tc.AddPartitions(AddPartitionsRequest{TransactionalID: "txn", ProducerID: first.ProducerID, ProducerEpoch: first.ProducerEpoch, Partitions: []TopicPartition{{Topic: "foo"}}})
+
+	second := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 60000, ProducerID: -1, ProducerEpoch: -1})
+	if second.ErrorCode != ErrorCodeNone || second.ProducerID != first.ProducerID || second.ProducerEpoch <= first.ProducerEpoch {
+		t.Fatalf("Expected the same producer id with a bumped epoch, got %+v after %+v", second, first)
+	}
+	if written := markers.all(); len(written) != 1 || written[0].commit || written[0].epoch <= first.ProducerEpoch {
+		t.Errorf("Expected the open transaction to be aborted with a bumped epoch, got %+v", written)
+	}
+	if code := tc.EndTransaction("txn", first.ProducerID, first.ProducerEpoch, true); code != ErrorCodeProducerFenced {
+		t.Errorf("Expected the old producer to be fenced, got %d", code)
+	}
+	if result := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 60000, ProducerID: first.ProducerID, ProducerEpoch: first.ProducerEpoch}); result.ErrorCode != ErrorCodeProducerFenced {
+		t.Errorf("Expected the old producer to be fenced when bumping its epoch, got %+v", result)
+	}
+	if result := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: int32(time.Hour / time.Millisecond), ProducerID: -1, ProducerEpoch: -1}); result.ErrorCode != ErrorCodeInvalidTransactionTimeout {
+		t.Errorf("Expected a timeout above the maximum to be rejected, got %+v", result)
+	}
+
+	reloaded := newTestCoordinator(t, logDir, &markerLog{})
+	txn, ok := reloaded.Transaction("txn")
+	if !ok || txn.ProducerID != second.ProducerID || txn.ProducerEpoch != second.ProducerEpoch || txn.State != Empty {
+		t.Errorf("Unexpected transaction after reload: %+v", txn)
+	}
+}
+
+func TestTransactionTimeout(t *testing.T) {
+	markers := &markerLog{}
+	tc := newTestCoordinator(t, t.TempDir(), markers)
+
+	producer := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 20, ProducerID: -1, ProducerEpoch: -1})
+	tc.AddPartitions(AddPartitionsRequest{TransactionalID: "txn", ProducerID: producer.ProducerID, ProducerEpoch: producer.ProducerEpoch, Partitions: []TopicPartition{{Topic: "foo"}}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(markers.all()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if txn, _ := tc.Transaction("txn"); txn.State != CompleteAbort || txn.ProducerEpoch != producer.ProducerEpoch+1 {
+		t.Fatalf("Expected the transaction to be aborted with a bumped epoch, got %+v", txn)
+	}
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, true); code != ErrorCodeProducerFenced {
+		t.Errorf("Expected the producer to be fenced after the timeout, got %d", code)
+	}
+}
+
+func TestPreparedTransactionCompletesOnLoad(t *testing.T) {
+	logDir := t.TempDir()
+	tc := newTestCoordinator(t, logDir, &markerLog{})
+	producer := tc.InitProducerID(InitProducerIDRequest{TransactionalID: "txn", TransactionTimeoutMs: 60000, ProducerID: -1, ProducerEpoch: -1})
+	tc.AddPartitions(AddPartitionsRequest{TransactionalID: "txn", ProducerID: producer.ProducerID, ProducerEpoch: producer.ProducerEpoch, Partitions: []TopicPartition{{Topic: "foo"}}})
+
+	// The broker stops after PrepareCommit was persisted but before the markers
+	tc.WriteMarkers = func(int64, int16, bool, []TopicPartition) error { return errors.New("broker stopped") }
+	if code := tc.EndTransaction("txn", producer.ProducerID, producer.ProducerEpoch, true); code != ErrorCodeCoordinatorNotAvailable {
+		t.Fatalf("Expected the failed markers to be reported, got %d", code)
+	}
+
+	markers := &markerLog{}
+	reloaded := newTestCoordinator(t, logDir, markers)
+	if written := markers.all(); len(written) != 1 || !written[0].commit {
+		t.Errorf("Expected the commit to be completed on load, got %+v", written)
+	}
+	if txn, _ := reloaded.Transaction("txn"); txn.State != CompleteCommit {
+		t.Errorf("Expected CompleteCommit after reload, got %s", txn.State)
+	}
+}
+
+func TestStateLogMatchesKafka(t *testing.T) {
+	for transactionalID, expected := range map[string]int{
+		"txn-1":               10,
+		"my-transactional-id": 46,
+		"txn-😀":               6,
+	} {
+		if partition := stateLogFor(transactionalID, 50); partition != expected {
+			t.Errorf("Expected %q on partition %d, got %d", transactionalID, expected, partition)
+		}
+	}
+}
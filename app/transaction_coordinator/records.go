@@ -0,0 +1,151 @@
+package transaction_coordinator
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Versions of the __transaction_state records this coordinator writes
+const (
+	transactionLogKeyVersion   = 0
+	transactionLogValueVersion = 0
+)
+
+// TransactionLogKey (version 0)
+// 00 00        // version
+// 00 03 74 78 6e  // transactional_id (string)
+
+func encodeTransactionLogKey(transactionalID string) []byte {
+	out := binary.BigEndian.AppendUint16(nil, transactionLogKeyVersion)
+	return appendString(out, transactionalID)
+}
+
+func decodeTransactionLogKey(key []byte) (string, error) {
+	r := &recordReader{buff: key}
+	if version := r.int16(); version != transactionLogKeyVersion {
+		return "", fmt.Errorf("unsupported transaction log key version %d", version)
+	}
+	transactionalID := r.string()
+	return transactionalID, r.err
+}
+
+// TransactionLogValue (version 0)
+// 00 00        // version
+// 00 00 00 00 00 00 03 e8  // producer_id
+// 00 00        // producer_epoch
+// 00 00 ea 60  // transaction_timeout_ms
+// 01           // transaction_status
+// 00 00 00 01  // transaction_partitions count
+// 00 03 66 6f 6f  // topic (string)
+// 00 00 00 01  // partition_ids count
+// 00 00 00 00  // partition_id
+// 00 00 01 8f ...  // transaction_last_update_timestamp_ms
+// 00 00 01 8f ...  // transaction_start_timestamp_ms
+
+func encodeTransactionLogValue(txn TransactionMetadata) []byte {
+	out := binary.BigEndian.AppendUint16(nil, transactionLogValueVersion)
+	out = binary.BigEndian.AppendUint64(out, uint64(txn.ProducerID))
+	out = binary.BigEndian.AppendUint16(out, uint16(txn.ProducerEpoch))
+	out = binary.BigEndian.AppendUint32(out, uint32(txn.TimeoutMs))
+	out = append(out, byte(txn.State))
+
+	topics := txn.partitionsByTopic()
+	out = binary.BigEndian.AppendUint32(out, uint32(len(topics)))
+	for _, topic := range topics {
+		out = appendString(out, topic.name)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(topic.partitions)))
+		for _, partition := range topic.partitions {
+			out = binary.BigEndian.AppendUint32(out, uint32(partition))
+		}
+	}
+
+	out = binary.BigEndian.AppendUint64(out, uint64(txn.LastUpdateTimestamp))
+	return binary.BigEndian.AppendUint64(out, uint64(txn.StartTimestamp))
+}
+
+func decodeTransactionLogValue(transactionalID string, value []byte) (TransactionMetadata, error) {
+	r := &recordReader{buff: value}
+	if version := r.int16(); version != transactionLogValueVersion {
+		return TransactionMetadata{}, fmt.Errorf("unsupported transaction log value version %d", version)
+	}
+	txn := newTransactionMetadata(transactionalID)
+	txn.ProducerID = r.int64()
+	txn.ProducerEpoch = r.int16()
+	txn.TimeoutMs = r.int32()
+	txn.State = TxnState(r.int8())
+
+	topics := r.int32()
+	for i := int32(0); i < topics && r.err == nil; i++ {
+		topic := r.string()
+		partitions := r.int32()
+		for j := int32(0); j < partitions && r.err == nil; j++ {
+			txn.Partitions[TopicPartition{Topic: topic, Partition: r.int32()}] = struct{}{}
+		}
+	}
+
+	txn.LastUpdateTimestamp = r.int64()
+	txn.StartTimestamp = r.int64()
+	return txn, r.err
+}
+
+// recordReader reads the fixed width fields of __transaction_state records,
+// the first short read sticks in err
+type recordReader struct {
+	buff   []byte
+	offset int
+	err    error
+}
+
+func (r *recordReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.offset+n > len(r.buff) {
+		r.err = fmt.Errorf("record too short, need %d bytes at %d", n, r.offset)
+		return nil
+	}
+	out := r.buff[r.offset : r.offset+n]
+	r.offset += n
+	return out
+}
+
+func (r *recordReader) int8() int8 {
+	if b := r.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *recordReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *recordReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *recordReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *recordReader) string() string {
+	length := r.int16()
+	if length < 0 {
+		return ""
+	}
+	return string(r.next(int(length)))
+}
+
+func appendString(out []byte, val string) []byte {
+	out = binary.BigEndian.AppendUint16(out, uint16(len(val)))
+	return append(out, val...)
+}
@@ -0,0 +1,124 @@
+package transaction_coordinator
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type TxnState int8
+
+// Transaction states, numbered as Kafka writes them to __transaction_state
+const (
+	Empty TxnState = iota
+	Ongoing
+	PrepareCommit
+	PrepareAbort
+	CompleteCommit
+	CompleteAbort
+	Dead
+	PrepareEpochFence
+)
+
+func (s TxnState) String() string {
+	switch s {
+	case Empty:
+		return "Empty"
+	case Ongoing:
+		return "Ongoing"
+	case PrepareCommit:
+		return "PrepareCommit"
+	case PrepareAbort:
+		return "PrepareAbort"
+	case CompleteCommit:
+		return "CompleteCommit"
+	case CompleteAbort:
+		return "CompleteAbort"
+	case Dead:
+		return "Dead"
+	case PrepareEpochFence:
+		return "PrepareEpochFence"
+	}
+	return "Unknown"
+}
+
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// TransactionMetadata is the state of a transactional id as persisted to
+// __transaction_state
+type TransactionMetadata struct {
+	TransactionalID     string
+	ProducerID          int64
+	ProducerEpoch       int16
+	TimeoutMs           int32
+	State               TxnState
+	Partitions          map[TopicPartition]struct{}
+	StartTimestamp      int64
+	LastUpdateTimestamp int64
+}
+
+func newTransactionMetadata(transactionalID string) TransactionMetadata {
+	return TransactionMetadata{
+		TransactionalID: transactionalID,
+		ProducerID:      -1,
+		ProducerEpoch:   -1,
+		Partitions:      make(map[TopicPartition]struct{}),
+		StartTimestamp:  -1,
+	}
+}
+
+// copy returns the metadata with its own partitions map
+func (m TransactionMetadata) copy() TransactionMetadata {
+	partitions := make(map[TopicPartition]struct{}, len(m.Partitions))
+	for tp := range m.Partitions {
+		partitions[tp] = struct{}{}
+	}
+	m.Partitions = partitions
+	return m
+}
+
+type topicPartitions struct {
+	name       string
+	partitions []int32
+}
+
+// partitionsByTopic groups the partitions of the transaction by topic, both
+// sorted so the persisted value is stable
+func (m TransactionMetadata) partitionsByTopic() []topicPartitions {
+	byTopic := make(map[string][]int32)
+	for tp := range m.Partitions {
+		byTopic[tp.Topic] = append(byTopic[tp.Topic], tp.Partition)
+	}
+
+	topics := make([]topicPartitions, 0, len(byTopic))
+	for name, partitions := range byTopic {
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		topics = append(topics, topicPartitions{name: name, partitions: partitions})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].name < topics[j].name })
+	return topics
+}
+
+// sortedPartitions lists the partitions of the transaction in marker order
+func (m TransactionMetadata) sortedPartitions() []TopicPartition {
+	var partitions []TopicPartition
+	for _, topic := range m.partitionsByTopic() {
+		for _, partition := range topic.partitions {
+			partitions = append(partitions, TopicPartition{Topic: topic.name, Partition: partition})
+		}
+	}
+	return partitions
+}
+
+// Transaction is the live state of a transactional id, every change goes
+// through the coordinator with mu held
+type Transaction struct {
+	mu sync.Mutex
+	TransactionMetadata
+
+	// Aborts the transaction once it has been open for longer than its timeout
+	timer *time.Timer
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"math"
 	"net"
+	"unicode/utf16"
 )
 
 // parseVarint parses a signed varint from the byte slice and returns the value and bytes consumed
@@ -31,6 +34,43 @@ func ParseVarint(bytes []byte) (int64, int, error) {
 	return 0, 0, fmt.Errorf("incomplete varint")
 }
 
+// ParseUvarint parses an unsigned varint from the byte slice and returns the value and bytes consumed
+func ParseUvarint(bytes []byte) (uint64, int, error) {
+	var result uint64
+	var shift uint
+
+	for i, b := range bytes {
+		if i >= 10 {
+			return 0, 0, fmt.Errorf("varint too long")
+		}
+
+		result |= uint64(b&0x7F) << shift
+
+		if b&0x80 == 0 {
+			return result, i + 1, nil
+		}
+
+		shift += 7
+	}
+
+	return 0, 0, fmt.Errorf("incomplete varint")
+}
+
+// EncodeVarint zigzag encodes a signed value, the inverse of ParseVarint
+func EncodeVarint(val int64) []byte {
+	return EncodeUvarint(uint64(val<<1) ^ uint64(val>>63))
+}
+
+// EncodeUvarint encodes an unsigned value 7 bits at a time, least significant group first
+func EncodeUvarint(val uint64) []byte {
+	out := make([]byte, 0, 2)
+	for val >= 0x80 {
+		out = append(out, byte(val)|0x80)
+		val >>= 7
+	}
+	return append(out, byte(val))
+}
+
 func BytesToInt(bs []byte, start int, end int) int {
 	valLen := end - start
 
@@ -44,7 +84,7 @@ func BytesToInt(bs []byte, start int, end int) int {
 	case 8:
 		return int(binary.BigEndian.Uint64(bs[start:end]))
 	default:
-		fmt.Println("CUSTOM LENGTH PASSED FOR BYTE 2 INT CONVERSION")
+		slog.Debug("Decoding an integer of unusual length", "bytes", valLen)
 		val := 0
 		for i := 0; i < valLen && i < 8; i++ {
 			val |= int(bs[start+i]) << ((valLen - 1 - i) * 8)
@@ -66,7 +106,7 @@ func intToBytes(val int, val_byte_len int) []byte {
 	case 8:
 		binary.BigEndian.PutUint64(bs, uint64(val))
 	default:
-		fmt.Println("CUSTOM LENGTH PASSED FOR INT 2 BYTE CONVERSION")
+		slog.Debug("Encoding an integer of unusual length", "bytes", val_byte_len)
 		for i := 0; i < val_byte_len && i < 8; i++ {
 			bs[i] = byte(val >> ((val_byte_len - 1 - i) * 8))
 		}
@@ -107,3 +147,21 @@ func encodeLength(l uint16) []byte {
 
 	return out
 }
+
+// CoordinatorPartition maps a group or transactional id to the partition of an
+// internal topic holding it the way Kafka does, Utils.abs(id.hashCode()) %
+// partitions. Java hashes the UTF-16 code units of a string, and Utils.abs
+// maps math.MinInt32 to 0.
+func CoordinatorPartition(id string, partitions int) int {
+	var hash int32
+	for _, unit := range utf16.Encode([]rune(id)) {
+		hash = 31*hash + int32(unit)
+	}
+	if hash == math.MinInt32 {
+		return 0
+	}
+	if hash < 0 {
+		hash = -hash
+	}
+	return int(hash) % partitions
+}